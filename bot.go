@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/jacquesh/netdeck/client"
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// The strategies that bots can use to decide what to do on their turn
+const (
+	BOT_STRATEGY_PASS  = "pass"  // Just end the turn
+	BOT_STRATEGY_DRAW  = "draw"  // Draw a card and end the turn
+	BOT_STRATEGY_CYCLE = "cycle" // Draw a card, discard a random card from hand and end the turn
+)
+
+const DefaultBotStrategy = BOT_STRATEGY_CYCLE
+
+// How long a bot waits after its turn starts before acting, so that the other players can follow what it does
+const BotTurnDelay = 2 * time.Second
+
+func isValidBotStrategy(strategy string) bool {
+	switch strategy {
+	case BOT_STRATEGY_PASS, BOT_STRATEGY_DRAW, BOT_STRATEGY_CYCLE:
+		return true
+	}
+	return false
+}
+
+// Returns a name for a new bot that is not already used by any player or card in the game
+func (gs *GameState) newBotName() string {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	for botNumber := 1; ; botNumber++ {
+		name := "Bot" + strconv.Itoa(botNumber)
+		if !gs.isNameTaken(name) {
+			return name
+		}
+	}
+}
+
+// Plays a game as the bot with the given ID by talking to the server over the given connection, in the same way that
+// a client would. The bot only pays attention to the start of its own turn and to being removed from the game.
+func runBot(conn net.Conn, botId uint64, strategy string) {
+	session := client.NewSession(conn)
+
+	// Commands are sent from a separate goroutine so that the bot never blocks on the server while the server is
+	// blocked sending it a notification. The connection is closed once everything has been sent.
+	sendChan := make(chan []byte, 16)
+	defer close(sendChan)
+	go func() {
+		defer session.Close()
+		for buffer := range sendChan {
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	var turnTimer <-chan time.Time
+	for {
+		select {
+		case cmdContainer, ok := <-session.Commands():
+			if !ok {
+				return
+			}
+			if cmdContainer.Header.Id != protocol.CMD_NOTIFY_PLAYER_ACTION {
+				break
+			}
+			var cmd protocol.NotifyPlayerActionCommand
+			err := protocol.SerialiseNotifyPlayerActionCommand(cmdContainer.Payload, &cmd, true)
+			if err != nil {
+				break
+			}
+
+			if (cmd.CmdId == protocol.CMD_TURN_END) && (cmd.TargetPlayerId == botId) {
+				turnTimer = time.After(BotTurnDelay)
+			} else if (cmd.CmdId == protocol.CMD_GAME_KICK) && (cmd.TargetPlayerId == botId) {
+				buffer, _ := protocol.WriteCommandHeader(protocol.CMD_DISCONNECT, 0)
+				sendChan <- buffer
+				return
+			}
+
+		case <-turnTimer:
+			turnTimer = nil
+			if strategy != BOT_STRATEGY_PASS {
+				buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_DRAW, protocol.CardDrawCommandLength)
+				drawCmd := protocol.CardDrawCommand{DeckId: 0, Count: 1, FaceUp: false}
+				protocol.SerialiseCardDrawCommand(buffer[headerLen:], &drawCmd, false)
+				sendChan <- buffer
+			}
+			if strategy == BOT_STRATEGY_CYCLE {
+				buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_DISCARD, protocol.CardDiscardCommandLength)
+				discardCmd := protocol.CardDiscardCommand{CardId: protocol.CARD_ID_ANY, FaceUp: true}
+				protocol.SerialiseCardDiscardCommand(buffer[headerLen:], &discardCmd, false)
+				sendChan <- buffer
+			}
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_TURN_END, 0)
+			sendChan <- buffer
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+type BuiltinSpec struct {
+	Name        string
+	Description string
+	build       func() *GameSpecification
+}
+
+// Specifications that are built into netdeck, so that games with common decks can be created without a spec file
+var builtinSpecs = []BuiltinSpec{
+	{"jokers", "A standard 52-card deck plus two jokers", buildJokersSpec},
+	{"double", "Two standard 52-card decks shuffled together (104 cards)", buildDoubleSpec},
+	{"piquet", "A 32-card deck with only the 7s and up of each suit", buildPiquetSpec},
+	{"tarot", "A 78-card tarot deck, with the 22 major arcana and four suits of 14 cards", buildTarotSpec},
+	{"uno", "A 108-card deck in four colours with action and wild cards, like the one used to play Uno", buildUnoSpec},
+}
+
+// Returns the built-in spec with the given name (ignoring case), or nil if there is no such spec
+func FindBuiltinSpec(specName string) *GameSpecification {
+	for _, builtin := range builtinSpecs {
+		if strings.EqualFold(builtin.Name, specName) {
+			return builtin.build()
+		}
+	}
+	return nil
+}
+
+var standardSuits = []string{"Spades", "Clubs", "Diamonds", "Hearts"}
+var standardRanks = []string{"Ace", "2", "3", "4", "5", "6", "7", "8", "9", "10", "Jack", "Queen", "King"}
+
+func newCardSpec(name string, count int, cardType string, value int64) CardSpec {
+	return CardSpec{Name: name, Count: count, Type: cardType, Value: &value}
+}
+
+// Returns one card of each of the given ranks in every standard suit, with values starting from firstValue
+func standardSuitCards(ranks []string, firstValue int64, count int) []CardSpec {
+	result := make([]CardSpec, 0, len(standardSuits)*len(ranks))
+	for _, suit := range standardSuits {
+		for rankIndex, rank := range ranks {
+			result = append(result, newCardSpec(rank+"-Of-"+suit, count, suit, firstValue+int64(rankIndex)))
+		}
+	}
+	return result
+}
+
+func buildJokersSpec() *GameSpecification {
+	cards := standardSuitCards(standardRanks, 1, 1)
+	cards = append(cards, CardSpec{Name: "Red-Joker", Count: 1, Type: "Joker"})
+	cards = append(cards, CardSpec{Name: "Black-Joker", Count: 1, Type: "Joker"})
+	return &GameSpecification{Cards: cards}
+}
+
+func buildDoubleSpec() *GameSpecification {
+	return &GameSpecification{Cards: standardSuitCards(standardRanks, 1, 2)}
+}
+
+func buildPiquetSpec() *GameSpecification {
+	// Aces are high in piquet, so they go after the kings
+	ranks := append(append([]string{}, standardRanks[6:]...), standardRanks[0])
+	return &GameSpecification{Cards: standardSuitCards(ranks, 7, 1)}
+}
+
+func buildTarotSpec() *GameSpecification {
+	majorArcana := []string{
+		"The-Fool", "The-Magician", "The-High-Priestess", "The-Empress", "The-Emperor", "The-Hierophant",
+		"The-Lovers", "The-Chariot", "Strength", "The-Hermit", "Wheel-Of-Fortune", "Justice", "The-Hanged-Man",
+		"Death", "Temperance", "The-Devil", "The-Tower", "The-Star", "The-Moon", "The-Sun", "Judgement", "The-World",
+	}
+	cards := make([]CardSpec, 0, 78)
+	for number, name := range majorArcana {
+		cards = append(cards, newCardSpec(name, 1, "Major-Arcana", int64(number)))
+	}
+
+	ranks := []string{"Ace", "2", "3", "4", "5", "6", "7", "8", "9", "10", "Page", "Knight", "Queen", "King"}
+	for _, suit := range []string{"Wands", "Cups", "Swords", "Pentacles"} {
+		for rankIndex, rank := range ranks {
+			cards = append(cards, newCardSpec(rank+"-Of-"+suit, 1, suit, int64(rankIndex+1)))
+		}
+	}
+	return &GameSpecification{Cards: cards}
+}
+
+func buildUnoSpec() *GameSpecification {
+	// The values are the points that each card is worth to the winner of a round
+	cards := make([]CardSpec, 0, 54)
+	for _, colour := range []string{"Red", "Yellow", "Green", "Blue"} {
+		cards = append(cards, newCardSpec(colour+"-0", 1, colour, 0))
+		for number := 1; number <= 9; number++ {
+			cards = append(cards, newCardSpec(colour+"-"+strconv.Itoa(number), 2, colour, int64(number)))
+		}
+		for _, action := range []string{"Skip", "Reverse", "Draw-Two"} {
+			cards = append(cards, newCardSpec(colour+"-"+action, 2, colour, 20))
+		}
+	}
+	cards = append(cards, newCardSpec("Wild", 4, "Wild", 50))
+	cards = append(cards, newCardSpec("Wild-Draw-Four", 4, "Wild", 50))
+	return &GameSpecification{
+		HowToPlay: "Match the top card of the discard pile by colour or by number/symbol, or play a wild card. " +
+			"Draw a card if you cannot play. The first player to empty their hand wins the round.",
+		Cards: cards,
+	}
+}
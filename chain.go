@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jacquesh/netdeck/client"
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// The most commands that can be chained together on one line, so that a mistake can't queue up a huge number of them
+const MaxChainedCommandCount = MaxMacroCommandCount
+
+// How long a chained command that was sent to the server waits for a reply before the next one runs anyway, for
+// commands that the server doesn't reply to (or replies to in a way that IsReply doesn't recognise)
+const ChainedCommandTimeout = 2 * time.Second
+
+// Commands that were entered on one line separated by ';' (e.g "draw 2; hand"), which are run one at a time. Once a
+// command has been sent to the server, the next one only runs after the server replies, so that the output of each
+// command is printed before the next one runs (and sees what it changed).
+type CommandChain struct {
+	commands   []chainedCommand
+	waiting    bool             // Whether the last command that ran is waiting for a reply from the server
+	waitingFor byte             // The ID of the command that was sent to the server by the command that is waiting
+	timeout    <-chan time.Time // Fires when the command that is waiting should stop waiting, or nil if none is
+}
+
+type chainedCommand struct {
+	text string
+	echo bool // Whether the command is printed before it runs, so that it's clear which output belongs to it
+}
+
+// Returns the commands on the given line, which are separated by ';'. A line without any ';' is a single command.
+func SplitChainedCommands(inputLine string) []string {
+	commands := make([]string, 0, 1)
+	for _, command := range strings.Split(inputLine, ";") {
+		command = strings.TrimSpace(command)
+		if len(command) > 0 {
+			commands = append(commands, command)
+		}
+	}
+	return commands
+}
+
+// Adds the commands on the given line to the end of the chain
+func (chain *CommandChain) Add(inputLine string) {
+	commands := SplitChainedCommands(inputLine)
+	if len(commands) > MaxChainedCommandCount {
+		printError("Error! At most %d commands can be chained together with ';'\n", MaxChainedCommandCount)
+		return
+	}
+	// A single command is only printed if it has to wait for other commands to run first
+	echo := (len(commands) > 1) || (len(chain.commands) > 0) || chain.waiting
+	for _, command := range commands {
+		chain.commands = append(chain.commands, chainedCommand{command, echo})
+	}
+}
+
+// Stops waiting for a reply to the last command that was sent to the server, so that the next one can run
+func (chain *CommandChain) StopWaiting() {
+	chain.waiting = false
+	chain.timeout = nil
+}
+
+// Drops every command that hasn't run yet, e.g because the connection to the server was lost
+func (chain *CommandChain) Clear() {
+	if len(chain.commands) > 0 {
+		printError("Error! %d chained commands were not run\n", len(chain.commands))
+	}
+	chain.commands = nil
+	chain.StopWaiting()
+}
+
+// Runs the commands in the chain until one of them needs to wait for a reply from the server
+func (chain *CommandChain) Run(session *client.Session, game *GameState, inGame bool, localPlayer *PlayerState) {
+	for !chain.waiting && (len(chain.commands) > 0) {
+		command := chain.commands[0]
+		chain.commands = chain.commands[1:]
+		if command.echo {
+			fmt.Fprintf(clientOutput, "> %s\n", command.text)
+		}
+
+		sentCount := session.SentCount()
+		handleInputFromStdin(command.text, session, game, inGame, localPlayer)
+		if (session.SentCount() != sentCount) && (len(chain.commands) > 0) {
+			chain.waiting = true
+			chain.waitingFor = session.LastSentId()
+			chain.timeout = time.After(ChainedCommandTimeout)
+		}
+	}
+}
+
+// Returns true if the given command from the server is the reply to the chained command that is waiting: either the
+// response to it, an input error about it, or the notification of the local player's own action. Anything else (e.g
+// another player's action) arrives independently of the command, so the next one has to keep waiting.
+func (chain *CommandChain) IsReply(cmdContainer protocol.CommandContainer, localPlayer *PlayerState) bool {
+	if !chain.waiting {
+		return false
+	}
+	switch cmdContainer.Header.Id {
+	case protocol.CMD_NOTIFY_INPUT_ERROR:
+		var cmd protocol.NotifyInputErrorCommand
+		err := protocol.SerialiseNotifyInputErrorCommand(cmdContainer.Payload, &cmd, true)
+		return (err == nil) && (cmd.CmdId == chain.waitingFor)
+
+	case protocol.CMD_NOTIFY_PLAYER_ACTION:
+		if localPlayer == nil {
+			return false
+		}
+		var cmd protocol.NotifyPlayerActionCommand
+		err := protocol.SerialiseNotifyPlayerActionCommand(cmdContainer.Payload, &cmd, true)
+		return (err == nil) && (cmd.PlayerId == localPlayer.Id) && (cmd.CmdId == chain.waitingFor)
+	}
+	return cmdContainer.Header.Id == responseCommandId(chain.waitingFor)
+}
+
+// Returns the ID of the command that the server responds to the given command with (rather than notifying the player
+// of their action), or CMD_UNKNOWN if it doesn't have one
+func responseCommandId(cmdId byte) byte {
+	switch {
+	case (cmdId >= protocol.CMD_INFO_PLAYERS) && (cmdId <= protocol.CMD_SYNC_REQUEST):
+		return protocol.CMD_INFO_PLAYERS_RESPONSE + (cmdId - protocol.CMD_INFO_PLAYERS)
+	case cmdId == protocol.CMD_SET_NAME:
+		return protocol.CMD_SET_NAME_RESPONSE
+	case (cmdId == protocol.CMD_GAME_CREATE) || (cmdId == protocol.CMD_GAME_JOIN):
+		return protocol.CMD_NOTIFY_GAME_JOINED
+	}
+	return protocol.CMD_UNKNOWN
+}
@@ -1,70 +1,70 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
-	"net"
+	"io"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"github.com/jacquesh/netdeck/client"
+	"github.com/jacquesh/netdeck/protocol"
 )
 
 var ErrInsufficientArguments = errors.New("Fewer than the required number of arguments were provided")
 
-func clientReadConsoleInput(stdInRead *bufio.Reader, stdinChan chan string) {
-	for {
-		inputLine, err := stdInRead.ReadString('\n')
-		if err != nil {
-			fmt.Println("ERROR READING FROM STD INPUT")
-			return
-		}
+const DefaultEventLogCount = 10
 
-		inputLine = strings.TrimSpace(inputLine)
-		stdinChan <- inputLine
-	}
-}
+// The file in which the client remembers the token it needs to resume its place in a game if the connection drops
+const ResumeTokenFileName = ".netdeck-session"
 
-func clientReadSocketInput(conn net.Conn, cmdChan chan CommandContainer, quitChan chan bool) {
-	for {
-		headerBytes, err := ReadExactlyNBytes(conn, CommandHeaderLength)
-		if err != nil {
-			fmt.Printf("Error: Failed to read command header from server: %s\n", err)
-			quitChan <- true
-			return
-		}
+// When the connection to the server drops, the client waits this long before trying to reconnect, doubling the wait
+// after every failed attempt up to MaxReconnectDelay. It gives up after MaxReconnectAttempts attempts.
+const InitialReconnectDelay = time.Second
+const MaxReconnectDelay = 30 * time.Second
+const MaxReconnectAttempts = 10
 
-		var cmdHeader CommandHeader
-		err = SerialiseCommandHeader(headerBytes, &cmdHeader, true)
-		if err != nil {
-			fmt.Printf("Error: Failed to read command header from server: %s\n", err)
-			quitChan <- true
-			return
-		}
+// Whether card and player name arguments should match regardless of accents/diacritics
+var matchIgnoringAccents = false
 
-		err = ValidateCommandHeader(cmdHeader)
-		if err != nil {
-			fmt.Printf("ERROR: Invalid command header {id=%d,len=%d} received from server: %s\n",
-				cmdHeader.id, cmdHeader.len, err)
-			quitChan <- true
-			return
-		}
+// Set when the player quits, so that the client doesn't try to reconnect when the server closes the connection
+var quitRequested = false
+
+// Set by 'hand grouped', so that the server's response (the list of cards in the player's hand) is printed grouped by
+// the type of each card
+var showHandGrouped = false
 
-		cmdBuffer, err := ReadExactlyNBytes(conn, cmdHeader.len)
+// The commands that can be tab-completed in a game and in the lobby (not including the short aliases of commands)
+var gameCommandNames = []string{
+	"addbot", "burn", "counter", "deal", "decks", "dice", "discard", "discardpile", "discardtype", "draw", "drawuntil",
+	"endturn", "facedown", "faceup", "fetch", "fingerprint", "flip", "give", "givecard", "giverand", "hand", "help",
+	"history", "info", "inspect", "kick", "leave", "log", "market", "marketdiscard", "markettake", "movecard", "myrole",
+	"owner", "peek", "peekbottom", "pick", "pickrandom", "pickup", "place", "play", "players", "putback", "putbottom", "quit",
+	"rearrange", "reset", "retrieve", "revealhand", "revealroles", "roll", "rules", "run", "score", "scores", "show",
+	"showcard", "showme", "shuffle", "shufflehand", "sort", "start", "swaphands", "sync", "table", "tableau",
+	"tableputback", "take", "trade", "turntimer", "types", "undo", "verbosity", "vote",
+}
+var lobbyCommandNames = []string{"create", "games", "help", "join", "quit", "rename", "run", "verbosity"}
+
+func clientReadConsoleInput(lineEditor *LineEditor, stdinChan chan string) {
+	for {
+		inputLine, err := lineEditor.ReadLine("")
 		if err != nil {
-			fmt.Printf("ERROR: Failed to read command buffer of length %d for command %d from server: %s\n",
-				cmdHeader.len, cmdHeader.id, err)
-			quitChan <- true
+			printError("ERROR READING FROM STD INPUT\n")
 			return
 		}
 
-		cmdContainer := CommandContainer{cmdHeader, cmdBuffer}
-		cmdChan <- cmdContainer
+		inputLine = strings.TrimSpace(inputLine)
+		stdinChan <- inputLine
 	}
 }
 
-func handleInputFromStdin(inputLine string, conn net.Conn, game *GameState, inGame bool, localPlayer *PlayerState) {
+func handleInputFromStdin(inputLine string, session *client.Session, game *GameState, inGame bool, localPlayer *PlayerState) {
 	inputTokens := strings.Split(inputLine, " ")
 	if len(inputTokens) == 0 {
 		return
@@ -72,9 +72,17 @@ func handleInputFromStdin(inputLine string, conn net.Conn, game *GameState, inGa
 
 	cmdStr := inputTokens[0]
 	unusedCmdArgs := inputTokens[1:]
+	if cmdStr == "run" {
+		runMacro(unusedCmdArgs, session, game, inGame, localPlayer)
+		return
+	} else if cmdStr == "verbosity" {
+		runVerbosityCommand(unusedCmdArgs)
+		return
+	}
+
 	if inGame {
 		if cmdStr == "help" {
-			fmt.Print(`
+			fmt.Fprint(clientOutput, `
 You are currently in a game.
 
 From here you can play the game by executing any of the commands below. There is no enforcement of 'turns' or 'rules'
@@ -90,11 +98,18 @@ specify the player to which that card should be shown. Both of these arguments a
 commands will both give the same result: "showcard PlayerA CardB" or "showcard CardB PlayerA".
 
 When specifying player or card names, the arguments you give are not case-sensitive. So "Duke" and "duke" and "dUkE"
-are all effectively the same. Sometimes players or cards also have long names, you can also give any text that is a
+are all effectively the same. If you started netdeck with the "--ignore-accents" flag then accents are ignored too,
+so "cafe" will match "Café". Sometimes players or cards also have long names, you can also give any text that is a
 prefix for the card/player you'd like to specify instead of typing out the full name each time.
 For example if you want to show the "Fireball" card to player "FooBarrington" you could use "show fire foo".
 Note that this needs to be unambiguous though, so if there were another player in the game whose name was
 "FooBarringstead" then you'd need to type out at least "foobarringt" to be clear which player you are referring to.
+Pressing tab completes the command, card or player name that you are typing (or lists the options if there are several
+that it could be), and the up and down arrow keys go back through the commands that you have already entered.
+
+If the game has more than one deck (see the "decks" command) then every command that uses "the deck" acts on the main
+deck by default. To use one of the other decks instead, give that deck's name (in full) as an extra argument, for
+example "draw 2 events" or "shuffle treasure".
 
 One special case is the "discard" command that has an optional "facedown" parameter. If you wish to discard a card
 face-up, then simply leave this parameter out and specify only the card. If you wish to discard a card face down,
@@ -113,14 +128,79 @@ Long form             |   Short Form   | Description
 decks                 |              - | Show a list of all card decks in the game
 players               |             pl | Show a list of all players in the game
 hand                  |             ha | Show a list of all the cards in your hand
-draw [n]              |            d n | Draw n cards from the deck into your hand. By default n is 1
-putback x y           |         pb x y | Put card x from your hand back into the deck y cards from the top
+hand grouped          |     ha grouped | Show the cards in your hand grouped by their type (e.g suit), with a count for each card that you have more than one of
+inspect x             |              - | Show the rules text, value and type of card x (if the game's specification gives them)
+fingerprint           |              - | Show the fingerprint of the game's specification, which is the same for every player using the same deck definition
+rules                 |              - | Show the instructions and reference text for the game (if the game's specification gives them)
+types                 |              - | Show how many cards of each type (as given by the game's specification) are left in the deck
+info                  |              - | Show the counters (e.g life or coins) of every player in the game
+scores                |              - | Show the score table, with the score of every player for every round and their totals
+score add x n         |              - | Record a score of n for player x for their next round
+counter x [+-=]n [y]  |              - | Change counter x of player y (or yourself) by n, or set it to n, e.g "counter life -3"
+draw [n] [faceup]     |       d n [up] | Draw n cards from the deck into your hand. By default n is 1. With "faceup" everyone sees which cards you drew
+drawuntil t           |              - | Draw cards from the deck until you draw one of type t (or the deck runs out)
+fetch x               |              - | Take card x out of the deck and put it in your hand. The deck is then shuffled
+putback x y [faceup]  |    pb x y [up] | Put card x from your hand back into the deck y cards from the top. With "faceup" everyone sees which card it was
+putback x random      |      pb x rand | Put card x from your hand back into the deck at a random depth that nobody is told
+putbottom x [faceup]  |    pb x bottom | Put card x from your hand on the bottom of the deck
 discard x [facedown]  |   dis x [down] | Discard card id x from your hand
+discardtype t [down]  |              - | Discard every card of type t from your hand. With "down" they are discarded face-down
 showcard x y          |       show x y | Show card x in your hand to player y
+showcard x y except z |              - | Show card x in your hand to everyone except player z. Here y must be "allplayers"
 givecard x y          |       give x y | Give card x in your hand to player y
+play x                |              - | Play card x from your hand face-up onto the table in the middle
+table                 |              - | Show a list of all the cards on the table
+take x                |              - | Take card x from the table into your hand
+tableputback x y      |        tpb x y | Put card x from the table back into the deck y cards from the top
+market                |              - | Show the face-up cards in the market row, which refills from the deck whenever a card is removed
+markettake x          |           mt x | Take card x from the market into your hand
+marketdiscard x       |           md x | Move card x from the market to the discard pile
+tableau               |              - | Show the cards that each player has face-up in front of them
+place x               |              - | Move card x from your hand face-up into your tableau in front of you
+retrieve x            |              - | Move card x from your tableau back into your hand
+revealhand [keep]     |              - | Show your entire hand to everyone. With "keep" it stays visible in the player list until you next use revealhand
+faceup x              |              - | Turn card x in your hand face-up so that everyone can see it until it leaves your hand
+facedown x            |              - | Turn face-up card x in your hand face-down again
+trade x y z           |              - | Offer to trade card x from your hand to player y in exchange for their card z
+trade accept|decline y|              - | Accept or decline a trade that player y offered to you
+showme x              |              - | Ask player x to let you look at their hand
+showme accept|decline x|             - | Accept or decline player x's request to look at your hand
+swaphands x           |              - | Swap your entire hand with player x's hand
+shufflehand           |              - | Shuffle the cards in your hand so nobody can keep track of which card is which
+sort [value|name]     |              - | Sort the cards in your hand into the order they are listed in the game's specification, or by value or name
+movecard x n          |              - | Move card x in your hand to position n, counting from 1 at the start of your hand
+discardpile           |             dp | Show a list of all the cards in the discard pile, from top to bottom
+pickup [x]            |         pick x | Take the top card of the discard pile, or search it for card x if allowed
 peek n                |              - | Look at the top n cards from the deck
+peekbottom n [public] |              - | Look at the bottom n cards from the deck. With "public" everyone else sees them too
 shuffle               |              - | Shuffle the deck
+rearrange a b c ...   |   rearr a b c  | Reorder the top cards of the deck. "rearrange 3 1 2" puts the 3rd card on top
+deal n                |              - | Deal n cards from the deck to every player in the game
+burn [n] [facedown]   |  burn [n] down | Move the top n cards of the deck onto the discard pile. By default n is 1
+roll [n]dx            |              - | Roll n dice that each have x sides, e.g "roll 2d6" or "roll d20". By default n is 1
+roll [n] x            |              - | Roll n of the dice named x in the game's specification, e.g "roll 4 fate". By default n is 1
+dice                  |              - | Show the named dice given in the game's specification and the faces of each one
+flip                  |              - | Flip a coin
+pickrandom a b c ...  |   pickr a b c  | Pick one of the given options at random, e.g "pickrandom Alice Bob Carol"
+log [n]               |              - | Show the last n things that happened in the game. By default n is 10
+history               |              - | Show everything that has happened in the game since it was created, including what you were told privately (e.g which cards you drew)
+sync                  |              - | Fetch the whole state of the game from the server again, in case your view of it has gone wrong
+vote start q o1 o2... |              - | Start a poll asking question q (which can contain spaces if it ends with a '?'), with options o1, o2 etc
+vote x                |              - | Vote for option x (either the option itself or its number) in the current poll. Votes stay hidden until everyone has voted
+endturn               |             et | End your turn, passing it to the next player. Turns start being tracked once the game has been started
+turntimer n [auto]    |              - | Give each player n seconds for their turn (0 to turn it off). With "auto" the turn passes on when time runs out. Only the game's owner can do this
+undo [yes|no]         |              - | Ask everyone to agree to undo the last action, or respond to somebody else's request to undo
+start                 |              - | Start the game, running any setup steps (e.g dealing cards) given in the game specification and setting every counter to its starting value. Only the game's owner can do this
+myrole                |              - | Show the secret role that you were dealt (if the game's specification gives roles)
+revealroles           |              - | Show everyone the secret role that each player was dealt, e.g at the end of the game. Only the game's owner can do this
+reset                 |              - | Return every card to the deck and shuffle it and set every counter to its starting value, to start a new round. Only the game's owner can do this
+owner x               |              - | Make player x the owner of the game, allowing them to run the commands that only the owner can. Only the game's owner can do this
+addbot [strategy]     |              - | Add a player controlled by the server, which takes its turns on its own. The strategy is "cycle" (draw and discard a card, the default), "draw" or "pass". Only the game's owner can do this
+kick x [discard]      |              - | Remove player x from the game, shuffling their cards back into the deck (or discarding them). Only the game's owner can do this
 leave                 |              - | Leave the game that you are currently in and return to the menu
+run [x] [args...]     |              - | Run the commands of macro x from the file given with --macros, one after another. Without x, list the macros
+verbosity [level]     |              - | Show or change how much is printed: "quiet" leaves out other players' minor actions (e.g peeks and draws), "normal" or "verbose"
+a; b; c               |              - | Run several commands one after another, e.g "draw 2; hand". Each one runs after the server has replied to the one before it
 help                  |              - | Show the currently-available commands and basic instructions.
 quit                  |              - | Leave the current game (if you are in one) and close this application
 =======================================================================================================================
@@ -128,702 +208,3293 @@ quit                  |              - | Leave the current game (if you are in o
 `)
 
 		} else if cmdStr == "decks" {
-			buffer, _ := WriteCommandHeader(CMD_INFO_DECKS, 0)
-			err := sendCommandBuffer(buffer, conn)
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_DECKS, 0)
+			err := session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
 		} else if (cmdStr == "players") || (cmdStr == "pl") {
-			buffer, _ := WriteCommandHeader(CMD_INFO_PLAYERS, 0)
-			err := sendCommandBuffer(buffer, conn)
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_PLAYERS, 0)
+			err := session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
 		} else if (cmdStr == "hand") || (cmdStr == "ha") {
-			buffer, _ := WriteCommandHeader(CMD_INFO_CARDS, 0)
-			err := sendCommandBuffer(buffer, conn)
+			showHandGrouped = stringInSlice("grouped", unusedCmdArgs) || stringInSlice("group", unusedCmdArgs)
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_CARDS, 0)
+			err := session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else if (cmdStr == "draw") || (cmdStr == "d") {
-			cardCount, err := parseInputUint16(unusedCmdArgs[:])
+		} else if cmdStr == "inspect" {
+			cardId, err := parseCardIdFromSpec(game, &unusedCmdArgs)
 			if err != nil {
-				cardCount = 1
-			}
-			buffer, headerLen := WriteCommandHeader(CMD_CARD_DRAW, CardDrawCommandLength)
-			cmd := CardDrawCommand{
-				0,
-				cardCount,
-				false,
-			}
-			SerialiseCardDrawCommand(buffer[headerLen:], &cmd, false)
-			err = sendCommandBuffer(buffer, conn)
-			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
 			}
+			printCardInfo(game, cardId)
 
-		} else if (cmdStr == "putback") || (cmdStr == "pb") {
-			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
-			if err != nil {
-				fmt.Printf("Error: Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+		} else if cmdStr == "fingerprint" {
+			printSpecFingerprint(game)
+
+		} else if cmdStr == "rules" {
+			if len(strings.TrimSpace(game.spec.HowToPlay)) == 0 {
+				fmt.Fprintln(clientOutput, "This game's specification does not include any rules or reference text")
 				return
 			}
+			fmt.Fprintln(clientOutput, strings.TrimRight(game.spec.HowToPlay, "\n"))
 
-			cardsFromTop, err := parseInputUint16(unusedCmdArgs[:])
+		} else if cmdStr == "types" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_CARD_TYPES, 0)
+			err := session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to parse the <cardsFromTop> argument for '%s': %s\n", cmdStr, err)
-				return
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-			buffer, headerLen := WriteCommandHeader(CMD_CARD_PUTBACK, CardPutbackCommandLength)
-			cmd := CardPutbackCommand{
-				cardId,
-				0,
-				cardsFromTop,
-			}
-			SerialiseCardPutbackCommand(buffer[headerLen:], &cmd, false)
-			err = sendCommandBuffer(buffer, conn)
+		} else if cmdStr == "drawuntil" {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			cardType, err := parseCardTypeFromSpec(game, &unusedCmdArgs)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <type> argument for '%s': %s\n", cmdStr, err)
+				return
 			}
 
-		} else if (cmdStr == "discard") || (cmdStr == "dis") {
-			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
+			cmd := protocol.CardDrawUntilTypeCommand{DeckId: deckId, CardType: cardType}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_DRAW_UNTIL_TYPE, uint16(cmd.CommandLength()))
+			protocol.SerialiseCardDrawUntilTypeCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
-				return
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
+		} else if cmdStr == "discardtype" {
 			faceUp := true
 			if stringInSlice("facedown", unusedCmdArgs) ||
 				stringInSlice("down", unusedCmdArgs) {
 				faceUp = false
 			}
+			cardType, err := parseCardTypeFromSpec(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <type> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
 
-			buffer, headerLen := WriteCommandHeader(CMD_CARD_DISCARD, CardDiscardCommandLength)
-			cmd := CardDiscardCommand{
-				cardId,
-				faceUp,
+			cmd := protocol.CardDiscardTypeCommand{CardType: cardType, FaceUp: faceUp}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_DISCARD_TYPE, uint16(cmd.CommandLength()))
+			protocol.SerialiseCardDiscardTypeCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
-			SerialiseCardDiscardCommand(buffer[headerLen:], &cmd, false)
-			err = sendCommandBuffer(buffer, conn)
+
+		} else if cmdStr == "info" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_COUNTERS, 0)
+			err := session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else if (cmdStr == "givecard") || (cmdStr == "give") {
-			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
+		} else if cmdStr == "scores" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_SCORES, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "score" {
+			if (len(unusedCmdArgs) < 3) || (strings.ToLower(unusedCmdArgs[0]) != "add") {
+				printError("Error! '%s' requires a player and an amount, e.g '%s add alice 12'\n", cmdStr, cmdStr)
+				return
+			}
+
+			value, err := strconv.ParseInt(unusedCmdArgs[len(unusedCmdArgs)-1], 10, 64)
 			if err != nil {
-				fmt.Printf("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <amount> argument for '%s': %s\n", cmdStr, err)
 				return
 			}
 
-			playerId, err := parsePlayerId(game, &unusedCmdArgs)
+			playerArgs := unusedCmdArgs[1 : len(unusedCmdArgs)-1]
+			playerId, err := parsePlayerId(game, &playerArgs)
 			if err != nil {
-				fmt.Printf("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
 				return
 			}
 
-			buffer, headerLen := WriteCommandHeader(CMD_CARD_GIVE, CardGiveCommandLength)
-			cmd := CardGiveCommand{
-				cardId,
-				playerId,
-				false,
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_SCORE_ADD, protocol.ScoreAddCommandLength)
+			cmd := protocol.ScoreAddCommand{
+				PlayerId: playerId,
+				Value:    value,
 			}
-			SerialiseCardGiveCommand(buffer[headerLen:], &cmd, false)
-			err = sendCommandBuffer(buffer, conn)
+			protocol.SerialiseScoreAddCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else if (cmdStr == "showcard") || (cmdStr == "show") {
-			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
-			if err != nil {
-				fmt.Printf("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+		} else if cmdStr == "counter" {
+			if len(unusedCmdArgs) < 2 {
+				printError("Error! '%s' requires the name of a counter and an amount, e.g '%s life -3'\n", cmdStr, cmdStr)
 				return
 			}
 
-			playerId, err := parsePlayerId(game, &unusedCmdArgs)
+			cmd := protocol.CounterChangeCommand{
+				PlayerId:    protocol.PLAYER_ID_NONE,
+				CounterName: unusedCmdArgs[0],
+				SetValue:    false,
+				Value:       0,
+			}
+			if !protocol.IsValidCounterName(cmd.CounterName) {
+				printError("Error! Counter names must be between 1 and %d characters long\n", protocol.MaxCounterNameLength)
+				return
+			}
+
+			valueStr := unusedCmdArgs[1]
+			if strings.HasPrefix(valueStr, "=") {
+				cmd.SetValue = true
+				valueStr = valueStr[1:]
+			} else if !strings.HasPrefix(valueStr, "+") && !strings.HasPrefix(valueStr, "-") {
+				cmd.SetValue = true
+			}
+			value, err := strconv.ParseInt(valueStr, 10, 64)
 			if err != nil {
-				fmt.Printf("Error! Failed to parse the <playerId> argument for '%s': %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <amount> argument for '%s': %s\n", cmdStr, err)
 				return
 			}
+			cmd.Value = value
 
-			buffer, headerLen := WriteCommandHeader(CMD_CARD_SHOW, CardShowCommandLength)
-			cmd := CardShowCommand{
-				cardId,
-				playerId,
+			unusedCmdArgs = unusedCmdArgs[2:]
+			if len(unusedCmdArgs) > 0 {
+				playerId, err := parsePlayerId(game, &unusedCmdArgs)
+				if err != nil {
+					printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+					return
+				}
+				cmd.PlayerId = playerId
 			}
-			SerialiseCardShowCommand(buffer[headerLen:], &cmd, false)
-			err = sendCommandBuffer(buffer, conn)
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_COUNTER_CHANGE, uint16(cmd.CommandLength()))
+			protocol.SerialiseCounterChangeCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else if cmdStr == "giverand" {
-			playerId, err := parsePlayerId(game, &unusedCmdArgs)
+		} else if (cmdStr == "draw") || (cmdStr == "d") {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			cardCount, err := parseInputUint16(unusedCmdArgs[:])
 			if err != nil {
-				fmt.Printf("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
-				return
+				cardCount = 1
+			}
+			faceUp := false
+			if stringInSlice("faceup", unusedCmdArgs) ||
+				stringInSlice("up", unusedCmdArgs) {
+				faceUp = true
 			}
 
-			buffer, headerLen := WriteCommandHeader(CMD_CARD_GIVE, CardGiveCommandLength)
-			cmd := CardGiveCommand{
-				CARD_ID_ANY,
-				playerId,
-				false,
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_DRAW, protocol.CardDrawCommandLength)
+			cmd := protocol.CardDrawCommand{
+				DeckId: deckId,
+				Count:  cardCount,
+				FaceUp: faceUp,
 			}
-			SerialiseCardGiveCommand(buffer[headerLen:], &cmd, false)
-			err = sendCommandBuffer(buffer, conn)
+			protocol.SerialiseCardDrawCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else if cmdStr == "peek" {
-			count, err := parseInputUint16(unusedCmdArgs[:])
+		} else if cmdStr == "fetch" {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			cardId, err := parseCardIdFromSpec(game, &unusedCmdArgs)
 			if err != nil {
-				fmt.Printf("Error! Failed to parse arguments for '%s': %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
 				return
 			}
 
-			buffer, headerLen := WriteCommandHeader(CMD_DECK_PEEK, DeckPeekCommandLength)
-			cmd := DeckPeekCommand{
-				0,
-				count,
-				false,
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_FETCH, protocol.CardFetchCommandLength)
+			cmd := protocol.CardFetchCommand{
+				DeckId: deckId,
+				CardId: cardId,
 			}
-			SerialiseDeckPeekCommand(buffer[headerLen:], &cmd, false)
-			err = sendCommandBuffer(buffer, conn)
+			protocol.SerialiseCardFetchCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else if cmdStr == "shuffle" {
-			buffer, headerLen := WriteCommandHeader(CMD_DECK_SHUFFLE, DeckShuffleCommandLength)
-			cmd := DeckShuffleCommand{
-				0,
-			}
-			SerialiseDeckShuffleCommand(buffer[headerLen:], &cmd, false)
-			err := sendCommandBuffer(buffer, conn)
+		} else if cmdStr == "revealhand" {
+			keepRevealed := stringInSlice("keep", unusedCmdArgs)
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_REVEAL_HAND, protocol.CardRevealHandCommandLength)
+			cmd := protocol.CardRevealHandCommand{KeepRevealed: keepRevealed}
+			protocol.SerialiseCardRevealHandCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else if cmdStr == "leave" {
-			buffer, _ := WriteCommandHeader(CMD_GAME_LEAVE, 0)
-			err := sendCommandBuffer(buffer, conn)
+		} else if (cmdStr == "faceup") || (cmdStr == "facedown") {
+			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
 			}
 
-		} else if cmdStr == "quit" {
-			buffer, _ := WriteCommandHeader(CMD_DISCONNECT, 0)
-			err := sendCommandBuffer(buffer, conn)
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_SET_FACE_UP, protocol.CardSetFaceUpCommandLength)
+			cmd := protocol.CardSetFaceUpCommand{
+				CardId: cardId,
+				FaceUp: cmdStr == "faceup",
+			}
+			protocol.SerialiseCardSetFaceUpCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else {
-			fmt.Printf("Unrecognised command: '%s', enter 'help' for a list of available commands\n", inputLine)
-		}
-	} else {
-		if cmdStr == "help" {
-			fmt.Print(`
-You are currently in the menu (and not in a game)
+		} else if cmdStr == "trade" {
+			if len(unusedCmdArgs) == 0 {
+				printError("Error! Insufficient arguments for '%s'\n", cmdStr)
+				return
+			}
 
-From here you can create a new game which will give you an ID that your friends can use to join your game, or you can
-join an existing game using the game ID of a game that a friend has already created.
-If you wish to create a game, use the 'create' command along with the name of a game-specification file located in the
-same folder as netdeck. You can find out more about game specifications online at https://github.com/jacquesh/netdeck
+			response := strings.ToLower(unusedCmdArgs[0])
+			if (response == "accept") || (response == "decline") {
+				responseArgs := unusedCmdArgs[1:]
+				playerId, err := parsePlayerId(game, &responseArgs)
+				if err != nil {
+					printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+					return
+				}
 
-Even if you have not created any specification files, you can always create a game that uses a single, standard 52-card
-deck (the Ace-to-King kind) by entering 'create default' (without the quotes). This uses a built-in specification file.
+				buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_TRADE_RESPOND, protocol.CardTradeRespondCommandLength)
+				cmd := protocol.CardTradeRespondCommand{
+					PlayerId: playerId,
+					Accept:   (response == "accept"),
+				}
+				protocol.SerialiseCardTradeRespondCommand(buffer[headerLen:], &cmd, false)
+				err = session.SendCommandBuffer(buffer)
+				if err != nil {
+					printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				}
+				return
+			}
 
-The following commands are currently available to you:
-=======================================================================================================================
-Command         | Description
-================|============
-create <name>   | Create a new game for others to join, using the specification in the local file 'name.yml'
-join <game-id>  | Join the existing game with ID x that was started by another player
-help            | Show the currently-available commands and basic instructions. Shows different info while in-game.
-quit            | Quit netdeck
-=======================================================================================================================
+			// The card we offer must come first, otherwise it would be ambiguous with the card we ask for in return
+			offeredArgs := unusedCmdArgs[:1]
+			offeredCardId, err := parseCardIdFromHand(game, localPlayer, &offeredArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
 
-`)
+			requestArgs := unusedCmdArgs[1:]
+			playerId, err := parsePlayerId(game, &requestArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
 
-		} else if cmdStr == "create" {
-			if len(inputTokens) != 2 {
-				fmt.Println("The 'create' command requires one argument specifying the game name. You can enter the name of 'default' to get a generic 52-card deck")
+			requestedCardId, err := parseCardIdFromSpec(game, &requestArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <their card> argument for '%s': %s\n", cmdStr, err)
 				return
 			}
 
-			var spec []byte
-			if inputTokens[1] == "default" {
-				spec = DefaultSerializedGameSpec()
-			} else {
-				var err error
-				spec, err = SerialiseSpecFromName(inputTokens[1])
-				if err != nil {
-					fmt.Println("Error reading local game specification: " + err.Error())
-					return
-				}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_TRADE_OFFER, protocol.CardTradeOfferCommandLength)
+			cmd := protocol.CardTradeOfferCommand{
+				OfferedCardId:   offeredCardId,
+				PlayerId:        playerId,
+				RequestedCardId: requestedCardId,
+			}
+			protocol.SerialiseCardTradeOfferCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
-			if len(spec) > MaxGameCreateSpecDataLength {
-				fmt.Printf("Game spec for '%s' is %d bytes, which is larger than the max allowed %d bytes\n",
-					inputTokens[1], len(spec), MaxGameCreateSpecDataLength)
+
+		} else if cmdStr == "showme" {
+			if len(unusedCmdArgs) == 0 {
+				printError("Error! Insufficient arguments for '%s'\n", cmdStr)
 				return
 			}
 
-			buffer, headerLen := WriteCommandHeader(CMD_GAME_CREATE, uint16(GameCreateCommandLength(len(spec))))
-			cmd := GameCreateCommand{spec}
-			SerialiseGameCreateCommand(buffer[headerLen:], &cmd, false)
+			response := strings.ToLower(unusedCmdArgs[0])
+			if (response == "accept") || (response == "decline") {
+				responseArgs := unusedCmdArgs[1:]
+				playerId, err := parsePlayerId(game, &responseArgs)
+				if err != nil {
+					printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+					return
+				}
 
-			err := sendCommandBuffer(buffer, conn)
-			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_VIEW_HAND_RESPOND, protocol.CardViewHandRespondCommandLength)
+				cmd := protocol.CardViewHandRespondCommand{
+					PlayerId: playerId,
+					Accept:   (response == "accept"),
+				}
+				protocol.SerialiseCardViewHandRespondCommand(buffer[headerLen:], &cmd, false)
+				err = session.SendCommandBuffer(buffer)
+				if err != nil {
+					printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				}
+				return
 			}
-			fmt.Printf("Sent game creation for '%s'...\n", inputTokens[1])
 
-		} else if cmdStr == "join" {
-			gameId, err := parseInputUint64(inputTokens[1:])
+			playerId, err := parsePlayerId(game, &unusedCmdArgs)
 			if err != nil {
-				fmt.Printf("Error! Failed to parse arguments for '%s': %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
 				return
 			}
 
-			buffer, headerLen := WriteCommandHeader(CMD_GAME_JOIN, GameJoinCommandLength)
-			cmd := GameJoinCommand{gameId}
-			SerialiseGameJoinCommand(buffer[headerLen:], &cmd, false)
-			err = sendCommandBuffer(buffer, conn)
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_VIEW_HAND_REQUEST, protocol.CardViewHandRequestCommandLength)
+			cmd := protocol.CardViewHandRequestCommand{PlayerId: playerId}
+			protocol.SerialiseCardViewHandRequestCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		} else if cmdStr == "quit" {
-			buffer, _ := WriteCommandHeader(CMD_DISCONNECT, 0)
-			err := sendCommandBuffer(buffer, conn)
+		} else if cmdStr == "swaphands" {
+			playerId, err := parsePlayerId(game, &unusedCmdArgs)
 			if err != nil {
-				fmt.Printf("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+				return
 			}
 
-		} else {
-			fmt.Printf("Unrecognised command: '%s', enter 'help' for a list of available commands\n", inputLine)
-		}
-	}
-}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_SWAP_HANDS, protocol.CardSwapHandsCommandLength)
+			cmd := protocol.CardSwapHandsCommand{PlayerId: playerId}
+			protocol.SerialiseCardSwapHandsCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
 
-func runClient(playerName string, serverHost string) {
-	stdInRead := bufio.NewReader(os.Stdin)
-	if len(playerName) == 0 {
-		for len(playerName) == 0 {
-			var err error
-			fmt.Print("Please enter your name: ")
-			playerName, err = stdInRead.ReadString('\n')
+		} else if (cmdStr == "putback") || (cmdStr == "pb") || (cmdStr == "putbottom") {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
 			if err != nil {
-				fmt.Println("FAILED TO GET NAME FROM STDIN", err)
+				printError("Error: Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
 				return
 			}
-			playerName = strings.TrimSpace(playerName)
-			if strings.ContainsAny(playerName, " \t\r\n") {
-				fmt.Println("Sorry, but your alias/name on this service cannot contain any spaces. Please enter a different name.")
-			}
-			fmt.Printf("Playername = %s\n", playerName)
-		}
 
-	} else if strings.ContainsAny(playerName, " \t\r\n") {
-		fmt.Println("Sorry, but your alias/name on this service cannot contain any spaces.")
-		return
-	}
+			var cardsFromTop uint16
+			if stringInSlice("random", unusedCmdArgs) || stringInSlice("rand", unusedCmdArgs) {
+				cardsFromTop = protocol.DECK_POSITION_RANDOM
+			} else if (cmdStr == "putbottom") || stringInSlice("bottom", unusedCmdArgs) {
+				cardsFromTop = protocol.DECK_POSITION_BOTTOM
+			} else {
+				cardsFromTop, err = parseInputUint16(unusedCmdArgs[:])
+				if err != nil {
+					printError("Error! Failed to parse the <cardsFromTop> argument for '%s': %s\n", cmdStr, err)
+					return
+				}
+			}
 
-	fmt.Println("Connecting to " + serverHost + "...")
-	conn, err := net.Dial("tcp", serverHost+":43831")
-	if err != nil {
-		// TODO: Direct people to some form of contact for me, or that they can host their own server too (--server), if you know how to do that and have the infrastructure
-		fmt.Println("ERROR CONNECTING TO SERVER: ", err)
-		return
-	}
+			faceUp := false
+			if stringInSlice("faceup", unusedCmdArgs) ||
+				stringInSlice("up", unusedCmdArgs) {
+				faceUp = true
+			}
 
-	handshake := HandshakeCommand{
-		PROTOCOL_MAGIC_NUMBER,
-		PROTOCOL_ID,
-		playerName,
-	}
-	handshakeBuffer, handshakeHeaderLen := WriteCommandHeader(CMD_HANDSHAKE, handshake.CommandLength())
-	SerialiseHandshakeCommand(handshakeBuffer[handshakeHeaderLen:], &handshake, false)
-	err = sendCommandBuffer(handshakeBuffer, conn)
-	if err != nil {
-		fmt.Printf("Failed to send handshake to the server, disconnecting: %s\n", err)
-		conn.Close()
-		return
-	}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_PUTBACK, protocol.CardPutbackCommandLength)
+			cmd := protocol.CardPutbackCommand{
+				CardId:       cardId,
+				DeckId:       deckId,
+				CardsFromTop: cardsFromTop,
+				FaceUp:       faceUp,
+			}
+			protocol.SerialiseCardPutbackCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
 
-	stdInChan := make(chan string)
-	cmdChan := make(chan CommandContainer)
-	quitChan := make(chan bool)
-	keepAliveTimer := time.NewTimer(10 * time.Second)
-	go clientReadConsoleInput(stdInRead, stdInChan)
-	go clientReadSocketInput(conn, cmdChan, quitChan)
+		} else if (cmdStr == "discard") || (cmdStr == "dis") {
+			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
 
-	game := GameState{}
-	inGame := false
-	var localPlayer *PlayerState = nil
-	var localPlayerId uint64 = 0
+			faceUp := true
+			if stringInSlice("facedown", unusedCmdArgs) ||
+				stringInSlice("down", unusedCmdArgs) {
+				faceUp = false
+			}
 
-	fmt.Println("Connected successfully. Waiting for handshake response...")
-	for {
-		shouldQuit := false
-		select {
-		case <-keepAliveTimer.C:
-			buffer, _ := WriteCommandHeader(CMD_KEEPALIVE, 0)
-			err := sendCommandBuffer(buffer, conn)
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_DISCARD, protocol.CardDiscardCommandLength)
+			cmd := protocol.CardDiscardCommand{
+				CardId: cardId,
+				FaceUp: faceUp,
+			}
+			protocol.SerialiseCardDiscardCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
 			if err != nil {
-				fmt.Printf("Error! Failed to send keep-alive packet to the server: %s\n", err)
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
 			}
 
-		case inputLine := <-stdInChan:
-			handleInputFromStdin(inputLine, conn, &game, inGame, localPlayer)
+		} else if (cmdStr == "givecard") || (cmdStr == "give") {
+			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
 
-		case cmdContainer := <-cmdChan:
-			cmdId := cmdContainer.header.id
-			switch cmdId {
-			case CMD_HANDSHAKE_RESPONSE:
-				var cmd HandshakeResponseCommand
-				SerialiseHandshakeResponseCommand(cmdContainer.payload, &cmd, true)
-				localPlayerId = cmd.playerId
-				fmt.Println("Handshake completed successfully. Type 'help' (without the quotes) to see a list of possible commands")
-
-			case CMD_INFO_PLAYERS_RESPONSE:
-				var cmd PlayerInfoResponseCommand
-				err := SerialisePlayerInfoResponseCommand(cmdContainer.payload, &cmd, true)
-				if err != nil {
-					fmt.Printf("Received invalid PlayerInfoResponseCommand: %s - %+v - %+v\n", err, cmd, cmdContainer.payload)
-				}
-				diverged := (len(cmd.ids) != len(game.Players))
-				fmt.Print("Players:\n")
-				for i := 0; i < len(cmd.ids); i++ {
-					fmt.Printf("  %s  %d cards in-hand", cmd.names[i], cmd.handSizes[i])
-					if cmd.ids[i] == localPlayer.Id {
-						fmt.Println("  <-- This is you")
-					} else {
-						fmt.Println()
-					}
-					if !diverged && (cmd.ids[i] != game.Players[i].Id) {
-						diverged = true
-					}
-				}
-				if diverged {
-					fmt.Println("ERROR: Local view of the players in the game has diverged from the server. This is a bug.")
-				}
+			playerId, err := parsePlayerId(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
 
-			case CMD_INFO_DECKS_RESPONSE:
-				var cmd DeckInfoResponseCommand
-				SerialiseDeckInfoResponseCommand(cmdContainer.payload, &cmd, true)
-				fmt.Printf("The deck contains %d cards\n", cmd.cardCounts[0])
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_GIVE, protocol.CardGiveCommandLength)
+			cmd := protocol.CardGiveCommand{
+				CardId:   cardId,
+				PlayerId: playerId,
+				FaceUp:   false,
+			}
+			protocol.SerialiseCardGiveCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
 
-			case CMD_INFO_CARDS_RESPONSE:
-				var cmd CardInfoResponseCommand
-				SerialiseCardInfoResponseCommand(cmdContainer.payload, &cmd, true)
-				diverged := (len(cmd.ids) != len(localPlayer.Hand))
-				if len(cmd.ids) == 0 {
-					fmt.Println("You have no cards in your hand")
-				} else {
-					fmt.Println("Cards in your hand:")
-					for cardIndex, cardId := range cmd.ids {
-						fmt.Printf("  - %s\n", game.spec.CardName(cardId))
-						if !diverged && (cardId != localPlayer.Hand[cardIndex]) {
-							diverged = true
-						}
-					}
+		} else if (cmdStr == "showcard") || (cmdStr == "show") {
+			exceptPlayerId := uint64(protocol.PLAYER_ID_NONE)
+			for argIndex, arg := range unusedCmdArgs {
+				if strings.ToLower(arg) != "except" {
+					continue
 				}
-				if diverged {
-					fmt.Println("ERROR: Local view of the cards in your hand has diverged from the server. This is a bug.")
+				exceptArgs := unusedCmdArgs[argIndex+1:]
+				var err error
+				exceptPlayerId, err = parsePlayerId(game, &exceptArgs)
+				if err != nil {
+					printError("Error! Failed to parse the player argument after 'except' for '%s': %s\n", cmdStr, err)
+					return
 				}
+				unusedCmdArgs = append(unusedCmdArgs[:argIndex], exceptArgs...)
+				break
+			}
 
-			case CMD_NOTIFY_GAME_JOINED:
-				var cmd NotifyGameJoinedCommand
-				SerialiseNotifyGameJoinedCommand(cmdContainer.payload, &cmd, true)
+			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
 
-				if inGame {
-					// A new player (that isn't us) has joined the game
-					newPlayerCount := len(cmd.playerIds)
-					for i := 0; i < newPlayerCount; i++ {
-						newPlayer := NewPlayerState(cmd.playerIds[i], cmd.playerNames[i], &game)
-						game.AddPlayer(&newPlayer)
-						fmt.Printf("%s has joined the game\n", newPlayer.Name)
-					}
+			playerId, err := parsePlayerId(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <playerId> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
 
-				} else {
-					// We just joined a game, set it up
-					spec, err := NewSpec(cmd.specData)
-					if err != nil {
-						fmt.Printf("Failed to create local game tracker from spec: %s\n", err)
-						shouldQuit = true
-						break
-					}
-					game = CreateGameFromSpec(spec)
-					game.Id = cmd.gameId
-					game.Deck = make([]uint16, int(cmd.deckSize))
-					for i := 0; i < len(game.Deck); i++ {
-						game.Deck[i] = CARD_ID_ANY
-					}
+			if (exceptPlayerId != protocol.PLAYER_ID_NONE) && (playerId != protocol.PLAYER_ID_ALL) {
+				printError("Error! 'except' can only be used when showing a card to allplayers\n")
+				return
+			}
 
-					game.Players = make([]*PlayerState, len(cmd.playerIds))
-					for i := 0; i < len(cmd.playerIds); i++ {
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_SHOW, protocol.CardShowCommandLength)
+			cmd := protocol.CardShowCommand{
+				CardId:         cardId,
+				PlayerId:       playerId,
+				ExceptPlayerId: exceptPlayerId,
+			}
+			protocol.SerialiseCardShowCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "play" {
+			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_TABLE_PLAY, protocol.TableCardCommandLength)
+			cmd := protocol.TableCardCommand{CardId: cardId}
+			protocol.SerialiseTableCardCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "table" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_TABLE, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "market" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_MARKET, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if (cmdStr == "markettake") || (cmdStr == "mt") || (cmdStr == "marketdiscard") || (cmdStr == "md") {
+			cardId, err := parseCardIdFromSpec(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			cmdId := protocol.CMD_MARKET_TAKE
+			if (cmdStr == "marketdiscard") || (cmdStr == "md") {
+				cmdId = protocol.CMD_MARKET_DISCARD
+			}
+			buffer, headerLen := protocol.WriteCommandHeader(cmdId, protocol.TableCardCommandLength)
+			cmd := protocol.TableCardCommand{CardId: cardId}
+			protocol.SerialiseTableCardCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "take" {
+			cardId, err := parseCardIdFromSpec(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_TABLE_TAKE, protocol.TableCardCommandLength)
+			cmd := protocol.TableCardCommand{CardId: cardId}
+			protocol.SerialiseTableCardCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if (cmdStr == "tableputback") || (cmdStr == "tpb") {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			cardId, err := parseCardIdFromSpec(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			cardsFromTop, err := parseInputUint16(unusedCmdArgs[:])
+			if err != nil {
+				printError("Error! Failed to parse the <cardsFromTop> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_TABLE_PUTBACK, protocol.TablePutbackCommandLength)
+			cmd := protocol.TablePutbackCommand{
+				CardId:       cardId,
+				DeckId:       deckId,
+				CardsFromTop: cardsFromTop,
+			}
+			protocol.SerialiseTablePutbackCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "tableau" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_TABLEAUS, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "place" {
+			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_TABLEAU_PLACE, protocol.TableCardCommandLength)
+			cmd := protocol.TableCardCommand{CardId: cardId}
+			protocol.SerialiseTableCardCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "retrieve" {
+			cardId, err := parseCardIdFromSpec(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_TABLEAU_RETRIEVE, protocol.TableCardCommandLength)
+			cmd := protocol.TableCardCommand{CardId: cardId}
+			protocol.SerialiseTableCardCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "shufflehand" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_CARD_SHUFFLE_HAND, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "sort" {
+			sortBy := ""
+			if len(unusedCmdArgs) > 0 {
+				sortBy = strings.ToLower(unusedCmdArgs[0])
+			}
+			if (sortBy != "") && (sortBy != "value") && (sortBy != "name") {
+				printError("Error! Unknown order '%s' for '%s', the hand can be sorted by 'value' or 'name'\n", unusedCmdArgs[0], cmdStr)
+				return
+			}
+
+			cmd := protocol.CardArrangeHandCommand{
+				NewOrder: sortedHandOrder(game, localPlayer.Hand, sortBy),
+			}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_ARRANGE_HAND, uint16(cmd.CommandLength()))
+			protocol.SerialiseCardArrangeHandCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "movecard" {
+			cardId, err := parseCardIdFromHand(game, localPlayer, &unusedCmdArgs)
+			if (err == nil) && ((cardId == protocol.CARD_ID_ANY) || (cardId == protocol.CARD_ID_ALL)) {
+				err = errors.New("A specific card must be given")
+			}
+			if err != nil {
+				printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+			position, err := parseInputUint16(unusedCmdArgs)
+			if (err != nil) || (position == 0) || (int(position) > len(localPlayer.Hand)) {
+				printError("Error! '%s' requires a position between 1 and %d, e.g '%s %s 1'\n", cmdStr, len(localPlayer.Hand), cmdStr, game.spec.CardName(cardId))
+				return
+			}
+
+			cardIndex := game.FindCard(localPlayer, cardId)
+			newOrder := make([]uint16, 0, len(localPlayer.Hand))
+			for index := range localPlayer.Hand {
+				if index != cardIndex {
+					newOrder = append(newOrder, uint16(index))
+				}
+			}
+			cmd := protocol.CardArrangeHandCommand{
+				NewOrder: sliceInsert(newOrder, uint16(cardIndex), int(position)-1),
+			}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_ARRANGE_HAND, uint16(cmd.CommandLength()))
+			protocol.SerialiseCardArrangeHandCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "giverand" {
+			playerId, err := parsePlayerId(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_GIVE, protocol.CardGiveCommandLength)
+			cmd := protocol.CardGiveCommand{
+				CardId:   protocol.CARD_ID_ANY,
+				PlayerId: playerId,
+				FaceUp:   false,
+			}
+			protocol.SerialiseCardGiveCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if (cmdStr == "discardpile") || (cmdStr == "dp") {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_DISCARDS, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if (cmdStr == "pickup") || (cmdStr == "pick") {
+			cmd := protocol.CardPickupCommand{
+				CardId: protocol.CARD_ID_NONE,
+				Search: false,
+			}
+			if len(unusedCmdArgs) > 0 {
+				cardId, err := parseCardIdFromSpec(game, &unusedCmdArgs)
+				if err != nil {
+					printError("Error! Failed to parse the <card> argument for '%s': %s\n", cmdStr, err)
+					return
+				}
+				cmd.CardId = cardId
+				cmd.Search = true
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_CARD_PICKUP, protocol.CardPickupCommandLength)
+			protocol.SerialiseCardPickupCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "peek" {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			count, err := parseInputUint16(unusedCmdArgs[:])
+			if err != nil {
+				printError("Error! Failed to parse arguments for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_DECK_PEEK, protocol.DeckPeekCommandLength)
+			cmd := protocol.DeckPeekCommand{
+				DeckId: deckId,
+				Count:  count,
+				Public: false,
+			}
+			protocol.SerialiseDeckPeekCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "peekbottom" {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			count, err := parseInputUint16(unusedCmdArgs[:])
+			if err != nil {
+				printError("Error! Failed to parse arguments for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_DECK_PEEK_BOTTOM, protocol.DeckPeekCommandLength)
+			cmd := protocol.DeckPeekCommand{
+				DeckId: deckId,
+				Count:  count,
+				Public: stringInSlice("public", unusedCmdArgs),
+			}
+			protocol.SerialiseDeckPeekCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "shuffle" {
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_DECK_SHUFFLE, protocol.DeckShuffleCommandLength)
+			cmd := protocol.DeckShuffleCommand{
+				DeckId: parseDeckIdFromSpec(game, &unusedCmdArgs),
+			}
+			protocol.SerialiseDeckShuffleCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if (cmdStr == "rearrange") || (cmdStr == "rearr") {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			if len(unusedCmdArgs) == 0 {
+				printError("Error! '%s' requires the new order of the top cards of the deck, e.g: '%s 3 1 2'\n", cmdStr, cmdStr)
+				return
+			}
+			newOrder := make([]uint16, 0, len(unusedCmdArgs))
+			for _, arg := range unusedCmdArgs {
+				position, err := parseInputUint16([]string{arg})
+				if (err != nil) || (position == 0) || (int(position) > len(unusedCmdArgs)) {
+					printError("Error! Invalid position '%s' for '%s', positions must be between 1 and %d\n", arg, cmdStr, len(unusedCmdArgs))
+					return
+				}
+				newOrder = append(newOrder, position-1)
+			}
+
+			cmd := protocol.DeckRearrangeCommand{
+				DeckId:   deckId,
+				NewOrder: newOrder,
+			}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_DECK_REARRANGE, uint16(cmd.CommandLength()))
+			protocol.SerialiseDeckRearrangeCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "burn" {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			faceUp := true
+			if stringInSlice("facedown", unusedCmdArgs) ||
+				stringInSlice("down", unusedCmdArgs) {
+				faceUp = false
+			}
+
+			count := uint16(1)
+			for _, arg := range unusedCmdArgs {
+				argCount, err := parseInputUint16([]string{arg})
+				if err == nil {
+					count = argCount
+					break
+				}
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_DECK_BURN, protocol.DeckBurnCommandLength)
+			cmd := protocol.DeckBurnCommand{
+				DeckId: deckId,
+				Count:  count,
+				FaceUp: faceUp,
+			}
+			protocol.SerialiseDeckBurnCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "deal" {
+			deckId := parseDeckIdFromSpec(game, &unusedCmdArgs)
+			cardCount, err := parseInputUint16(unusedCmdArgs[:])
+			if err != nil {
+				printError("Error! Failed to parse the <n> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_DECK_DEAL, protocol.DeckDealCommandLength)
+			cmd := protocol.DeckDealCommand{
+				DeckId: deckId,
+				Count:  cardCount,
+			}
+			protocol.SerialiseDeckDealCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "roll" {
+			dice := parseNamedDice(game, &unusedCmdArgs)
+			if dice != nil {
+				count := uint16(1)
+				for _, arg := range unusedCmdArgs {
+					argCount, err := parseInputUint16([]string{arg})
+					if err == nil {
+						count = argCount
+						break
+					}
+				}
+
+				cmd := protocol.RandomRollNamedCommand{DiceName: dice.Name, Count: count}
+				buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_RANDOM_ROLL_NAMED, uint16(cmd.CommandLength()))
+				protocol.SerialiseRandomRollNamedCommand(buffer[headerLen:], &cmd, false)
+				err := session.SendCommandBuffer(buffer)
+				if err != nil {
+					printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				}
+				return
+			}
+
+			count, sides, err := parseDiceRoll(unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse arguments for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_RANDOM_ROLL, protocol.RandomRollCommandLength)
+			cmd := protocol.RandomRollCommand{
+				Count: count,
+				Sides: sides,
+			}
+			protocol.SerialiseRandomRollCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "dice" {
+			if len(game.spec.Dice) == 0 {
+				fmt.Fprintln(clientOutput, "This game's specification does not give any named dice")
+				return
+			}
+			fmt.Fprintln(clientOutput, "Dice in this game:")
+			for _, dice := range game.spec.Dice {
+				fmt.Fprintf(clientOutput, "  - %s: %s\n", dice.Name, strings.Join(dice.FaceNames(), ", "))
+			}
+
+		} else if cmdStr == "flip" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_RANDOM_FLIP, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if (cmdStr == "pickrandom") || (cmdStr == "pickr") {
+			options := make([]string, 0, len(unusedCmdArgs))
+			for _, arg := range unusedCmdArgs {
+				if len(arg) > 0 {
+					options = append(options, arg)
+				}
+			}
+			if len(options) == 0 {
+				printError("Error! '%s' requires at least one option to pick from\n", cmdStr)
+				return
+			}
+
+			cmd := protocol.RandomPickCommand{Options: options}
+			if cmd.CommandLength() > protocol.MaxRandomPickCommandLength {
+				printError("Error! Too many options given for '%s'\n", cmdStr)
+				return
+			}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_RANDOM_PICK, uint16(cmd.CommandLength()))
+			protocol.SerialiseRandomPickCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "vote" {
+			if len(unusedCmdArgs) == 0 {
+				printError("Error! Insufficient arguments for '%s'\n", cmdStr)
+				return
+			}
+
+			if strings.ToLower(unusedCmdArgs[0]) == "start" {
+				pollArgs := make([]string, 0, len(unusedCmdArgs))
+				for _, arg := range unusedCmdArgs[1:] {
+					if len(arg) > 0 {
+						pollArgs = append(pollArgs, arg)
+					}
+				}
+
+				// The question runs up to the first word ending in a question mark, or is just the first word if there is none
+				questionLength := 1
+				for index, arg := range pollArgs {
+					if strings.HasSuffix(arg, "?") {
+						questionLength = index + 1
+						break
+					}
+				}
+				if len(pollArgs) < questionLength+2 {
+					printError("Error! '%s start' requires a question and at least two options, e.g '%s start Who is the spy? alice bob'\n", cmdStr, cmdStr)
+					return
+				}
+
+				cmd := protocol.PollStartCommand{
+					Question: strings.Join(pollArgs[:questionLength], " "),
+					Options:  pollArgs[questionLength:],
+				}
+				if (cmd.CommandLength() > protocol.MaxPollStartCommandLength) || (len(cmd.Options) > MaxPollOptionCount) {
+					printError("Error! Too many options given for '%s'\n", cmdStr)
+					return
+				}
+				buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_POLL_START, uint16(cmd.CommandLength()))
+				protocol.SerialisePollStartCommand(buffer[headerLen:], &cmd, false)
+				err := session.SendCommandBuffer(buffer)
+				if err != nil {
+					printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				}
+				return
+			}
+
+			option, err := parsePollOption(game.poll, unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <option> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_POLL_VOTE, protocol.PollVoteCommandLength)
+			cmd := protocol.PollVoteCommand{Option: option}
+			protocol.SerialisePollVoteCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "log" {
+			count, err := parseInputUint16(unusedCmdArgs[:])
+			if err != nil {
+				count = DefaultEventLogCount
+			}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_INFO_EVENTS, protocol.EventInfoCommandLength)
+			cmd := protocol.EventInfoCommand{
+				Count: count,
+			}
+			protocol.SerialiseEventInfoCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "history" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_HISTORY, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "sync" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_SYNC_REQUEST, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if (cmdStr == "endturn") || (cmdStr == "et") {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_TURN_END, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "turntimer" {
+			seconds, err := parseInputUint16(unusedCmdArgs[:])
+			if err != nil {
+				printError("Error! Failed to parse the <seconds> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_TURN_TIMER, protocol.TurnTimerCommandLength)
+			cmd := protocol.TurnTimerCommand{
+				Seconds:     seconds,
+				AutoAdvance: stringInSlice("auto", unusedCmdArgs),
+			}
+			protocol.SerialiseTurnTimerCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "undo" {
+			if len(unusedCmdArgs) == 0 {
+				buffer, _ := protocol.WriteCommandHeader(protocol.CMD_GAME_UNDO, 0)
+				err := session.SendCommandBuffer(buffer)
+				if err != nil {
+					printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+				}
+				return
+			}
+
+			var approve bool
+			switch strings.ToLower(unusedCmdArgs[0]) {
+			case "yes", "y":
+				approve = true
+			case "no", "n":
+				approve = false
+			default:
+				printError("Error! Expected either 'yes' or 'no' as the argument for '%s', but got '%s'\n", cmdStr, unusedCmdArgs[0])
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_GAME_UNDO_VOTE, protocol.GameUndoVoteCommandLength)
+			cmd := protocol.GameUndoVoteCommand{Approve: approve}
+			protocol.SerialiseGameUndoVoteCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "start" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_GAME_START, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "myrole" {
+			if len(game.spec.Roles) == 0 {
+				fmt.Fprintln(clientOutput, "This game's specification does not give any roles")
+				return
+			}
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_ROLE, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "revealroles" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_GAME_REVEAL_ROLES, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "reset" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_GAME_RESET, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "addbot" {
+			strategy := DefaultBotStrategy
+			if (len(unusedCmdArgs) > 0) && (len(unusedCmdArgs[0]) > 0) {
+				strategy = strings.ToLower(unusedCmdArgs[0])
+			}
+			if !isValidBotStrategy(strategy) {
+				printError("Error! Unrecognised bot strategy '%s', it should be one of: %s, %s, %s\n", strategy, BOT_STRATEGY_CYCLE, BOT_STRATEGY_DRAW, BOT_STRATEGY_PASS)
+				return
+			}
+
+			cmd := protocol.GameAddBotCommand{Strategy: strategy}
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_GAME_ADD_BOT, uint16(cmd.CommandLength()))
+			protocol.SerialiseGameAddBotCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "kick" {
+			discardCards := stringInSlice("discard", unusedCmdArgs)
+			playerId, err := parsePlayerId(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_GAME_KICK, protocol.GameKickCommandLength)
+			cmd := protocol.GameKickCommand{
+				PlayerId:     playerId,
+				DiscardCards: discardCards,
+			}
+			protocol.SerialiseGameKickCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "owner" {
+			playerId, err := parsePlayerId(game, &unusedCmdArgs)
+			if err != nil {
+				printError("Error! Failed to parse the <player> argument for '%s': %s\n", cmdStr, err)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_GAME_TRANSFER_OWNER, protocol.GameTransferOwnerCommandLength)
+			cmd := protocol.GameTransferOwnerCommand{PlayerId: playerId}
+			protocol.SerialiseGameTransferOwnerCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "leave" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_GAME_LEAVE, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "quit" {
+			quitRequested = true
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_DISCONNECT, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else {
+			fmt.Fprintf(clientOutput, "Unrecognised command: '%s', enter 'help' for a list of available commands\n", inputLine)
+		}
+	} else {
+		if cmdStr == "help" {
+			fmt.Fprint(clientOutput, `
+You are currently in the menu (and not in a game)
+
+From here you can create a new game which will give you an ID that your friends can use to join your game, or you can
+join an existing game using the join code (e.g BRAVE-OTTER-42) or game ID of a game that a friend has already created.
+If you wish to create a game, use the 'create' command along with the name of a game-specification file located in the
+same folder as netdeck. You can find out more about game specifications online at https://github.com/jacquesh/netdeck
+Specification files can be written in either YAML (with a .yml or .yaml extension) or JSON (with a .json extension).
+
+Even if you have not created any specification files, you can always create a game that uses a single, standard 52-card
+deck (the Ace-to-King kind) by entering 'create default' (without the quotes). This uses a built-in specification file.
+There are also built-in specifications for some other common decks, which you can use in the same way:
+  jokers - A standard 52-card deck plus two jokers
+  double - Two standard 52-card decks shuffled together (104 cards)
+  piquet - A 32-card deck with only the 7s and up of each suit
+  tarot  - A 78-card tarot deck, with the 22 major arcana and four suits of 14 cards
+  uno    - A 108-card deck in four colours with action and wild cards, like the one used to play Uno
+
+The following commands are currently available to you:
+=======================================================================================================================
+Command         | Description
+================|============
+create <name>   | Create a new game for others to join, using the specification in the local file 'name.yml' (or .json). Add "public" after the name to list it in 'games', or "--seed n" to make every shuffle and random choice the same each time
+games           | Show a list of the public games that you can join
+join <id/code>  | Join the existing game with the given ID or join code (e.g BRAVE-OTTER-42) that was started by another player
+rename <name>   | Change your name to the one given, e.g if somebody in the game that you want to join already has your name
+run [x] [args]  | Run the commands of macro x from the file given with --macros, one after another. Without x, list the macros
+verbosity [lvl] | Show or change how much is printed: "quiet" leaves out other players' minor actions (e.g peeks and draws), "normal" or "verbose"
+a; b; c         | Run several commands one after another, e.g "create default; draw 5". Each one runs after the server has replied to the one before it
+help            | Show the currently-available commands and basic instructions. Shows different info while in-game.
+quit            | Quit netdeck
+=======================================================================================================================
+
+`)
+
+		} else if cmdStr == "create" {
+			if len(inputTokens) < 2 {
+				fmt.Fprintln(clientOutput, "The 'create' command requires one argument specifying the game name. You can enter the name of 'default' to get a generic 52-card deck")
+				return
+			}
+			public := false
+			seeded := false
+			var seed int64 = 0
+			for argIndex := 2; argIndex < len(inputTokens); argIndex++ {
+				arg := strings.ToLower(inputTokens[argIndex])
+				if arg == "public" {
+					public = true
+				} else if (arg == "--seed") && (argIndex+1 < len(inputTokens)) {
+					var err error
+					seed, err = strconv.ParseInt(inputTokens[argIndex+1], 10, 64)
+					if err != nil {
+						printError("Error! Failed to parse the seed for '%s': %s\n", cmdStr, err)
+						return
+					}
+					seeded = true
+					argIndex++
+				} else {
+					printError("Error! Unrecognised argument '%s' for '%s'. Expected \"public\" or \"--seed n\"\n", inputTokens[argIndex], cmdStr)
+					return
+				}
+			}
+			if len(inputTokens[1]) > protocol.MaxGameNameLength {
+				fmt.Fprintf(clientOutput, "Game names can be at most %d characters long\n", protocol.MaxGameNameLength)
+				return
+			}
+
+			var spec []byte
+			if inputTokens[1] == "default" {
+				spec = DefaultSerializedGameSpec()
+			} else if builtinSpec := FindBuiltinSpec(inputTokens[1]); builtinSpec != nil {
+				var err error
+				spec, err = SerialiseSpecFromSpec(builtinSpec)
+				if err != nil {
+					printError("Error creating built-in game specification: %s\n", err)
+					return
+				}
+			} else {
+				var err error
+				spec, err = SerialiseSpecFromName(inputTokens[1])
+				if err != nil {
+					printError("Error reading local game specification: %s\n", err)
+					return
+				}
+			}
+			if len(spec) > protocol.MaxGameCreateSpecDataLength {
+				fmt.Fprintf(clientOutput, "Game spec for '%s' is %d bytes, which is larger than the max allowed %d bytes\n",
+					inputTokens[1], len(spec), protocol.MaxGameCreateSpecDataLength)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_GAME_CREATE, uint16(protocol.GameCreateCommandLength(len(inputTokens[1]), len(spec))))
+			cmd := protocol.GameCreateCommand{
+				Name:     inputTokens[1],
+				Public:   public,
+				Seeded:   seeded,
+				Seed:     seed,
+				SpecData: spec,
+			}
+			protocol.SerialiseGameCreateCommand(buffer[headerLen:], &cmd, false)
+
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+			fmt.Fprintf(clientOutput, "Sent game creation for '%s'...\n", inputTokens[1])
+
+		} else if cmdStr == "games" {
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_INFO_GAMES, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "join" {
+			// Anything that isn't a game ID is taken to be a join code, which may have been typed with spaces instead of dashes
+			cmd := protocol.GameJoinCommand{GameId: 0, JoinCode: ""}
+			gameId, err := parseInputUint64(inputTokens[1:])
+			if err == nil {
+				cmd.GameId = gameId
+			} else {
+				cmd.JoinCode = normaliseJoinCode(strings.Join(inputTokens[1:], " "))
+				if (len(cmd.JoinCode) == 0) || (len(cmd.JoinCode) > protocol.MaxJoinCodeLength) {
+					printError("Error! Failed to parse arguments for '%s': Expected a game ID or join code\n", cmdStr)
+					return
+				}
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_GAME_JOIN, uint16(cmd.CommandLength()))
+			protocol.SerialiseGameJoinCommand(buffer[headerLen:], &cmd, false)
+			err = session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "rename" {
+			if len(inputTokens) != 2 {
+				printError("Error! The '%s' command requires exactly one argument specifying your new name\n", cmdStr)
+				return
+			}
+			cmd := protocol.SetNameCommand{Name: inputTokens[1]}
+			if !protocol.IsValidPlayerName(cmd.Name) {
+				printError("Error! Names can be at most %d characters long and cannot contain any spaces\n", protocol.MaxPlayerNameLength)
+				return
+			}
+
+			buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_SET_NAME, uint16(cmd.CommandLength()))
+			protocol.SerialiseSetNameCommand(buffer[headerLen:], &cmd, false)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else if cmdStr == "quit" {
+			quitRequested = true
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_DISCONNECT, 0)
+			err := session.SendCommandBuffer(buffer)
+			if err != nil {
+				printError("Error! Failed to send '%s' command to the server: %s\n", cmdStr, err)
+			}
+
+		} else {
+			fmt.Fprintf(clientOutput, "Unrecognised command: '%s', enter 'help' for a list of available commands\n", inputLine)
+		}
+	}
+}
+
+// Runs each of the commands in the given macro (the first argument) as if it had been entered, with the rest of the
+// arguments as the macro's parameters. The commands are all sent straight away, without waiting for the server to
+// respond to the earlier ones.
+func runMacro(args []string, session *client.Session, game *GameState, inGame bool, localPlayer *PlayerState) {
+	if len(args) == 0 {
+		if len(clientMacros) == 0 {
+			fmt.Fprintln(clientOutput, "There are no macros, load some from a file by starting netdeck with --macros <file>")
+			return
+		}
+		fmt.Fprintln(clientOutput, "Macros:")
+		for _, macro := range clientMacros {
+			fmt.Fprintf(clientOutput, "  - %s: %s\n", macro.Name, strings.Join(macro.Commands, ", "))
+		}
+		return
+	}
+
+	macro := FindMacro(clientMacros, args[0])
+	if macro == nil {
+		printError("Error! There is no macro named '%s', enter 'run' for a list of the macros\n", args[0])
+		return
+	}
+	commands, err := macro.Expand(args[1:])
+	if err != nil {
+		printError("Error! Failed to run macro '%s': %s\n", macro.Name, err)
+		return
+	}
+	for _, command := range commands {
+		fmt.Fprintf(clientOutput, "> %s\n", command)
+		handleInputFromStdin(command, session, game, inGame, localPlayer)
+	}
+}
+
+type ClientConfig struct {
+	PlayerName string // The name to play as, or empty to ask the player for one
+	ServerHost string // The address of the server to connect to
+	RelayCode  string // The code of the server to connect to through the relay at ServerHost, or empty to not use a relay
+
+	// The spec (a local spec file's name or a built-in spec) of a game to play alone on a server run inside the client,
+	// instead of connecting to ServerHost. Empty to connect to ServerHost as usual.
+	SoloSpec string
+
+	IgnoreAccents bool   // Whether card and player names match regardless of accents, see matchIgnoringAccents
+	NoColour      bool   // Whether colours are turned off even if the terminal supports them
+	MacroFile     string // The file to load macros from for 'run', or empty to not load any
+	LogFile       string // The file to append a transcript of everything the client prints to, or empty to not keep one
+
+	// Whether to send desktop notifications as well as ringing the bell when it becomes the player's turn, they are
+	// given or shown cards, or a message mentions them
+	DesktopNotifications bool
+
+	Verbosity Verbosity // How much the client prints about what is happening, which can be changed with 'verbosity'
+
+	// Whether to print the commands received from the server as JSON on stdout and read commands to send as JSON from
+	// stdin, instead of the usual text (which is printed on stderr instead). See jsonOutputEnabled.
+	JSON bool
+}
+
+// Connects to the server at the given address, through the relay there if relayCode isn't empty. The handshake still
+// needs to be sent.
+func connectToServer(serverAddress string, relayCode string) (*client.Session, error) {
+	session, err := client.Dial(serverAddress + ":43831")
+	if err != nil {
+		return nil, err
+	}
+	if len(relayCode) > 0 {
+		// The relay passes everything after this on to the server that is hosting through it, starting with the handshake
+		err = session.ConnectThroughRelay(relayCode)
+		if err != nil {
+			session.Close()
+			return nil, fmt.Errorf("Failed to connect through the relay: %w", err)
+		}
+	}
+	return session, nil
+}
+
+func runClient(config ClientConfig) {
+	playerName := config.PlayerName
+	serverHost := config.ServerHost
+	relayCode := config.RelayCode
+	macroFilePath := config.MacroFile
+	solo := (len(config.SoloSpec) > 0)
+	matchIgnoringAccents = config.IgnoreAccents
+	colourEnabled = !config.NoColour && !config.JSON && colourSupported()
+	desktopNotificationsEnabled = config.DesktopNotifications
+	clientVerbosity = config.Verbosity
+	jsonOutputEnabled = config.JSON
+
+	// Stdout is left for the JSON commands when using JSON
+	textOutput := io.Writer(os.Stdout)
+	if jsonOutputEnabled {
+		textOutput = os.Stderr
+	}
+	clientOutput = textOutput
+	defer func() {
+		clientOutput = os.Stdout
+	}()
+
+	var transcript *Transcript = nil
+	if len(config.LogFile) > 0 {
+		var err error
+		transcript, err = OpenTranscript(config.LogFile)
+		if err != nil {
+			printError("Error! Failed to open the log file '%s': %s\n", config.LogFile, err)
+			return
+		}
+		clientOutput = io.MultiWriter(textOutput, transcript)
+		hiddenOutput = transcript
+		defer func() {
+			hiddenOutput = ioutil.Discard
+			transcript.Close()
+		}()
+	}
+
+	if len(macroFilePath) > 0 {
+		macros, err := LoadMacros(macroFilePath)
+		if err != nil {
+			printError("Error! Failed to load macros from '%s': %s\n", macroFilePath, err)
+			return
+		}
+		clientMacros = macros
+		fmt.Fprintf(clientOutput, "Loaded %d macros from '%s'\n", len(macros), macroFilePath)
+	}
+	var lineEditor *LineEditor = nil
+	if !jsonOutputEnabled {
+		lineEditor = NewLineEditor(os.Stdin)
+		defer lineEditor.Close()
+	}
+	if solo && (len(playerName) == 0) {
+		playerName = DefaultSoloPlayerName
+	}
+	if (len(playerName) == 0) && jsonOutputEnabled {
+		printError("Error! A name must be given with --name when using --json\n")
+		return
+	} else if len(playerName) == 0 {
+		for len(playerName) == 0 {
+			var err error
+			playerName, err = lineEditor.ReadLine("Please enter your name: ")
+			if err != nil {
+				fmt.Fprintln(clientOutput, "FAILED TO GET NAME FROM STDIN", err)
+				return
+			}
+			playerName = strings.TrimSpace(playerName)
+			if (len(playerName) > 0) && !protocol.IsValidPlayerName(playerName) {
+				fmt.Fprintf(clientOutput, "Sorry, but your alias/name on this service cannot contain any spaces or be longer than %d characters. Please enter a different name.\n", protocol.MaxPlayerNameLength)
+				playerName = ""
+				continue
+			}
+			fmt.Fprintf(clientOutput, "Playername = %s\n", playerName)
+		}
+
+	} else if !protocol.IsValidPlayerName(playerName) {
+		fmt.Fprintf(clientOutput, "Sorry, but your alias/name on this service cannot contain any spaces or be longer than %d characters. Please choose a different name with --name.\n", protocol.MaxPlayerNameLength)
+		return
+	}
+
+	var session *client.Session
+	var err error
+	if solo {
+		fmt.Fprintln(clientOutput, "Starting a server to play alone on...")
+		session, err = startSoloSession()
+		if err != nil {
+			printError("ERROR STARTING SOLO SERVER: %s\n", err)
+			return
+		}
+	} else {
+		fmt.Fprintln(clientOutput, "Connecting to "+serverHost+"...")
+		relayCode = normaliseJoinCode(relayCode)
+		session, err = connectToServer(serverHost, relayCode)
+		if err != nil {
+			// TODO: Direct people to some form of contact for me, or that they can host their own server too (--server), if you know how to do that and have the infrastructure
+			printError("ERROR CONNECTING TO SERVER: %s\n", err)
+			return
+		}
+	}
+
+	// Sessions and identities belong to the server being relayed to, not to the relay itself
+	serverAddress := serverHost
+	if !solo && (len(relayCode) > 0) {
+		serverHost += "/" + relayCode
+	}
+
+	// The solo server only lasts as long as the client does, so there is never anything to resume or an identity to keep
+	var resumeToken uint64 = 0
+	var identityToken []byte = nil
+	if !solo {
+		resumeToken = loadResumeToken(serverHost)
+		if resumeToken != 0 {
+			fmt.Fprintln(clientOutput, "Found a previous session for this server, you will rejoin your game if it is still waiting for you")
+		}
+		identityToken = loadIdentityToken(serverHost)
+	}
+	err = session.Handshake(playerName, resumeToken, identityToken)
+	if err != nil {
+		fmt.Fprintf(clientOutput, "Failed to send handshake to the server, disconnecting: %s\n", err)
+		session.Close()
+		return
+	}
+
+	// Only one of these channels is used, depending on whether input is read as JSON or as text
+	stdInChan := make(chan string)
+	jsonInChan := make(chan []byte)
+	keepAliveTicker := time.NewTicker(protocol.KeepAliveInterval)
+	if jsonOutputEnabled {
+		go clientReadJSONInput(jsonInChan)
+	} else {
+		lineEditor.SetPrompt(inputPrompt(nil, false, nil, playerName, true))
+		go clientReadConsoleInput(lineEditor, stdInChan)
+	}
+
+	game := GameState{}
+	inGame := false
+	var localPlayer *PlayerState = nil
+	var localPlayerId uint64 = 0
+
+	// While the client is waiting to reconnect, sessionCommands is nil (so nothing is received from it) and
+	// reconnectTimer fires when it is time for the next attempt
+	sessionCommands := session.Commands()
+	var reconnectTimer <-chan time.Time = nil
+	reconnectDelay := InitialReconnectDelay
+	reconnectAttempts := 0
+	reconnected := false
+	serverShuttingDown := false
+	chain := CommandChain{}
+
+	fmt.Fprintln(clientOutput, "Connected successfully. Waiting for handshake response...")
+	for {
+		shouldQuit := false
+		chainReplyReceived := false
+		select {
+		case <-keepAliveTicker.C:
+			lineEditor.Hide()
+			if sessionCommands == nil {
+				break
+			}
+			buffer, _ := protocol.WriteCommandHeader(protocol.CMD_KEEPALIVE, 0)
+			err := session.SendCommandBuffer(buffer)
+			if (err != nil) && (clientVerbosity > VERBOSITY_QUIET) {
+				printError("Error! Failed to send keep-alive packet to the server: %s\n", err)
+			}
+
+		case inputLine := <-stdInChan:
+			lineEditor.Hide()
+			if transcript != nil {
+				transcript.WriteInput(inputLine)
+			}
+			if sessionCommands == nil {
+				if strings.TrimSpace(inputLine) == "quit" {
+					shouldQuit = true
+				} else {
+					printError("Error! Not connected to the server, please wait for the client to reconnect (or enter 'quit')\n")
+				}
+				break
+			}
+			chain.Add(inputLine)
+			chain.Run(session, &game, inGame, localPlayer)
+
+		case <-chain.timeout:
+			lineEditor.Hide()
+			chain.StopWaiting()
+			chain.Run(session, &game, inGame, localPlayer)
+
+		case line, ok := <-jsonInChan:
+			if !ok {
+				// Scripts stop the client by closing its input
+				jsonInChan = nil
+				if sessionCommands != nil {
+					quitRequested = true
+					buffer, _ := protocol.WriteCommandHeader(protocol.CMD_DISCONNECT, 0)
+					session.SendCommandBuffer(buffer)
+				}
+				shouldQuit = true
+				break
+			}
+			if transcript != nil {
+				transcript.WriteInput(string(line))
+			}
+			if sessionCommands == nil {
+				os.Stdout.Write(protocol.InputErrorJSON(protocol.CMD_UNKNOWN, protocol.ERROR_NOT_PERMITTED, "Not connected to the server, waiting to reconnect"))
+				break
+			}
+			sendJSONCommand(line, session)
+
+		case <-reconnectTimer:
+			lineEditor.Hide()
+			reconnectTimer = nil
+			reconnectAttempts++
+			newSession, err := connectToServer(serverAddress, relayCode)
+			if err == nil {
+				err = newSession.Handshake(playerName, resumeToken, identityToken)
+				if err != nil {
+					newSession.Close()
+				}
+			}
+			if err != nil {
+				if reconnectAttempts >= MaxReconnectAttempts {
+					printError("ERROR: Failed to reconnect to the server after %d attempts: %s\n", reconnectAttempts, err)
+					shouldQuit = true
+					break
+				}
+				reconnectDelay *= 2
+				if reconnectDelay > MaxReconnectDelay {
+					reconnectDelay = MaxReconnectDelay
+				}
+				fmt.Fprintf(clientOutput, "Failed to reconnect (%s), trying again in %s...\n", err, reconnectDelay)
+				reconnectTimer = time.After(reconnectDelay)
+				break
+			}
+			session = newSession
+			sessionCommands = session.Commands()
+			reconnected = true
+			fmt.Fprintln(clientOutput, "Reconnected. Waiting for handshake response...")
+
+		case cmdContainer, ok := <-sessionCommands:
+			lineEditor.Hide()
+			if !ok && (quitRequested || solo || serverShuttingDown) {
+				if !quitRequested {
+					printError("ERROR: Lost the connection to the server: %s\n", session.Err())
+				}
+				shouldQuit = true
+				break
+			} else if !ok {
+				// The game will be resumed with the resume token from the last handshake, as long as the server notices
+				// that the old connection has dropped before the client reconnects
+				printError("ERROR: Lost the connection to the server: %s\n", session.Err())
+				chain.Clear()
+				session.Close()
+				sessionCommands = nil
+				reconnectDelay = InitialReconnectDelay
+				reconnectAttempts = 0
+				fmt.Fprintf(clientOutput, "Trying to reconnect in %s...\n", reconnectDelay)
+				reconnectTimer = time.After(reconnectDelay)
+				break
+			}
+			// Checked before the command is handled, since handling it can change the local player (e.g when joining a game)
+			chainReplyReceived = chain.IsReply(cmdContainer, localPlayer)
+			cmdId := cmdContainer.Header.Id
+			if clientVerbosity >= VERBOSITY_VERBOSE {
+				fmt.Fprintf(clientOutput, "Received %s (%d bytes) from the server\n", protocol.CommandName(cmdId), len(cmdContainer.Payload))
+			}
+			if jsonOutputEnabled {
+				printCommandJSON(cmdContainer)
+			}
+			switch cmdId {
+			case protocol.CMD_HANDSHAKE_RESPONSE:
+				var cmd protocol.HandshakeResponseCommand
+				protocol.SerialiseHandshakeResponseCommand(cmdContainer.Payload, &cmd, true)
+				wasReconnect := reconnected
+				if reconnected {
+					// The server sends the whole state of the game again if the player got their place back
+					reconnected = false
+					if inGame && (cmd.PlayerId != localPlayerId) {
+						printError("ERROR: Your place in the game was not kept while you were disconnected, so you are back in the menu\n")
+					}
+					inGame = false
+					game = GameState{}
+					localPlayer = nil
+				}
+				localPlayerId = cmd.PlayerId
+				resumeToken = cmd.ResumeToken
+				if solo {
+					fmt.Fprintln(clientOutput, "Handshake completed successfully. Type 'help' (without the quotes) to see a list of possible commands")
+					fmt.Fprintln(clientOutput, "You are playing alone, but you can add players controlled by the server with 'addbot'")
+					handleInputFromStdin("create "+config.SoloSpec, session, &game, inGame, localPlayer)
+					break
+				}
+				saveResumeToken(serverHost, cmd.ResumeToken)
+				if !bytes.Equal(cmd.IdentityToken, identityToken) {
+					saveIdentityToken(serverHost, cmd.IdentityToken)
+					identityToken = cmd.IdentityToken
+				}
+				if wasReconnect {
+					fmt.Fprintln(clientOutput, "Handshake completed successfully, you are back on the server")
+					break
+				}
+				fmt.Fprintln(clientOutput, "Handshake completed successfully. Type 'help' (without the quotes) to see a list of possible commands")
+
+			case protocol.CMD_SET_NAME_RESPONSE:
+				var cmd protocol.SetNameCommand
+				err := protocol.SerialiseSetNameCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid SetNameCommand: %s - %+v - %+v\n", err, cmd, cmdContainer.Payload)
+					break
+				}
+				playerName = cmd.Name
+				fmt.Fprintf(clientOutput, "You are now known as '%s'\n", playerName)
+
+			case protocol.CMD_INFO_PLAYERS_RESPONSE:
+				var cmd protocol.PlayerInfoResponseCommand
+				err := protocol.SerialisePlayerInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid PlayerInfoResponseCommand: %s - %+v - %+v\n", err, cmd, cmdContainer.Payload)
+				}
+				diverged := (len(cmd.Ids) != len(game.Players))
+				fmt.Fprint(clientOutput, "Players:\n")
+				for i := 0; i < len(cmd.Ids); i++ {
+					fmt.Fprintf(clientOutput, "  %s  %d cards in-hand", cmd.Names[i], cmd.HandSizes[i])
+					if cmd.Ids[i] == game.OwnerId {
+						fmt.Fprint(clientOutput, "  (owner)")
+					}
+					if cmd.Ids[i] == localPlayer.Id {
+						fmt.Fprintln(clientOutput, "  <-- This is you")
+					} else {
+						fmt.Fprintln(clientOutput)
+					}
+					if cmd.HandRevealed[i] {
+						fmt.Fprintln(clientOutput, "    Revealed hand:")
+						for _, cardId := range cmd.RevealedHands[i] {
+							fmt.Fprintf(clientOutput, "      - %s\n", displayCardName(&game, cardId))
+						}
+					} else if len(cmd.RevealedHands[i]) > 0 {
+						fmt.Fprintln(clientOutput, "    Face-up cards in hand:")
+						for _, cardId := range cmd.RevealedHands[i] {
+							fmt.Fprintf(clientOutput, "      - %s\n", displayCardName(&game, cardId))
+						}
+					}
+					if !diverged && (cmd.Ids[i] != game.Players[i].Id) {
+						diverged = true
+					}
+				}
+				if diverged {
+					printError("ERROR: Local view of the players in the game has diverged from the server. This is a bug, type 'sync' to fix it.\n")
+				}
+
+			case protocol.CMD_INFO_GAMES_RESPONSE:
+				var cmd protocol.GameInfoResponseCommand
+				err := protocol.SerialiseGameInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid GameInfoResponseCommand: %s - %+v - %+v\n", err, cmd, cmdContainer.Payload)
+					break
+				}
+				if len(cmd.GameIds) == 0 {
+					fmt.Fprintln(clientOutput, "There are no public games to join. You can create one with 'create <name> public'")
+					break
+				}
+				fmt.Fprint(clientOutput, "Public games:\n")
+				for i := 0; i < len(cmd.GameIds); i++ {
+					fmt.Fprintf(clientOutput, "  %d  %s  %d player(s), owned by %s\n", cmd.GameIds[i], cmd.Names[i], cmd.PlayerCounts[i], cmd.OwnerNames[i])
+				}
+				fmt.Fprintln(clientOutput, "Use 'join <game-id>' to join one of them")
+
+			case protocol.CMD_INFO_DECKS_RESPONSE:
+				var cmd protocol.DeckInfoResponseCommand
+				protocol.SerialiseDeckInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if len(cmd.Ids) == 1 {
+					fmt.Fprintf(clientOutput, "The deck contains %d cards\n", cmd.CardCounts[0])
+					if cmd.TopCardIds[0] != protocol.CARD_ID_NONE {
+						fmt.Fprintf(clientOutput, "The card on top of the deck is face-up: %s\n", displayCardName(&game, cmd.TopCardIds[0]))
+					}
+					break
+				}
+				fmt.Fprintln(clientOutput, "Decks in this game:")
+				for index, deckId := range cmd.Ids {
+					fmt.Fprintf(clientOutput, "  - %s: %d cards\n", game.spec.DeckName(deckId), cmd.CardCounts[index])
+					if cmd.TopCardIds[index] != protocol.CARD_ID_NONE {
+						fmt.Fprintf(clientOutput, "      The card on top is face-up: %s\n", displayCardName(&game, cmd.TopCardIds[index]))
+					}
+				}
+
+			case protocol.CMD_INFO_CARDS_RESPONSE:
+				var cmd protocol.CardInfoResponseCommand
+				protocol.SerialiseCardInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				diverged := (len(cmd.Ids) != len(localPlayer.Hand))
+				localPlayer.FaceUpCards = cmd.FaceUpIds
+				if len(cmd.Ids) == 0 {
+					fmt.Fprintln(clientOutput, "You have no cards in your hand")
+				} else if showHandGrouped {
+					fmt.Fprintln(clientOutput, "Cards in your hand:")
+					printGroupedHand(&game, localPlayer, cmd.Ids)
+				} else {
+					fmt.Fprintln(clientOutput, "Cards in your hand:")
+					for _, cardId := range cmd.Ids {
+						if localPlayer.IsFaceUp(cardId) {
+							fmt.Fprintf(clientOutput, "  - %s  (face-up)\n", displayCardName(&game, cardId))
+						} else {
+							fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+						}
+					}
+				}
+				for cardIndex, cardId := range cmd.Ids {
+					if !diverged && (cardId != localPlayer.Hand[cardIndex]) {
+						diverged = true
+					}
+				}
+				showHandGrouped = false
+				if diverged {
+					printError("ERROR: Local view of the cards in your hand has diverged from the server. This is a bug, type 'sync' to fix it.\n")
+				}
+
+			case protocol.CMD_INFO_DISCARDS_RESPONSE:
+				var cmd protocol.CardInfoResponseCommand
+				protocol.SerialiseCardInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if len(cmd.Ids) == 0 {
+					fmt.Fprintln(clientOutput, "The discard pile is empty")
+				} else {
+					fmt.Fprintln(clientOutput, "Cards in the discard pile, from top to bottom:")
+					for _, cardId := range cmd.Ids {
+						if cardId == protocol.CARD_ID_ANY {
+							fmt.Fprintln(clientOutput, "  - <face-down card>")
+						} else {
+							fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+						}
+					}
+				}
+
+			case protocol.CMD_INFO_TABLE_RESPONSE:
+				var cmd protocol.CardInfoResponseCommand
+				protocol.SerialiseCardInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if len(cmd.Ids) == 0 {
+					fmt.Fprintln(clientOutput, "There are no cards on the table")
+				} else {
+					fmt.Fprintln(clientOutput, "Cards on the table:")
+					for _, cardId := range cmd.Ids {
+						fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+					}
+				}
+
+			case protocol.CMD_INFO_MARKET_RESPONSE:
+				var cmd protocol.CardInfoResponseCommand
+				protocol.SerialiseCardInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if len(cmd.Ids) == 0 {
+					fmt.Fprintln(clientOutput, "There are no cards in the market")
+				} else {
+					fmt.Fprintln(clientOutput, "Cards in the market:")
+					for _, cardId := range cmd.Ids {
+						fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+					}
+				}
+
+			case protocol.CMD_INFO_ROLE_RESPONSE:
+				var cmd protocol.CardInfoResponseCommand
+				protocol.SerialiseCardInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if len(cmd.Ids) == 0 {
+					fmt.Fprintln(clientOutput, "You have not been dealt a role")
+				} else {
+					fmt.Fprintf(clientOutput, "Your secret role is %s\n", displayCardName(&game, cmd.Ids[0]))
+				}
+
+			case protocol.CMD_INFO_CARD_TYPES_RESPONSE:
+				var cmd protocol.CardTypeInfoResponseCommand
+				protocol.SerialiseCardTypeInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if len(cmd.Types) == 0 {
+					fmt.Fprintln(clientOutput, "This game's specification does not give any cards a type")
+				} else {
+					fmt.Fprintf(clientOutput, "Cards left in %s of each type:\n", describeDeck(&game, 0))
+					for i, cardType := range cmd.Types {
+						fmt.Fprintf(clientOutput, "  %s: %d\n", cardType, cmd.DeckCounts[i])
+					}
+				}
+
+			case protocol.CMD_INFO_TABLEAUS_RESPONSE:
+				var cmd protocol.TableauInfoResponseCommand
+				err := protocol.SerialiseTableauInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid TableauInfoResponseCommand: %s\n", err)
+					break
+				}
+				fmt.Fprintln(clientOutput, "Tableaus:")
+				for i, playerId := range cmd.PlayerIds {
+					playerName := "<unknown>"
+					if playerIndex := game.FindPlayer(playerId); playerIndex >= 0 {
+						playerName = game.Players[playerIndex].Name
+					}
+					if len(cmd.CardIds[i]) == 0 {
+						fmt.Fprintf(clientOutput, "  %s: (empty)\n", playerName)
+						continue
+					}
+					cardNames := make([]string, 0, len(cmd.CardIds[i]))
+					for _, cardId := range cmd.CardIds[i] {
+						cardNames = append(cardNames, displayCardName(&game, cardId))
+					}
+					fmt.Fprintf(clientOutput, "  %s: %s\n", playerName, strings.Join(cardNames, ", "))
+				}
+
+			case protocol.CMD_INFO_SCORES_RESPONSE:
+				var cmd protocol.ScoreInfoResponseCommand
+				err := protocol.SerialiseScoreInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid ScoreInfoResponseCommand: %s\n", err)
+					break
+				}
+				if len(cmd.PlayerNames) == 0 {
+					fmt.Fprintln(clientOutput, "No scores have been recorded yet")
+					break
+				}
+
+				playerNames := make([]string, 0)
+				playerRounds := make(map[string][]int64)
+				maxRounds := 0
+				for i, playerName := range cmd.PlayerNames {
+					if _, ok := playerRounds[playerName]; !ok {
+						playerNames = append(playerNames, playerName)
+					}
+					playerRounds[playerName] = append(playerRounds[playerName], cmd.Values[i])
+					if len(playerRounds[playerName]) > maxRounds {
+						maxRounds = len(playerRounds[playerName])
+					}
+				}
+
+				nameWidth := len("Player")
+				for _, playerName := range playerNames {
+					if len(playerName) > nameWidth {
+						nameWidth = len(playerName)
+					}
+				}
+				header := fmt.Sprintf("  %-*s", nameWidth, "Player")
+				for round := 1; round <= maxRounds; round++ {
+					header += fmt.Sprintf(" %6s", fmt.Sprintf("R%d", round))
+				}
+				fmt.Fprintf(clientOutput, "%s | %6s\n", header, "Total")
+				for _, playerName := range playerNames {
+					row := fmt.Sprintf("  %-*s", nameWidth, playerName)
+					total := int64(0)
+					for round := 0; round < maxRounds; round++ {
+						if round < len(playerRounds[playerName]) {
+							row += fmt.Sprintf(" %6d", playerRounds[playerName][round])
+							total += playerRounds[playerName][round]
+						} else {
+							row += fmt.Sprintf(" %6s", "-")
+						}
+					}
+					fmt.Fprintf(clientOutput, "%s | %6d\n", row, total)
+				}
+
+			case protocol.CMD_INFO_COUNTERS_RESPONSE:
+				var cmd protocol.CounterInfoResponseCommand
+				err := protocol.SerialiseCounterInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid CounterInfoResponseCommand: %s\n", err)
+					break
+				}
+				if len(cmd.PlayerIds) == 0 {
+					fmt.Fprintln(clientOutput, "Nobody has any counters")
+					break
+				}
+				fmt.Fprintln(clientOutput, "Counters:")
+				for _, p := range game.Players {
+					counterList := ""
+					for i, playerId := range cmd.PlayerIds {
+						if playerId != p.Id {
+							continue
+						}
+						if len(counterList) > 0 {
+							counterList += ", "
+						}
+						counterList += fmt.Sprintf("%s=%d", cmd.CounterNames[i], cmd.Values[i])
+					}
+					if len(counterList) > 0 {
+						fmt.Fprintf(clientOutput, "  %s: %s\n", p.Name, counterList)
+					}
+				}
+
+			case protocol.CMD_INFO_EVENTS_RESPONSE:
+				var cmd protocol.EventInfoResponseCommand
+				err := protocol.SerialiseEventInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid EventInfoResponseCommand: %s\n", err)
+					break
+				}
+				if len(cmd.Timestamps) == 0 {
+					fmt.Fprintln(clientOutput, "Nothing has happened in this game yet")
+				} else {
+					fmt.Fprintln(clientOutput, "Recent events in the game:")
+					for i, timestamp := range cmd.Timestamps {
+						eventTime := time.Unix(int64(timestamp), 0).Format("15:04:05")
+						event := protocol.NewPlayerActionNotify(protocol.PLAYER_ID_NONE, cmd.CmdIds[i], protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, cmd.TargetCardIds[i])
+						event.TargetStrings = cmd.TargetStrings[i]
+						eventStr := describeGameEvent(&game, localPlayer, cmd.PlayerNames[i], cmd.TargetPlayerNames[i], &event)
+						eventStr = colourText(playerColour(cmd.PlayerNames[i] == localPlayer.Name), eventStr)
+						fmt.Fprintf(clientOutput, "  [%s] %s\n", eventTime, eventStr)
+					}
+				}
+
+			case protocol.CMD_INFO_HISTORY_RESPONSE:
+				var cmd protocol.HistoryInfoResponseCommand
+				err := protocol.SerialiseHistoryInfoResponseCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid HistoryInfoResponseCommand: %s\n", err)
+					break
+				}
+				if cmd.FirstIndex == 0 {
+					if (len(cmd.Timestamps) == 0) && (cmd.Remaining == 0) {
+						fmt.Fprintln(clientOutput, "Nothing has happened in this game yet")
+					} else {
+						fmt.Fprintln(clientOutput, "Everything that has happened in the game:")
+					}
+				}
+				for i, timestamp := range cmd.Timestamps {
+					eventTime := time.Unix(int64(timestamp), 0).Format("15:04:05")
+					event := protocol.NewPlayerActionNotify(protocol.PLAYER_ID_NONE, cmd.CmdIds[i], cmd.TargetDeckIds[i], protocol.PLAYER_ID_NONE, cmd.TargetCardIds[i])
+					event.TargetStrings = cmd.TargetStrings[i]
+					eventStr := describeGameEvent(&game, localPlayer, cmd.PlayerNames[i], cmd.TargetPlayerNames[i], &event)
+					if cmd.Private[i] {
+						eventStr += " (only you were told this)"
+					}
+					eventStr = colourText(playerColour(cmd.PlayerNames[i] == localPlayer.Name), eventStr)
+					fmt.Fprintf(clientOutput, "  %4d [%s] %s\n", cmd.FirstIndex+uint64(i)+1, eventTime, eventStr)
+				}
+
+			case protocol.CMD_SYNC_RESPONSE:
+				var cmd protocol.SyncResponseCommand
+				err := protocol.SerialiseSyncResponseCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid SyncResponseCommand: %s\n", err)
+					break
+				}
+				localPlayerId := localPlayer.Id
+				game.Players = make([]*PlayerState, len(cmd.PlayerIds))
+				for i := 0; i < len(cmd.PlayerIds); i++ {
+					player := PlayerState{
+						cmd.PlayerIds[i],
+						nil,
+						cmd.PlayerNames[i],
+						makeFilledIdSlice(int(cmd.HandSizes[i]), protocol.CARD_ID_ANY),
+						&game,
+						make(map[string]int64),
+						cmd.TableauIds[i],
+						false,
+						make([]uint16, 0),
+						0,
+						false,
+						false,
+						0,
+						nil,
+						nil,
+					}
+					if player.Id == localPlayerId {
+						player.Hand = cmd.Hand
+						player.FaceUpCards = cmd.FaceUpIds
+						player.HandRevealed = cmd.HandRevealed
+						localPlayer = &player
+					}
+					game.Players[i] = &player
+				}
+				game.Decks = make([][]uint16, len(cmd.DeckSizes))
+				for deckId, deckSize := range cmd.DeckSizes {
+					game.Decks[deckId] = makeFilledIdSlice(int(deckSize), protocol.CARD_ID_ANY)
+				}
+				game.DiscardPile = make([]DiscardedCard, 0, len(cmd.DiscardIds))
+				for i := len(cmd.DiscardIds) - 1; i >= 0; i-- {
+					game.AddToDiscardPile(cmd.DiscardIds[i], cmd.DiscardIds[i] != protocol.CARD_ID_ANY)
+				}
+				game.Table = cmd.TableIds
+				game.Market = cmd.MarketIds
+				game.OwnerId = cmd.OwnerId
+				game.TurnPlayerId = cmd.TurnPlayerId
+				fmt.Fprintf(clientOutput, "Your view of the game is now up to date: %d players, %d cards in your hand\n", len(game.Players), len(localPlayer.Hand))
+
+			case protocol.CMD_NOTIFY_GAME_JOINED:
+				var cmd protocol.NotifyGameJoinedCommand
+				protocol.SerialiseNotifyGameJoinedCommand(cmdContainer.Payload, &cmd, true)
+
+				if inGame {
+					// A new player (that isn't us) has joined the game
+					newPlayerCount := len(cmd.PlayerIds)
+					for i := 0; i < newPlayerCount; i++ {
+						newPlayer := NewPlayerState(cmd.PlayerIds[i], cmd.PlayerNames[i], &game)
+						err := game.AddPlayer(&newPlayer)
+						if err != nil {
+							printError("ERROR: Failed to add %s to the game: %s\n", newPlayer.Name, err)
+							continue
+						}
+						fmt.Fprintf(clientOutput, "%s has joined the game\n", newPlayer.Name)
+					}
+
+				} else {
+					// We just joined a game, set it up
+					spec, err := NewSpec(cmd.SpecData)
+					if err == ErrUnsupportedSpecVersion {
+						fmt.Fprintln(clientOutput, "Failed to join the game because its specification was written for a newer version of netdeck. Please update netdeck and try again.")
+						shouldQuit = true
+						break
+					} else if err != nil {
+						fmt.Fprintf(clientOutput, "Failed to create local game tracker from spec: %s\n", err)
+						shouldQuit = true
+						break
+					}
+					game = CreateGameFromSpec(spec)
+					game.Id = cmd.GameId
+					game.JoinCode = cmd.JoinCode
+					game.OwnerId = cmd.OwnerId
+					for deckId, deckSize := range cmd.DeckSizes {
+						if deckId < len(game.Decks) {
+							game.Decks[deckId] = makeFilledIdSlice(int(deckSize), protocol.CARD_ID_ANY)
+						}
+					}
+
+					game.Players = make([]*PlayerState, len(cmd.PlayerIds))
+					for i := 0; i < len(cmd.PlayerIds); i++ {
 						player := PlayerState{
-							cmd.playerIds[i],
+							cmd.PlayerIds[i],
 							nil,
-							cmd.playerNames[i],
-							cmd.playerHands[i],
+							cmd.PlayerNames[i],
+							cmd.PlayerHands[i],
 							&game,
+							make(map[string]int64),
+							make([]uint16, 0),
+							false,
+							make([]uint16, 0),
+							0,
+							false,
+							false,
+							0,
+							nil,
+							nil,
+						}
+						if player.Id == localPlayerId {
+							localPlayer = &player
+						}
+						game.Players[i] = &player
+					}
+					fmt.Fprintf(clientOutput, "Successfully joined a game. Your friends can join using the code %s or the game ID: %d. Type 'help' to get a list of in-game commands.\n", game.JoinCode, game.Id)
+					game.specHash = cmd.SpecHash
+					printSpecFingerprint(&game)
+				}
+				inGame = true
+
+			case protocol.CMD_NOTIFY_INPUT_ERROR:
+				var cmd protocol.NotifyInputErrorCommand
+				protocol.SerialiseNotifyInputErrorCommand(cmdContainer.Payload, &cmd, true)
+				switch cmd.ErrorId {
+				case protocol.ERROR_INVALID_CMD_ID:
+					printError("ERROR: Unsupported command ID %d\n", cmd.CmdId)
+				case protocol.ERROR_INVALID_GAME_ID:
+					if cmd.CmdId == protocol.CMD_RELAY_CONNECT {
+						printError("ERROR: There is no server hosted through that relay with that code\n")
+					} else {
+						printError("ERROR: There is no game with that ID or join code\n")
+					}
+				case protocol.ERROR_INVALID_PLAYER_ID:
+					printError("ERROR: Invalid player ID\n")
+				case protocol.ERROR_INVALID_DECK_ID:
+					printError("ERROR: Invalid deck ID\n")
+				case protocol.ERROR_INVALID_CARD_ID:
+					printError("ERROR: Invalid card ID\n")
+				case protocol.ERROR_INVALID_PLAYER_NAME:
+					printError("ERROR: Invalid player name. All players must have distinct names and cannot share a name with a card\n") // TODO: Redirect to docs for name specifications? This doesn't mention the name requirements (max length, no whitespace)
+				case protocol.ERROR_SERVER_FULL:
+					switch cmd.CmdId {
+					case protocol.CMD_GAME_CREATE:
+						printError("ERROR: The server already has as many games as it allows, so no new games can be created. Please try again later\n")
+					case protocol.CMD_GAME_ADD_BOT:
+						printError("ERROR: The server cannot add any more bots\n")
+					case protocol.CMD_GAME_JOIN:
+						printError("ERROR: That game already has as many players as the server allows\n")
+					default:
+						printError("ERROR: The server you are trying to connect to is full. Please try again later\n") // TODO: Print instructions for hosting your own or contact details or whatever
+					}
+				case protocol.ERROR_NOT_PERMITTED:
+					printError("ERROR: Only the owner of the game can do that\n")
+				case protocol.ERROR_PLAYER_COUNT:
+					switch cmd.CmdId {
+					case protocol.CMD_GAME_START:
+						printError("ERROR: This game needs at least %d players before it can be started\n", game.spec.MinPlayers)
+					case protocol.CMD_GAME_ADD_BOT:
+						printError("ERROR: This game already has as many players as it allows\n")
+					default:
+						printError("ERROR: That game already has as many players as it allows\n")
+					}
+				case protocol.ERROR_RATE_LIMITED:
+					if cmd.CmdId == protocol.CMD_HANDSHAKE {
+						printError("ERROR: There are already too many connections to the server from your network address\n")
+					} else {
+						printError("ERROR: You sent commands to the server too quickly and have been disconnected\n")
+					}
+				case protocol.ERROR_SERVER_SHUTTING_DOWN:
+					printError("ERROR: The server is shutting down, so no new games can be created. Please try again later\n")
+				case protocol.ERROR_UNSUPPORTED_SPEC_VERSION:
+					printError("ERROR: The game specification was written for a newer version of the specification format than the server supports\n")
+				case protocol.ERROR_INVALID_DATA:
+					switch cmd.CmdId {
+					case protocol.CMD_GAME_CREATE:
+						printError("ERROR: Invalid specification provided for the 'create' command\n")
+					case protocol.CMD_CARD_PUTBACK:
+						printError("ERROR: Invalid depth in the deck for 'putback' command\n")
+					case protocol.CMD_RANDOM_ROLL:
+						printError("ERROR: You can roll between 1 and %d dice, each of which must have at least 1 side\n", protocol.MaxRandomRollDiceCount)
+					case protocol.CMD_RANDOM_ROLL_NAMED:
+						printError("ERROR: You can roll between 1 and %d of the dice given in the game's specification\n", protocol.MaxRandomRollDiceCount)
+					case protocol.CMD_TABLE_PUTBACK:
+						printError("ERROR: Invalid depth in the deck for 'tableputback' command\n")
+					case protocol.CMD_DECK_REARRANGE:
+						printError("ERROR: Invalid order for the 'rearrange' command, each position must be given exactly once\n")
+					case protocol.CMD_CARD_ARRANGE_HAND:
+						printError("ERROR: Your hand has changed since you asked to rearrange it, please try again\n")
+					case protocol.CMD_GAME_START:
+						printError("ERROR: The game has already been started\n")
+					case protocol.CMD_GAME_REVEAL_ROLES:
+						printError("ERROR: Nobody has been dealt a role yet\n")
+					case protocol.CMD_TURN_END:
+						printError("ERROR: It is not your turn, or the game has not been started yet\n")
+					case protocol.CMD_TURN_TIMER:
+						printError("ERROR: The turn timer can be at most %d seconds\n", MaxTurnTimeLimitSeconds)
+					case protocol.CMD_POLL_START:
+						printError("ERROR: A poll needs a question and between 2 and %d options, and only one poll can run at a time\n", MaxPollOptionCount)
+					case protocol.CMD_POLL_VOTE:
+						printError("ERROR: There is no poll running, or it does not have that option\n")
+					case protocol.CMD_GAME_ADD_BOT:
+						printError("ERROR: Unrecognised bot strategy\n")
+					case protocol.CMD_CARD_DRAW_UNTIL_TYPE, protocol.CMD_CARD_DISCARD_TYPE:
+						printError("ERROR: No card in this game has that type\n")
+					case protocol.CMD_CARD_TRADE_RESPOND:
+						printError("ERROR: The trade can no longer happen because the other player no longer has the card they offered\n")
+					case protocol.CMD_GAME_UNDO:
+						printError("ERROR: There is nothing to undo, or an undo is already being voted on\n")
+					case protocol.CMD_GAME_UNDO_VOTE:
+						printError("ERROR: Nobody has asked to undo anything\n")
+					case protocol.CMD_CARD_PICKUP:
+						printError("ERROR: This game does not allow searching through the discard pile, you can only pick up the top card\n")
+					case protocol.CMD_GAME_JOIN:
+						printError("ERROR: Failed to join the game because there is already a player or card named '%s'. Use 'rename <newname>' to pick a different name and then join again.\n", playerName)
+					}
+				}
+
+			case protocol.CMD_NOTIFY_PLAYER_ACTION:
+				var cmd protocol.NotifyPlayerActionCommand
+				protocol.SerialiseNotifyPlayerActionCommand(cmdContainer.Payload, &cmd, true)
+				srcPlayerIndex := game.FindPlayer(cmd.PlayerId)
+				if srcPlayerIndex < 0 {
+					fmt.Fprintf(clientOutput, "Received an action notification for unrecognised player ID: %d. Ignoring...\n", cmd.PlayerId)
+					break
+				}
+				srcPlayerName := game.Players[srcPlayerIndex].Name
+				if cmd.PlayerId == localPlayer.Id {
+					srcPlayerName = "You"
+				}
+
+				targetPlayerName := "Everyone"
+				if (cmd.TargetPlayerId != protocol.PLAYER_ID_NONE) && (cmd.TargetPlayerId != protocol.PLAYER_ID_ALL) {
+					targetPlayerIndex := game.FindPlayer(cmd.TargetPlayerId)
+					if targetPlayerIndex < 0 {
+						fmt.Fprintf(clientOutput, "Received an action notification targetting an unknown player ID: %d. Ignoring...\n", cmd.TargetPlayerId)
+						break
+					}
+					if cmd.TargetPlayerId == localPlayer.Id {
+						targetPlayerName = "You"
+					} else {
+						targetPlayerName = game.Players[targetPlayerIndex].Name
+					}
+				}
+
+				// Minor actions are still applied to the game when the verbosity is quiet, they just aren't printed
+				visibleOutput := clientOutput
+				if (clientVerbosity <= VERBOSITY_QUIET) && isMinorAction(&cmd, localPlayer.Id) {
+					clientOutput = hiddenOutput
+				}
+
+				// Everything that is printed about the action is in the colour of the player who took it
+				startOutputColour(playerColour(cmd.PlayerId == localPlayer.Id))
+				faceDownCardCount := 0
+				cardList := ""
+				for index, newCardId := range cmd.TargetCardIds {
+					if index > 0 {
+						cardList += ", "
+					}
+					cardList += displayCardName(&game, newCardId)
+					if newCardId == protocol.CARD_ID_ANY {
+						faceDownCardCount++
+					}
+				}
+
+				switch cmd.CmdId {
+				case protocol.CMD_CARD_DRAW:
+					if cmd.PlayerId == localPlayer.Id {
+						if len(cmd.TargetCardIds) == 0 {
+							fmt.Fprintf(clientOutput, "No cards left to draw!\n")
+						} else {
+							for _, cardId := range cmd.TargetCardIds {
+								if (cardId != protocol.CARD_ID_ANY) && (cardId != protocol.CARD_ID_ALL) && (cardId != protocol.CARD_ID_NONE) {
+									localPlayer.Draw(cardId)
+								}
+							}
+							fmt.Fprintf(clientOutput, "You drew: %s. You now have the following cards in your hand:\n", cardList)
+							for _, cardId := range localPlayer.Hand {
+								fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+							}
+						}
+					} else {
+						if len(cmd.TargetCardIds) == 0 {
+							fmt.Fprintf(clientOutput, "%s tried to draw a card, but there were no cards left!\n", srcPlayerName)
+						} else {
+							if faceDownCardCount == 0 {
+								fmt.Fprintf(clientOutput, "%s drew: %s\n", srcPlayerName, cardList)
+							} else {
+								if len(cmd.TargetCardIds) == 1 {
+									fmt.Fprintf(clientOutput, "%s drew a card\n", srcPlayerName)
+								} else {
+									fmt.Fprintf(clientOutput, "%s drew %d cards\n", srcPlayerName, len(cmd.TargetCardIds))
+								}
+							}
+						}
+					}
+
+				case protocol.CMD_CARD_DRAW_UNTIL_TYPE:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							if (cardId != protocol.CARD_ID_ANY) && (cardId != protocol.CARD_ID_ALL) && (cardId != protocol.CARD_ID_NONE) {
+								localPlayer.Draw(cardId)
+							}
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_CARD_DISCARD_TYPE:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							cardIndex := game.FindCard(localPlayer, cardId)
+							if cardIndex >= 0 {
+								localPlayer.Discard(cardIndex)
+							}
 						}
-						if player.Id == localPlayerId {
-							localPlayer = &player
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_CARD_DISCARD:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							cardIndex := game.FindCard(localPlayer, cardId)
+							if cardIndex < 0 {
+								printError("ERROR: Received a discard notification for a card (%d) that is not in your hand!\n", cardId)
+								break
+							}
+							localPlayer.Discard(cardIndex)
 						}
-						game.Players[i] = &player
 					}
-					fmt.Printf("Successfully joined a game. Your friends can join using the game ID: %d. Type 'help' to get a list of in-game commands.\n", game.Id)
+					if faceDownCardCount == 0 {
+						fmt.Fprintf(clientOutput, "%s discarded %s from their hand\n", srcPlayerName, cardList)
+					} else {
+						fmt.Fprintf(clientOutput, "%s discarded %d cards from their hand\n", srcPlayerName, len(cmd.TargetCardIds))
+					}
+
+				case protocol.CMD_CARD_GIVE:
+					if cmd.TargetPlayerId == localPlayer.Id {
+						if len(cmd.TargetCardIds) > 0 {
+							for _, cardId := range cmd.TargetCardIds {
+								if (cardId != protocol.CARD_ID_ANY) && (cardId != protocol.CARD_ID_ALL) && (cardId != protocol.CARD_ID_NONE) {
+									localPlayer.Draw(cardId)
+								}
+							}
+							fmt.Fprintf(clientOutput, "%s gave you %s from their hand. You now have the following cards in your hand:\n", srcPlayerName, cardList)
+							alertPlayer(fmt.Sprintf("%s gave you %d cards", srcPlayerName, len(cmd.TargetCardIds)))
+							for _, cardId := range localPlayer.Hand {
+								fmt.Fprintf(clientOutput, "  %s\n", displayCardName(&game, cardId))
+							}
+						}
+						break
+					}
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							cardIndex := game.FindCard(localPlayer, cardId)
+							if cardIndex < 0 {
+								printError("ERROR: Received a give notification for a card (%d) that is not in your hand!\n", cardId)
+								break
+							}
+							localPlayer.Discard(cardIndex)
+						}
+						fmt.Fprintf(clientOutput, "You gave %s from your hand to %s\n", cardList, targetPlayerName)
+						break
+					}
+					if faceDownCardCount == 0 {
+						fmt.Fprintf(clientOutput, "%s gave %s from their hand to %s\n", srcPlayerName, cardList, targetPlayerName)
+					} else {
+						fmt.Fprintf(clientOutput, "%s gave a card from their hand to %s\n", srcPlayerName, targetPlayerName)
+					}
+
+				case protocol.CMD_CARD_PUTBACK:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							cardIndex := game.FindCard(localPlayer, cardId)
+							if cardIndex < 0 {
+								printError("ERROR: Received a discard notification for a card (%d) that is not in your hand!\n", cardId)
+								break
+							}
+							localPlayer.Discard(cardIndex)
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_CARD_PICKUP:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							localPlayer.Draw(cardId)
+						}
+						fmt.Fprintf(clientOutput, "You picked up %s from the discard pile. You now have the following cards in your hand:\n", cardList)
+						for _, cardId := range localPlayer.Hand {
+							fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+						}
+					} else if faceDownCardCount == 0 {
+						fmt.Fprintf(clientOutput, "%s picked up %s from the discard pile\n", srcPlayerName, cardList)
+					} else {
+						fmt.Fprintf(clientOutput, "%s picked up a face-down card from the discard pile\n", srcPlayerName)
+					}
+
+				case protocol.CMD_CARD_SHUFFLE_HAND:
+					if cmd.PlayerId == localPlayer.Id {
+						localPlayer.Hand = cmd.TargetCardIds
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_CARD_ARRANGE_HAND:
+					localPlayer.Hand = cmd.TargetCardIds
+					fmt.Fprintln(clientOutput, "You now have the following cards in your hand:")
+					for _, cardId := range localPlayer.Hand {
+						fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+					}
+
+				case protocol.CMD_CARD_FETCH:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							localPlayer.Draw(cardId)
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_CARD_TRADE_OFFER:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+					if cmd.TargetPlayerId == localPlayer.Id {
+						fmt.Fprintf(clientOutput, "Type 'trade accept %s' or 'trade decline %s' to respond\n", srcPlayerName, srcPlayerName)
+					}
+
+				case protocol.CMD_CARD_VIEW_HAND_REQUEST:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+					if cmd.TargetPlayerId == localPlayer.Id {
+						fmt.Fprintf(clientOutput, "Type 'showme accept %s' or 'showme decline %s' to respond\n", srcPlayerName, srcPlayerName)
+					}
+
+				case protocol.CMD_CARD_VIEW_HAND_RESPOND:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+
+				case protocol.CMD_CARD_TRADE_RESPOND:
+					accepted := (len(cmd.TargetStrings) > 0) && (cmd.TargetStrings[0] == "accepted")
+					if accepted && (len(cmd.TargetCardIds) == 2) {
+						offeredCardId := cmd.TargetCardIds[0]
+						requestedCardId := cmd.TargetCardIds[1]
+						if cmd.PlayerId == localPlayer.Id {
+							cardIndex := game.FindCardByName(localPlayer, requestedCardId)
+							if cardIndex >= 0 {
+								localPlayer.Discard(cardIndex)
+							}
+							localPlayer.Draw(offeredCardId)
+						} else if cmd.TargetPlayerId == localPlayer.Id {
+							cardIndex := game.FindCard(localPlayer, offeredCardId)
+							if cardIndex >= 0 {
+								localPlayer.Discard(cardIndex)
+							}
+							localPlayer.Draw(requestedCardId)
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+
+				case protocol.CMD_CARD_REVEAL_HAND:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_CARD_SET_FACE_UP:
+					if (cmd.PlayerId == localPlayer.Id) && (len(cmd.TargetCardIds) == 1) {
+						localPlayer.SetFaceUp(cmd.TargetCardIds[0], (len(cmd.TargetStrings) == 0) || (cmd.TargetStrings[0] != protocol.CARD_FACING_DOWN))
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_CARD_SWAP_HANDS:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+					if (cmd.PlayerId == localPlayer.Id) || (cmd.TargetPlayerId == localPlayer.Id) {
+						localPlayer.Hand = cmd.TargetCardIds
+						fmt.Fprintln(clientOutput, "You now have the following cards in your hand:")
+						for _, cardId := range localPlayer.Hand {
+							fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+						}
+					}
+
+				case protocol.CMD_CARD_SHOW:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+					if (cmd.PlayerId != localPlayer.Id) && (faceDownCardCount < len(cmd.TargetCardIds)) {
+						alertPlayer(fmt.Sprintf("%s showed you cards", srcPlayerName))
+					}
+
+				case protocol.CMD_DECK_PEEK:
+					if faceDownCardCount == 0 {
+						peekedCardList := ""
+						if len(cmd.TargetCardIds) > 0 {
+							peekedCardList = fmt.Sprintf("  - %s  <-- Top of the deck\n", displayCardName(&game, cmd.TargetCardIds[0]))
+							for _, peekedCardId := range cmd.TargetCardIds[1:] {
+								peekedCardList += fmt.Sprintf("  - %s\n", displayCardName(&game, peekedCardId))
+							}
+						}
+						fmt.Fprintf(clientOutput, "%s looked at the top %d cards in %s and ordered from top to bottom they are:\n%s", srcPlayerName, len(cmd.TargetCardIds), describeDeck(&game, cmd.TargetDeckId), peekedCardList)
+					} else {
+						fmt.Fprintf(clientOutput, "%s looked at the top %d cards in %s\n", srcPlayerName, len(cmd.TargetCardIds), describeDeck(&game, cmd.TargetDeckId))
+					}
+
+				case protocol.CMD_DECK_PEEK_BOTTOM:
+					if (faceDownCardCount == 0) && (len(cmd.TargetCardIds) > 0) {
+						peekedCardList := fmt.Sprintf("  - %s  <-- Bottom of the deck\n", displayCardName(&game, cmd.TargetCardIds[0]))
+						for _, peekedCardId := range cmd.TargetCardIds[1:] {
+							peekedCardList += fmt.Sprintf("  - %s\n", displayCardName(&game, peekedCardId))
+						}
+						fmt.Fprintf(clientOutput, "%s looked at the bottom %d cards in %s and ordered from bottom to top they are:\n%s", srcPlayerName, len(cmd.TargetCardIds), describeDeck(&game, cmd.TargetDeckId), peekedCardList)
+					} else {
+						fmt.Fprintf(clientOutput, "%s looked at the bottom %d cards in %s\n", srcPlayerName, len(cmd.TargetCardIds), describeDeck(&game, cmd.TargetDeckId))
+					}
+
+				case protocol.CMD_DECK_SHUFFLE:
+					fmt.Fprintf(clientOutput, "%s shuffled %s\n", srcPlayerName, describeDeck(&game, cmd.TargetDeckId))
+
+				case protocol.CMD_DECK_REARRANGE:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_DECK_BURN:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_DECK_DEAL:
+					for _, cardId := range cmd.TargetCardIds {
+						localPlayer.Draw(cardId)
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+					if len(cmd.TargetCardIds) > 0 {
+						fmt.Fprintf(clientOutput, "You now have the following cards in your hand:\n")
+						for _, cardId := range localPlayer.Hand {
+							fmt.Fprintf(clientOutput, "  - %s\n", displayCardName(&game, cardId))
+						}
+					}
+
+				case protocol.CMD_DECK_TOP_CARD:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_TABLEAU_PLACE:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							cardIndex := game.FindCard(localPlayer, cardId)
+							if cardIndex < 0 {
+								printError("ERROR: Received a tableau notification for a card (%d) that is not in your hand!\n", cardId)
+								break
+							}
+							localPlayer.Discard(cardIndex)
+							localPlayer.Tableau = append(localPlayer.Tableau, cardId)
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_TABLEAU_RETRIEVE:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							tableauIndex := game.FindTableauCard(localPlayer, cardId)
+							if tableauIndex >= 0 {
+								localPlayer.RemoveFromTableau(tableauIndex)
+							}
+							localPlayer.Draw(cardId)
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_TABLE_PLAY:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							cardIndex := game.FindCard(localPlayer, cardId)
+							if cardIndex < 0 {
+								printError("ERROR: Received a play notification for a card (%d) that is not in your hand!\n", cardId)
+								break
+							}
+							localPlayer.Discard(cardIndex)
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_TABLE_TAKE:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							localPlayer.Draw(cardId)
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_MARKET_TAKE:
+					if cmd.PlayerId == localPlayer.Id {
+						for _, cardId := range cmd.TargetCardIds {
+							localPlayer.Draw(cardId)
+						}
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_MARKET_DISCARD:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_MARKET_REFILL:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_TABLE_PUTBACK:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, "", &cmd))
+
+				case protocol.CMD_SCORE_ADD:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+
+				case protocol.CMD_COUNTER_CHANGE:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, srcPlayerName, targetPlayerName, &cmd))
+
+				case protocol.CMD_RANDOM_ROLL, protocol.CMD_RANDOM_ROLL_NAMED, protocol.CMD_RANDOM_FLIP, protocol.CMD_RANDOM_PICK:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_GAME_START:
+					game.TurnPlayerId = cmd.PlayerId
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_GAME_RESET:
+					localPlayer.Hand = make([]uint16, 0)
+					localPlayer.Tableau = make([]uint16, 0)
+					localPlayer.HandRevealed = false
+					localPlayer.FaceUpCards = make([]uint16, 0)
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_GAME_DEAL_ROLES, protocol.CMD_GAME_REVEAL_ROLES:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_TURN_END:
+					game.TurnPlayerId = cmd.TargetPlayerId
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+					if (cmd.TargetPlayerId == localPlayer.Id) && (cmd.PlayerId != localPlayer.Id) {
+						alertPlayer("It is your turn")
+					}
+
+				case protocol.CMD_TURN_TIMER:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_POLL_START:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+					if (len(cmd.TargetStrings) >= 2) && (cmd.TargetStrings[0] == POLL_STATUS_STARTED) {
+						game.poll = &Poll{
+							cmd.PlayerId,
+							cmd.TargetStrings[1],
+							cmd.TargetStrings[2:],
+							make(map[uint64]uint16),
+						}
+						fmt.Fprintln(clientOutput, "Type 'vote x' (where x is either the option or its number) to cast your vote")
+					} else {
+						game.poll = nil
+					}
+
+				case protocol.CMD_POLL_VOTE:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_GAME_UNDO:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+					if (len(cmd.TargetStrings) == 0) || (cmd.TargetStrings[0] == UNDO_STATUS_PROPOSED) {
+						if cmd.PlayerId != localPlayer.Id {
+							fmt.Fprintln(clientOutput, "Type 'undo yes' to agree or 'undo no' to refuse")
+						}
+					} else if cmd.TargetStrings[0] == UNDO_STATUS_ACCEPTED {
+						localPlayer.Hand = cmd.TargetCardIds
+						game.TurnPlayerId = cmd.TargetPlayerId
+					}
+
+				case protocol.CMD_GAME_UNDO_VOTE:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_GAME_KICK:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+					if cmd.TargetPlayerId == localPlayer.Id {
+						inGame = false
+						game = GameState{}
+					} else {
+						targetPlayerIndex := game.FindPlayer(cmd.TargetPlayerId)
+						if targetPlayerIndex >= 0 {
+							game.RemovePlayer(game.Players[targetPlayerIndex])
+						}
+					}
+
+				case protocol.CMD_GAME_RESUME:
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, "", &cmd))
+
+				case protocol.CMD_GAME_TRANSFER_OWNER:
+					if cmd.TargetPlayerId == protocol.PLAYER_ID_NONE {
+						game.OwnerId = cmd.PlayerId
+					} else {
+						game.OwnerId = cmd.TargetPlayerId
+					}
+					fmt.Fprintln(clientOutput, describeGameEvent(&game, localPlayer, game.Players[srcPlayerIndex].Name, targetPlayerName, &cmd))
+
+				case protocol.CMD_GAME_LEAVE:
+					fmt.Fprintf(clientOutput, "%s left the game\n", srcPlayerName)
+					game.RemovePlayer(game.Players[srcPlayerIndex])
+					if cmd.PlayerId == localPlayer.Id {
+						inGame = false
+						game = GameState{}
+					}
+
+				default:
+					fmt.Fprintf(clientOutput, "Received unexpected command %d, ignoring...\n", cmd.CmdId)
 				}
-				inGame = true
+				endOutputColour()
+				clientOutput = visibleOutput
 
-			case CMD_NOTIFY_INPUT_ERROR:
-				var cmd NotifyInputErrorCommand
-				SerialiseNotifyInputErrorCommand(cmdContainer.payload, &cmd, true)
-				switch cmd.errorId {
-				case ERROR_INVALID_CMD_ID:
-					fmt.Printf("ERROR: Unsupported command ID %d\n", cmd.cmdId)
-				case ERROR_INVALID_GAME_ID:
-					fmt.Printf("ERROR: Invalid game ID\n")
-				case ERROR_INVALID_PLAYER_ID:
-					fmt.Printf("ERROR: Invalid player ID\n")
-				case ERROR_INVALID_DECK_ID:
-					fmt.Printf("ERROR: Invalid deck ID\n")
-				case ERROR_INVALID_CARD_ID:
-					fmt.Printf("ERROR: Invalid card ID\n")
-				case ERROR_INVALID_PLAYER_NAME:
-					fmt.Printf("ERROR: Invalid player name. All players must have distinct names and cannot share a name with a card\n") // TODO: Redirect to docs for name specifications? This doesn't mention the name requirements (max length, no whitespace)
-				case ERROR_SERVER_FULL:
-					fmt.Printf("ERROR: The server you are trying to connect to is full.\n") // TODO: Print instructions for hosting your own or contact details or whatever
-				case ERROR_INVALID_DATA:
-					switch cmd.cmdId {
-					case CMD_GAME_CREATE:
-						fmt.Printf("ERROR: Invalid specification provided for the 'create' command\n")
-					case CMD_CARD_PUTBACK:
-						fmt.Printf("ERROR: Invalid depth in the deck for 'putback' command\n")
-					case CMD_GAME_JOIN:
-						fmt.Printf("ERROR: Failed to join the game, there may already be a player named '%s'. Please try again with a different username.\n", localPlayer.Name)
-					}
-				}
-
-			case CMD_NOTIFY_PLAYER_ACTION:
-				var cmd NotifyPlayerActionCommand
-				SerialiseNotifyPlayerActionCommand(cmdContainer.payload, &cmd, true)
-				srcPlayerIndex := game.FindPlayer(cmd.playerId)
-				if srcPlayerIndex < 0 {
-					fmt.Printf("Received an action notification for unrecognised player ID: %d. Ignoring...\n", cmd.playerId)
+			case protocol.CMD_NOTIFY_SERVER_SHUTDOWN:
+				fmt.Fprintf(clientOutput, "Server is shutting down...\n")
+				serverShuttingDown = true
+
+			case protocol.CMD_NOTIFY_SERVER_MESSAGE:
+				var cmd protocol.NotifyServerMessageCommand
+				err := protocol.SerialiseNotifyServerMessageCommand(cmdContainer.Payload, &cmd, true)
+				if err != nil {
+					fmt.Fprintf(clientOutput, "Received invalid NotifyServerMessageCommand: %s\n", err)
 					break
 				}
-				srcPlayerName := game.Players[srcPlayerIndex].Name
-				if cmd.playerId == localPlayer.Id {
-					srcPlayerName = "You"
+				fmt.Fprintf(clientOutput, "*** Message from the server: %s ***\n", cmd.Message)
+				if mentionsPlayer(cmd.Message, playerName) {
+					alertPlayer(cmd.Message)
+				}
+
+			default:
+				printError("ERROR: Received unrecognised or unsupported command %d from server, disconnecting...\n", cmdId)
+				shouldQuit = true
+			}
+		}
+
+		if chainReplyReceived && !shouldQuit {
+			chain.StopWaiting()
+			chain.Run(session, &game, inGame, localPlayer)
+		}
+
+		lineEditor.SetCompletions(inputCompletions(&game, inGame, localPlayer))
+		lineEditor.SetPrompt(inputPrompt(&game, inGame, localPlayer, playerName, sessionCommands != nil))
+		lineEditor.Show()
+		if shouldQuit {
+			break
+		}
+	}
+
+	keepAliveTicker.Stop()
+	session.Close()
+}
+
+// Produces the same text that a player not directly involved in the event would have seen when it happened
+func describeGameEvent(game *GameState, localPlayer *PlayerState, srcPlayerName string, targetPlayerName string, event *protocol.NotifyPlayerActionCommand) string {
+	if (localPlayer != nil) && (srcPlayerName == localPlayer.Name) {
+		srcPlayerName = "You"
+	}
+	if len(targetPlayerName) == 0 {
+		targetPlayerName = "Everyone"
+	} else if (localPlayer != nil) && (targetPlayerName == localPlayer.Name) {
+		targetPlayerName = "You"
+	}
+
+	cardIds := event.TargetCardIds
+	faceDownCardCount := 0
+	cardList := ""
+	for index, cardId := range cardIds {
+		if index > 0 {
+			cardList += ", "
+		}
+		cardList += game.spec.CardName(cardId)
+		if cardId == protocol.CARD_ID_ANY {
+			faceDownCardCount++
+		}
+	}
+	deckName := describeDeck(game, event.TargetDeckId)
+	drawSource := ""
+	if (event.TargetDeckId != 0) && (int(event.TargetDeckId) < len(game.spec.DeckNames)) {
+		drawSource = " from " + deckName
+	}
+
+	switch event.CmdId {
+	case protocol.CMD_CARD_DRAW:
+		if len(cardIds) == 0 {
+			return fmt.Sprintf("%s tried to draw a card%s, but there were no cards left!", srcPlayerName, drawSource)
+		} else if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s drew%s: %s", srcPlayerName, drawSource, cardList)
+		} else if len(cardIds) == 1 {
+			return fmt.Sprintf("%s drew a card%s", srcPlayerName, drawSource)
+		}
+		return fmt.Sprintf("%s drew %d cards%s", srcPlayerName, len(cardIds), drawSource)
+
+	case protocol.CMD_CARD_DISCARD:
+		if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s discarded %s from their hand", srcPlayerName, cardList)
+		}
+		return fmt.Sprintf("%s discarded %d cards from their hand", srcPlayerName, len(cardIds))
+
+	case protocol.CMD_CARD_DRAW_UNTIL_TYPE:
+		if len(event.TargetStrings) < 2 {
+			return fmt.Sprintf("%s drew %d cards%s", srcPlayerName, len(cardIds), drawSource)
+		}
+		cardType := event.TargetStrings[0]
+		found := (event.TargetStrings[1] == "true")
+		if len(cardIds) == 0 {
+			return fmt.Sprintf("%s tried to draw until they found a %s card%s, but there were no cards left!", srcPlayerName, cardType, drawSource)
+		} else if faceDownCardCount > 0 {
+			if found {
+				return fmt.Sprintf("%s drew %d cards%s, the last of which is a %s card", srcPlayerName, len(cardIds), drawSource, cardType)
+			}
+			return fmt.Sprintf("%s drew %d cards looking for a %s card, but %s ran out before they found one", srcPlayerName, len(cardIds), cardType, deckName)
+		} else if found {
+			return fmt.Sprintf("%s drew until they found a %s card%s: %s", srcPlayerName, cardType, drawSource, cardList)
+		}
+		return fmt.Sprintf("%s drew the rest of %s without finding a %s card: %s", srcPlayerName, deckName, cardType, cardList)
+
+	case protocol.CMD_CARD_DISCARD_TYPE:
+		cardType := "typed"
+		if len(event.TargetStrings) > 0 {
+			cardType = event.TargetStrings[0]
+		}
+		if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s discarded every %s card from their hand: %s", srcPlayerName, cardType, cardList)
+		}
+		return fmt.Sprintf("%s discarded every %s card from their hand (%d cards, face-down)", srcPlayerName, cardType, len(cardIds))
+
+	case protocol.CMD_CARD_GIVE:
+		if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s gave %s from their hand to %s", srcPlayerName, cardList, targetPlayerName)
+		}
+		return fmt.Sprintf("%s gave a card from their hand to %s", srcPlayerName, targetPlayerName)
+
+	case protocol.CMD_CARD_PUTBACK:
+		position := ""
+		if len(event.TargetStrings) > 0 {
+			if event.TargetStrings[0] == protocol.PUTBACK_POSITION_RANDOM {
+				position = " at a random depth"
+			} else if event.TargetStrings[0] == protocol.PUTBACK_POSITION_BOTTOM {
+				position = ", at the bottom"
+			}
+		}
+		if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s put a %s from their hand back into %s%s", srcPlayerName, cardList, deckName, position)
+		}
+		return fmt.Sprintf("%s put a card from their hand back into %s%s", srcPlayerName, deckName, position)
+
+	case protocol.CMD_CARD_PICKUP:
+		if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s picked up %s from the discard pile", srcPlayerName, cardList)
+		}
+		return fmt.Sprintf("%s picked up a face-down card from the discard pile", srcPlayerName)
+
+	case protocol.CMD_CARD_SHUFFLE_HAND:
+		return fmt.Sprintf("%s shuffled their hand", srcPlayerName)
+
+	case protocol.CMD_CARD_ARRANGE_HAND:
+		return fmt.Sprintf("%s rearranged their hand", srcPlayerName)
+
+	case protocol.CMD_CARD_FETCH:
+		return fmt.Sprintf("%s took %s out of %s and then shuffled it", srcPlayerName, cardList, deckName)
+
+	case protocol.CMD_CARD_VIEW_HAND_REQUEST:
+		return fmt.Sprintf("%s asked to look at the hand of %s", srcPlayerName, targetPlayerName)
+
+	case protocol.CMD_CARD_VIEW_HAND_RESPOND:
+		accepted := (len(event.TargetStrings) > 0) && (event.TargetStrings[0] == "accepted")
+		if !accepted {
+			return fmt.Sprintf("%s refused to let %s look at their hand", srcPlayerName, targetPlayerName)
+		}
+		if len(cardIds) == 0 {
+			return fmt.Sprintf("%s let %s look at their hand", srcPlayerName, targetPlayerName)
+		}
+		result := fmt.Sprintf("%s let %s look at their hand, which contains:", srcPlayerName, targetPlayerName)
+		for _, cardId := range cardIds {
+			result += fmt.Sprintf("\n  - %s", game.spec.CardName(cardId))
+		}
+		return result
+
+	case protocol.CMD_CARD_TRADE_OFFER:
+		if len(cardIds) != 2 {
+			return fmt.Sprintf("%s offered a trade to %s", srcPlayerName, targetPlayerName)
+		}
+		return fmt.Sprintf("%s offered to trade %s to %s in exchange for %s", srcPlayerName, game.spec.CardName(cardIds[0]), targetPlayerName, game.spec.CardName(cardIds[1]))
+
+	case protocol.CMD_CARD_TRADE_RESPOND:
+		accepted := (len(event.TargetStrings) > 0) && (event.TargetStrings[0] == "accepted")
+		if !accepted {
+			return fmt.Sprintf("%s declined the trade offered by %s", srcPlayerName, targetPlayerName)
+		}
+		if len(cardIds) != 2 {
+			return fmt.Sprintf("%s accepted a trade with %s and exchanged a card with them", srcPlayerName, targetPlayerName)
+		}
+		return fmt.Sprintf("%s accepted the trade offered by %s, exchanging %s for %s", srcPlayerName, targetPlayerName, game.spec.CardName(cardIds[1]), game.spec.CardName(cardIds[0]))
+
+	case protocol.CMD_CARD_REVEAL_HAND:
+		if len(cardIds) == 0 {
+			return fmt.Sprintf("%s revealed their hand to everyone, but it is empty", srcPlayerName)
+		}
+		result := fmt.Sprintf("%s revealed their hand to everyone:", srcPlayerName)
+		for _, cardId := range cardIds {
+			result += fmt.Sprintf("\n  - %s", game.spec.CardName(cardId))
+		}
+		return result
+
+	case protocol.CMD_CARD_SWAP_HANDS:
+		if len(event.TargetStrings) != 2 {
+			return fmt.Sprintf("%s swapped hands with %s", srcPlayerName, targetPlayerName)
+		}
+		return fmt.Sprintf("%s swapped hands with %s (who now hold %s and %s cards respectively)", srcPlayerName, targetPlayerName, event.TargetStrings[0], event.TargetStrings[1])
+
+	case protocol.CMD_CARD_SHOW:
+		// Cards that are face-up in the player's hand are visible even to those who weren't shown them
+		faceUpSuffix := ""
+		if (faceDownCardCount > 0) && (faceDownCardCount < len(cardIds)) {
+			faceUpCardList := ""
+			for _, cardId := range cardIds {
+				if cardId == protocol.CARD_ID_ANY {
+					continue
 				}
+				if len(faceUpCardList) > 0 {
+					faceUpCardList += ", "
+				}
+				faceUpCardList += game.spec.CardName(cardId)
+			}
+			faceUpSuffix = fmt.Sprintf(", including the face-up %s", faceUpCardList)
+		}
+		if (len(event.TargetStrings) > 0) && (event.TargetStrings[0] == protocol.SHOW_TARGET_EXCEPT) {
+			if targetPlayerName == "You" {
+				targetPlayerName = "you"
+			}
+			if faceDownCardCount == 0 {
+				return fmt.Sprintf("%s showed the following cards to everyone except %s: %s", srcPlayerName, targetPlayerName, cardList)
+			}
+			return fmt.Sprintf("%s showed %d cards to everyone except %s%s", srcPlayerName, len(cardIds), targetPlayerName, faceUpSuffix)
+		}
+		if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s showed the following cards to %s: %s", srcPlayerName, targetPlayerName, cardList)
+		}
+		return fmt.Sprintf("%s showed %d cards to %s%s", srcPlayerName, len(cardIds), targetPlayerName, faceUpSuffix)
+
+	case protocol.CMD_CARD_SET_FACE_UP:
+		if (len(event.TargetStrings) > 0) && (event.TargetStrings[0] == protocol.CARD_FACING_DOWN) {
+			return fmt.Sprintf("%s turned %s in their hand face-down", srcPlayerName, cardList)
+		}
+		return fmt.Sprintf("%s turned %s in their hand face-up for everyone to see", srcPlayerName, cardList)
+
+	case protocol.CMD_DECK_PEEK:
+		if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s looked at the top %d cards in %s: %s", srcPlayerName, len(cardIds), deckName, cardList)
+		}
+		return fmt.Sprintf("%s looked at the top %d cards in %s", srcPlayerName, len(cardIds), deckName)
+
+	case protocol.CMD_DECK_PEEK_BOTTOM:
+		if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s looked at the bottom %d cards in %s: %s", srcPlayerName, len(cardIds), deckName, cardList)
+		}
+		return fmt.Sprintf("%s looked at the bottom %d cards in %s", srcPlayerName, len(cardIds), deckName)
+
+	case protocol.CMD_DECK_SHUFFLE:
+		return fmt.Sprintf("%s shuffled %s", srcPlayerName, deckName)
+
+	case protocol.CMD_DECK_REARRANGE:
+		return fmt.Sprintf("%s rearranged the top %d cards of %s", srcPlayerName, len(cardIds), deckName)
+
+	case protocol.CMD_DECK_BURN:
+		if len(cardIds) == 0 {
+			return fmt.Sprintf("%s tried to burn a card, but there were no cards left!", srcPlayerName)
+		} else if faceDownCardCount == 0 {
+			return fmt.Sprintf("%s burned the top %d cards of %s: %s", srcPlayerName, len(cardIds), deckName, cardList)
+		}
+		return fmt.Sprintf("%s burned the top %d cards of %s face-down", srcPlayerName, len(cardIds), deckName)
+
+	case protocol.CMD_DECK_DEAL:
+		dealCount := ""
+		if len(event.TargetStrings) > 0 {
+			dealCount = event.TargetStrings[0] + " "
+		}
+		if len(cardIds) == 0 {
+			return fmt.Sprintf("%s dealt %scards%s to every player", srcPlayerName, dealCount, drawSource)
+		}
+		return fmt.Sprintf("%s dealt %scards%s to every player. You received: %s", srcPlayerName, dealCount, drawSource, cardList)
+
+	case protocol.CMD_DECK_TOP_CARD:
+		if len(cardIds) == 0 {
+			return "The deck has run out, so there is no longer a face-up card on top of it"
+		}
+		return fmt.Sprintf("The face-up card on top of the deck is now %s", cardList)
+
+	case protocol.CMD_TABLEAU_PLACE:
+		return fmt.Sprintf("%s placed %s from their hand into their tableau", srcPlayerName, cardList)
+
+	case protocol.CMD_TABLEAU_RETRIEVE:
+		return fmt.Sprintf("%s took %s from their tableau back into their hand", srcPlayerName, cardList)
+
+	case protocol.CMD_TABLE_PLAY:
+		return fmt.Sprintf("%s played %s from their hand onto the table", srcPlayerName, cardList)
+
+	case protocol.CMD_TABLE_TAKE:
+		return fmt.Sprintf("%s took %s from the table into their hand", srcPlayerName, cardList)
+
+	case protocol.CMD_TABLE_PUTBACK:
+		return fmt.Sprintf("%s put %s from the table back into %s", srcPlayerName, cardList, deckName)
+
+	case protocol.CMD_MARKET_TAKE:
+		return fmt.Sprintf("%s took %s from the market into their hand", srcPlayerName, cardList)
+
+	case protocol.CMD_MARKET_DISCARD:
+		return fmt.Sprintf("%s moved %s from the market to the discard pile", srcPlayerName, cardList)
+
+	case protocol.CMD_MARKET_REFILL:
+		return fmt.Sprintf("The market was refilled from the deck with: %s", cardList)
+
+	case protocol.CMD_SCORE_ADD:
+		if len(event.TargetStrings) != 3 {
+			return fmt.Sprintf("%s recorded a score for %s", srcPlayerName, targetPlayerName)
+		}
+		return fmt.Sprintf("%s recorded a score of %s for %s in round %s, bringing their total to %s", srcPlayerName, event.TargetStrings[0], targetPlayerName, event.TargetStrings[1], event.TargetStrings[2])
+
+	case protocol.CMD_COUNTER_CHANGE:
+		if len(event.TargetStrings) != 3 {
+			break
+		}
+		counterOwner := targetPlayerName + "'s"
+		if targetPlayerName == "You" {
+			counterOwner = "your"
+		} else if targetPlayerName == srcPlayerName {
+			counterOwner = "their"
+		}
+		return fmt.Sprintf("%s changed %s %s from %s to %s", srcPlayerName, counterOwner, event.TargetStrings[0], event.TargetStrings[1], event.TargetStrings[2])
+
+	case protocol.CMD_RANDOM_ROLL:
+		if len(cardIds) < 2 {
+			break
+		}
+		total := 0
+		rolls := make([]string, 0, len(cardIds)-1)
+		for _, roll := range cardIds[1:] {
+			total += int(roll)
+			rolls = append(rolls, strconv.Itoa(int(roll)))
+		}
+		return fmt.Sprintf("%s rolled %dd%d and got: %s (total %d)", srcPlayerName, len(rolls), cardIds[0], strings.Join(rolls, ", "), total)
 
-				targetPlayerName := "Everyone"
-				if (cmd.targetPlayerId != PLAYER_ID_NONE) && (cmd.targetPlayerId != PLAYER_ID_ALL) {
-					targetPlayerIndex := game.FindPlayer(cmd.targetPlayerId)
-					if targetPlayerIndex < 0 {
-						fmt.Printf("Received an action notification targetting an unknown player ID: %d. Ignoring...\n", cmd.targetPlayerId)
-						break
-					}
-					if cmd.targetPlayerId == localPlayer.Id {
-						targetPlayerName = "You"
-					} else {
-						targetPlayerName = game.Players[targetPlayerIndex].Name
-					}
-				}
+	case protocol.CMD_RANDOM_ROLL_NAMED:
+		if len(event.TargetStrings) < 2 {
+			break
+		}
+		return fmt.Sprintf("%s rolled %d %s dice and got: %s", srcPlayerName, len(event.TargetStrings)-1, event.TargetStrings[0], strings.Join(event.TargetStrings[1:], ", "))
 
-				faceDownCardCount := 0
-				cardList := ""
-				for index, newCardId := range cmd.targetCardIds {
-					if index > 0 {
-						cardList += ", "
-					}
-					cardList += game.spec.CardName(newCardId)
-					if newCardId == CARD_ID_ANY {
-						faceDownCardCount++
-					}
-				}
+	case protocol.CMD_RANDOM_FLIP:
+		if len(event.TargetStrings) == 0 {
+			break
+		}
+		return fmt.Sprintf("%s flipped a coin and got %s", srcPlayerName, event.TargetStrings[0])
 
-				switch cmd.cmdId {
-				case CMD_CARD_DRAW:
-					if cmd.playerId == localPlayer.Id {
-						if len(cmd.targetCardIds) == 0 {
-							fmt.Printf("No cards left to draw!\n")
-						} else {
-							for _, cardId := range cmd.targetCardIds {
-								if (cardId != CARD_ID_ANY) && (cardId != CARD_ID_ALL) && (cardId != CARD_ID_NONE) {
-									localPlayer.Draw(cardId)
-								}
-							}
-							fmt.Printf("You drew: %s. You now have the following cards in your hand:\n", cardList)
-							for _, cardId := range localPlayer.Hand {
-								fmt.Printf("  - %s\n", game.spec.CardName(cardId))
-							}
-						}
-					} else {
-						if len(cmd.targetCardIds) == 0 {
-							fmt.Printf("%s tried to draw a card, but there were no cards left!\n", srcPlayerName)
-						} else {
-							if faceDownCardCount == 0 {
-								fmt.Printf("%s drew: %s\n", srcPlayerName, cardList)
-							} else {
-								if len(cmd.targetCardIds) == 1 {
-									fmt.Printf("%s drew a card\n", srcPlayerName)
-								} else {
-									fmt.Printf("%s drew %d cards\n", srcPlayerName, len(cmd.targetCardIds))
-								}
-							}
-						}
-					}
+	case protocol.CMD_RANDOM_PICK:
+		if len(event.TargetStrings) == 0 {
+			break
+		}
+		return fmt.Sprintf("%s picked randomly from %s and got %s", srcPlayerName, strings.Join(event.TargetStrings[1:], ", "), event.TargetStrings[0])
 
-				case CMD_CARD_DISCARD:
-					if cmd.playerId == localPlayer.Id {
-						for _, cardId := range cmd.targetCardIds {
-							cardIndex := game.FindCard(localPlayer, cardId)
-							if cardIndex < 0 {
-								fmt.Printf("ERROR: Received a discard notification for a card (%d) that is not in your hand!\n", cardId)
-								break
-							}
-							localPlayer.Discard(cardIndex)
-						}
-					}
-					if faceDownCardCount == 0 {
-						fmt.Printf("%s discarded %s from their hand\n", srcPlayerName, cardList)
-					} else {
-						fmt.Printf("%s discarded %d cards from their hand\n", srcPlayerName, len(cmd.targetCardIds))
-					}
+	case protocol.CMD_GAME_CREATE:
+		return fmt.Sprintf("%s created the game", srcPlayerName)
 
-				case CMD_CARD_GIVE:
-					if cmd.targetPlayerId == localPlayer.Id {
-						if len(cmd.targetCardIds) > 0 {
-							for _, cardId := range cmd.targetCardIds {
-								if (cardId != CARD_ID_ANY) && (cardId != CARD_ID_ALL) && (cardId != CARD_ID_NONE) {
-									localPlayer.Draw(cardId)
-								}
-							}
-							fmt.Printf("%s gave you %s from their hand. You now have the following cards in your hand:\n", srcPlayerName, cardList)
-							for _, cardId := range localPlayer.Hand {
-								fmt.Printf("  %s\n", game.spec.CardName(cardId))
-							}
-						}
-						break
-					}
-					if cmd.playerId == localPlayer.Id {
-						for _, cardId := range cmd.targetCardIds {
-							cardIndex := game.FindCard(localPlayer, cardId)
-							if cardIndex < 0 {
-								fmt.Printf("ERROR: Received a give notification for a card (%d) that is not in your hand!\n", cardId)
-								break
-							}
-							localPlayer.Discard(cardIndex)
-						}
-						fmt.Printf("You gave %s from your hand to %s\n", cardList, targetPlayerName)
-						break
-					}
-					if faceDownCardCount == 0 {
-						fmt.Printf("%s gave %s from their hand to %s\n", srcPlayerName, cardList, targetPlayerName)
-					} else {
-						fmt.Printf("%s gave a card from their hand to %s\n", srcPlayerName, targetPlayerName)
-					}
+	case protocol.CMD_GAME_JOIN:
+		return fmt.Sprintf("%s joined the game", srcPlayerName)
 
-				case CMD_CARD_PUTBACK:
-					if cmd.playerId == localPlayer.Id {
-						for _, cardId := range cmd.targetCardIds {
-							cardIndex := game.FindCard(localPlayer, cardId)
-							if cardIndex < 0 {
-								fmt.Printf("ERROR: Received a discard notification for a card (%d) that is not in your hand!\n", cardId)
-								break
-							}
-							localPlayer.Discard(cardIndex)
-						}
-					}
-					if faceDownCardCount == 0 {
-						fmt.Printf("%s put a %s from their hand back into the deck\n", srcPlayerName, cardList)
-					} else {
-						fmt.Printf("%s put a card from their hand back into the deck\n", srcPlayerName)
-					}
+	case protocol.CMD_GAME_START:
+		if len(game.spec.Counters) > 0 {
+			return fmt.Sprintf("%s started the game and took the first turn. Every player's counters were set to their starting values", srcPlayerName)
+		}
+		return fmt.Sprintf("%s started the game and took the first turn", srcPlayerName)
 
-				case CMD_CARD_SHOW:
-					if faceDownCardCount == 0 {
-						fmt.Printf("%s showed the following cards to %s: %s\n", srcPlayerName, targetPlayerName, cardList)
-					} else {
-						fmt.Printf("%s showed %d cards to %s\n", srcPlayerName, len(cmd.targetCardIds), targetPlayerName)
-					}
+	case protocol.CMD_GAME_RESET:
+		if len(game.spec.Counters) > 0 {
+			return fmt.Sprintf("%s returned every card to the deck, shuffled it and set every player's counters to their starting values", srcPlayerName)
+		}
+		return fmt.Sprintf("%s returned every card to the deck and shuffled it", srcPlayerName)
 
-				case CMD_DECK_PEEK:
-					if faceDownCardCount == 0 {
-						peekedCardList := ""
-						if len(cmd.targetCardIds) > 0 {
-							peekedCardList = fmt.Sprintf("  - %s  <-- Top of the deck\n", game.spec.CardName(cmd.targetCardIds[0]))
-							for _, peekedCardId := range cmd.targetCardIds[1:] {
-								peekedCardList += fmt.Sprintf("  - %s\n", game.spec.CardName(peekedCardId))
-							}
-						}
-						fmt.Printf("%s looked at the top %d cards in the deck and ordered from top to bottom they are:\n%s", srcPlayerName, len(cmd.targetCardIds), peekedCardList)
-					} else {
-						fmt.Printf("%s looked at the top %d cards in the deck\n", srcPlayerName, len(cmd.targetCardIds))
-					}
+	case protocol.CMD_GAME_DEAL_ROLES:
+		if len(cardIds) == 1 {
+			return fmt.Sprintf("%s dealt a secret role to every player. Your role is %s", srcPlayerName, cardList)
+		}
+		return fmt.Sprintf("%s dealt a secret role to every player", srcPlayerName)
 
-				case CMD_DECK_SHUFFLE:
-					fmt.Printf("%s shuffled the deck\n", srcPlayerName)
+	case protocol.CMD_GAME_REVEAL_ROLES:
+		if len(cardIds) != len(event.TargetStrings) {
+			break
+		}
+		roles := make([]string, 0, len(cardIds))
+		for index, cardId := range cardIds {
+			roles = append(roles, fmt.Sprintf("%s was %s", event.TargetStrings[index], game.spec.CardName(cardId)))
+		}
+		return fmt.Sprintf("%s revealed every player's role: %s", srcPlayerName, strings.Join(roles, ", "))
 
-				case CMD_GAME_LEAVE:
-					fmt.Printf("%s left the game\n", srcPlayerName)
-					game.RemovePlayer(game.Players[srcPlayerIndex])
-					if cmd.playerId == localPlayer.Id {
-						inGame = false
-						game = GameState{}
-					}
+	case protocol.CMD_TURN_END:
+		if targetPlayerName == "You" {
+			return fmt.Sprintf("%s ended their turn. It is now your turn", srcPlayerName)
+		}
+		return fmt.Sprintf("%s ended their turn. It is now %s's turn", srcPlayerName, targetPlayerName)
 
-				default:
-					fmt.Printf("Received unexpected command %d, ignoring...\n", cmd.cmdId)
-				}
+	case protocol.CMD_TURN_TIMER:
+		if len(event.TargetStrings) < 2 {
+			return fmt.Sprintf("%s changed the turn timer", srcPlayerName)
+		}
+		seconds := event.TargetStrings[1]
+		switch event.TargetStrings[0] {
+		case TURN_TIMER_STATUS_WARNING:
+			return fmt.Sprintf("%s has %s seconds left to finish their turn", srcPlayerName, seconds)
+		case TURN_TIMER_STATUS_EXPIRED:
+			return fmt.Sprintf("%s ran out of time for their turn", srcPlayerName)
+		}
+		if seconds == "0" {
+			return fmt.Sprintf("%s turned off the turn timer", srcPlayerName)
+		}
+		if (len(event.TargetStrings) > 2) && (event.TargetStrings[2] == "auto") {
+			return fmt.Sprintf("%s set the turn timer to %s seconds. When time runs out the turn passes to the next player", srcPlayerName, seconds)
+		}
+		return fmt.Sprintf("%s set the turn timer to %s seconds", srcPlayerName, seconds)
 
-			case CMD_NOTIFY_SERVER_SHUTDOWN:
-				fmt.Printf("Server is shutting down...\n")
+	case protocol.CMD_POLL_START:
+		if len(event.TargetStrings) < 2 {
+			return fmt.Sprintf("%s started a poll", srcPlayerName)
+		}
+		status := event.TargetStrings[0]
+		question := event.TargetStrings[1]
+		options := event.TargetStrings[2:]
+		if status == POLL_STATUS_STARTED {
+			result := fmt.Sprintf("%s started a poll: %s", srcPlayerName, question)
+			for index, option := range options {
+				result += fmt.Sprintf("\n  %d. %s", index+1, option)
+			}
+			return result
+		}
 
-			default:
-				fmt.Printf("ERROR: Received unrecognised or unsupported command %d from server, disconnecting...\n", cmdId)
-				quitChan <- true
-				return
+		result := fmt.Sprintf("Everyone has voted in the poll '%s'. The results are:", question)
+		if status == POLL_STATUS_EXPIRED {
+			result = fmt.Sprintf("Time ran out for voting in the poll '%s'. The results are:", question)
+		}
+		for index, option := range options {
+			votes := uint16(0)
+			if index < len(cardIds) {
+				votes = cardIds[index]
 			}
+			result += fmt.Sprintf("\n  %s: %d", option, votes)
+		}
+		return result
+
+	case protocol.CMD_POLL_VOTE:
+		return fmt.Sprintf("%s voted in the poll", srcPlayerName)
 
-		case <-quitChan:
-			shouldQuit = true
+	case protocol.CMD_GAME_UNDO:
+		status := UNDO_STATUS_PROPOSED
+		if len(event.TargetStrings) > 0 {
+			status = event.TargetStrings[0]
 		}
+		switch status {
+		case UNDO_STATUS_ACCEPTED:
+			return fmt.Sprintf("Everyone agreed to the request by %s, so the last action was undone", srcPlayerName)
+		case UNDO_STATUS_REJECTED:
+			return fmt.Sprintf("The request by %s to undo the last action was refused", srcPlayerName)
+		case UNDO_STATUS_EXPIRED:
+			return fmt.Sprintf("The request by %s to undo the last action expired before everyone agreed to it", srcPlayerName)
+		case UNDO_STATUS_CANCELLED:
+			return fmt.Sprintf("The request by %s to undo the last action was cancelled because something else happened in the meantime", srcPlayerName)
+		}
+		return fmt.Sprintf("%s asked to undo the last action", srcPlayerName)
 
-		if shouldQuit {
-			break
+	case protocol.CMD_GAME_UNDO_VOTE:
+		if (len(event.TargetStrings) > 0) && (event.TargetStrings[0] == "yes") {
+			return fmt.Sprintf("%s agreed to undo the last action", srcPlayerName)
+		}
+		return fmt.Sprintf("%s refused to undo the last action", srcPlayerName)
+
+	case protocol.CMD_GAME_KICK:
+		cardDestination := "shuffled back into the deck"
+		if (len(event.TargetStrings) > 0) && (event.TargetStrings[0] == "discarded") {
+			cardDestination = "discarded"
+		}
+		if targetPlayerName == "You" {
+			return fmt.Sprintf("%s removed you from the game. Your cards were %s", srcPlayerName, cardDestination)
 		}
+		return fmt.Sprintf("%s removed %s from the game. Their cards were %s", srcPlayerName, targetPlayerName, cardDestination)
+
+	case protocol.CMD_GAME_RESUME:
+		if (len(event.TargetStrings) > 0) && (event.TargetStrings[0] == RESUME_STATUS_DISCONNECTED) {
+			return fmt.Sprintf("%s lost their connection. Their place in the game is kept for a few minutes so that they can reconnect", srcPlayerName)
+		}
+		return fmt.Sprintf("%s reconnected", srcPlayerName)
+
+	case protocol.CMD_GAME_TRANSFER_OWNER:
+		if event.TargetPlayerId == protocol.PLAYER_ID_NONE {
+			if srcPlayerName == "You" {
+				return "The owner of the game left, so you are now the owner"
+			}
+			return fmt.Sprintf("The owner of the game left, so %s is now the owner", srcPlayerName)
+		}
+		return fmt.Sprintf("%s made %s the owner of the game", srcPlayerName, targetPlayerName)
+
+	case protocol.CMD_GAME_LEAVE:
+		return fmt.Sprintf("%s left the game", srcPlayerName)
+	}
+	return fmt.Sprintf("%s did something unrecognised (command %d)", srcPlayerName, event.CmdId)
+}
+
+// Returns the token saved from the last connection to the given server, or 0 if there isn't one
+func loadResumeToken(serverHost string) uint64 {
+	data, err := ioutil.ReadFile(ResumeTokenFileName)
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(data))
+	if (len(fields) != 2) || (fields[0] != serverHost) {
+		return 0
+	}
+	token, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return 0
 	}
+	return token
+}
 
-	keepAliveTimer.Stop()
-	conn.Close()
+func saveResumeToken(serverHost string, token uint64) {
+	data := fmt.Sprintf("%s %d\n", serverHost, token)
+	err := ioutil.WriteFile(ResumeTokenFileName, []byte(data), 0600)
+	if err != nil {
+		fmt.Fprintf(clientOutput, "Failed to save the session file, you will not be able to rejoin your game if your connection drops: %s\n", err)
+	}
 }
 
-func sendCommandBuffer(buffer []byte, conn net.Conn) error {
-	bytesWritten := 0
-	for bytesWritten < len(buffer) {
-		newBytesWritten, err := conn.Write(buffer)
-		if err != nil {
-			return err
-		}
-		bytesWritten += newBytesWritten
+// Returns the prompt that is shown before the player's input, which says whether they are in the menu or in a game and
+// how many cards they are holding, e.g "[game BRAVE-OTTER-42 | alice | 5 cards] > "
+func inputPrompt(game *GameState, inGame bool, localPlayer *PlayerState, playerName string, connected bool) string {
+	if !connected {
+		return fmt.Sprintf("[reconnecting | %s] > ", playerName)
+	} else if !inGame || (localPlayer == nil) {
+		return fmt.Sprintf("[menu | %s] > ", playerName)
 	}
 
-	return nil
+	cardCount := fmt.Sprintf("%d cards", len(localPlayer.Hand))
+	if len(localPlayer.Hand) == 1 {
+		cardCount = "1 card"
+	}
+	turn := ""
+	if game.TurnPlayerId == localPlayer.Id {
+		turn = " | your turn"
+	}
+	return fmt.Sprintf("[game %s | %s | %s%s] > ", game.JoinCode, localPlayer.Name, cardCount, turn)
+}
+
+// Returns the words that can be tab-completed at the start of a line of input (the commands) and after that (the names
+// of the cards in the local player's hand and of the players in the game)
+func inputCompletions(game *GameState, inGame bool, localPlayer *PlayerState) ([]string, []string) {
+	if !inGame || (localPlayer == nil) {
+		return lobbyCommandNames, nil
+	}
+	arguments := make([]string, 0, len(localPlayer.Hand)+len(game.Players))
+	for _, cardId := range localPlayer.Hand {
+		arguments = append(arguments, game.spec.CardName(cardId))
+	}
+	for _, player := range game.Players {
+		arguments = append(arguments, player.Name)
+	}
+	return gameCommandNames, arguments
 }
 
 func parseInputUint16(inputTokens []string) (uint16, error) {
@@ -850,17 +3521,91 @@ func parseInputUint64(inputTokens []string) (uint64, error) {
 	return fullValue, err
 }
 
+// Parses dice descriptions of the form "2d6", "2 d6" or "d6" (which is the same as "1d6")
+func parseDiceRoll(inputTokens []string) (uint16, uint16, error) {
+	diceStr := strings.ToLower(strings.Join(inputTokens, ""))
+	diceParts := strings.Split(diceStr, "d")
+	if len(diceParts) != 2 {
+		return 0, 0, errors.New("Dice must be given in the form 'ndx', for example '2d6'")
+	}
+
+	count := uint16(1)
+	if len(diceParts[0]) > 0 {
+		parsedCount, err := parseInputUint16(diceParts[:1])
+		if err != nil {
+			return 0, 0, err
+		}
+		count = parsedCount
+	}
+
+	sides, err := parseInputUint16(diceParts[1:])
+	if err != nil {
+		return 0, 0, err
+	}
+	return count, sides, nil
+}
+
+// Returns the dice from the game's spec that is named by one of the arguments (which is then removed from the list), or
+// nil if none of the arguments name one of the spec's dice
+func parseNamedDice(game *GameState, unusedArgs *[]string) *DiceSpec {
+	for argIndex, arg := range *unusedArgs {
+		if len(arg) == 0 {
+			continue
+		}
+		dice := game.spec.FindDice(arg)
+		if dice != nil {
+			*unusedArgs = append((*unusedArgs)[:argIndex], (*unusedArgs)[argIndex+1:]...)
+			return dice
+		}
+	}
+	return nil
+}
+
+// Parses either the (1-based) number of an option in the poll, or a prefix of the option itself.
+// If we don't know about the poll (e.g because we joined the game after it started) then only numbers are accepted.
+func parsePollOption(poll *Poll, inputTokens []string) (uint16, error) {
+	optionNumber, err := parseInputUint16(inputTokens)
+	if err == nil {
+		if (optionNumber == 0) || ((poll != nil) && (int(optionNumber) > len(poll.options))) {
+			return 0, errors.New("There is no option with that number")
+		}
+		return optionNumber - 1, nil
+	}
+	if poll == nil {
+		return 0, err
+	}
+
+	lowerArg := foldForMatching(strings.Join(inputTokens, " "), matchIgnoringAccents)
+	matchedOption := -1
+	for index, option := range poll.options {
+		lowerOption := foldForMatching(option, matchIgnoringAccents)
+		if lowerOption == lowerArg {
+			return uint16(index), nil
+		}
+		if strings.HasPrefix(lowerOption, lowerArg) {
+			if matchedOption >= 0 {
+				return 0, errors.New("Ambiguous option, more than one option starts with '" + lowerArg + "'")
+			}
+			matchedOption = index
+		}
+	}
+	if matchedOption < 0 {
+		return 0, errors.New("There is no option called '" + lowerArg + "'")
+	}
+	return uint16(matchedOption), nil
+}
+
 func parsePlayerId(game *GameState, unusedArgs *[]string) (uint64, error) {
 	for argIndex, arg := range *unusedArgs {
 		if len(arg) == 0 {
 			continue
 		}
 
-		lowerArg := strings.ToLower(arg)
+		lowerArg := foldForMatching(arg, matchIgnoringAccents)
 		firstMatchedPlayerId := uint64(0)
 		matchedPlayerNames := make([]string, 0)
 		for _, player := range game.Players {
-			lowerPlayer := strings.ToLower(player.Name)
+			lowerPlayer := foldForMatching(player.Name, matchIgnoringAccents)
 			if strings.HasPrefix(lowerPlayer, lowerArg) {
 				if len(matchedPlayerNames) == 0 {
 					firstMatchedPlayerId = player.Id
@@ -885,27 +3630,139 @@ func parsePlayerId(game *GameState, unusedArgs *[]string) (uint64, error) {
 			return 0, errors.New(errMsg)
 
 		} else if lowerArg == "anyplayer" {
-			return PLAYER_ID_ANY, nil
+			return protocol.PLAYER_ID_ANY, nil
 		} else if lowerArg == "allplayers" {
-			return PLAYER_ID_ALL, nil
+			return protocol.PLAYER_ID_ALL, nil
 		}
 	}
 
 	return 0, errors.New("No valid arguments")
 }
 
+// Prints the given cards from the player's hand grouped by their type, in the order that the types are listed in the
+// game's specification, followed by any cards that have no type. Cards with the same name (and that are both face-up or
+// both face-down) are printed once, with a count.
+func printGroupedHand(game *GameState, player *PlayerState, cardIds []uint16) {
+	type cardGroupEntry struct {
+		cardId uint16
+		faceUp bool
+		count  int
+	}
+
+	groupNames := append(game.spec.CardTypes(), "")
+	groups := make([][]cardGroupEntry, len(groupNames))
+	for _, cardId := range cardIds {
+		groupIndex := len(groupNames) - 1
+		if cardInfo := game.spec.CardInfo(cardId); cardInfo != nil {
+			for typeIndex, cardType := range groupNames[:len(groupNames)-1] {
+				if strings.EqualFold(cardType, cardInfo.Type) {
+					groupIndex = typeIndex
+					break
+				}
+			}
+		}
+
+		faceUp := player.IsFaceUp(cardId)
+		found := false
+		for entryIndex, entry := range groups[groupIndex] {
+			if (entry.faceUp == faceUp) && game.spec.SameCard(entry.cardId, cardId) {
+				groups[groupIndex][entryIndex].count++
+				found = true
+				break
+			}
+		}
+		if !found {
+			groups[groupIndex] = append(groups[groupIndex], cardGroupEntry{cardId, faceUp, 1})
+		}
+	}
+
+	for groupIndex, entries := range groups {
+		if len(entries) == 0 {
+			continue
+		}
+		cardCount := 0
+		for _, entry := range entries {
+			cardCount += entry.count
+		}
+		groupName := groupNames[groupIndex]
+		if len(groupName) == 0 {
+			groupName = "Other"
+			if cardCount == len(cardIds) {
+				groupName = "All"
+			}
+		}
+		fmt.Fprintf(clientOutput, "  %s (%d):\n", groupName, cardCount)
+		for _, entry := range entries {
+			countStr := ""
+			if entry.count > 1 {
+				countStr = fmt.Sprintf("%dx ", entry.count)
+			}
+			faceUpStr := ""
+			if entry.faceUp {
+				faceUpStr = "  (face-up)"
+			}
+			fmt.Fprintf(clientOutput, "    - %s%s%s\n", countStr, displayCardName(game, entry.cardId), faceUpStr)
+		}
+	}
+}
+
+// Returns the order (as given to CMD_CARD_ARRANGE_HAND) that sorts the given hand into the order that the cards are
+// listed in the game's specification, or by the cards' values or names. Cards that have no value go after those that do.
+func sortedHandOrder(game *GameState, hand []uint16, sortBy string) []uint16 {
+	newOrder := make([]uint16, len(hand))
+	for index := range newOrder {
+		newOrder[index] = uint16(index)
+	}
+	sort.SliceStable(newOrder, func(i, j int) bool {
+		cardA := hand[newOrder[i]]
+		cardB := hand[newOrder[j]]
+		if sortBy == "value" {
+			infoA := game.spec.CardInfo(cardA)
+			infoB := game.spec.CardInfo(cardB)
+			hasValueA := (infoA != nil) && (infoA.Value != nil)
+			hasValueB := (infoB != nil) && (infoB.Value != nil)
+			if hasValueA != hasValueB {
+				return hasValueA
+			}
+			if hasValueA && (*infoA.Value != *infoB.Value) {
+				return *infoA.Value < *infoB.Value
+			}
+		} else if sortBy == "name" {
+			nameA := foldForMatching(game.spec.CardName(cardA), true)
+			nameB := foldForMatching(game.spec.CardName(cardB), true)
+			if nameA != nameB {
+				return nameA < nameB
+			}
+		}
+		return cardA < cardB
+	})
+	return newOrder
+}
+
 func parseCardIdFromHand(game *GameState, player *PlayerState, unusedArgs *[]string) (uint16, error) {
+	return parseCardIdFromList(game, player.Hand, unusedArgs)
+}
+
+func parseCardIdFromSpec(game *GameState, unusedArgs *[]string) (uint16, error) {
+	allCardIds := make([]uint16, len(game.spec.Deck))
+	for cardId := range allCardIds {
+		allCardIds[cardId] = uint16(cardId)
+	}
+	return parseCardIdFromList(game, allCardIds, unusedArgs)
+}
+
+func parseCardIdFromList(game *GameState, cardIds []uint16, unusedArgs *[]string) (uint16, error) {
 	for argIndex, arg := range *unusedArgs {
 		if len(arg) == 0 {
 			continue
 		}
 
-		lowerArg := strings.ToLower(arg)
+		lowerArg := foldForMatching(arg, matchIgnoringAccents)
 		firstMatchedCardId := uint16(0)
 		matchedCardNames := make([]string, 0)
-		for _, cardId := range player.Hand {
+		for _, cardId := range cardIds {
 			cardName := game.spec.CardName(cardId)
-			lowerCard := strings.ToLower(cardName)
+			lowerCard := foldForMatching(cardName, matchIgnoringAccents)
 			if lowerCard == lowerArg {
 				return uint16(cardId), nil
 			}
@@ -933,15 +3790,118 @@ func parseCardIdFromHand(game *GameState, player *PlayerState, unusedArgs *[]str
 			return 0, errors.New(errMsg)
 
 		} else if lowerArg == "anycard" {
-			return CARD_ID_ANY, nil
+			return protocol.CARD_ID_ANY, nil
 		} else if lowerArg == "allcards" {
-			return CARD_ID_ALL, nil
+			return protocol.CARD_ID_ALL, nil
 		}
 	}
 
 	return 0, errors.New("No cards were found that matched any given arguments")
 }
 
+// Finds the card type from the game's spec that matches (or is uniquely prefixed by) one of the given arguments, and
+// removes that argument from the list
+func parseCardTypeFromSpec(game *GameState, unusedArgs *[]string) (string, error) {
+	cardTypes := game.spec.CardTypes()
+	if len(cardTypes) == 0 {
+		return "", errors.New("This game's specification does not give any cards a type")
+	}
+
+	for argIndex, arg := range *unusedArgs {
+		if len(arg) == 0 {
+			continue
+		}
+
+		lowerArg := foldForMatching(arg, matchIgnoringAccents)
+		matchedTypes := make([]string, 0)
+		for _, cardType := range cardTypes {
+			lowerType := foldForMatching(cardType, matchIgnoringAccents)
+			if lowerType == lowerArg {
+				matchedTypes = []string{cardType}
+				break
+			}
+			if strings.HasPrefix(lowerType, lowerArg) {
+				matchedTypes = append(matchedTypes, cardType)
+			}
+		}
+
+		if len(matchedTypes) == 1 {
+			*unusedArgs = append((*unusedArgs)[:argIndex], (*unusedArgs)[argIndex+1:]...)
+			return matchedTypes[0], nil
+		} else if len(matchedTypes) > 1 {
+			errMsg := fmt.Sprintf("Argument '%s' is ambiguous and could refer to any of: %s. Please try again with a more specific argument",
+				arg, strings.Join(matchedTypes, ", "))
+			return "", errors.New(errMsg)
+		}
+	}
+
+	return "", errors.New("No card types were found that matched any given arguments. The types in this game are: " + strings.Join(cardTypes, ", "))
+}
+
+// Returns how to refer to the given deck when describing events: just "the deck" unless the game has more than one
+func describeDeck(game *GameState, deckId uint16) string {
+	if (len(game.spec.DeckNames) <= 1) || (int(deckId) >= len(game.spec.DeckNames)) {
+		return "the deck"
+	}
+	return "the " + game.spec.DeckName(deckId) + " deck"
+}
+
+// Returns the ID of the deck named by one of the arguments (which is then removed from the list), or the ID of the main
+// deck if no deck was named. Deck names must be given in full, so that they are not confused with card names.
+func parseDeckIdFromSpec(game *GameState, unusedArgs *[]string) uint16 {
+	for argIndex, arg := range *unusedArgs {
+		if len(arg) == 0 {
+			continue
+		}
+		deckId := game.spec.FindDeckByName(arg)
+		if deckId != protocol.DECK_ID_NONE {
+			*unusedArgs = append((*unusedArgs)[:argIndex], (*unusedArgs)[argIndex+1:]...)
+			return deckId
+		}
+	}
+	return 0
+}
+
+// Prints the fingerprint of the game's spec that the server gave us, warning if it does not match the spec we received
+func printSpecFingerprint(game *GameState) {
+	fmt.Fprintf(clientOutput, "The fingerprint of this game's specification is %s. Every player should see the same fingerprint.\n", SpecFingerprint(game.specHash))
+	localHash, err := HashSpec(game.spec)
+	if (err != nil) || !bytes.Equal(localHash, game.specHash) {
+		fmt.Fprintf(clientOutput, "WARNING: The specification received from the server does not match its fingerprint (%s locally)\n", SpecFingerprint(localHash))
+	}
+}
+
+func printCardInfo(game *GameState, cardId uint16) {
+	card := game.spec.CardInfo(cardId)
+	if card == nil {
+		fmt.Fprintln(clientOutput, "There is no such card in this game")
+		return
+	}
+
+	copyCount := 0
+	for otherCardId := range game.spec.Deck {
+		if game.spec.SameCard(uint16(otherCardId), cardId) {
+			copyCount++
+		}
+	}
+	fmt.Fprintf(clientOutput, "%s  (%d in the game)\n", card.Name, copyCount)
+	if !card.HasMetadata() {
+		fmt.Fprintln(clientOutput, "  The game's specification has no more information about this card")
+		return
+	}
+	if len(card.Type) > 0 {
+		fmt.Fprintf(clientOutput, "  Type: %s\n", card.Type)
+	}
+	if card.Value != nil {
+		fmt.Fprintf(clientOutput, "  Value: %d\n", *card.Value)
+	}
+	if len(card.Text) > 0 {
+		for _, line := range strings.Split(strings.TrimSpace(card.Text), "\n") {
+			fmt.Fprintf(clientOutput, "  %s\n", line)
+		}
+	}
+}
+
 func stringInSlice(str string, slice []string) bool {
 	for _, sliceStr := range slice {
 		if str == sliceStr {
@@ -0,0 +1,192 @@
+// Package client connects to a netdeck server as a player, for programs (e.g bots, GUIs or bridges to chat services)
+// that want to play netdeck games without handling the connection and the binary protocol themselves. The commands
+// that are sent and received are the ones defined in the protocol package.
+package client
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// A connection to a netdeck server. Everything that the server sends is read on a separate goroutine and delivered by
+// Commands, one command at a time, with compressed commands already decompressed and batches already split into the
+// commands that they contain.
+type Session struct {
+	conn      net.Conn
+	sendMutex sync.Mutex
+	sentCount uint64 // The number of commands that have been sent, protected by sendMutex
+	lastSent  byte   // The ID of the last command that was sent, protected by sendMutex
+	commands  chan protocol.CommandContainer
+	err       error // Why the connection was lost, which is only set once commands has been closed
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// Connects to the server at the given address (e.g "example.com:43831"). The handshake still needs to be sent with
+// Handshake, possibly after ConnectThroughRelay.
+func Dial(address string) (*Session, error) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return NewSession(conn), nil
+}
+
+// Starts a session on a connection that is already open, e.g a net.Pipe to a server in the same process
+func NewSession(conn net.Conn) *Session {
+	session := &Session{
+		conn:     conn,
+		commands: make(chan protocol.CommandContainer),
+		done:     make(chan struct{}),
+	}
+	go session.readCommands()
+	return session
+}
+
+// Returns the channel on which commands from the server are delivered. It is closed when the connection is lost or the
+// session is closed, after which Err says why.
+func (s *Session) Commands() <-chan protocol.CommandContainer {
+	return s.commands
+}
+
+// Returns the error that the connection was lost because of, once the channel returned by Commands has been closed
+func (s *Session) Err() error {
+	return s.err
+}
+
+// Asks the relay that this session is connected to to pass everything from now on to the server that is hosting
+// through it with the given code. This must be done before the handshake.
+func (s *Session) ConnectThroughRelay(code string) error {
+	return s.Send(protocol.CMD_RELAY_CONNECT, &protocol.RelayCodeCommand{Code: code})
+}
+
+// Sends the handshake that must be the first command sent to the server (besides RELAY_CONNECT). resumeToken and
+// identityToken come from the HANDSHAKE_RESPONSE of an earlier session with the same server, if there was one.
+func (s *Session) Handshake(name string, resumeToken uint64, identityToken []byte) error {
+	handshake := protocol.HandshakeCommand{
+		MagicNumber:        protocol.PROTOCOL_MAGIC_NUMBER,
+		ProtocolId:         protocol.PROTOCOL_ID,
+		ResumeToken:        resumeToken,
+		IdentityToken:      identityToken,
+		LocalName:          name,
+		CompressionMethods: protocol.COMPRESSION_GZIP,
+	}
+	return s.Send(protocol.CMD_HANDSHAKE, &handshake)
+}
+
+// Sends the given command to the server. cmd is nil for commands that have no data.
+func (s *Session) Send(cmdId byte, cmd protocol.Command) error {
+	buffer, err := protocol.BuildCommand(cmdId, cmd)
+	if err != nil {
+		return err
+	}
+	return s.SendCommandBuffer(buffer)
+}
+
+// Sends a command that has already been serialised (including its header) to the server. This can be called from
+// several goroutines at once.
+func (s *Session) SendCommandBuffer(buffer []byte) error {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+	s.sentCount++
+	if len(buffer) > 0 {
+		s.lastSent = buffer[0]
+	}
+	return protocol.SendCommandBufferTo(s.conn, buffer)
+}
+
+// Returns the number of commands that have been sent (or attempted) so far, e.g to tell whether some code sent anything
+func (s *Session) SentCount() uint64 {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+	return s.sentCount
+}
+
+// Returns the ID of the last command that was sent, or CMD_UNKNOWN if none have been sent yet
+func (s *Session) LastSentId() byte {
+	s.sendMutex.Lock()
+	defer s.sendMutex.Unlock()
+	return s.lastSent
+}
+
+// Closes the connection to the server, without telling it first (send CMD_DISCONNECT for that)
+func (s *Session) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.conn.Close()
+	})
+	return err
+}
+
+func (s *Session) readCommands() {
+	defer close(s.commands)
+	for {
+		cmdHeader, cmdBuffer, err := s.readCommand()
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		if cmdHeader.Id == protocol.CMD_NOTIFY_BATCH {
+			batchedCmds, err := protocol.SplitBatchCommand(cmdBuffer)
+			if err != nil {
+				s.err = fmt.Errorf("Invalid batch of commands: %w", err)
+				return
+			}
+			for _, cmdContainer := range batchedCmds {
+				if !s.deliver(cmdContainer) {
+					return
+				}
+			}
+			continue
+		}
+
+		if !s.deliver(protocol.CommandContainer{Header: cmdHeader, Payload: cmdBuffer}) {
+			return
+		}
+	}
+}
+
+func (s *Session) readCommand() (protocol.CommandHeader, []byte, error) {
+	var cmdHeader protocol.CommandHeader
+	headerBytes, err := protocol.ReadExactlyNBytes(s.conn, protocol.CommandHeaderLength)
+	if err == nil {
+		err = protocol.SerialiseCommandHeader(headerBytes, &cmdHeader, true)
+	}
+	if err != nil {
+		return cmdHeader, nil, fmt.Errorf("Failed to read command header: %w", err)
+	}
+
+	if (cmdHeader.Id & protocol.CMD_FLAG_COMPRESSED) != 0 {
+		innerHeader, cmdBuffer, err := protocol.ReadCompressedCommand(s.conn, cmdHeader)
+		if err != nil {
+			return cmdHeader, nil, fmt.Errorf("Failed to read compressed command %d: %w", cmdHeader.Id, err)
+		}
+		return innerHeader, cmdBuffer, nil
+	}
+
+	err = protocol.ValidateCommandHeader(cmdHeader)
+	if err != nil {
+		return cmdHeader, nil, fmt.Errorf("Invalid command header {id=%d,len=%d}: %w", cmdHeader.Id, cmdHeader.Len, err)
+	}
+	cmdBuffer, err := protocol.ReadExactlyNBytes(s.conn, cmdHeader.Len)
+	if err != nil {
+		return cmdHeader, nil, fmt.Errorf("Failed to read command buffer of length %d for command %d: %w",
+			cmdHeader.Len, cmdHeader.Id, err)
+	}
+	return cmdHeader, cmdBuffer, nil
+}
+
+// Passes the given command on to whoever is reading from Commands, returning false if the session was closed first
+func (s *Session) deliver(cmdContainer protocol.CommandContainer) bool {
+	select {
+	case s.commands <- cmdContainer:
+		return true
+	case <-s.done:
+		return false
+	}
+}
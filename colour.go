@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// The ANSI escape codes for the colours that the client prints things in
+const (
+	COLOUR_NONE    = ""
+	COLOUR_RESET   = "\x1b[0m"
+	COLOUR_BOLD    = "\x1b[1m"
+	COLOUR_RED     = "\x1b[31m"
+	COLOUR_GREEN   = "\x1b[32m"
+	COLOUR_CYAN    = "\x1b[36m"
+	COLOUR_DEFAULT = "\x1b[39m"
+)
+
+// The colours of the things that the client prints
+const (
+	COLOUR_ERROR        = COLOUR_RED
+	COLOUR_LOCAL_PLAYER = COLOUR_GREEN // Actions that the local player took
+	COLOUR_OTHER_PLAYER = COLOUR_CYAN  // Actions that other players took
+)
+
+// Whether the client prints in colour, which is only the case if the output is a terminal (and the player hasn't
+// asked for no colours)
+var colourEnabled = false
+
+// The colour that output is currently being printed in, which is returned to after printing anything in another colour
+var currentOutputColour = COLOUR_NONE
+
+// Returns true if colours should be used unless the player asks otherwise, following https://no-color.org
+func colourSupported() bool {
+	if (len(os.Getenv("NO_COLOR")) > 0) || (os.Getenv("TERM") == "dumb") {
+		return false
+	}
+	return isTerminal(os.Stdout.Fd())
+}
+
+// Returns the given text in the given colour, if colours are enabled. Any newline at the end of the text is left
+// uncoloured, so that the colour doesn't spill over into the next line.
+func colourText(colour string, text string) string {
+	if !colourEnabled || (colour == COLOUR_NONE) {
+		return text
+	}
+	body := strings.TrimRight(text, "\n")
+	return colour + body + COLOUR_RESET + currentOutputColour + text[len(body):]
+}
+
+// Starts printing everything in the given colour, until endOutputColour is called
+func startOutputColour(colour string) {
+	if colourEnabled && (colour != COLOUR_NONE) {
+		currentOutputColour = colour
+		fmt.Fprint(clientOutput, colour)
+	}
+}
+
+func endOutputColour() {
+	if colourEnabled && (currentOutputColour != COLOUR_NONE) {
+		currentOutputColour = COLOUR_NONE
+		fmt.Fprint(clientOutput, COLOUR_RESET)
+	}
+}
+
+// Prints an error message, which is shown in red if colours are enabled
+func printError(format string, args ...interface{}) {
+	fmt.Fprint(clientOutput, colourText(COLOUR_ERROR, fmt.Sprintf(format, args...)))
+}
+
+// Returns the colour for actions taken by the given player
+func playerColour(isLocalPlayer bool) string {
+	if isLocalPlayer {
+		return COLOUR_LOCAL_PLAYER
+	}
+	return COLOUR_OTHER_PLAYER
+}
+
+// Returns the name of the given card for printing, which for cards of the standard suits is in the suit's colour
+func displayCardName(game *GameState, cardId uint16) string {
+	name := game.spec.CardName(cardId)
+	cardInfo := game.spec.CardInfo(cardId)
+	if cardInfo == nil {
+		return name
+	}
+	switch cardInfo.Type {
+	case "Hearts", "Diamonds":
+		return colourText(COLOUR_RED, name)
+	case "Spades", "Clubs":
+		return colourText(COLOUR_BOLD+COLOUR_DEFAULT, name)
+	}
+	return name
+}
@@ -3,23 +3,196 @@ package main
 import (
 	"bytes"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/jacquesh/netdeck/protocol"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	SETUP_SHUFFLE   = "shuffle"
+	SETUP_DEAL      = "deal"
+	SETUP_BURN      = "burn"
+	SETUP_GIVE_EACH = "giveeach"
+)
+
+// The version of the spec file format that this build of netdeck understands. Specs without a version are treated as
+// being written for version 1, and specs for any version up to this one can be loaded.
+const SpecFormatVersion = 1
+
+var ErrUnsupportedSpecVersion = errors.New("Specification was written for a newer version of the specification format than is supported")
+
+type SetupStep struct {
+	Action string
+	Count  int
+	CardId uint16
+}
+
+// A card as it is listed in the deck of a spec file. This is either just the name of the card, or a mapping with
+// the name, the number of copies of that card in the deck (e.g "name: Skip, count: 4") and optionally some reference
+// information about the card that players can look up with the 'inspect' command.
+type CardSpec struct {
+	Name  string
+	Count int
+
+	Text  string `yaml:",omitempty"` // The rules text printed on the card
+	Value *int64 `yaml:",omitempty"` // The card's value (or strength, or cost), if it has one
+	Type  string `yaml:",omitempty"` // The suit or type of the card (e.g "Hearts" or "Spell")
+}
+
+// A separate deck of cards (e.g an event deck or a treasure deck) that is drawn from independently of the main deck
+type DeckSpec struct {
+	Name  string
+	Cards []CardSpec
+}
+
+// A kind of die that players can roll by name. It either has the given number of sides (numbered from 1) or the given
+// faces, which can be any text (e.g "+", "-" and "blank" for Fate dice).
+type DiceSpec struct {
+	Name  string
+	Sides int      `yaml:",omitempty"`
+	Faces []string `yaml:",omitempty"`
+}
+
+const MaxDiceFaceCount = 100
+const MaxDiceFaceLength = 64
+
+// Returns the text of each face of the die
+func (dice *DiceSpec) FaceNames() []string {
+	if len(dice.Faces) > 0 {
+		return dice.Faces
+	}
+	result := make([]string, dice.Sides)
+	for i := range result {
+		result[i] = strconv.Itoa(i + 1)
+	}
+	return result
+}
+
+const MaxDeckCount = 16
+const MaxDeckNameLength = 32
+const MainDeckName = "main"
+
+// Returns true if the card has any reference information besides its name and count
+func (card *CardSpec) HasMetadata() bool {
+	return (len(card.Text) > 0) || (card.Value != nil) || (len(card.Type) > 0)
+}
+
+// Allows each card in the spec's deck to be given as just its name, in which case there is a single copy of it
+func (card *CardSpec) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		card.Name = value.Value
+		card.Count = 1
+		return nil
+	}
+
+	type plainCardSpec CardSpec
+	plainCard := plainCardSpec{Count: 1}
+	err := value.Decode(&plainCard)
+	if err != nil {
+		return err
+	}
+	*card = CardSpec(plainCard)
+	return nil
+}
+
+func (card CardSpec) MarshalYAML() (interface{}, error) {
+	if (card.Count == 1) && !card.HasMetadata() {
+		return card.Name, nil
+	}
+	type plainCardSpec CardSpec
+	return plainCardSpec(card), nil
+}
+
 type GameSpecification struct {
-	Deck []string
+	// Reference text for the players, such as how to play the game or what each card does (e.g the card values in Love
+	// Letter), which any player can read with the 'rules' command
+	HowToPlay string `yaml:"howtoplay,omitempty"`
+
+	// The version of the spec file format that the spec was written for
+	Version int `yaml:"version,omitempty"`
+
+	// The cards of the main deck as they were listed in the spec, and the name of every individual card in all of the
+	// decks (indexed by card ID) with one entry for each copy of each card
+	Cards     []CardSpec  `yaml:"deck"`
+	Deck      []string    `yaml:"-"`
+	cardSpecs []*CardSpec // The spec entry for each card ID in Deck
+
+	// Any additional named decks, which are numbered from 1 (the main deck is deck 0). Card IDs are shared between all
+	// decks, with the cards of each additional deck numbered after those of the decks before it.
+	ExtraDecks []DeckSpec `yaml:"decks,omitempty"`
+	DeckNames  []string   `yaml:"-"`
+	cardDecks  []uint16   // The ID of the deck that each card ID belongs to
+
+	// The number of players that the game supports. The game cannot be started with fewer than MinPlayers players and
+	// nobody can join once it has MaxPlayers players. Zero means that there is no limit.
+	MinPlayers int `yaml:"minplayers,omitempty"`
+	MaxPlayers int `yaml:"maxplayers,omitempty"`
+
+	// Whether players may take any face-up card out of the discard pile, rather than only the top card
+	DiscardPileSearchable bool
+
+	// Whether the top card of the deck is always face-up for everyone to see (e.g a trump card)
+	TopCardFaceUp bool
+
+	// The number of face-up cards in the market row, which is refilled from the deck whenever a card is taken out of it.
+	// Zero if the game has no market.
+	MarketSize int
+
+	// Secret role cards (e.g for social deduction games). When the game is started or reset, each player is dealt one of
+	// these face-down. Roles are never part of any deck and stay hidden until the 'revealroles' command is used.
+	Roles []CardSpec `yaml:"roles,omitempty"`
+
+	// The dice that players can roll by name, in addition to the numbered dice that are available in every game
+	Dice []DiceSpec `yaml:"dice,omitempty"`
+
+	// The counters (e.g "life: 30" or "coins: 3") that each player starts with, and their starting values. Every player's
+	// counters are set back to these values when the game is started or reset.
+	Counters map[string]int64
+
+	// The number of cards dealt from the main deck to each player once the game has been started (and the setup steps
+	// have been run). If there is an entry in StartingHandSizes for the number of players in the game (e.g "2: 7, 4: 5")
+	// then that is used instead.
+	StartingHandSize  int         `yaml:"startinghandsize,omitempty"`
+	StartingHandSizes map[int]int `yaml:"startinghandsizes,omitempty"`
+
+	// Steps that are run by the server when the game is started, e.g "shuffle", "deal 5", "burn 20" or "giveeach Defuse"
+	Setup      []string
+	setupSteps []SetupStep
+}
+
+// Returns the die with the given name (ignoring case), or nil if the spec has no such die
+func (gs *GameSpecification) FindDice(diceName string) *DiceSpec {
+	foldedName := foldForMatching(diceName, false)
+	for diceIndex := range gs.Dice {
+		if foldForMatching(gs.Dice[diceIndex].Name, false) == foldedName {
+			return &gs.Dice[diceIndex]
+		}
+	}
+	return nil
+}
+
+// Returns the number of cards that each player should be dealt when a game with the given number of players is started
+func (gs *GameSpecification) StartingHandSizeFor(playerCount int) int {
+	if handSize, ok := gs.StartingHandSizes[playerCount]; ok {
+		return handSize
+	}
+	return gs.StartingHandSize
 }
 
 func (gs *GameSpecification) CardName(cardId uint16) string {
-	if (cardId == CARD_ID_ANY) || (cardId == CARD_ID_ALL) {
+	if (cardId == protocol.CARD_ID_ANY) || (cardId == protocol.CARD_ID_ALL) {
 		return "<RANDOM-CARD>"
-	} else if cardId == CARD_ID_NONE {
+	} else if cardId == protocol.CARD_ID_NONE {
 		return "<NO-CARD>"
 	} else if int(cardId) >= len(gs.Deck) {
 		return "<ERROR-UNKNOWN-CARD>"
@@ -27,6 +200,105 @@ func (gs *GameSpecification) CardName(cardId uint16) string {
 	return gs.Deck[cardId]
 }
 
+// Returns the spec entry for the given card (which holds its reference information), or nil if there is no such card
+func (gs *GameSpecification) CardInfo(cardId uint16) *CardSpec {
+	if int(cardId) >= len(gs.cardSpecs) {
+		return nil
+	}
+	return gs.cardSpecs[cardId]
+}
+
+// Returns the ID of the deck that the given card belongs to (and is returned to when the game is reset), or DECK_ID_NONE
+// for role cards
+func (gs *GameSpecification) CardDeck(cardId uint16) uint16 {
+	if int(cardId) >= len(gs.cardDecks) {
+		return 0
+	}
+	return gs.cardDecks[cardId]
+}
+
+// Returns the cards as they were listed in the spec for the given deck
+func (gs *GameSpecification) DeckCards(deckId uint16) []CardSpec {
+	if deckId == 0 {
+		return gs.Cards
+	} else if int(deckId) > len(gs.ExtraDecks) {
+		return nil
+	}
+	return gs.ExtraDecks[deckId-1].Cards
+}
+
+func (gs *GameSpecification) DeckName(deckId uint16) string {
+	if int(deckId) >= len(gs.DeckNames) {
+		return "<ERROR-UNKNOWN-DECK>"
+	}
+	return gs.DeckNames[deckId]
+}
+
+// Returns the ID of the deck with the given name (ignoring case), or DECK_ID_NONE if there is none
+func (gs *GameSpecification) FindDeckByName(deckName string) uint16 {
+	foldedName := foldForMatching(deckName, false)
+	for deckId, name := range gs.DeckNames {
+		if foldForMatching(name, false) == foldedName {
+			return uint16(deckId)
+		}
+	}
+	return protocol.DECK_ID_NONE
+}
+
+// Returns every distinct type of the cards in the spec's decks, in the order in which they first appear
+func (gs *GameSpecification) CardTypes() []string {
+	result := make([]string, 0)
+	for cardId := range gs.Deck {
+		card := gs.cardSpecs[cardId]
+		if gs.cardDecks[cardId] == protocol.DECK_ID_NONE {
+			continue
+		}
+		if (len(card.Type) > 0) && !gs.typeInList(card.Type, result) {
+			result = append(result, card.Type)
+		}
+	}
+	return result
+}
+
+// Returns true if the given card has the given type (ignoring case)
+func (gs *GameSpecification) IsCardOfType(cardId uint16, cardType string) bool {
+	card := gs.CardInfo(cardId)
+	if (card == nil) || (len(card.Type) == 0) {
+		return false
+	}
+	return foldForMatching(card.Type, false) == foldForMatching(cardType, false)
+}
+
+// Returns true if any card in the spec has the given type (ignoring case)
+func (gs *GameSpecification) HasCardType(cardType string) bool {
+	return gs.typeInList(cardType, gs.CardTypes())
+}
+
+func (gs *GameSpecification) typeInList(cardType string, typeList []string) bool {
+	foldedType := foldForMatching(cardType, false)
+	for _, listType := range typeList {
+		if foldForMatching(listType, false) == foldedType {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the ID of the first card in the deck with the given name (ignoring case), or CARD_ID_NONE if there is none
+func (gs *GameSpecification) FindCardByName(cardName string) uint16 {
+	foldedName := foldForMatching(cardName, false)
+	for cardId, deckCardName := range gs.Deck {
+		if foldForMatching(deckCardName, false) == foldedName {
+			return uint16(cardId)
+		}
+	}
+	return protocol.CARD_ID_NONE
+}
+
+func (gs *GameSpecification) SameCard(cardIdA uint16, cardIdB uint16) bool {
+	return gs.CardName(cardIdA) == gs.CardName(cardIdB)
+}
+
 func NewSpec(data []byte) (*GameSpecification, error) {
 	gzipDecoder, err := gzip.NewReader(bytes.NewReader(data))
 	if err != nil {
@@ -38,25 +310,187 @@ func NewSpec(data []byte) (*GameSpecification, error) {
 		return nil, errors.New("Specification data is corrupt or not compressed")
 	}
 
+	// JSON is a subset of YAML so both formats are read by the YAML parser, but JSON is checked first so that
+	// syntax errors in JSON specs are not reported as YAML errors
+	if isJSONSpecData(decompressedData) && !json.Valid(decompressedData) {
+		return nil, errors.New("Specification data is not valid JSON")
+	}
 	var spec GameSpecification
 	err = yaml.Unmarshal(decompressedData, &spec)
 	if err != nil {
 		return nil, errors.New("Specification data does not form a valid game specification")
 	}
 
-	if len(spec.Deck) > CARD_ID_MAX {
-		return nil, errors.New("Specification contains more than the maximum allowed number of cards")
+	if spec.Version == 0 {
+		spec.Version = 1
+	} else if spec.Version < 0 {
+		return nil, errors.New("Specification has an invalid format version")
+	} else if spec.Version > SpecFormatVersion {
+		return nil, ErrUnsupportedSpecVersion
+	}
+
+	if len(spec.ExtraDecks)+1 > MaxDeckCount {
+		return nil, errors.New("Specification contains more than the maximum of " + strconv.Itoa(MaxDeckCount) + " decks")
+	}
+	spec.DeckNames = []string{MainDeckName}
+	for _, deck := range spec.ExtraDecks {
+		if (len(deck.Name) == 0) || strings.ContainsAny(deck.Name, " \t\r\n") || (len(deck.Name) > MaxDeckNameLength) {
+			return nil, errors.New("Specification includes a deck with a name that is empty, contains spaces or is too long")
+		}
+		if spec.FindDeckByName(deck.Name) != protocol.DECK_ID_NONE {
+			return nil, errors.New("Specification includes more than one deck named '" + deck.Name + "'")
+		}
+		spec.DeckNames = append(spec.DeckNames, deck.Name)
+	}
+
+	spec.Deck = make([]string, 0)
+	spec.cardSpecs = make([]*CardSpec, 0)
+	spec.cardDecks = make([]uint16, 0)
+	// Role cards are numbered after the cards of every deck, and do not belong to any deck
+	cardLists := make([][]CardSpec, 0, len(spec.DeckNames)+1)
+	for deckId := range spec.DeckNames {
+		cardLists = append(cardLists, spec.DeckCards(uint16(deckId)))
+	}
+	cardLists = append(cardLists, spec.Roles)
+	for listIndex, deckCards := range cardLists {
+		deckId := uint16(listIndex)
+		if listIndex == len(spec.DeckNames) {
+			deckId = protocol.DECK_ID_NONE
+		}
+		for cardSpecIndex := range deckCards {
+			card := &deckCards[cardSpecIndex]
+			if strings.ContainsAny(card.Name, " \t\r\n") {
+				return nil, errors.New("Specification includes cards with spaces in their names")
+			}
+			if strings.ContainsAny(card.Type, " \t\r\n") || (len(card.Type) > protocol.MaxCardTypeLength) {
+				return nil, errors.New("Specification includes card '" + card.Name + "' with a type that contains spaces or is too long")
+			}
+			if card.Count < 1 {
+				return nil, errors.New("Specification includes card '" + card.Name + "' with a count of less than 1")
+			}
+			if len(spec.Deck)+card.Count > protocol.CARD_ID_MAX {
+				return nil, errors.New("Specification contains more than the maximum allowed number of cards")
+			}
+			for i := 0; i < card.Count; i++ {
+				spec.Deck = append(spec.Deck, card.Name)
+				spec.cardSpecs = append(spec.cardSpecs, card)
+				spec.cardDecks = append(spec.cardDecks, deckId)
+			}
+		}
+	}
+
+	if (spec.MinPlayers < 0) || (spec.MaxPlayers < 0) {
+		return nil, errors.New("Specification has a negative minimum or maximum number of players")
+	}
+	if (spec.MaxPlayers > 0) && (spec.MinPlayers > spec.MaxPlayers) {
+		return nil, errors.New("Specification has a minimum number of players that is larger than its maximum")
+	}
+
+	if spec.StartingHandSize < 0 {
+		return nil, errors.New("Specification has a negative starting hand size")
+	}
+	for playerCount, handSize := range spec.StartingHandSizes {
+		if (playerCount < 1) || (handSize < 0) {
+			return nil, errors.New("Specification has a starting hand size for an invalid number of players, or a negative hand size")
+		}
+	}
+
+	if (spec.MarketSize < 0) || (spec.MarketSize > MaxMarketSize) {
+		return nil, errors.New("Specification has a market size that is not between 0 and " + strconv.Itoa(MaxMarketSize))
 	}
-	for _, cardName := range spec.Deck {
-		if strings.ContainsAny(cardName, " \t\r\n") {
-			return nil, errors.New("Specification includes cards with spaces in their names")
+
+	for diceIndex, dice := range spec.Dice {
+		if (len(dice.Name) == 0) || strings.ContainsAny(dice.Name, " \t\r\n") || (len(dice.Name) > protocol.MaxDiceNameLength) {
+			return nil, errors.New("Specification includes dice with a name that is empty, contains spaces or is too long")
+		}
+		if spec.FindDice(dice.Name) != &spec.Dice[diceIndex] {
+			return nil, errors.New("Specification includes more than one kind of dice named '" + dice.Name + "'")
+		}
+		if (dice.Sides > 0) == (len(dice.Faces) > 0) {
+			return nil, errors.New("Specification includes dice '" + dice.Name + "' that do not have exactly one of a number of sides or a list of faces")
+		}
+		if (dice.Sides < 0) || (dice.Sides > MaxDiceFaceCount) || (len(dice.Faces) > MaxDiceFaceCount) {
+			return nil, errors.New("Specification includes dice '" + dice.Name + "' with more than " + strconv.Itoa(MaxDiceFaceCount) + " faces")
+		}
+		for _, face := range dice.Faces {
+			if (len(face) == 0) || (len(face) > MaxDiceFaceLength) {
+				return nil, errors.New("Specification includes dice '" + dice.Name + "' with a face that is empty or too long")
+			}
 		}
 	}
 
+	for counterName := range spec.Counters {
+		if !protocol.IsValidCounterName(counterName) {
+			return nil, errors.New("Specification includes a counter with an invalid name '" + counterName + "'")
+		}
+	}
+
+	spec.setupSteps = make([]SetupStep, 0, len(spec.Setup))
+	for _, stepStr := range spec.Setup {
+		step, err := parseSetupStep(&spec, stepStr)
+		if err != nil {
+			return nil, err
+		}
+		spec.setupSteps = append(spec.setupSteps, step)
+	}
+
 	return &spec, nil
 }
 
-func SerialiseSpecFromName(specName string) ([]byte, error) {
+func parseSetupStep(spec *GameSpecification, stepStr string) (SetupStep, error) {
+	stepTokens := strings.Fields(stepStr)
+	if len(stepTokens) == 0 {
+		return SetupStep{}, errors.New("Specification contains an empty setup step")
+	}
+
+	step := SetupStep{strings.ToLower(stepTokens[0]), 0, protocol.CARD_ID_NONE}
+	switch step.Action {
+	case SETUP_SHUFFLE:
+		if len(stepTokens) != 1 {
+			return step, errors.New("Setup step '" + stepStr + "' should not have any arguments")
+		}
+
+	case SETUP_DEAL, SETUP_BURN:
+		if len(stepTokens) != 2 {
+			return step, errors.New("Setup step '" + stepStr + "' requires a single number of cards")
+		}
+		count, err := strconv.ParseUint(stepTokens[1], 10, 16)
+		if err != nil {
+			return step, errors.New("Setup step '" + stepStr + "' has an invalid number of cards")
+		}
+		step.Count = int(count)
+
+	case SETUP_GIVE_EACH:
+		if len(stepTokens) != 2 {
+			return step, errors.New("Setup step '" + stepStr + "' requires a single card name")
+		}
+		step.CardId = spec.FindCardByName(stepTokens[1])
+		if (step.CardId == protocol.CARD_ID_NONE) || (spec.CardDeck(step.CardId) == protocol.DECK_ID_NONE) {
+			return step, errors.New("Setup step '" + stepStr + "' refers to a card that is not in the deck")
+		}
+
+	default:
+		return step, errors.New("Setup step '" + stepStr + "' has an unrecognised action")
+	}
+	return step, nil
+}
+
+func IsSpecFileName(filename string) bool {
+	ext := filepath.Ext(filename)
+	return (ext == ".yml") || (ext == ".yaml") || (ext == ".json")
+}
+
+func IsJSONSpecFileName(filename string) bool {
+	return filepath.Ext(filename) == ".json"
+}
+
+// Returns true if the given (uncompressed) spec data is in JSON rather than YAML, which is the case if it is an object
+func isJSONSpecData(data []byte) bool {
+	trimmedData := bytes.TrimSpace(data)
+	return (len(trimmedData) > 0) && (trimmedData[0] == '{')
+}
+
+func ListLocalSpecFiles() ([]string, error) {
 	workingDir, err := os.Getwd()
 	if err != nil {
 		return nil, errors.New("Failed to get the directory for local specification files")
@@ -66,20 +500,32 @@ func SerialiseSpecFromName(specName string) ([]byte, error) {
 	if err != nil {
 		return nil, errors.New("Failed to open the directory for local specification files")
 	}
+	defer dir.Close()
 
 	workingDirEntries, err := dir.Readdirnames(0)
 	if err != nil {
 		return nil, errors.New("Failed to list local specification files")
 	}
 
-	specFileName := ""
+	result := make([]string, 0)
 	for _, filename := range workingDirEntries {
-		ext := filepath.Ext(filename)
-		if (ext != ".yml") && (ext != ".yaml") {
-			continue
+		if IsSpecFileName(filename) {
+			result = append(result, filename)
 		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func SerialiseSpecFromName(specName string) ([]byte, error) {
+	specFileNames, err := ListLocalSpecFiles()
+	if err != nil {
+		return nil, err
+	}
 
-		if filename == specName+ext {
+	specFileName := ""
+	for _, filename := range specFileNames {
+		if filename == specName+filepath.Ext(filename) {
 			specFileName = filename
 			break
 		}
@@ -89,17 +535,62 @@ func SerialiseSpecFromName(specName string) ([]byte, error) {
 		return nil, errors.New("Specification '" + specName + "' not found in the local specification files")
 	}
 
-	specFilePath := filepath.Join(workingDir, specFileName)
-	specData, err := ioutil.ReadFile(specFilePath)
+	specData, err := ioutil.ReadFile(specFileName)
 	if err != nil {
-		return nil, errors.New("Failed to read local specification file '" + specFilePath + "'")
+		return nil, errors.New("Failed to read local specification file '" + specFileName + "'")
 	}
 
 	return SerialiseSpecFromBytes(specData), nil
 }
 
+func LoadSpecFromFile(specFilePath string) (*GameSpecification, error) {
+	specData, err := ioutil.ReadFile(specFilePath)
+	if err != nil {
+		return nil, errors.New("Failed to read specification file '" + specFilePath + "'")
+	}
+	return NewSpec(SerialiseSpecFromBytes(specData))
+}
+
+func MarshalSpec(spec *GameSpecification) ([]byte, error) {
+	return yaml.Marshal(spec)
+}
+
+// Writes the spec out as JSON, with the same field names as in YAML. The spec is converted via YAML so that the field
+// names and the short forms of cards only need to be defined once.
+func MarshalSpecJSON(spec *GameSpecification) ([]byte, error) {
+	yamlData, err := MarshalSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	var specFields map[string]interface{}
+	err = yaml.Unmarshal(yamlData, &specFields)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(specFields, "", "  ")
+}
+
+// Returns a hash of the canonical form of the spec, which is the same for any two specs that define the same game
+// regardless of how their spec files were written
+func HashSpec(spec *GameSpecification) ([]byte, error) {
+	specData, err := MarshalSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(specData)
+	return hash[:], nil
+}
+
+// Returns a short, human-readable form of a spec hash that players can compare with each other
+func SpecFingerprint(specHash []byte) string {
+	if len(specHash) < 4 {
+		return "<NO-FINGERPRINT>"
+	}
+	return hex.EncodeToString(specHash[:2]) + "-" + hex.EncodeToString(specHash[2:4])
+}
+
 func SerialiseSpecFromSpec(spec *GameSpecification) ([]byte, error) {
-	specData, err := yaml.Marshal(spec)
+	specData, err := MarshalSpec(spec)
 	return SerialiseSpecFromBytes(specData), err
 }
 
@@ -1,41 +1,212 @@
 package main
 
 import (
+	"errors"
 	"math/rand"
 	"sync"
 	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
 )
 
+const MaxGameEventLogLength = 256
+
+var ErrTooManyPlayers = errors.New("The game already has as many players as its spec allows")
+var ErrGameFull = errors.New("The game already has as many players as the server allows")
+var ErrPlayerNameTaken = errors.New("Another player or a card in the game already has that name")
+var ErrCardNotInHand = errors.New("The player does not have that card")
+var ErrTradeWithdrawn = errors.New("The player who made the trade offer has left or no longer has the card they offered")
+
+type GameEvent struct {
+	Timestamp        time.Time
+	PlayerName       string
+	TargetPlayerName string
+	Notify           protocol.NotifyPlayerActionCommand
+}
+
+type DiscardedCard struct {
+	CardId uint16
+	FaceUp bool
+}
+
+// Scores are kept by player name rather than ID so that they are not lost if a player leaves and rejoins the game
+type PlayerScores struct {
+	PlayerName string
+	Rounds     []int64
+}
+
+type TradeOffer struct {
+	SourcePlayerId  uint64
+	TargetPlayerId  uint64
+	OfferedCardId   uint16
+	RequestedCardId uint16
+}
+
+type HandViewRequest struct {
+	SourcePlayerId uint64
+	TargetPlayerId uint64
+}
+
 type GameState struct {
-	spec    *GameSpecification
-	Deck    []uint16
-	Players []*PlayerState
-	mutex   *sync.Mutex
-	Id      uint64
-	rng     *rand.Rand
+	spec             *GameSpecification
+	Decks            [][]uint16 // The cards in each deck (indexed by deck ID) from bottom to top
+	DiscardPile      []DiscardedCard
+	Table            []uint16
+	Market           []uint16 // The face-up cards in the market row, which is refilled from the deck (if the spec has one)
+	Players          []*PlayerState
+	mutex            *sync.Mutex
+	Id               uint64
+	JoinCode         string // A short, human-friendly alternative to the ID, e.g "BRAVE-OTTER-42"
+	Name             string
+	Public           bool
+	rng              *rand.Rand
+	EventLog         []GameEvent
+	Started          bool
+	OwnerId          uint64 // The player allowed to run administrative commands. Initially the player who created the game
+	TradeOffers      []TradeOffer
+	ViewHandRequests []HandViewRequest
+	Scores           []PlayerScores
+
+	eventCount   uint64
+	undoHistory  []*GameSnapshot
+	undoMutex    *sync.Mutex // Held while an undoable command is running, see TakeSnapshot
+	undoProposal *UndoProposal
+	poll         *Poll
+
+	// The player whose turn it is, or PLAYER_ID_NONE if the game has not started and so turns are not being tracked
+	TurnPlayerId    uint64
+	turnTimeLimit   time.Duration
+	turnAutoAdvance bool
+	turnSequence    uint64
+
+	specHash []byte // Computed by the server when the game is created, see HashSpec
+
+	roleCards []uint16          // Every role card in the spec
+	Roles     map[uint64]uint16 // The role card that each player was dealt
+
+	// The most players that the server allows in the game, or 0 if there is no limit. See AddPlayer.
+	MaxPlayers int
+
+	lastActivity time.Time // When a player (other than a bot) last sent a command for this game
+	idleWarned   bool      // Whether the players have been warned that the game will soon be closed for being idle
+
+	replay *ReplayWriter // Records every event in the game, or nil if the server is not recording games
+
+	history []HistoryEntry // Everything that has happened in the game, see HistoryForPlayer
+
+	ircBridge *IRCBridge // Mirrors the game's events into an IRC channel, or nil if the server is not configured to
 }
 
 func CreateGameFromSpec(spec *GameSpecification) GameState {
 	result := GameState{
 		spec,
-		make([]uint16, len(spec.Deck)),
+		make([][]uint16, len(spec.DeckNames)),
+		make([]DiscardedCard, 0),
+		make([]uint16, 0),
+		make([]uint16, 0),
 		make([]*PlayerState, 0),
 		&sync.Mutex{},
 		uint64(0),
+		"",
+		"",
+		false,
 		rand.New(rand.NewSource(time.Now().UTC().UnixNano())),
+		make([]GameEvent, 0),
+		false,
+		protocol.PLAYER_ID_NONE,
+		make([]TradeOffer, 0),
+		make([]HandViewRequest, 0),
+		make([]PlayerScores, 0),
+		0,
+		make([]*GameSnapshot, 0),
+		&sync.Mutex{},
+		nil,
+		nil,
+		protocol.PLAYER_ID_NONE,
+		0,
+		false,
+		0,
+		nil,
+		make([]uint16, 0),
+		make(map[uint64]uint16),
+		0,
+		time.Now(),
+		false,
+		nil,
+		make([]HistoryEntry, 0),
+		nil,
 	}
 
-	for cardId, _ := range spec.Deck {
-		result.Deck[cardId] = uint16(cardId)
+	for deckId := range result.Decks {
+		result.Decks[deckId] = make([]uint16, 0)
+	}
+	for cardId := range spec.Deck {
+		deckId := spec.CardDeck(uint16(cardId))
+		if deckId == protocol.DECK_ID_NONE {
+			result.roleCards = append(result.roleCards, uint16(cardId))
+			continue
+		}
+		result.Decks[deckId] = append(result.Decks[deckId], uint16(cardId))
 	}
 	return result
 }
 
-func (gs *GameState) AddPlayer(newPlayer *PlayerState) {
+// Adds the player to the game, unless it already has as many players as its spec allows (ErrTooManyPlayers) or the
+// server allows (ErrGameFull), or the player's name is already taken (ErrPlayerNameTaken). These are all checked while
+// holding the game mutex, so two players that join at the same time can't both get the last place in the game or the
+// same name.
+func (gs *GameState) AddPlayer(newPlayer *PlayerState) error {
 	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	if (gs.spec.MaxPlayers > 0) && (len(gs.Players) >= gs.spec.MaxPlayers) {
+		return ErrTooManyPlayers
+	}
+	if (gs.MaxPlayers > 0) && (len(gs.Players) >= gs.MaxPlayers) {
+		return ErrGameFull
+	}
+	if gs.isNameTaken(newPlayer.Name) {
+		return ErrPlayerNameTaken
+	}
 	gs.Players = append(gs.Players, newPlayer)
 	newPlayer.CurrentGame = gs
-	gs.mutex.Unlock()
+	gs.initPlayerCounters(newPlayer)
+	return nil
+}
+
+// Returns true if the given name matches that of a player or card in the game, ignoring case
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) isNameTaken(name string) bool {
+	lowerName := foldForMatching(name, false)
+	for _, player := range gs.Players {
+		if foldForMatching(player.Name, false) == lowerName {
+			return true
+		}
+	}
+	for _, cardName := range gs.spec.Deck {
+		if foldForMatching(cardName, false) == lowerName {
+			return true
+		}
+	}
+	return false
+}
+
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) initPlayerCounters(player *PlayerState) {
+	player.Counters = make(map[string]int64)
+	if gs.spec == nil {
+		return
+	}
+	for counterName, startValue := range gs.spec.Counters {
+		player.Counters[counterName] = startValue
+	}
+}
+
+// Sets the counters of every player in the game back to the starting values given in the spec
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) resetPlayerCounters() {
+	for _, player := range gs.Players {
+		gs.initPlayerCounters(player)
+	}
 }
 
 func (gs *GameState) RemovePlayer(player *PlayerState) {
@@ -50,88 +221,626 @@ func (gs *GameState) RemovePlayer(player *PlayerState) {
 	gs.mutex.Unlock()
 }
 
-func (gs *GameState) BroadcastNotification(notify NotifyPlayerActionCommand) error {
+// If the given player (who has already been removed from the game) was the owner, hands ownership over to one of the
+// remaining players and tells everyone who the new owner is.
+func (gs *GameState) handOverOwnership(leavingPlayerId uint64) {
+	gs.mutex.Lock()
+	if (gs.OwnerId != leavingPlayerId) || (len(gs.Players) == 0) {
+		gs.mutex.Unlock()
+		return
+	}
+	// Bots can't run any of the owner's commands, so prefer to give the game to a real player
+	gs.OwnerId = gs.Players[0].Id
+	for _, player := range gs.Players {
+		if !player.IsBot {
+			gs.OwnerId = player.Id
+			break
+		}
+	}
+	newOwnerId := gs.OwnerId
+	gs.mutex.Unlock()
+
+	notifyAction := protocol.NewPlayerActionNotify(newOwnerId, protocol.CMD_GAME_TRANSFER_OWNER, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+	err := gs.SendNotificationToSourcePlayer(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to send ownership notification to the new owner: %s", err)
+	}
+	err = gs.BroadcastNotification(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to broadcast ownership notification: %s", err)
+	}
+}
+
+func (gs *GameState) BroadcastNotification(notify protocol.NotifyPlayerActionCommand) error {
 	cmdLen := notify.CommandLength()
-	if cmdLen > MaxNotifyPlayerActionCommandLength {
-		return ErrInvalidLength
+	if cmdLen > protocol.MaxNotifyPlayerActionCommandLength {
+		return protocol.ErrInvalidLength
 	}
-	buffer, headerLen := WriteCommandHeader(CMD_NOTIFY_PLAYER_ACTION, uint16(cmdLen))
-	SerialiseNotifyPlayerActionCommand(buffer[headerLen:], &notify, false)
+	buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_NOTIFY_PLAYER_ACTION, uint16(cmdLen))
+	protocol.SerialiseNotifyPlayerActionCommand(buffer[headerLen:], &notify, false)
 
 	gs.mutex.Lock()
-	var err error = nil
+	gs.recordEvent(notify)
+	recipients := make([]*PlayerState, 0, len(gs.Players))
 	for _, player := range gs.Players {
-		if (player.Id == notify.playerId) || (player.Id == notify.targetPlayerId) {
+		if (player.Id == notify.PlayerId) || (player.Id == notify.TargetPlayerId) {
 			continue
 		}
+		recipients = append(recipients, player)
+	}
+	gs.mutex.Unlock()
+
+	// Nothing is sent while the lock is held, so that one slow connection can never hold up everyone else in the game
+	return sendToPlayers(recipients, buffer)
+}
+
+// Sends the given command to each of the given players, returning the last error (if any)
+func sendToPlayers(players []*PlayerState, buffer []byte) error {
+	var result error = nil
+	for _, player := range players {
+		err := player.SendCommandBuffer(buffer)
+		if err != nil {
+			result = err
+		}
+	}
+	return result
+}
+
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) recordEvent(notify protocol.NotifyPlayerActionCommand) {
+	event := gs.newGameEvent(notify)
+	if len(gs.EventLog) >= MaxGameEventLogLength {
+		copy(gs.EventLog, gs.EventLog[1:])
+		gs.EventLog = gs.EventLog[:len(gs.EventLog)-1]
+	}
+	gs.EventLog = append(gs.EventLog, event)
+	gs.eventCount++
+	gs.recordPublicHistory(event)
+	gs.recordReplayEvent(event)
+	gs.mirrorEvent(event)
+}
+
+func (gs *GameState) RecordEvent(notify protocol.NotifyPlayerActionCommand) {
+	gs.mutex.Lock()
+	gs.recordEvent(notify)
+	gs.mutex.Unlock()
+}
 
-		err = player.SendCommandBuffer(buffer)
+func (gs *GameState) RecentEvents(count int) []GameEvent {
+	gs.mutex.Lock()
+	if len(gs.EventLog) < count {
+		count = len(gs.EventLog)
 	}
+	result := make([]GameEvent, count)
+	copy(result, gs.EventLog[len(gs.EventLog)-count:])
 	gs.mutex.Unlock()
-	return err
+	return result
 }
 
-func (gs *GameState) SendNotificationToSourcePlayer(notify NotifyPlayerActionCommand) error {
-	return gs.SendNotificationToPlayer(notify, notify.playerId)
+func (gs *GameState) SendNotificationToSourcePlayer(notify protocol.NotifyPlayerActionCommand) error {
+	return gs.SendNotificationToPlayer(notify, notify.PlayerId)
 }
 
-func (gs *GameState) SendNotificationToTargetPlayer(notify NotifyPlayerActionCommand) error {
-	return gs.SendNotificationToPlayer(notify, notify.targetPlayerId)
+func (gs *GameState) SendNotificationToTargetPlayer(notify protocol.NotifyPlayerActionCommand) error {
+	return gs.SendNotificationToPlayer(notify, notify.TargetPlayerId)
 }
 
-func (gs *GameState) SendNotificationToPlayer(notify NotifyPlayerActionCommand, destinationPlayerId uint64) error {
+func (gs *GameState) SendNotificationToPlayer(notify protocol.NotifyPlayerActionCommand, destinationPlayerId uint64) error {
 	cmdLen := notify.CommandLength()
-	if cmdLen > MaxNotifyPlayerActionCommandLength {
-		return ErrInvalidLength
+	if cmdLen > protocol.MaxNotifyPlayerActionCommandLength {
+		return protocol.ErrInvalidLength
 	}
-	buffer, headerLen := WriteCommandHeader(CMD_NOTIFY_PLAYER_ACTION, uint16(cmdLen))
-	SerialiseNotifyPlayerActionCommand(buffer[headerLen:], &notify, false)
+	buffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_NOTIFY_PLAYER_ACTION, uint16(cmdLen))
+	protocol.SerialiseNotifyPlayerActionCommand(buffer[headerLen:], &notify, false)
 
-	var err error = nil
-	playerFound := false
+	var destination *PlayerState = nil
+	gs.mutex.Lock()
 	for _, player := range gs.Players {
-		if player.Id != destinationPlayerId {
-			continue
+		if player.Id == destinationPlayerId {
+			gs.recordPrivateHistory(notify, destinationPlayerId)
+			destination = player
+			break
 		}
-
-		err = player.SendCommandBuffer(buffer)
-		playerFound = true
-		break
 	}
+	gs.mutex.Unlock()
 
-	if (err == nil) && (!playerFound) {
-		return ErrInvalidPlayerId
+	if destination == nil {
+		return protocol.ErrInvalidPlayerId
 	}
-	return err
+	return destination.SendCommandBuffer(buffer)
 }
 
 func (gs *GameState) Draw(deckId uint16, count int) []uint16 {
 	gs.mutex.Lock()
-	if len(gs.Deck) < count {
-		count = len(gs.Deck)
+	deck := gs.Decks[deckId]
+	if len(deck) < count {
+		count = len(deck)
 	}
 
 	result := make([]uint16, count)
 	for i := 0; i < count; i++ {
-		result[i] = gs.Deck[len(gs.Deck)-i-1]
+		result[i] = deck[len(deck)-i-1]
 	}
-	gs.Deck = gs.Deck[:len(gs.Deck)-count]
+	gs.Decks[deckId] = deck[:len(deck)-count]
 	gs.mutex.Unlock()
 	return result
 }
 
-func (gs *GameState) ShuffleDeck() {
-	gs.rng.Shuffle(len(gs.Deck), func(i, j int) {
-		gs.Deck[i], gs.Deck[j] = gs.Deck[j], gs.Deck[i]
+// Deals count cards from the top of the deck to each player in turn (one card at a time, as if dealing by hand) and
+// returns the cards that each player received. If the deck runs out then some players will receive fewer cards.
+func (gs *GameState) Deal(deckId uint16, count int) map[uint64][]uint16 {
+	gs.mutex.Lock()
+	result := make(map[uint64][]uint16, len(gs.Players))
+	for i := 0; i < count; i++ {
+		for _, player := range gs.Players {
+			deck := gs.Decks[deckId]
+			if len(deck) == 0 {
+				break
+			}
+			cardId := deck[len(deck)-1]
+			gs.Decks[deckId] = deck[:len(deck)-1]
+			player.Draw(cardId)
+			result[player.Id] = append(result[player.Id], cardId)
+		}
+	}
+	gs.mutex.Unlock()
+	return result
+}
+
+// Shuffles the spec's role cards and deals one to each player, replacing any roles that were dealt previously. If there
+// are more players than roles then the players at the end of the list do not get one. Returns the role of each player.
+func (gs *GameState) DealRoles() map[uint64]uint16 {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	gs.rng.Shuffle(len(gs.roleCards), func(i, j int) {
+		gs.roleCards[i], gs.roleCards[j] = gs.roleCards[j], gs.roleCards[i]
 	})
+	gs.Roles = make(map[uint64]uint16, len(gs.Players))
+	for index, player := range gs.Players {
+		if index >= len(gs.roleCards) {
+			break
+		}
+		gs.Roles[player.Id] = gs.roleCards[index]
+	}
+
+	result := make(map[uint64]uint16, len(gs.Roles))
+	for playerId, cardId := range gs.Roles {
+		result[playerId] = cardId
+	}
+	return result
+}
+
+// Draws cards from the top of the deck until a card of the given type is drawn or the deck runs out. Returns the drawn
+// cards (the last of which has the given type, if one was found) and whether a card of that type was found.
+func (gs *GameState) DrawUntilType(deckId uint16, cardType string) ([]uint16, bool) {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	result := make([]uint16, 0)
+	for len(gs.Decks[deckId]) > 0 {
+		deck := gs.Decks[deckId]
+		cardId := deck[len(deck)-1]
+		gs.Decks[deckId] = deck[:len(deck)-1]
+		result = append(result, cardId)
+		if gs.spec.IsCardOfType(cardId, cardType) {
+			return result, true
+		}
+	}
+	return result, false
+}
+
+// Returns the number of cards of each of the spec's card types that are left in the main deck
+func (gs *GameState) DeckTypeCounts() ([]string, []uint16) {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	types := gs.spec.CardTypes()
+	counts := make([]uint16, len(types))
+	for _, cardId := range gs.Decks[0] {
+		for typeIndex, cardType := range types {
+			if gs.spec.IsCardOfType(cardId, cardType) {
+				counts[typeIndex]++
+				break
+			}
+		}
+	}
+	return types, counts
+}
+
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) AddToDiscardPile(cardId uint16, faceUp bool) {
+	gs.DiscardPile = append(gs.DiscardPile, DiscardedCard{cardId, faceUp})
+}
+
+// Returns the IDs of the cards in the discard pile from top to bottom, with face-down cards hidden
+func (gs *GameState) VisibleDiscardPile() []uint16 {
+	gs.mutex.Lock()
+	result := make([]uint16, len(gs.DiscardPile))
+	for i, card := range gs.DiscardPile {
+		cardId := card.CardId
+		if !card.FaceUp {
+			cardId = protocol.CARD_ID_ANY
+		}
+		result[len(result)-i-1] = cardId
+	}
+	gs.mutex.Unlock()
+	return result
+}
+
+// Returns the ID of the card on top of the main deck if the game keeps it face-up, or CARD_ID_NONE if it is hidden or
+// the deck is empty
+func (gs *GameState) FaceUpTopCard() uint16 {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	deck := gs.Decks[0]
+	if !gs.spec.TopCardFaceUp || (len(deck) == 0) {
+		return protocol.CARD_ID_NONE
+	}
+	return deck[len(deck)-1]
+}
+
+// Tells everyone in the game which card is now face-up on top of the deck, if it is different to what it was before
+// the given player's action. The notification carries no cards if the deck has run out.
+func (gs *GameState) notifyTopCardChange(playerId uint64, previousTopCard uint16) {
+	topCard := gs.FaceUpTopCard()
+	if topCard == previousTopCard {
+		return
+	}
+	var cardIds []uint16
+	if topCard != protocol.CARD_ID_NONE {
+		cardIds = []uint16{topCard}
+	}
+	notifyAction := protocol.NewPlayerActionNotify(playerId, protocol.CMD_DECK_TOP_CARD, 0, protocol.PLAYER_ID_NONE, cardIds)
+	err := gs.SendNotificationToSourcePlayer(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to send top card notification to source player: %s", err)
+	}
+	err = gs.BroadcastNotification(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to broadcast top card notification: %s", err)
+	}
+}
+
+// Returns the index in the discard pile of the card that would be picked up, or -1 if there is no such card.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) FindDiscardedCard(cardId uint16, search bool) int {
+	if !search {
+		return len(gs.DiscardPile) - 1
+	}
+
+	for index := len(gs.DiscardPile) - 1; index >= 0; index-- {
+		card := gs.DiscardPile[index]
+		if card.FaceUp && gs.spec.SameCard(card.CardId, cardId) {
+			return index
+		}
+	}
+	return -1
+}
+
+// Returns false (and leaves the deck untouched) if newOrder is not a valid ordering of the top cards of the deck
+func (gs *GameState) RearrangeDeck(deckId uint16, newOrder []uint16) bool {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	deck := gs.Decks[deckId]
+	count := len(newOrder)
+	if count > len(deck) {
+		return false
+	}
+	seen := make([]bool, count)
+	for _, oldPosition := range newOrder {
+		if (int(oldPosition) >= count) || seen[oldPosition] {
+			return false
+		}
+		seen[oldPosition] = true
+	}
+
+	topIndex := len(deck) - 1
+	oldTop := make([]uint16, count)
+	for i := 0; i < count; i++ {
+		oldTop[i] = deck[topIndex-i]
+	}
+	for newPosition, oldPosition := range newOrder {
+		deck[topIndex-newPosition] = oldTop[oldPosition]
+	}
+	return true
+}
+
+// Removes a card with the same name as the given card from the deck and returns its ID, or CARD_ID_NONE if there is no
+// such card in the deck. The deck is shuffled afterwards so that nobody learns anything about the order of the deck.
+func (gs *GameState) Fetch(deckId uint16, cardId uint16) uint16 {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	deck := gs.Decks[deckId]
+	for index, deckCardId := range deck {
+		if gs.spec.SameCard(deckCardId, cardId) {
+			gs.Decks[deckId] = append(deck[:index], deck[index+1:]...)
+			gs.ShuffleDeck(deckId)
+			return deckCardId
+		}
+	}
+	return protocol.CARD_ID_NONE
+}
+
+// Returns the index on the table of a card with the same name as the given card, or -1 if there is no such card.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) FindTableCard(cardId uint16) int {
+	for index, tableCardId := range gs.Table {
+		if gs.spec.SameCard(tableCardId, cardId) {
+			return index
+		}
+	}
+	return -1
+}
+
+// Returns the index in the player's tableau of a card with the same name as the given card, or -1 if there is no such card.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) FindTableauCard(player *PlayerState, cardId uint16) int {
+	for index, tableauCardId := range player.Tableau {
+		if gs.spec.SameCard(tableauCardId, cardId) {
+			return index
+		}
+	}
+	return -1
+}
+
+// Returns the index in the player's hand of a card with the same name as the given card, or -1 if there is no such card.
+// Unlike FindCard this does not need the exact card ID, so it can be used for cards in other players' hands.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) FindCardByName(player *PlayerState, cardId uint16) int {
+	for index, handCardId := range player.Hand {
+		if gs.spec.SameCard(handCardId, cardId) {
+			return index
+		}
+	}
+	return -1
+}
+
+// Adds the given trade offer, replacing any previous offer between the same two players.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) addTradeOffer(offer TradeOffer) {
+	gs.removeTradeOffer(offer.SourcePlayerId, offer.TargetPlayerId)
+	gs.TradeOffers = append(gs.TradeOffers, offer)
+}
+
+// Returns the index of the trade offer from the given source player to the given target player, or -1 if there is none.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) findTradeOffer(sourcePlayerId uint64, targetPlayerId uint64) int {
+	for index, offer := range gs.TradeOffers {
+		if (offer.SourcePlayerId == sourcePlayerId) && (offer.TargetPlayerId == targetPlayerId) {
+			return index
+		}
+	}
+	return -1
+}
+
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) removeTradeOffer(sourcePlayerId uint64, targetPlayerId uint64) {
+	offerIndex := gs.findTradeOffer(sourcePlayerId, targetPlayerId)
+	if offerIndex >= 0 {
+		gs.TradeOffers = append(gs.TradeOffers[:offerIndex], gs.TradeOffers[offerIndex+1:]...)
+	}
+}
+
+// Records an offer from the source player to trade one of their cards for a card like the requested one from the
+// target player. The offer is for the specific card in the source player's hand, so offering CARD_ID_ANY picks one at
+// random now rather than when the offer is accepted.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) offerTrade(sourcePlayer *PlayerState, targetPlayerId uint64, offeredCardId uint16, requestedCardId uint16) (TradeOffer, error) {
+	cardIndex := gs.FindCard(sourcePlayer, offeredCardId)
+	if cardIndex < 0 {
+		return TradeOffer{}, ErrCardNotInHand
+	}
+	offer := TradeOffer{sourcePlayer.Id, targetPlayerId, sourcePlayer.Hand[cardIndex], requestedCardId}
+	gs.addTradeOffer(offer)
+	return offer, nil
+}
+
+// Swaps the cards in the given trade offer between the hands of the two players, now that the target player has
+// accepted it. Returns the player who made the offer and the ID of the card that they received.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) acceptTrade(targetPlayer *PlayerState, offer TradeOffer) (*PlayerState, uint16, error) {
+	requestedCardIndex := gs.FindCardByName(targetPlayer, offer.RequestedCardId)
+	if requestedCardIndex < 0 {
+		return nil, 0, ErrCardNotInHand
+	}
+	gs.removeTradeOffer(offer.SourcePlayerId, offer.TargetPlayerId)
+	sourcePlayerIndex := gs.FindPlayer(offer.SourcePlayerId)
+	if sourcePlayerIndex < 0 {
+		return nil, 0, ErrTradeWithdrawn
+	}
+	sourcePlayer := gs.Players[sourcePlayerIndex]
+	offeredCardIndex := gs.FindCard(sourcePlayer, offer.OfferedCardId)
+	if offeredCardIndex < 0 {
+		return nil, 0, ErrTradeWithdrawn
+	}
+
+	requestedCardId := targetPlayer.Hand[requestedCardIndex]
+	targetPlayer.Discard(requestedCardIndex)
+	sourcePlayer.Discard(offeredCardIndex)
+	targetPlayer.Draw(offer.OfferedCardId)
+	sourcePlayer.Draw(requestedCardId)
+	return sourcePlayer, requestedCardId, nil
+}
+
+// Records the score for the given player's next round, returning the round number and the player's new total score.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) addScore(playerName string, value int64) (int, int64) {
+	scoresIndex := -1
+	for index, scores := range gs.Scores {
+		if scores.PlayerName == playerName {
+			scoresIndex = index
+			break
+		}
+	}
+	if scoresIndex < 0 {
+		gs.Scores = append(gs.Scores, PlayerScores{playerName, make([]int64, 0)})
+		scoresIndex = len(gs.Scores) - 1
+	}
+
+	scores := &gs.Scores[scoresIndex]
+	scores.Rounds = append(scores.Rounds, value)
+	total := int64(0)
+	for _, roundScore := range scores.Rounds {
+		total += roundScore
+	}
+	return len(scores.Rounds), total
+}
+
+// Removes the request from the source player to see the target player's hand, returning false if there was no such request.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) removeViewHandRequest(sourcePlayerId uint64, targetPlayerId uint64) bool {
+	for index, request := range gs.ViewHandRequests {
+		if (request.SourcePlayerId == sourcePlayerId) && (request.TargetPlayerId == targetPlayerId) {
+			gs.ViewHandRequests = append(gs.ViewHandRequests[:index], gs.ViewHandRequests[index+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Returns every card in the game (from player hands, tableaus, the table, the market and the discard pile) to the deck it
+// came from and shuffles every deck, so that a new round can be played with the same players.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) ResetCards() {
+	for _, player := range gs.Players {
+		gs.returnToDecks(player.Hand)
+		gs.returnToDecks(player.Tableau)
+		player.Hand = make([]uint16, 0)
+		player.Tableau = make([]uint16, 0)
+		player.HandRevealed = false
+		player.FaceUpCards = make([]uint16, 0)
+	}
+	gs.returnToDecks(gs.Table)
+	gs.Table = make([]uint16, 0)
+	gs.returnToDecks(gs.Market)
+	gs.Market = make([]uint16, 0)
+	for _, card := range gs.DiscardPile {
+		gs.returnToDecks([]uint16{card.CardId})
+	}
+	gs.DiscardPile = make([]DiscardedCard, 0)
+
+	// Any outstanding trades refer to cards that are no longer in anybody's hand
+	gs.TradeOffers = make([]TradeOffer, 0)
+	for deckId := range gs.Decks {
+		gs.ShuffleDeck(uint16(deckId))
+	}
+}
+
+// Puts each of the given cards back on top of the deck that it belongs to
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) returnToDecks(cardIds []uint16) {
+	for _, cardId := range cardIds {
+		deckId := gs.spec.CardDeck(cardId)
+		if deckId == protocol.DECK_ID_NONE {
+			continue
+		}
+		gs.Decks[deckId] = append(gs.Decks[deckId], cardId)
+	}
+}
+
+// Takes every card out of the given player's hand and tableau, either moving them to the discard pile (with the cards
+// from their hand face-down, unless they were already face-up) or shuffling them back into the decks they came from.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) ReclaimPlayerCards(player *PlayerState, discard bool) {
+	if discard {
+		for _, cardId := range player.Hand {
+			gs.AddToDiscardPile(cardId, player.IsFaceUp(cardId))
+		}
+		for _, cardId := range player.Tableau {
+			gs.AddToDiscardPile(cardId, true)
+		}
+	} else {
+		gs.returnToDecks(player.Hand)
+		gs.returnToDecks(player.Tableau)
+		for deckId := range gs.Decks {
+			gs.ShuffleDeck(uint16(deckId))
+		}
+	}
+	player.Hand = make([]uint16, 0)
+	player.Tableau = make([]uint16, 0)
+	player.FaceUpCards = make([]uint16, 0)
+}
+
+func (gs *GameState) ShuffleDeck(deckId uint16) {
+	deck := gs.Decks[deckId]
+	gs.rng.Shuffle(len(deck), func(i, j int) {
+		deck[i], deck[j] = deck[j], deck[i]
+	})
+}
+
+func (gs *GameState) ShuffleHand(player *PlayerState) []uint16 {
+	gs.mutex.Lock()
+	gs.rng.Shuffle(len(player.Hand), func(i, j int) {
+		player.Hand[i], player.Hand[j] = player.Hand[j], player.Hand[i]
+	})
+	result := make([]uint16, len(player.Hand))
+	copy(result, player.Hand)
+	gs.mutex.Unlock()
+	return result
+}
+
+// Reorders the player's hand as described by a CardArrangeHandCommand and returns a copy of the new hand. Returns false
+// (and leaves the hand as it was) if newOrder doesn't give every card in the hand exactly once.
+func (gs *GameState) ArrangeHand(player *PlayerState, newOrder []uint16) ([]uint16, bool) {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	count := len(player.Hand)
+	if len(newOrder) != count {
+		return nil, false
+	}
+	seen := make([]bool, count)
+	for _, oldPosition := range newOrder {
+		if (int(oldPosition) >= count) || seen[oldPosition] {
+			return nil, false
+		}
+		seen[oldPosition] = true
+	}
+
+	newHand := make([]uint16, count)
+	for newPosition, oldPosition := range newOrder {
+		newHand[newPosition] = player.Hand[oldPosition]
+	}
+	player.Hand = newHand
+	return copyCardIds(newHand), true
+}
+
+func (gs *GameState) RollDice(count int, sides int) []uint16 {
+	gs.mutex.Lock()
+	result := make([]uint16, count)
+	for i := range result {
+		result[i] = uint16(gs.rng.Intn(sides) + 1)
+	}
+	gs.mutex.Unlock()
+	return result
+}
+
+func (gs *GameState) PickRandom(options []string) string {
+	gs.mutex.Lock()
+	result := options[gs.rng.Intn(len(options))]
+	gs.mutex.Unlock()
+	return result
+}
+
+// Returns the number of cards left in each deck, indexed by deck ID
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) deckSizes() []uint16 {
+	result := make([]uint16, len(gs.Decks))
+	for deckId, deck := range gs.Decks {
+		result[deckId] = uint16(len(deck))
+	}
+	return result
 }
 
 func (gs *GameState) FindDeck(deckId uint16) int {
-	return 0
+	if int(deckId) >= len(gs.Decks) {
+		return -1
+	}
+	return int(deckId)
 }
 
 func (gs *GameState) FindPlayer(playerId uint64) int {
-	if playerId == PLAYER_ID_ANY {
+	if playerId == protocol.PLAYER_ID_ANY {
 		return gs.rng.Intn(len(gs.Players))
 	}
 
@@ -148,7 +857,10 @@ func (gs *GameState) FindCard(player *PlayerState, cardId uint16) int {
 		return -1
 	}
 
-	if cardId == CARD_ID_ANY {
+	if cardId == protocol.CARD_ID_ANY {
+		if len(player.Hand) == 0 {
+			return -1
+		}
 		return gs.rng.Intn(len(player.Hand))
 	}
 
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// Returns a game of the given built-in spec with a player for each of the given hands, whose IDs start from 1
+func newTestGame(t *testing.T, specName string, hands ...[]uint16) (*GameState, []*PlayerState) {
+	builtinSpec := FindBuiltinSpec(specName)
+	if builtinSpec == nil {
+		t.Fatalf("There is no built-in spec called '%s'", specName)
+	}
+	// Built-in specs go through the same serialisation as any other, which is also what works out their card IDs
+	specData, err := SerialiseSpecFromSpec(builtinSpec)
+	if err != nil {
+		t.Fatalf("Failed to serialise built-in spec '%s': %s", specName, err)
+	}
+	spec, err := NewSpec(specData)
+	if err != nil {
+		t.Fatalf("Failed to load built-in spec '%s': %s", specName, err)
+	}
+	game := CreateGameFromSpec(spec)
+	players := make([]*PlayerState, len(hands))
+	for i, hand := range hands {
+		player := NewPlayerState(uint64(i+1), "player"+strconv.Itoa(i+1), nil)
+		player.Hand = hand
+		// There is no connection for anything to be sent on, so treat them as disconnected
+		player.disconnected = true
+		err = game.AddPlayer(&player)
+		if err != nil {
+			t.Fatalf("Failed to add player %d: %s", i+1, err)
+		}
+		players[i] = &player
+	}
+	return &game, players
+}
+
+func TestTrade(t *testing.T) {
+	tests := []struct {
+		name           string
+		sourceHand     []uint16
+		targetHand     []uint16
+		offeredCardId  uint16
+		requestedCard  uint16
+		offerErr       error
+		acceptErr      error
+		wantSourceHand []uint16
+		wantTargetHand []uint16
+	}{
+		{"Specific cards", []uint16{1, 2}, []uint16{3, 4}, 1, 3, nil, nil, []uint16{2, 3}, []uint16{4, 1}},
+		{"Any card", []uint16{5}, []uint16{6}, protocol.CARD_ID_ANY, 6, nil, nil, []uint16{6}, []uint16{5}},
+		{"All cards", []uint16{5}, []uint16{6}, protocol.CARD_ID_ALL, 6, ErrCardNotInHand, nil, []uint16{5}, []uint16{6}},
+		{"Offered card not in hand", []uint16{5}, []uint16{6}, 7, 6, ErrCardNotInHand, nil, []uint16{5}, []uint16{6}},
+		{"Requested card not in hand", []uint16{5}, []uint16{6}, 5, 7, nil, ErrCardNotInHand, []uint16{5}, []uint16{6}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, players := newTestGame(t, "jokers", test.sourceHand, test.targetHand)
+			source, target := players[0], players[1]
+
+			offer, err := game.offerTrade(source, target.Id, test.offeredCardId, test.requestedCard)
+			if err != test.offerErr {
+				t.Fatalf("Offer returned error %v, expected %v", err, test.offerErr)
+			}
+			if err == nil {
+				if game.findTradeOffer(source.Id, target.Id) < 0 {
+					t.Fatalf("Offer %+v was not recorded", offer)
+				}
+				tradedWith, receivedCardId, err := game.acceptTrade(target, offer)
+				if err != test.acceptErr {
+					t.Fatalf("Accept returned error %v, expected %v", err, test.acceptErr)
+				}
+				if (err == nil) && ((tradedWith != source) || (receivedCardId != test.requestedCard)) {
+					t.Errorf("Accept traded card %d with %v, expected card %d with the source player",
+						receivedCardId, tradedWith, test.requestedCard)
+				}
+			}
+
+			if !reflect.DeepEqual(source.Hand, test.wantSourceHand) {
+				t.Errorf("Source player's hand is %v, expected %v", source.Hand, test.wantSourceHand)
+			}
+			if !reflect.DeepEqual(target.Hand, test.wantTargetHand) {
+				t.Errorf("Target player's hand is %v, expected %v", target.Hand, test.wantTargetHand)
+			}
+		})
+	}
+}
+
+func TestAddPlayer(t *testing.T) {
+	tests := []struct {
+		name           string
+		specMaxPlayers int
+		maxPlayers     int
+		playerName     string
+		wantErr        error
+	}{
+		{"No limit", 0, 0, "carol", nil},
+		{"Below both limits", 3, 3, "carol", nil},
+		{"At the spec's limit", 2, 0, "carol", ErrTooManyPlayers},
+		{"At the server's limit", 0, 2, "carol", ErrGameFull},
+		{"Name of another player", 0, 0, "PLAYER1", ErrPlayerNameTaken},
+		{"Name of a card", 0, 0, "ace-of-spades", ErrPlayerNameTaken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, _ := newTestGame(t, "jokers", nil, nil)
+			game.spec.MaxPlayers = test.specMaxPlayers
+			game.MaxPlayers = test.maxPlayers
+			newPlayer := NewPlayerState(3, test.playerName, nil)
+
+			err := game.AddPlayer(&newPlayer)
+			if err != test.wantErr {
+				t.Fatalf("AddPlayer returned error %v, expected %v", err, test.wantErr)
+			}
+			wantPlayerCount := 3
+			if err != nil {
+				wantPlayerCount = 2
+			}
+			if len(game.Players) != wantPlayerCount {
+				t.Errorf("Game has %d players, expected %d", len(game.Players), wantPlayerCount)
+			}
+			if (err == nil) != (newPlayer.CurrentGame == game) {
+				t.Errorf("Player's current game is %p, expected it to be %p only if they were added", newPlayer.CurrentGame, game)
+			}
+		})
+	}
+}
+
+// Players that join at the same time must not be able to take the game over its limit
+func TestAddPlayerConcurrently(t *testing.T) {
+	game, _ := newTestGame(t, "jokers")
+	game.MaxPlayers = 5
+	var wait sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wait.Add(1)
+		go func(id uint64) {
+			defer wait.Done()
+			newPlayer := NewPlayerState(id, "player"+strconv.FormatUint(id, 10), nil)
+			game.AddPlayer(&newPlayer)
+		}(uint64(i + 1))
+	}
+	wait.Wait()
+	if len(game.Players) != game.MaxPlayers {
+		t.Errorf("Game has %d players, expected %d", len(game.Players), game.MaxPlayers)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// The body of the responses from the health check endpoints
+type HealthStatus struct {
+	Listening     bool   `json:"listening"`
+	Draining      bool   `json:"draining"`
+	UptimeSeconds int64  `json:"uptime_seconds"`
+	Players       int    `json:"players"`
+	Bots          int    `json:"bots"`
+	Games         int    `json:"games"`
+	ActiveGames   int    `json:"active_games"`
+	Protocol      uint16 `json:"protocol"`
+}
+
+func (ss *ServerState) listenerStarted() {
+	ss.mutex.Lock()
+	ss.activeListeners++
+	ss.mutex.Unlock()
+}
+
+func (ss *ServerState) listenerStopped() {
+	ss.mutex.Lock()
+	ss.activeListeners--
+	ss.mutex.Unlock()
+}
+
+func (ss *ServerState) HealthStatus() HealthStatus {
+	activeGames := ss.ActiveGameCount()
+
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	result := HealthStatus{
+		ss.activeListeners == len(ss.config.ListenAddresses), // Not ready if any of the addresses has stopped listening
+		ss.draining,
+		int64(time.Since(ss.startTime) / time.Second),
+		0,
+		0,
+		len(ss.allGames),
+		activeGames,
+		protocol.PROTOCOL_ID,
+	}
+	for _, player := range ss.allPlayers {
+		if player.IsBot {
+			result.Bots++
+		} else {
+			result.Players++
+		}
+	}
+	return result
+}
+
+// Serves HTTP endpoints for load balancers and uptime checkers:
+//   - /healthz succeeds as long as the server is accepting connections
+//   - /readyz also fails once the server has started shutting down, so that no new players are sent to it
+func serveHealthChecks(address string, server *ServerState) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status := server.HealthStatus()
+		writeHealthStatus(w, status, status.Listening)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		status := server.HealthStatus()
+		writeHealthStatus(w, status, status.Listening && !status.Draining)
+	})
+
+	serverLog.Infof("Serving health checks on %s", address)
+	err := http.ListenAndServe(address, mux)
+	if err != nil {
+		serverLog.Errorf("Failed to serve health checks on %s: %s", address, err)
+	}
+}
+
+func writeHealthStatus(w http.ResponseWriter, status HealthStatus, healthy bool) {
+	w.Header().Set("Content-Type", "application/json")
+	if !healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	err := json.NewEncoder(w).Encode(&status)
+	if err != nil {
+		serverLog.Errorf("Failed to write health status: %s", err)
+	}
+}
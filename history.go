@@ -0,0 +1,168 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// An entry in the complete history of a game. Unlike the event log (which only keeps the most recent events), the
+// history keeps everything that happened in the game from when it was created, including the details that only some
+// of the players were told about (e.g which cards were drawn).
+type HistoryEntry struct {
+	Event GameEvent
+
+	// The only player that was told about this event, or PLAYER_ID_NONE for events that are part of the public record
+	// of the game (which is what everyone else was told)
+	RecipientId uint64
+}
+
+// Returns the event for the given notification, with the names of the players that it refers to
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) newGameEvent(notify protocol.NotifyPlayerActionCommand) GameEvent {
+	event := GameEvent{
+		time.Now().UTC(),
+		"",
+		"",
+		notify,
+	}
+	for _, player := range gs.Players {
+		if player.Id == notify.PlayerId {
+			event.PlayerName = player.Name
+		}
+		if player.Id == notify.TargetPlayerId {
+			event.TargetPlayerName = player.Name
+		}
+	}
+	return event
+}
+
+// Adds a public event to the history
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) recordPublicHistory(event GameEvent) {
+	// Players are often sent exactly the same notification as everybody else (just separately, since broadcasts skip
+	// the players involved), which would just repeat the public event in their history
+	for len(gs.history) > 0 {
+		last := &gs.history[len(gs.history)-1]
+		if (last.RecipientId == protocol.PLAYER_ID_NONE) || !sameNotification(&last.Event.Notify, &event.Notify) {
+			break
+		}
+		gs.history = gs.history[:len(gs.history)-1]
+	}
+	gs.history = append(gs.history, HistoryEntry{event, protocol.PLAYER_ID_NONE})
+}
+
+// Adds an event that only the given player was told about to the history
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) recordPrivateHistory(notify protocol.NotifyPlayerActionCommand, recipientId uint64) {
+	for index := len(gs.history) - 1; index >= 0; index-- {
+		if gs.history[index].RecipientId == protocol.PLAYER_ID_NONE {
+			if sameNotification(&gs.history[index].Event.Notify, &notify) {
+				return
+			}
+			break
+		}
+	}
+	gs.history = append(gs.history, HistoryEntry{gs.newGameEvent(notify), recipientId})
+}
+
+func sameNotification(a *protocol.NotifyPlayerActionCommand, b *protocol.NotifyPlayerActionCommand) bool {
+	if (a.PlayerId != b.PlayerId) || (a.CmdId != b.CmdId) || (a.TargetDeckId != b.TargetDeckId) ||
+		(a.TargetPlayerId != b.TargetPlayerId) || (len(a.TargetCardIds) != len(b.TargetCardIds)) ||
+		(len(a.TargetStrings) != len(b.TargetStrings)) {
+		return false
+	}
+	for index := range a.TargetCardIds {
+		if a.TargetCardIds[index] != b.TargetCardIds[index] {
+			return false
+		}
+	}
+	for index := range a.TargetStrings {
+		if a.TargetStrings[index] != b.TargetStrings[index] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the complete history of the game as the given player is allowed to see it: every public event, along with
+// the private events that were sent to that player (but not those sent to anybody else)
+func (gs *GameState) HistoryForPlayer(playerId uint64) []HistoryEntry {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+	result := make([]HistoryEntry, 0, len(gs.history))
+	for _, entry := range gs.history {
+		if (entry.RecipientId == protocol.PLAYER_ID_NONE) || (entry.RecipientId == playerId) {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Sends the given history to the player, split over as many commands as it takes
+func sendGameHistory(player *PlayerState, history []HistoryEntry) error {
+	firstIndex := 0
+	for {
+		respCmd := protocol.HistoryInfoResponseCommand{
+			FirstIndex:        uint64(firstIndex),
+			Remaining:         0,
+			Timestamps:        make([]uint64, 0),
+			PlayerNames:       make([]string, 0),
+			TargetPlayerNames: make([]string, 0),
+			CmdIds:            make([]byte, 0),
+			TargetDeckIds:     make([]uint16, 0),
+			TargetCardIds:     make([][]uint16, 0),
+			TargetStrings:     make([][]string, 0),
+			Private:           make([]bool, 0),
+		}
+		cmdLen := protocol.MinHistoryInfoResponseCommandLength
+		index := firstIndex
+		for ; index < len(history); index++ {
+			entry := &history[index]
+			eventLen := historyEventLength(&entry.Event)
+			if cmdLen+eventLen > protocol.MaxHistoryInfoResponseCommandLength {
+				break
+			}
+			cmdLen += eventLen
+			respCmd.Timestamps = append(respCmd.Timestamps, uint64(entry.Event.Timestamp.Unix()))
+			respCmd.PlayerNames = append(respCmd.PlayerNames, entry.Event.PlayerName)
+			respCmd.TargetPlayerNames = append(respCmd.TargetPlayerNames, entry.Event.TargetPlayerName)
+			respCmd.CmdIds = append(respCmd.CmdIds, entry.Event.Notify.CmdId)
+			respCmd.TargetDeckIds = append(respCmd.TargetDeckIds, entry.Event.Notify.TargetDeckId)
+			respCmd.TargetCardIds = append(respCmd.TargetCardIds, entry.Event.Notify.TargetCardIds)
+			respCmd.TargetStrings = append(respCmd.TargetStrings, entry.Event.Notify.TargetStrings)
+			respCmd.Private = append(respCmd.Private, entry.RecipientId != protocol.PLAYER_ID_NONE)
+		}
+		if (index == firstIndex) && (index < len(history)) {
+			// This event is too big to send at all, so leave it out rather than getting stuck on it
+			playerLog(player).Errorf("Game history event %d is too long to send, skipping it", index)
+			history = append(history[:index], history[index+1:]...)
+			continue
+		}
+		respCmd.Remaining = uint64(len(history) - index)
+
+		respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_HISTORY_RESPONSE, uint16(cmdLen))
+		err := protocol.SerialiseHistoryInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
+		if err != nil {
+			return err
+		}
+		err = player.SendCommandBuffer(respBuffer)
+		if err != nil {
+			return err
+		}
+
+		firstIndex = index
+		if firstIndex >= len(history) {
+			return nil
+		}
+	}
+}
+
+// Returns the number of bytes that the given event adds to a HistoryInfoResponseCommand
+func historyEventLength(event *GameEvent) int {
+	result := 12 + (2 + len(event.PlayerName)) + (2 + len(event.TargetPlayerName)) + (2 + 2*len(event.Notify.TargetCardIds)) + 2
+	for _, str := range event.Notify.TargetStrings {
+		result += 2 + len(str)
+	}
+	return result
+}
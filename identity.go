@@ -0,0 +1,135 @@
+package main
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// Identity tokens are given to each client during its first handshake with a server, and are presented again every time
+// that it connects so that the server knows who is connecting, even across server restarts. Each token is the
+// identity's ID followed by an HMAC of that ID, so clients cannot make up tokens (or change the ID in theirs) without
+// knowing the server's secret key.
+const IdentityKeyLength = 32
+
+const DefaultIdentityKeyFileName = ".netdeck-server-key"
+
+// The file in which the client remembers its identity token for each server that it has connected to
+const IdentityTokenFileName = ".netdeck-identity"
+
+var ErrInvalidIdentityKey = errors.New("Identity key file does not contain a valid key")
+
+// Loads the server's secret identity key from the given file, or creates the file with a new random key if it does not
+// exist yet
+func loadOrCreateIdentityKey(path string) ([]byte, error) {
+	key, err := ioutil.ReadFile(path)
+	if err == nil {
+		if len(key) != IdentityKeyLength {
+			return nil, ErrInvalidIdentityKey
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err = newIdentityKey()
+	if err != nil {
+		return nil, err
+	}
+	err = ioutil.WriteFile(path, key, 0600)
+	if err != nil {
+		return nil, err
+	}
+	serverLog.Infof("Created new identity key file '%s'", path)
+	return key, nil
+}
+
+// Returns a new random key for signing identity tokens
+func newIdentityKey() ([]byte, error) {
+	key := make([]byte, IdentityKeyLength)
+	_, err := cryptorand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func signIdentity(key []byte, identityId uint64) []byte {
+	token := make([]byte, protocol.IdentityTokenLength)
+	binary.LittleEndian.PutUint64(token, identityId)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(token[:8])
+	copy(token[8:], mac.Sum(nil))
+	return token
+}
+
+// Returns a token for a brand new identity, along with that identity's ID
+func (ss *ServerState) newIdentityToken() (uint64, []byte) {
+	identityId := newUnguessableId()
+	for identityId == 0 {
+		identityId = newUnguessableId()
+	}
+	return identityId, signIdentity(ss.identityKey, identityId)
+}
+
+// Returns the ID of the identity in the given token, or 0 if the token is empty or was not issued by this server
+func (ss *ServerState) verifyIdentityToken(token []byte) uint64 {
+	if len(token) != protocol.IdentityTokenLength {
+		return 0
+	}
+	identityId := binary.LittleEndian.Uint64(token)
+	if (identityId == 0) || !hmac.Equal(token, signIdentity(ss.identityKey, identityId)) {
+		return 0
+	}
+	return identityId
+}
+
+// Returns the identity token saved from an earlier connection to the given server, or nil if there isn't one
+func loadIdentityToken(serverHost string) []byte {
+	data, err := ioutil.ReadFile(IdentityTokenFileName)
+	if err != nil {
+		return nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if (len(fields) != 2) || (fields[0] != serverHost) {
+			continue
+		}
+		token, err := hex.DecodeString(fields[1])
+		if (err != nil) || (len(token) != protocol.IdentityTokenLength) {
+			return nil
+		}
+		return token
+	}
+	return nil
+}
+
+// Saves the identity token for the given server, keeping the tokens for every other server
+func saveIdentityToken(serverHost string, token []byte) {
+	data := ""
+	oldData, err := ioutil.ReadFile(IdentityTokenFileName)
+	if err == nil {
+		for _, line := range strings.Split(string(oldData), "\n") {
+			fields := strings.Fields(line)
+			if (len(fields) == 2) && (fields[0] != serverHost) {
+				data += fmt.Sprintf("%s %s\n", fields[0], fields[1])
+			}
+		}
+	}
+	data += fmt.Sprintf("%s %s\n", serverHost, hex.EncodeToString(token))
+
+	err = ioutil.WriteFile(IdentityTokenFileName, []byte(data), 0600)
+	if err != nil {
+		fmt.Fprintf(clientOutput, "Failed to save the identity file, the server will not recognise you next time you connect: %s\n", err)
+	}
+}
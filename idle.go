@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+const DefaultIdleGameTimeoutMinutes = 60
+
+// How often the server checks for games that have been idle for too long
+const IdleGameCheckInterval = 30 * time.Second
+
+// Players are warned that their game will be closed when this fraction (1/n) of the idle timeout remains
+const IdleGameWarningFraction = 4
+
+// Records that a player has just done something in the game, so that it does not get closed for being idle
+func (gs *GameState) markActive() {
+	gs.mutex.Lock()
+	gs.lastActivity = time.Now()
+	gs.idleWarned = false
+	gs.mutex.Unlock()
+}
+
+// Warns the players of every game that will soon have been idle for the given timeout, and closes those that have been
+func (ss *ServerState) ExpireIdleGames(timeout time.Duration) {
+	warningTime := timeout - (timeout / IdleGameWarningFraction)
+	expiredGames := make([]*GameState, 0)
+
+	ss.mutex.Lock()
+	games := make([]*GameState, len(ss.allGames))
+	copy(games, ss.allGames)
+	ss.mutex.Unlock()
+
+	for _, game := range games {
+		game.mutex.Lock()
+		idleTime := time.Since(game.lastActivity)
+		shouldWarn := (idleTime >= warningTime) && !game.idleWarned
+		if shouldWarn {
+			game.idleWarned = true
+		}
+		players := make([]*PlayerState, len(game.Players))
+		copy(players, game.Players)
+		game.mutex.Unlock()
+
+		if idleTime >= timeout {
+			expiredGames = append(expiredGames, game)
+		} else if shouldWarn {
+			gameLog(game).Infof("Warn players that the game has been idle for %s", idleTime.Round(time.Second))
+			message := fmt.Sprintf("Nobody has done anything in this game for a while. It will be closed in %s unless somebody does something",
+				(timeout - idleTime).Round(time.Minute))
+			err := sendServerMessage(players, message)
+			if err != nil {
+				gameLog(game).Errorf("Failed to send idle game warning: %s", err)
+			}
+		}
+	}
+
+	for _, game := range expiredGames {
+		ss.closeIdleGame(game, timeout)
+	}
+}
+
+// Removes every player from the given game (sending them back to the menu) and then removes the game from the server
+func (ss *ServerState) closeIdleGame(game *GameState, timeout time.Duration) {
+	gameLog(game).Infof("Close the game after it was idle for %s", timeout)
+	game.mutex.Lock()
+	players := make([]*PlayerState, 0, len(game.Players))
+	for _, player := range game.Players {
+		if !player.IsBot {
+			players = append(players, player)
+		}
+	}
+	game.mutex.Unlock()
+
+	err := sendServerMessage(players, fmt.Sprintf("The game was closed because nobody did anything in it for %s", timeout))
+	if err != nil {
+		gameLog(game).Errorf("Failed to send idle game notification: %s", err)
+	}
+	for _, player := range players {
+		notifyAction := protocol.NewPlayerActionNotify(player.Id, protocol.CMD_GAME_LEAVE, protocol.DECK_ID_NONE, player.Id, nil)
+		err = game.SendNotificationToTargetPlayer(notifyAction)
+		if err != nil {
+			playerLog(player).Errorf("Failed to send leave notification for idle game: %s", err)
+		}
+		game.RemovePlayer(player)
+		player.CurrentGame = nil
+	}
+	ss.RemoveIdleBots(game)
+	game.mutex.Lock()
+	game.closeReplay()
+	game.mutex.Unlock()
+
+	ss.mutex.Lock()
+	for index, otherGame := range ss.allGames {
+		if otherGame == game {
+			ss.allGames[index] = ss.allGames[len(ss.allGames)-1]
+			ss.allGames = ss.allGames[:len(ss.allGames)-1]
+			break
+		}
+	}
+	ss.mutex.Unlock()
+}
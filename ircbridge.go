@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+const DefaultIRCNick = "netdeck"
+
+// The most messages that can be waiting to be sent to the channel. Messages are dropped once this many are waiting
+// (which can happen while the bridge is disconnected) rather than holding up the games that they are about.
+const IRCQueueLength = 256
+
+// IRC servers disconnect clients that send messages too quickly, so the bridge waits this long between messages
+const IRCMessageInterval = time.Second
+const IRCReconnectDelay = 30 * time.Second
+const IRCConnectTimeout = 30 * time.Second
+
+// IRC lines are at most 512 bytes long, including the command and the prefix that the server adds to say who sent them
+const MaxIRCMessageLength = 400
+
+var ErrInvalidIRCURL = errors.New("IRC URLs must look like irc://server[:port]/#channel (or ircs:// to use TLS)")
+
+// Mirrors the action feed of every public game on the server into an IRC channel, for communities that organise their
+// games in one. Private games are never mirrored, since anybody in the channel could see them. If enabled, people in
+// the channel can also send a few commands back to the server (see handleCommand). Matrix rooms can use the bridge
+// through any of the usual Matrix-IRC bridges.
+type IRCBridge struct {
+	address  string
+	useTLS   bool
+	channel  string
+	nick     string
+	commands bool
+	server   *ServerState
+	outgoing chan string
+}
+
+func NewIRCBridge(ircURL string, nick string, commands bool, server *ServerState) (*IRCBridge, error) {
+	address, useTLS, channel, err := parseIRCURL(ircURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(nick) == 0 {
+		nick = DefaultIRCNick
+	}
+	return &IRCBridge{address, useTLS, channel, nick, commands, server, make(chan string, IRCQueueLength)}, nil
+}
+
+// Returns the address of the IRC server, whether to connect to it with TLS, and the channel to join
+func parseIRCURL(ircURL string) (string, bool, string, error) {
+	parsedURL, err := url.Parse(ircURL)
+	if (err != nil) || ((parsedURL.Scheme != "irc") && (parsedURL.Scheme != "ircs")) || (len(parsedURL.Hostname()) == 0) {
+		return "", false, "", ErrInvalidIRCURL
+	}
+	useTLS := (parsedURL.Scheme == "ircs")
+	port := parsedURL.Port()
+	if len(port) == 0 {
+		port = "6667"
+		if useTLS {
+			port = "6697"
+		}
+	}
+
+	// The '#' that starts most channel names also starts a URL fragment, so the channel can end up in either place
+	channel := strings.Trim(parsedURL.Path, "/")
+	if len(parsedURL.Fragment) > 0 {
+		channel = parsedURL.Fragment
+	}
+	if len(channel) == 0 || strings.ContainsAny(channel, " ,\a") {
+		return "", false, "", ErrInvalidIRCURL
+	}
+	if !strings.HasPrefix(channel, "#") && !strings.HasPrefix(channel, "&") {
+		channel = "#" + channel
+	}
+	return net.JoinHostPort(parsedURL.Hostname(), port), useTLS, channel, nil
+}
+
+// Queues the given message to be sent to the channel. This never blocks, the message is just dropped if too many are
+// already waiting to be sent.
+func (bridge *IRCBridge) Send(message string) {
+	message = strings.Join(strings.Fields(message), " ") // IRC messages cannot contain newlines
+	if len(message) > MaxIRCMessageLength {
+		message = message[:MaxIRCMessageLength-3] + "..."
+	}
+	select {
+	case bridge.outgoing <- message:
+	default:
+		serverLog.Debugf("Dropped IRC message because too many are waiting to be sent: %s", message)
+	}
+}
+
+// Stays connected to the IRC server for as long as the netdeck server is running, reconnecting whenever the
+// connection is lost
+func (bridge *IRCBridge) Run() {
+	for {
+		err := bridge.runSession()
+		serverLog.Warnf("Lost the connection to IRC server %s, reconnecting in %s: %s", bridge.address, IRCReconnectDelay, err)
+		time.Sleep(IRCReconnectDelay)
+	}
+}
+
+func (bridge *IRCBridge) runSession() error {
+	dialer := &net.Dialer{Timeout: IRCConnectTimeout}
+	var conn net.Conn
+	var err error
+	if bridge.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", bridge.address, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", bridge.address)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	lines := make(chan string, 16)
+	readErrChan := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		readErrChan <- scanner.Err()
+		close(lines)
+	}()
+
+	nick := bridge.nick
+	writeLine := func(line string) error {
+		_, err := conn.Write([]byte(line + "\r\n"))
+		return err
+	}
+	err = writeLine("NICK " + nick)
+	if err == nil {
+		err = writeLine("USER " + nick + " 0 * :netdeck server")
+	}
+	if err != nil {
+		return err
+	}
+
+	joined := false
+	var throttle <-chan time.Time
+	for {
+		// Nothing is sent to the channel until it has been joined, or while waiting between messages
+		var outgoing chan string
+		if joined && (throttle == nil) {
+			outgoing = bridge.outgoing
+		}
+
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				err = <-readErrChan
+				if err == nil {
+					err = errors.New("Connection closed by the IRC server")
+				}
+				return err
+			}
+			prefix, command, params := parseIRCLine(line)
+			switch command {
+			case "PING":
+				if len(params) > 0 {
+					err = writeLine("PONG :" + params[len(params)-1])
+				}
+			case "001": // Welcome, sent once the server has accepted our nick
+				serverLog.Infof("Connected to IRC server %s as %s, joining %s", bridge.address, nick, bridge.channel)
+				err = writeLine("JOIN " + bridge.channel)
+				joined = true
+			case "433": // Nick already in use
+				if !joined {
+					nick += "_"
+					err = writeLine("NICK " + nick)
+				}
+			case "PRIVMSG":
+				if bridge.commands && (len(params) == 2) && strings.EqualFold(params[0], bridge.channel) {
+					senderNick := strings.SplitN(prefix, "!", 2)[0]
+					bridge.handleCommand(senderNick, params[1])
+				}
+			case "ERROR":
+				return fmt.Errorf("IRC server sent an error: %s", strings.Join(params, " "))
+			}
+			if err != nil {
+				return err
+			}
+
+		case message := <-outgoing:
+			err = writeLine("PRIVMSG " + bridge.channel + " :" + message)
+			if err != nil {
+				return err
+			}
+			throttle = time.After(IRCMessageInterval)
+
+		case <-throttle:
+			throttle = nil
+		}
+	}
+}
+
+// Splits a line received from an IRC server into the prefix (which says where it came from), command and parameters
+func parseIRCLine(line string) (string, string, []string) {
+	prefix := ""
+	if strings.HasPrefix(line, ":") {
+		prefixEnd := strings.Index(line, " ")
+		if prefixEnd < 0 {
+			return line[1:], "", nil
+		}
+		prefix = line[1:prefixEnd]
+		line = line[prefixEnd+1:]
+	}
+
+	// The last parameter can contain spaces if it starts with ':'
+	trailing := ""
+	hasTrailing := false
+	if trailingStart := strings.Index(line, " :"); trailingStart >= 0 {
+		trailing = line[trailingStart+2:]
+		hasTrailing = true
+		line = line[:trailingStart]
+	}
+	params := strings.Fields(line)
+	if len(params) == 0 {
+		return prefix, "", nil
+	}
+	command := strings.ToUpper(params[0])
+	params = params[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+	return prefix, command, params
+}
+
+// Runs a command sent to the channel, if the message is one. The commands are:
+//   - !games lists the public games on the server
+//   - !say <join code> <message> shows a message to everyone in the public game with that join code
+func (bridge *IRCBridge) handleCommand(senderNick string, message string) {
+	args := strings.Fields(message)
+	if (len(args) == 0) || !strings.HasPrefix(args[0], "!") {
+		return
+	}
+
+	switch strings.ToLower(args[0]) {
+	case "!games":
+		games := bridge.server.PublicGames()
+		if len(games.GameIds) == 0 {
+			bridge.Send("There are no public games at the moment")
+			return
+		}
+		for index, gameId := range games.GameIds {
+			joinCode := ""
+			game := bridge.server.FindGame(gameId)
+			if game != nil {
+				joinCode = game.JoinCode
+			}
+			bridge.Send(fmt.Sprintf("%s (%s): %d players, owned by %s", games.Names[index], joinCode, games.PlayerCounts[index], games.OwnerNames[index]))
+		}
+
+	case "!say":
+		if len(args) < 3 {
+			bridge.Send("Usage: !say <join code> <message>")
+			return
+		}
+		game := bridge.server.FindGameByJoinCode(args[1])
+		if (game == nil) || !game.Public {
+			bridge.Send(fmt.Sprintf("There is no public game with the join code '%s'", args[1]))
+			return
+		}
+		text := fmt.Sprintf("%s (on IRC): %s", senderNick, strings.Join(args[2:], " "))
+		if len(text) > protocol.MaxServerMessageLength {
+			bridge.Send(fmt.Sprintf("Messages can be at most %d bytes long", protocol.MaxServerMessageLength))
+			return
+		}
+		game.mutex.Lock()
+		players := make([]*PlayerState, len(game.Players))
+		copy(players, game.Players)
+		game.mutex.Unlock()
+		err := sendServerMessage(players, text)
+		if err != nil {
+			serverLog.Errorf("Failed to send message from IRC to game %d: %s", game.Id, err)
+		}
+
+	case "!help":
+		bridge.Send("Commands: !games lists the public games, !say <join code> <message> sends a message to the players of a public game")
+	}
+}
+
+// Sends the given event to the IRC channel, if the game is being mirrored to one
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) mirrorEvent(event GameEvent) {
+	if (gs.ircBridge == nil) || !gs.Public {
+		return
+	}
+	text := describeGameEvent(gs, nil, event.PlayerName, event.TargetPlayerName, &event.Notify)
+	gs.ircBridge.Send(fmt.Sprintf("[%s] %s", gs.Name, text))
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Join codes are made of one word from each of these lists followed by a two-digit number, e.g "BRAVE-OTTER-42". They
+// are easy to read out over voice chat, but there are few enough of them that they are much easier to guess than game
+// IDs. The words are all distinct, short and hard to mishear.
+var joinCodeAdjectives = []string{
+	"AMBER", "BOLD", "BRAVE", "BRIGHT", "BRISK", "CALM", "CLEVER", "COSY", "CRISP", "CURLY", "DARING", "EAGER", "FANCY",
+	"FIERCE", "FROSTY", "FUZZY", "GENTLE", "GIANT", "GOLDEN", "GRAND", "HAPPY", "HARDY", "HONEST", "HUMBLE", "JOLLY",
+	"KEEN", "LIVELY", "LUCKY", "MAGIC", "MELLOW", "MIGHTY", "MISTY", "NIMBLE", "NOBLE", "PLUCKY", "POLITE", "PROUD",
+	"QUICK", "QUIET", "RAPID", "ROYAL", "RUSTY", "SHINY", "SILVER", "SLEEPY", "SMOOTH", "SNOWY", "SPEEDY", "STEADY",
+	"STORMY", "SUNNY", "SWIFT", "TIDY", "TINY", "TOUGH", "VELVET", "VIVID", "WARM", "WILD", "WINDY", "WISE", "WITTY",
+	"YOUNG", "ZESTY",
+}
+
+var joinCodeAnimals = []string{
+	"BADGER", "BEAR", "BEAVER", "BISON", "CAMEL", "CHEETAH", "COBRA", "CONDOR", "COYOTE", "CRANE", "DINGO", "DOLPHIN",
+	"DONKEY", "EAGLE", "FALCON", "FERRET", "FINCH", "GECKO", "GIBBON", "GOOSE", "GORILLA", "HAMSTER", "HERON", "HIPPO",
+	"HYENA", "IBIS", "IGUANA", "JACKAL", "JAGUAR", "KOALA", "LEMUR", "LEOPARD", "LION", "LLAMA", "LOBSTER", "LYNX",
+	"MAGPIE", "MARMOT", "MOOSE", "NEWT", "OCELOT", "OSPREY", "OTTER", "PANDA", "PANTHER", "PARROT", "PELICAN",
+	"PENGUIN", "PUFFIN", "PYTHON", "RABBIT", "RAVEN", "SALMON", "SEAL", "SPARROW", "SQUID", "TIGER", "TOUCAN",
+	"TURTLE", "WALRUS", "WEASEL", "WHALE", "WOMBAT", "ZEBRA",
+}
+
+// Returns the given join code in the form that the server stores them in, so that codes can be typed in any case and
+// with spaces instead of dashes
+func normaliseJoinCode(code string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(strings.ReplaceAll(code, "-", " ")), "-"))
+}
+
+// Returns a random join code that is not used by any other game
+// NOTE: This expects the server mutex to already be held by the caller
+func (ss *ServerState) newJoinCode() string {
+	for {
+		random := newUnguessableId()
+		adjective := joinCodeAdjectives[random%uint64(len(joinCodeAdjectives))]
+		random /= uint64(len(joinCodeAdjectives))
+		animal := joinCodeAnimals[random%uint64(len(joinCodeAnimals))]
+		random /= uint64(len(joinCodeAnimals))
+		number := 10 + (random % 90)
+		code := adjective + "-" + animal + "-" + strconv.FormatUint(number, 10)
+
+		codeTaken := false
+		for _, game := range ss.allGames {
+			if game.JoinCode == code {
+				codeTaken = true
+				break
+			}
+		}
+		if !codeTaken {
+			return code
+		}
+	}
+}
+
+// Returns the game with the given join code (ignoring case), or nil if there is no such game
+func (ss *ServerState) FindGameByJoinCode(code string) *GameState {
+	code = normaliseJoinCode(code)
+	var result *GameState = nil
+	ss.mutex.Lock()
+	for _, game := range ss.allGames {
+		if game.JoinCode == code {
+			result = game
+			break
+		}
+	}
+	ss.mutex.Unlock()
+	return result
+}
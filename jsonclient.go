@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+
+	"github.com/jacquesh/netdeck/client"
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// With --json, every command received from the server is printed on stdout as one line of JSON, and commands are read
+// from stdin as lines of JSON in the same format (see protocol.CommandToJSON), for scripts and other programs that want
+// to play through the client. Everything that the client would normally print goes to stderr instead.
+var jsonOutputEnabled = false
+
+// Reads lines of JSON from stdin and sends them on the channel, which is closed when stdin ends
+func clientReadJSONInput(jsonInChan chan []byte) {
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 4096), protocol.MaxJSONCommandLength)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) > 0 {
+			jsonInChan <- append([]byte{}, line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		printError("ERROR READING FROM STD INPUT: %s\n", err)
+	}
+	close(jsonInChan)
+}
+
+// Prints the given command from the server on stdout as a line of JSON
+func printCommandJSON(cmdContainer protocol.CommandContainer) {
+	line, err := protocol.CommandToJSON(cmdContainer.Header, cmdContainer.Payload)
+	if err != nil {
+		printError("Error! Failed to convert command %d from the server to JSON: %s\n", cmdContainer.Header.Id, err)
+		return
+	}
+	os.Stdout.Write(line)
+}
+
+// Sends the command given as a line of JSON to the server. If the command is invalid then the reason why is printed on
+// stdout as a NOTIFY_INPUT_ERROR, like the server does for clients that connect to it with JSON.
+func sendJSONCommand(line []byte, session *client.Session) {
+	cmdId, buffer, err := protocol.CommandFromJSON(line)
+	if err != nil {
+		os.Stdout.Write(protocol.InputErrorJSON(cmdId, protocol.ERROR_INVALID_DATA, err.Error()))
+		return
+	}
+	if cmdId == protocol.CMD_DISCONNECT {
+		quitRequested = true
+	}
+	err = session.SendCommandBuffer(buffer)
+	if err != nil {
+		printError("Error! Failed to send %s command to the server: %s\n", protocol.CommandName(cmdId), err)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// The most lines that the line editor remembers for the up and down arrow keys
+const MaxInputHistoryLength = 256
+
+// Reads lines of input from the terminal, with support for moving around and editing the line before it is entered,
+// going back through previously-entered lines with the up and down arrow keys, and completing words with the tab key.
+// If the input is not a terminal (or the terminal can't be put into raw mode on this platform) then lines are just read
+// as they are, without any editing support. Everything except ReadLine can be called on a nil editor, which does nothing,
+// for when the client doesn't read its input as lines of text (e.g with --json).
+type LineEditor struct {
+	input   *bufio.Reader
+	restore func() // Puts the terminal back the way it was, or nil if it is not in raw mode
+
+	mutex        sync.Mutex
+	reading      bool   // Whether ReadLine is waiting for input, and so the line is on the screen
+	hidden       bool   // Whether the line has been cleared from the screen to make room for other output
+	prompt       string // Printed before the line
+	linePrompt   string // The prompt given to ReadLine for the line being read, which overrides the one from SetPrompt
+	sharedPrompt string // Printed before lines that are read without a prompt of their own, see SetPrompt
+	line         []rune
+	cursor       int // The index in line at which typed characters are inserted
+	history      []string
+	historyIndex int    // The index in history of the line being edited, or len(history) for a new line
+	draft        string // The new line that was being typed before going back through the history
+
+	// The words that can be completed with the tab key, for the first word of the line (the command) and for any later
+	// words (the arguments)
+	commandCompletions  []string
+	argumentCompletions []string
+}
+
+func NewLineEditor(input *os.File) *LineEditor {
+	editor := &LineEditor{input: bufio.NewReader(input)}
+	restore, err := enableRawTerminal(input.Fd())
+	if err == nil {
+		editor.restore = restore
+		// The terminal needs to be restored even if the client is interrupted, otherwise the shell is left unusable
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-signals
+			editor.Close()
+			os.Exit(1)
+		}()
+	}
+	return editor
+}
+
+// Puts the terminal back the way it was before the editor was created
+func (editor *LineEditor) Close() {
+	if editor == nil {
+		return
+	}
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+	if editor.restore != nil {
+		editor.restore()
+		editor.restore = nil
+	}
+}
+
+// Sets the words that the tab key completes to. This can be called while a line is being read.
+func (editor *LineEditor) SetCompletions(commands []string, arguments []string) {
+	if editor == nil {
+		return
+	}
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+	editor.commandCompletions = commands
+	editor.argumentCompletions = arguments
+}
+
+// Sets the prompt that is printed before lines that are read without a prompt of their own, e.g to show what the
+// player is doing. This can be called while a line is being read, which updates its prompt. It is only used when the
+// line can be edited, because otherwise it can't be moved out of the way of other output.
+func (editor *LineEditor) SetPrompt(prompt string) {
+	if editor == nil {
+		return
+	}
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+	editor.sharedPrompt = prompt
+	if editor.reading && (len(editor.linePrompt) == 0) && (editor.prompt != prompt) {
+		editor.prompt = prompt
+		editor.redraw()
+	}
+}
+
+// Clears the line that is being typed (if any) from the screen, so that other output can be printed without getting
+// mixed up with it. The line is shown again by Show.
+func (editor *LineEditor) Hide() {
+	if editor == nil {
+		return
+	}
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+	if (editor.restore == nil) || !editor.reading || editor.hidden {
+		return
+	}
+	fmt.Print("\r\x1b[K")
+	editor.hidden = true
+}
+
+func (editor *LineEditor) Show() {
+	if editor == nil {
+		return
+	}
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+	if !editor.hidden {
+		return
+	}
+	editor.hidden = false
+	editor.redraw()
+}
+
+// Prints the prompt and then reads the next line of input, without the trailing newline. Returns io.EOF if the input
+// has ended (or Ctrl-D was pressed on an empty line).
+func (editor *LineEditor) ReadLine(prompt string) (string, error) {
+	editor.mutex.Lock()
+	if editor.restore == nil {
+		editor.mutex.Unlock()
+		fmt.Print(prompt)
+		line, err := editor.input.ReadString('\n')
+		if (err == io.EOF) && (len(line) > 0) {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	editor.reading = true
+	editor.linePrompt = prompt
+	editor.prompt = prompt
+	if len(prompt) == 0 {
+		editor.prompt = editor.sharedPrompt
+	}
+	editor.line = editor.line[:0]
+	editor.cursor = 0
+	editor.historyIndex = len(editor.history)
+	editor.redraw()
+	editor.mutex.Unlock()
+
+	for {
+		key, _, err := editor.input.ReadRune()
+		if err != nil {
+			editor.finishLine()
+			return "", err
+		}
+
+		escapeSequence := ""
+		if key == 0x1b {
+			escapeSequence = editor.readEscapeSequence()
+		}
+
+		editor.mutex.Lock()
+		done, eof := editor.handleKey(key, escapeSequence)
+		editor.mutex.Unlock()
+		if eof {
+			editor.finishLine()
+			return "", io.EOF
+		}
+		if done {
+			return editor.finishLine(), nil
+		}
+	}
+}
+
+// Stops reading the current line and moves the cursor on to the next one, adding the line to the history
+func (editor *LineEditor) finishLine() string {
+	editor.mutex.Lock()
+	defer editor.mutex.Unlock()
+	editor.reading = false
+	editor.hidden = false
+	fmt.Print("\r\n")
+
+	line := string(editor.line)
+	if (len(strings.TrimSpace(line)) > 0) &&
+		((len(editor.history) == 0) || (editor.history[len(editor.history)-1] != line)) {
+		editor.history = append(editor.history, line)
+		if len(editor.history) > MaxInputHistoryLength {
+			editor.history = editor.history[1:]
+		}
+	}
+	return line
+}
+
+// Applies the given key (and the rest of the escape sequence that it started, if it is an escape) to the line. Returns
+// whether the line has been entered, and whether the input has ended.
+// NOTE: This expects the editor mutex to already be held by the caller
+func (editor *LineEditor) handleKey(key rune, escapeSequence string) (bool, bool) {
+	switch key {
+	case '\r', '\n':
+		return true, false
+	case 0x01: // Ctrl-A
+		editor.cursor = 0
+	case 0x02: // Ctrl-B
+		editor.moveCursor(-1)
+	case 0x04: // Ctrl-D
+		if len(editor.line) == 0 {
+			return false, true
+		}
+		editor.deleteRange(editor.cursor, editor.cursor+1)
+	case 0x05: // Ctrl-E
+		editor.cursor = len(editor.line)
+	case 0x06: // Ctrl-F
+		editor.moveCursor(1)
+	case 0x08, 0x7f: // Ctrl-H or Backspace
+		editor.deleteRange(editor.cursor-1, editor.cursor)
+	case '\t':
+		editor.complete()
+	case 0x0b: // Ctrl-K
+		editor.deleteRange(editor.cursor, len(editor.line))
+	case 0x0e: // Ctrl-N
+		editor.moveThroughHistory(1)
+	case 0x10: // Ctrl-P
+		editor.moveThroughHistory(-1)
+	case 0x15: // Ctrl-U
+		editor.deleteRange(0, editor.cursor)
+	case 0x17: // Ctrl-W
+		wordStart := editor.cursor
+		for (wordStart > 0) && (editor.line[wordStart-1] == ' ') {
+			wordStart--
+		}
+		for (wordStart > 0) && (editor.line[wordStart-1] != ' ') {
+			wordStart--
+		}
+		editor.deleteRange(wordStart, editor.cursor)
+	case 0x1b: // Escape, which starts the sequences sent by the arrow keys and others
+		switch escapeSequence {
+		case "[A", "OA":
+			editor.moveThroughHistory(-1)
+		case "[B", "OB":
+			editor.moveThroughHistory(1)
+		case "[C", "OC":
+			editor.moveCursor(1)
+		case "[D", "OD":
+			editor.moveCursor(-1)
+		case "[H", "OH", "[1~", "[7~":
+			editor.cursor = 0
+		case "[F", "OF", "[4~", "[8~":
+			editor.cursor = len(editor.line)
+		case "[3~":
+			editor.deleteRange(editor.cursor, editor.cursor+1)
+		}
+	default:
+		if key < ' ' {
+			return false, false
+		}
+		editor.line = append(editor.line, 0)
+		copy(editor.line[editor.cursor+1:], editor.line[editor.cursor:])
+		editor.line[editor.cursor] = key
+		editor.cursor++
+	}
+	editor.redraw()
+	return false, false
+}
+
+// Reads the rest of an escape sequence, after the escape character itself. Only the sequences that are sent by the
+// keys that the editor handles are recognised, anything else is returned as far as it has been read.
+func (editor *LineEditor) readEscapeSequence() string {
+	var sequence strings.Builder
+	for sequence.Len() < 8 {
+		char, _, err := editor.input.ReadRune()
+		if err != nil {
+			break
+		}
+		sequence.WriteRune(char)
+		if (sequence.Len() == 1) && (char != '[') && (char != 'O') {
+			break
+		}
+		if (sequence.Len() > 1) && (((char >= 'A') && (char <= 'Z')) || (char == '~')) {
+			break
+		}
+	}
+	return sequence.String()
+}
+
+func (editor *LineEditor) moveCursor(offset int) {
+	editor.cursor += offset
+	if editor.cursor < 0 {
+		editor.cursor = 0
+	} else if editor.cursor > len(editor.line) {
+		editor.cursor = len(editor.line)
+	}
+}
+
+// Removes the characters in the given range (which is clamped to the line) and moves the cursor to where they were
+func (editor *LineEditor) deleteRange(start int, end int) {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(editor.line) {
+		end = len(editor.line)
+	}
+	if start >= end {
+		return
+	}
+	editor.line = append(editor.line[:start], editor.line[end:]...)
+	editor.cursor = start
+}
+
+func (editor *LineEditor) moveThroughHistory(offset int) {
+	newIndex := editor.historyIndex + offset
+	if (newIndex < 0) || (newIndex > len(editor.history)) {
+		return
+	}
+	if editor.historyIndex == len(editor.history) {
+		editor.draft = string(editor.line)
+	}
+	editor.historyIndex = newIndex
+	if newIndex == len(editor.history) {
+		editor.line = []rune(editor.draft)
+	} else {
+		editor.line = []rune(editor.history[newIndex])
+	}
+	editor.cursor = len(editor.line)
+}
+
+// Completes the word before the cursor to the longest prefix that all of the matching completions share, or lists the
+// matching completions if that doesn't add anything to the word
+func (editor *LineEditor) complete() {
+	wordStart := editor.cursor
+	for (wordStart > 0) && (editor.line[wordStart-1] != ' ') {
+		wordStart--
+	}
+	candidates := editor.argumentCompletions
+	if len(strings.TrimSpace(string(editor.line[:wordStart]))) == 0 {
+		candidates = editor.commandCompletions
+	}
+
+	word := string(editor.line[wordStart:editor.cursor])
+	foldedWord := foldForMatching(word, matchIgnoringAccents)
+	var matches []string
+	for _, candidate := range candidates {
+		foldedCandidate := foldForMatching(candidate, matchIgnoringAccents)
+		if strings.HasPrefix(foldedCandidate, foldedWord) && !stringInSlice(candidate, matches) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return
+	}
+
+	completion := []rune(matches[0])
+	for _, match := range matches[1:] {
+		matchRunes := []rune(match)
+		commonLength := 0
+		for (commonLength < len(completion)) && (commonLength < len(matchRunes)) {
+			completionChar := foldForMatching(string(completion[commonLength]), matchIgnoringAccents)
+			if completionChar != foldForMatching(string(matchRunes[commonLength]), matchIgnoringAccents) {
+				break
+			}
+			commonLength++
+		}
+		completion = completion[:commonLength]
+	}
+	if len(matches) == 1 {
+		completion = append(completion, ' ')
+	}
+
+	if len(completion) > len([]rune(word)) {
+		remainder := append([]rune{}, editor.line[editor.cursor:]...)
+		editor.line = append(append(editor.line[:wordStart], completion...), remainder...)
+		editor.cursor = wordStart + len(completion)
+	} else if len(matches) > 1 {
+		fmt.Printf("\n%s\n", strings.Join(matches, "  "))
+	}
+}
+
+// Prints the prompt and the line, with the cursor in the right place
+// NOTE: This expects the editor mutex to already be held by the caller
+func (editor *LineEditor) redraw() {
+	if editor.hidden {
+		return
+	}
+	fmt.Printf("\r\x1b[K%s%s", editor.prompt, string(editor.line))
+	if editor.cursor < len(editor.line) {
+		fmt.Printf("\x1b[%dD", len(editor.line)-editor.cursor)
+	}
+}
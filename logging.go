@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LOG_LEVEL_DEBUG LogLevel = iota
+	LOG_LEVEL_INFO
+	LOG_LEVEL_WARNING
+	LOG_LEVEL_ERROR
+)
+
+const LogTimestampFormat = "2006-01-02 15:04:05.000"
+
+// The names of the log levels as they are given to the --log-level flag and written in the log
+var logLevelNames = []string{"debug", "info", "warning", "error"}
+
+var ErrUnknownLogLevel = errors.New("Unknown log level")
+
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(levelName, name) {
+			return LogLevel(level), nil
+		}
+	}
+	return LOG_LEVEL_INFO, ErrUnknownLogLevel
+}
+
+func (level LogLevel) String() string {
+	if (level < 0) || (int(level) >= len(logLevelNames)) {
+		return "unknown"
+	}
+	return logLevelNames[level]
+}
+
+// The destination that is shared by a logger and every logger derived from it
+type logOutput struct {
+	mutex    *sync.Mutex
+	writer   io.Writer
+	minLevel LogLevel
+	json     bool
+}
+
+// Writes timestamped log lines, each of which is tagged with the game and/or player that it relates to (if any).
+// Loggers are never modified once created, so that they can be shared freely between goroutines.
+type Logger struct {
+	output   *logOutput
+	gameId   *uint64
+	playerId *uint64
+}
+
+// The format of each log line when JSON output is enabled
+type logEntry struct {
+	Time     string  `json:"time"`
+	Level    string  `json:"level"`
+	GameId   *uint64 `json:"game,omitempty"`
+	PlayerId *uint64 `json:"player,omitempty"`
+	Message  string  `json:"msg"`
+}
+
+// The logger used by the server. It has no game or player, and logs at the info level until configureServerLog is called.
+var serverLog = &Logger{
+	&logOutput{&sync.Mutex{}, os.Stdout, LOG_LEVEL_INFO, false},
+	nil,
+	nil,
+}
+
+func configureServerLog(minLevel LogLevel, jsonOutput bool) {
+	serverLog.output.mutex.Lock()
+	serverLog.output.minLevel = minLevel
+	serverLog.output.json = jsonOutput
+	serverLog.output.mutex.Unlock()
+}
+
+// Writes the server log to the given writer instead of to stdout
+func setServerLogWriter(writer io.Writer) {
+	serverLog.output.mutex.Lock()
+	serverLog.output.writer = writer
+	serverLog.output.mutex.Unlock()
+}
+
+// Returns a logger that tags every line with the given game
+func (l *Logger) WithGame(gameId uint64) *Logger {
+	return &Logger{l.output, &gameId, l.playerId}
+}
+
+// Returns a logger that tags every line with the given player
+func (l *Logger) WithPlayer(playerId uint64) *Logger {
+	return &Logger{l.output, l.gameId, &playerId}
+}
+
+// Returns the server logger tagged with the given game, or the untagged server logger if there is no game
+func gameLog(game *GameState) *Logger {
+	if game == nil {
+		return serverLog
+	}
+	return serverLog.WithGame(game.Id)
+}
+
+// Returns the server logger tagged with the given player and the game that they are in (if any), or the untagged
+// server logger if there is no player (e.g because the connection has not completed its handshake yet)
+func playerLog(player *PlayerState) *Logger {
+	if player == nil {
+		return serverLog
+	}
+	return gameLog(player.CurrentGame).WithPlayer(player.Id)
+}
+
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logf(LOG_LEVEL_DEBUG, format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logf(LOG_LEVEL_INFO, format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logf(LOG_LEVEL_WARNING, format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logf(LOG_LEVEL_ERROR, format, args...)
+}
+
+func (l *Logger) logf(level LogLevel, format string, args ...interface{}) {
+	l.output.mutex.Lock()
+	defer l.output.mutex.Unlock()
+	if level < l.output.minLevel {
+		return
+	}
+
+	now := time.Now().UTC()
+	message := strings.TrimRight(fmt.Sprintf(format, args...), "\r\n")
+	if l.output.json {
+		entry := logEntry{now.Format(time.RFC3339Nano), level.String(), l.gameId, l.playerId, message}
+		entryBytes, err := json.Marshal(&entry)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(l.output.writer, "%s\n", entryBytes)
+		return
+	}
+
+	fields := ""
+	if l.gameId != nil {
+		fields += fmt.Sprintf("game=%d ", *l.gameId)
+	}
+	if l.playerId != nil {
+		fields += fmt.Sprintf("player=%d ", *l.playerId)
+	}
+	fmt.Fprintf(l.output.writer, "%s %-7s %s%s\n", now.Format(LogTimestampFormat), strings.ToUpper(level.String()), fields, message)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The most commands that a single macro can run, so that a mistake in the macro file can't get a player disconnected
+// for sending too many commands at once
+const MaxMacroCommandCount = 32
+
+// A named sequence of commands that the player can run all at once with 'run <name>'. The commands can contain the
+// parameters $1 to $9, which are replaced by the arguments given to 'run', and $*, which is replaced by all of them.
+type Macro struct {
+	Name     string
+	Commands []string
+}
+
+// The macros loaded from the file given with --macros, in the order in which they were given
+var clientMacros []Macro
+
+// Reads macros from the given file, in which each macro starts with its name in square brackets and is followed by the
+// commands that it runs, one per line. Blank lines and lines starting with '#' are ignored. For example:
+//
+//	[setup]
+//	draw 7
+//	peek 1
+func LoadMacros(filePath string) ([]Macro, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	macros := make([]Macro, 0)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if (len(line) == 0) || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if (len(name) == 0) || strings.ContainsAny(name, " \t") {
+				return nil, fmt.Errorf("Line %d: Macro names cannot be empty or contain spaces", lineNumber)
+			}
+			if FindMacro(macros, name) != nil {
+				return nil, fmt.Errorf("Line %d: There is already a macro named '%s'", lineNumber, name)
+			}
+			macros = append(macros, Macro{name, make([]string, 0)})
+			continue
+		}
+
+		if len(macros) == 0 {
+			return nil, fmt.Errorf("Line %d: Commands must come after the name of the macro that they belong to, e.g '[setup]'", lineNumber)
+		}
+		macro := &macros[len(macros)-1]
+		if strings.HasPrefix(line, "run ") || (line == "run") {
+			return nil, fmt.Errorf("Line %d: Macros cannot run other macros", lineNumber)
+		}
+		if len(macro.Commands) >= MaxMacroCommandCount {
+			return nil, fmt.Errorf("Line %d: Macros can run at most %d commands", lineNumber, MaxMacroCommandCount)
+		}
+		macro.Commands = append(macro.Commands, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return macros, nil
+}
+
+// Returns the macro with the given name (ignoring case), or nil if there is no such macro
+func FindMacro(macros []Macro, name string) *Macro {
+	for index := range macros {
+		if strings.EqualFold(macros[index].Name, name) {
+			return &macros[index]
+		}
+	}
+	return nil
+}
+
+// Returns the macro's commands with its parameters replaced by the given arguments. Fails if the macro uses a parameter
+// that wasn't given, or if an argument would make it run another macro.
+func (macro *Macro) Expand(args []string) ([]string, error) {
+	result := make([]string, 0, len(macro.Commands))
+	for _, command := range macro.Commands {
+		var expanded strings.Builder
+		for index := 0; index < len(command); index++ {
+			if (command[index] != '$') || (index+1 >= len(command)) {
+				expanded.WriteByte(command[index])
+				continue
+			}
+
+			param := command[index+1]
+			if param == '*' {
+				expanded.WriteString(strings.Join(args, " "))
+				index++
+			} else if (param >= '1') && (param <= '9') {
+				argIndex, _ := strconv.Atoi(string(param))
+				if argIndex > len(args) {
+					return nil, fmt.Errorf("Macro '%s' uses parameter $%d, but only %d arguments were given", macro.Name, argIndex, len(args))
+				}
+				expanded.WriteString(args[argIndex-1])
+				index++
+			} else {
+				expanded.WriteByte(command[index])
+			}
+		}
+		if fields := strings.Fields(expanded.String()); (len(fields) > 0) && (fields[0] == "run") {
+			return nil, fmt.Errorf("Macros cannot run other macros")
+		}
+		result = append(result, expanded.String())
+	}
+	return result, nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import "github.com/jacquesh/netdeck/protocol"
+
+const MaxMarketSize = 32
+
+// Returns the index in the market of a card with the same name as the given card, or -1 if there is no such card
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) FindMarketCard(cardId uint16) int {
+	for index, marketCardId := range gs.Market {
+		if gs.spec.SameCard(marketCardId, cardId) {
+			return index
+		}
+	}
+	return -1
+}
+
+// Draws cards from the top of the main deck into the market until it is full or the deck runs out.
+// Returns the cards that were added to the market.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) refillMarket() []uint16 {
+	newCards := make([]uint16, 0)
+	for (len(gs.Market) < gs.spec.MarketSize) && (len(gs.Decks[0]) > 0) {
+		deck := gs.Decks[0]
+		cardId := deck[len(deck)-1]
+		gs.Decks[0] = deck[:len(deck)-1]
+		gs.Market = append(gs.Market, cardId)
+		newCards = append(newCards, cardId)
+	}
+	return newCards
+}
+
+// Refills the market from the deck and tells everyone in the game (including the player whose action emptied a
+// space in the market) which cards were added to it
+func (gs *GameState) RefillMarket(playerId uint64) {
+	gs.mutex.Lock()
+	newCards := gs.refillMarket()
+	gs.mutex.Unlock()
+	if len(newCards) == 0 {
+		return
+	}
+
+	notifyAction := protocol.NewPlayerActionNotify(playerId, protocol.CMD_MARKET_REFILL, 0, protocol.PLAYER_ID_NONE, newCards)
+	err := gs.SendNotificationToSourcePlayer(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to send market refill notification to source player: %s", err)
+	}
+	err = gs.BroadcastNotification(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to broadcast market refill notification: %s", err)
+	}
+}
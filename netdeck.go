@@ -3,45 +3,159 @@ package main
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/akamensky/argparse"
+	"github.com/jacquesh/netdeck/protocol"
 )
 
-// TODO: Add a list of setup commands to the game spec (e.g shuffle, each player a defuse, each player draw 5, burn 20 from the deck, etc)
-// TODO: Add a 'start' command to start a game (and none of the other commands work until then, notify a player when they join a game that is already in progress)
-// TODO: Add a 'draw <this-card-name>' to be able to pull specific cards out of the deck? Important for setup, required for exploding kittens
-// TODO: Add a burn-up and burn-down command pair (lots of games work on a "reveal the top card of this deck" basis, and we can use it for that)
+// TODO: Should none of the other commands work until the game has been started? Also notify a player when they join a game that is already in progress
 // TODO: Consider adding chat so that you can use it without the video channel?
 // TODO: Required for Exploding Kittens Expansions: Shuffle hand (and then its hidden), look at hand (for the curse). Draw from the bottom, Rearrange top n (could be solved by having multiple hands? But thats a bunch of extra complication, just trust)
-// TODO: Support for multiple decks (hinted at by GameState::FindDeck, would need support in NotifyGameJoinedCommand, would need verification in NewSpec())
 // TODO: Add a panic handler that prints some info (contact/github/etc)
-// TODO: Possibly support having face-up cards in players hands and/or in the deck? Then we could show extra info in CMD_INFO_DECKS if the top card is face-up and CMD_CARD_PUTBACK can take an extra face-up argument
-// TODO: Do some actual proper logging (at least on the server) rather than just printing everything to stdout
 // TODO: Possibly add a 'lastplay' command that shows what the last action taken was?
-// TODO: Add a 'roll' command ("roll 2 d20", "roll 2d6", "roll d2" etc)
-// TODO: Make game IDs be something other than consecutive integers so that its just a little harder to join random people's games (and probably easier to tell people what to join too)
 // TODO: Spec file docs
-// TODO: Add a field to the spec for "game-specific instructions/help". Basically "how-to-play" or reference material (useful in Love Letter, for example)
 // TODO: Add a state reload to both the client and the server so that I can kill the server and restart and all the clients can reconnect and carry on playing. This would let me deploy without there needing to be no running games.
-// TODO: Add a command for sending text to all connected players from the server (which allows me to send shutdown notifications).
 
 func main() {
 	const DefaultServerAddr = "app-server-1.jacquesheunis.com"
 	parser := argparse.NewParser("netdeck", "Helps you play card- and boardgames with your friends over the internet by providing a mechanism for managing and sharing hidden information (basically cards in each player's hand)")
-	mode := parser.Selector("m", "mode", []string{"client", "server"}, &argparse.Options{Default: "client", Help: "Whether to run as a client (and connect to a server) or as a server (that other clients can connect to)"})
-	playerName := parser.String("n", "name", &argparse.Options{Help: "The name you wish to be known by to other players in the game"})
-	serverAddr := parser.String("s", "server", &argparse.Options{Default: DefaultServerAddr, Help: "The address of the server to connect to (only valid when running in client mode)"})
 
-	err := parser.Parse(os.Args)
+	playCmd := parser.NewCommand("play", "Connect to a server and play a game (this is the default if no command is given)")
+	playerName := playCmd.String("n", "name", &argparse.Options{Help: "The name you wish to be known by to other players in the game"})
+	serverAddr := playCmd.String("s", "server", &argparse.Options{Default: DefaultServerAddr, Help: "The address of the server to connect to"})
+	relayCode := playCmd.String("r", "relay", &argparse.Options{Help: "The code of the server to connect to through the relay given by --server, for servers that are hosted through a relay"})
+	ignoreAccents := playCmd.Flag("a", "ignore-accents", &argparse.Options{Help: "Match card and player names regardless of accents, so that 'cafe' will match 'Café'"})
+	soloSpec := playCmd.String("", "solo", &argparse.Options{Help: "Play a game with the given spec (a local spec file's name, or a built-in spec such as 'default') alone, on a server run inside netdeck instead of one on the internet. Useful for trying out spec files and learning the commands"})
+	macroFile := playCmd.String("m", "macros", &argparse.Options{Help: "A file of macros (named sequences of commands) that can be run with 'run <macro>'"})
+	noColour := playCmd.Flag("", "no-color", &argparse.Options{Help: "Don't use colours in the output, even if the terminal supports them. Colours are also turned off by setting the NO_COLOR environment variable"})
+	clientLogFile := playCmd.String("", "log-file", &argparse.Options{Help: "A file to append a timestamped transcript of the game to (everything that is printed and every command you enter), for reviewing the game afterwards or attaching to a bug report"})
+	desktopNotify := playCmd.Flag("", "notify", &argparse.Options{Help: "Send a desktop notification (as well as ringing the terminal bell) when it becomes your turn, you are given or shown cards, or a message mentions you"})
+	quiet := playCmd.Flag("q", "quiet", &argparse.Options{Help: "Leave out other players' minor actions (e.g peeking at or shuffling the deck) and keep-alive errors. This can be changed while playing with 'verbosity'"})
+	verbose := playCmd.Flag("v", "verbose", &argparse.Options{Help: "Print every command received from the server as well as what happens in the game, e.g for bug reports. This can be changed while playing with 'verbosity'"})
+	jsonMode := playCmd.Flag("", "json", &argparse.Options{Help: "Print every command received from the server as a line of JSON on stdout, and read commands to send to the server as lines of JSON from stdin, for scripting bots and other interfaces. The usual output is printed on stderr instead. Requires --name"})
+
+	serveCmd := parser.NewCommand("serve", "Run a server that other players can connect to")
+	logLevel := serveCmd.Selector("", "log-level", logLevelNames, &argparse.Options{Default: LOG_LEVEL_INFO.String(), Help: "The least severe level of message that the server should log"})
+	idleTimeout := serveCmd.Int("", "idle-timeout", &argparse.Options{Default: DefaultIdleGameTimeoutMinutes, Help: "Close games that nobody has done anything in for this many minutes (0 to never close them)"})
+	keepAliveTimeout := serveCmd.Int("", "keepalive-timeout", &argparse.Options{Default: protocol.DefaultKeepAliveTimeoutSeconds, Help: "Drop connections that nothing has been received on for this many seconds (0 to never drop them)"})
+	maxConnections := serveCmd.Int("", "max-connections", &argparse.Options{Default: 0, Help: "The most players that can be connected to the server at once (0 for no limit)"})
+	maxGames := serveCmd.Int("", "max-games", &argparse.Options{Default: 0, Help: "The most games that can exist on the server at once (0 for no limit)"})
+	maxPlayersPerGame := serveCmd.Int("", "max-players-per-game", &argparse.Options{Default: 0, Help: "The most players that can be in a single game, including bots (0 for no limit)"})
+	maxConnectionsPerIP := serveCmd.Int("", "max-connections-per-ip", &argparse.Options{Default: DefaultMaxConnectionsPerIP, Help: "The most connections that can be open from a single IP address at once (0 for no limit)"})
+	maxCommandsPerSecond := serveCmd.Int("", "max-commands-per-second", &argparse.Options{Default: DefaultMaxCommandsPerSecond, Help: "Disconnect players that send more than this many commands per second on average (0 for no limit)"})
+	healthAddr := serveCmd.String("", "health-addr", &argparse.Options{Help: "The address (e.g ':8080') on which to serve the /healthz and /readyz HTTP endpoints. By default they are not served"})
+	webAddr := serveCmd.String("", "web-addr", &argparse.Options{Help: "The address (e.g ':8000') on which to serve a browser client that players can join games with, without installing netdeck. By default it is not served"})
+	replayDir := serveCmd.String("", "replay-dir", &argparse.Options{Help: "The directory in which to record a replay file of every game, for reviewing games afterwards. By default games are not recorded"})
+	identityKeyFile := serveCmd.String("", "identity-key-file", &argparse.Options{Default: DefaultIdentityKeyFileName, Help: "The file containing the secret key used to sign players' identity tokens, which is created if it does not exist. Players keep their identity across server restarts as long as this file is kept (and kept secret)"})
+	listenAddrs := serveCmd.StringList("", "listen", &argparse.Options{Default: []string{DefaultListenAddress}, Help: "An address (e.g '0.0.0.0:43831' or '[::1]') on which to accept connections from players. Can be given more than once to listen on several addresses, such as both IPv4 and IPv6. The port defaults to " + DefaultListenPort + " if it is left out"})
+	ircURL := serveCmd.String("", "irc", &argparse.Options{Help: "The IRC channel (e.g 'ircs://irc.libera.chat/#netdeck') to mirror the actions in every public game into. By default games are not mirrored"})
+	ircNick := serveCmd.String("", "irc-nick", &argparse.Options{Default: DefaultIRCNick, Help: "The nick to use in the IRC channel given by --irc"})
+	ircCommands := serveCmd.Flag("", "irc-commands", &argparse.Options{Help: "Let people in the IRC channel given by --irc list public games with '!games' and send messages to them with '!say'"})
+	relayEnabled := serveCmd.Flag("", "relay", &argparse.Options{Help: "Let other servers host games through this one (with --relay-via), for people who can't accept connections from the internet themselves"})
+	relayVia := serveCmd.String("", "relay-via", &argparse.Options{Help: "The address of a server run with --relay to host games through, so that players can connect without this server accepting connections from the internet. The server still listens for connections as usual"})
+	logJSON := serveCmd.Flag("", "log-json", &argparse.Options{Help: "Write the server log as one JSON object per line instead of as plain text"})
+
+	replayCmd := parser.NewCommand("replay", "Step through the events of a game that was recorded by a server run with --replay-dir")
+	replayFile := replayCmd.String("f", "file", &argparse.Options{Required: true, Help: "The path of the replay file to load"})
+
+	specCmd := parser.NewCommand("spec", "Tools for creating and checking game specification files")
+	specValidateCmd := specCmd.NewCommand("validate", "Check that a game specification file is valid")
+	specValidateFile := specValidateCmd.String("f", "file", &argparse.Options{Required: true, Help: "The path of the specification file to check"})
+	specListCmd := specCmd.NewCommand("list", "List the game specification files in the current directory")
+	specConvertCmd := specCmd.NewCommand("convert", "Read a game specification file and write it out again in the format given by the output file's extension")
+	specConvertInput := specConvertCmd.String("i", "input", &argparse.Options{Required: true, Help: "The path of the specification file to read"})
+	specConvertOutput := specConvertCmd.String("o", "output", &argparse.Options{Required: true, Help: "The path of the specification file to write"})
+
+	args := os.Args
+	if len(args) <= 1 {
+		// Running with no arguments (e.g by double-clicking the executable) should just start playing
+		args = append(args, "play")
+	}
+	err := parser.Parse(args)
 	if err != nil {
 		fmt.Print(parser.Usage(err))
+		return
 	}
 
-	if *mode == "server" {
-		runServer()
-	} else {
-		runClient(*playerName, *serverAddr)
+	if serveCmd.Happened() {
+		minLogLevel, err := ParseLogLevel(*logLevel)
+		if err != nil {
+			fmt.Printf("Invalid log level '%s': %s\n", *logLevel, err)
+			return
+		}
+		configureServerLog(minLogLevel, *logJSON)
+		if *idleTimeout < 0 {
+			fmt.Printf("Invalid idle timeout '%d', it cannot be negative\n", *idleTimeout)
+			return
+		}
+		if (*keepAliveTimeout != 0) && (time.Duration(*keepAliveTimeout)*time.Second <= protocol.KeepAliveInterval) {
+			fmt.Printf("Invalid keep-alive timeout '%d', it must be longer than the %s between keep-alives sent by clients\n", *keepAliveTimeout, protocol.KeepAliveInterval)
+			return
+		}
+		if (*maxConnections < 0) || (*maxGames < 0) || (*maxPlayersPerGame < 0) || (*maxConnectionsPerIP < 0) || (*maxCommandsPerSecond < 0) {
+			fmt.Printf("Invalid server limits, they cannot be negative\n")
+			return
+		}
+		if *replayDir != "" {
+			err = os.MkdirAll(*replayDir, 0755)
+			if err != nil {
+				fmt.Printf("Failed to create replay directory '%s': %s\n", *replayDir, err)
+				return
+			}
+		}
+		runServer(ServerConfig{
+			time.Duration(*idleTimeout) * time.Minute,
+			time.Duration(*keepAliveTimeout) * time.Second,
+			*maxConnections,
+			*maxGames,
+			*maxPlayersPerGame,
+			*maxConnectionsPerIP,
+			*maxCommandsPerSecond,
+			*healthAddr,
+			*webAddr,
+			*replayDir,
+			*identityKeyFile,
+			*listenAddrs,
+			*ircURL,
+			*ircNick,
+			*ircCommands,
+			*relayEnabled,
+			*relayVia,
+		})
+	} else if replayCmd.Happened() {
+		runReplay(*replayFile)
+	} else if specValidateCmd.Happened() {
+		runSpecValidate(*specValidateFile)
+	} else if specListCmd.Happened() {
+		runSpecList()
+	} else if specConvertCmd.Happened() {
+		runSpecConvert(*specConvertInput, *specConvertOutput)
+	} else if playCmd.Happened() {
+		verbosity := VERBOSITY_NORMAL
+		if *quiet && *verbose {
+			fmt.Println("Invalid verbosity, --quiet and --verbose cannot both be given")
+			return
+		} else if *quiet {
+			verbosity = VERBOSITY_QUIET
+		} else if *verbose {
+			verbosity = VERBOSITY_VERBOSE
+		}
+		runClient(ClientConfig{
+			*playerName,
+			*serverAddr,
+			*relayCode,
+			*soloSpec,
+			*ignoreAccents,
+			*noColour,
+			*macroFile,
+			*clientLogFile,
+			*desktopNotify,
+			verbosity,
+			*jsonMode,
+		})
+		if !*jsonMode {
+			fmt.Println("Thanks for playing!")
+		}
 	}
-
-	fmt.Println("Thanks for playing!")
 }
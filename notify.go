@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// The title of the desktop notifications that the client sends
+const DesktopNotificationTitle = "netdeck"
+
+// Whether the client also sends a desktop notification (as well as ringing the terminal bell) when something happens
+// that the player needs to notice, such as it becoming their turn. Turned off if sending one fails.
+var desktopNotificationsEnabled = false
+
+// Guards desktopNotificationsEnabled, since notifications are sent (and so can fail) on goroutines of their own
+var desktopNotificationsMutex sync.Mutex
+
+// Gets the player's attention (even if the client's window is in the background) by ringing the terminal bell and, if
+// they are turned on, sending a desktop notification with the given message
+func alertPlayer(message string) {
+	// The bell only goes to the terminal, so that it doesn't end up in the transcript (or among the JSON)
+	if isTerminal(os.Stdout.Fd()) && !jsonOutputEnabled {
+		os.Stdout.WriteString("\a")
+	}
+	desktopNotificationsMutex.Lock()
+	enabled := desktopNotificationsEnabled
+	desktopNotificationsMutex.Unlock()
+	if !enabled {
+		return
+	}
+
+	// Sending a notification runs another program, which the client shouldn't stop handling commands to wait for
+	go func() {
+		err := sendDesktopNotification(DesktopNotificationTitle, message)
+		if err == nil {
+			return
+		}
+		desktopNotificationsMutex.Lock()
+		wasEnabled := desktopNotificationsEnabled
+		desktopNotificationsEnabled = false
+		desktopNotificationsMutex.Unlock()
+		if wasEnabled {
+			printError("Error! Failed to send a desktop notification, so no more will be sent: %s\n", err)
+		}
+	}()
+}
+
+// Returns true if the given message mentions the given player's name as a word of its own (ignoring case), such as
+// "alice" in "Your turn, Alice!"
+func mentionsPlayer(message string, playerName string) bool {
+	if len(playerName) == 0 {
+		return false
+	}
+	name := foldForMatching(playerName, matchIgnoringAccents)
+	words := strings.FieldsFunc(message, func(char rune) bool {
+		return !unicode.IsLetter(char) && !unicode.IsNumber(char) && !strings.ContainsRune(playerName, char)
+	})
+	for _, word := range words {
+		if foldForMatching(word, matchIgnoringAccents) == name {
+			return true
+		}
+	}
+	return false
+}
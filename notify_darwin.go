@@ -0,0 +1,33 @@
+//go:build darwin
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+func sendDesktopNotification(title string, message string) error {
+	script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+	return exec.Command("osascript", "-e", script).Run()
+}
+
+// Returns the given text as an AppleScript string literal. Only backslashes and double quotes need to be escaped in
+// one, and control characters (which AppleScript has no escapes for in general) are left out.
+func appleScriptString(text string) string {
+	var result strings.Builder
+	result.WriteByte('"')
+	for _, char := range text {
+		if unicode.IsControl(char) {
+			continue
+		}
+		if (char == '\\') || (char == '"') {
+			result.WriteByte('\\')
+		}
+		result.WriteRune(char)
+	}
+	result.WriteByte('"')
+	return result.String()
+}
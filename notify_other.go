@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "errors"
+
+var ErrDesktopNotificationsUnsupported = errors.New("Desktop notifications are not supported on this platform")
+
+func sendDesktopNotification(title string, message string) error {
+	return ErrDesktopNotificationsUnsupported
+}
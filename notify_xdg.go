@@ -0,0 +1,10 @@
+//go:build linux || freebsd || netbsd || openbsd
+
+package main
+
+import "os/exec"
+
+// Sends a desktop notification with notify-send, which comes with most desktop environments
+func sendDesktopNotification(title string, message string) error {
+	return exec.Command("notify-send", "--app-name", title, title, message).Run()
+}
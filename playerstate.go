@@ -2,14 +2,44 @@ package main
 
 import (
 	"net"
+	"sync"
+
+	"github.com/jacquesh/netdeck/protocol"
 )
 
 type PlayerState struct {
 	Id          uint64
-	Conn        net.Conn
+	conn        net.Conn // See connMutex
 	Name        string
 	Hand        []uint16
 	CurrentGame *GameState
+	Counters    map[string]int64
+	Tableau     []uint16
+
+	// Set when the player has chosen to leave their hand face-up for everyone to see
+	HandRevealed bool
+
+	// The IDs of the cards in the player's hand that have been turned face-up for everyone to see
+	FaceUpCards []uint16
+
+	// Given to the client during the handshake so that it can take back control of this player if its connection drops
+	ResumeToken uint64
+
+	// Set while the player's connection has dropped and the server is waiting for them to reconnect. See connMutex.
+	disconnected bool
+
+	// Set for server-controlled players that were added with the 'addbot' command
+	IsBot bool
+
+	// The identity proven by the player's identity token, which stays the same across connections (and server restarts).
+	// 0 for bots, and on the client.
+	IdentityId uint64
+
+	sendQueue *SendQueue // Sends commands to conn, see SendCommandBuffer. Only used on the server.
+
+	// Guards conn, disconnected and sendQueue, which are replaced when the player reconnects while other goroutines
+	// might be sending commands to them
+	connMutex *sync.Mutex
 }
 
 func NewPlayerState(id uint64, name string, currentGame *GameState) PlayerState {
@@ -19,6 +49,16 @@ func NewPlayerState(id uint64, name string, currentGame *GameState) PlayerState
 		name,
 		make([]uint16, 0),
 		currentGame,
+		make(map[string]int64),
+		make([]uint16, 0),
+		false,
+		make([]uint16, 0),
+		0,
+		false,
+		false,
+		0,
+		nil,
+		&sync.Mutex{},
 	}
 }
 
@@ -26,15 +66,115 @@ func (ps *PlayerState) InGame() bool {
 	return ps.CurrentGame != nil
 }
 
+// Queues the given command to be sent to the player, without waiting for it to be written to their connection
 func (ps *PlayerState) SendCommandBuffer(buffer []byte) error {
-	return SendCommandBufferTo(ps.Conn, buffer)
+	ps.connMutex.Lock()
+	defer ps.connMutex.Unlock()
+	if ps.disconnected {
+		// They will be sent the current state of the game when they reconnect
+		return nil
+	}
+	return ps.sendQueue.Send(buffer)
+}
+
+// Sets the connection that commands for this player are sent on, and marks them as connected. Any previous
+// connection should have been closed first.
+func (ps *PlayerState) setConnection(conn net.Conn) {
+	ps.connMutex.Lock()
+	ps.conn = conn
+	ps.sendQueue = NewSendQueue(conn)
+	ps.disconnected = false
+	ps.connMutex.Unlock()
+}
+
+// Closes the player's connection once every command that has already been sent to them has been written to it
+func (ps *PlayerState) CloseConnection() {
+	ps.connMutex.Lock()
+	ps.sendQueue.Close()
+	ps.connMutex.Unlock()
+}
+
+// Closes the player's connection and marks them as waiting to reconnect. Returns the connection that was closed.
+func (ps *PlayerState) suspendConnection() net.Conn {
+	ps.connMutex.Lock()
+	defer ps.connMutex.Unlock()
+	ps.sendQueue.Close()
+	ps.disconnected = true
+	return ps.conn
+}
+
+func (ps *PlayerState) IsDisconnected() bool {
+	ps.connMutex.Lock()
+	defer ps.connMutex.Unlock()
+	return ps.disconnected
+}
+
+// Returns true if the player is still waiting to reconnect after the given connection dropped
+func (ps *PlayerState) isStillDisconnectedFrom(conn net.Conn) bool {
+	ps.connMutex.Lock()
+	defer ps.connMutex.Unlock()
+	return ps.disconnected && (ps.conn == conn)
+}
+
+// Returns the queue that sends commands on the player's current connection
+func (ps *PlayerState) currentSendQueue() *SendQueue {
+	ps.connMutex.Lock()
+	defer ps.connMutex.Unlock()
+	return ps.sendQueue
+}
+
+func (ps *PlayerState) RemoteAddr() net.Addr {
+	ps.connMutex.Lock()
+	defer ps.connMutex.Unlock()
+	return ps.conn.RemoteAddr()
 }
 
 func (ps *PlayerState) Draw(cardId uint16) {
 	ps.Hand = append(ps.Hand, cardId)
 }
 
+// Removes the card at the given index from the player's hand, keeping the rest of the hand in the same order
 func (ps *PlayerState) Discard(cardIndex int) {
-	ps.Hand[cardIndex] = ps.Hand[len(ps.Hand)-1]
-	ps.Hand = ps.Hand[:len(ps.Hand)-1]
+	ps.SetFaceUp(ps.Hand[cardIndex], false)
+	ps.Hand = append(ps.Hand[:cardIndex], ps.Hand[cardIndex+1:]...)
+}
+
+func (ps *PlayerState) IsFaceUp(cardId uint16) bool {
+	for _, faceUpCardId := range ps.FaceUpCards {
+		if faceUpCardId == cardId {
+			return true
+		}
+	}
+	return false
+}
+
+func (ps *PlayerState) SetFaceUp(cardId uint16, faceUp bool) {
+	for index, faceUpCardId := range ps.FaceUpCards {
+		if faceUpCardId == cardId {
+			if !faceUp {
+				ps.FaceUpCards = append(ps.FaceUpCards[:index], ps.FaceUpCards[index+1:]...)
+			}
+			return
+		}
+	}
+	if faceUp {
+		ps.FaceUpCards = append(ps.FaceUpCards, cardId)
+	}
+}
+
+// Returns a copy of the given cards from the player's hand, with every card that is not face-up replaced by CARD_ID_ANY
+func (ps *PlayerState) MaskHiddenCards(cardIds []uint16) []uint16 {
+	result := make([]uint16, len(cardIds))
+	for index, cardId := range cardIds {
+		if ps.IsFaceUp(cardId) {
+			result[index] = cardId
+		} else {
+			result[index] = protocol.CARD_ID_ANY
+		}
+	}
+	return result
+}
+
+func (ps *PlayerState) RemoveFromTableau(tableauIndex int) {
+	ps.Tableau = append(ps.Tableau[:tableauIndex], ps.Tableau[tableauIndex+1:]...)
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+const PollTimeout = 120 * time.Second
+const MaxPollOptionCount = 64
+
+// The strings sent as the first of the TargetStrings of a poll notification to say what stage the poll is at.
+// They are followed by the question and then each of the options. Once the poll is finished, the TargetCardIds
+// contain the number of votes for each option (in the same order as the options).
+const (
+	POLL_STATUS_STARTED  = "started"
+	POLL_STATUS_FINISHED = "finished"
+	POLL_STATUS_EXPIRED  = "expired"
+)
+
+type Poll struct {
+	creatorId uint64
+	question  string
+	options   []string
+	votes     map[uint64]uint16
+}
+
+// Returns true if every player currently in the game has voted in the current poll
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) pollComplete() bool {
+	if gs.poll == nil {
+		return false
+	}
+	for _, player := range gs.Players {
+		if _, voted := gs.poll.votes[player.Id]; !voted {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the number of votes that each option of the poll received
+func (poll *Poll) Tally() []uint16 {
+	result := make([]uint16, len(poll.options))
+	for _, option := range poll.votes {
+		result[option]++
+	}
+	return result
+}
+
+// Tells everyone in the game (including the poll creator) about a change in the status of a poll
+func (gs *GameState) notifyPollStatus(poll *Poll, status string) {
+	var tally []uint16
+	if status != POLL_STATUS_STARTED {
+		tally = poll.Tally()
+	}
+	notifyAction := protocol.NewPlayerActionNotify(poll.creatorId, protocol.CMD_POLL_START, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, tally)
+	notifyAction.TargetStrings = append([]string{status, poll.question}, poll.options...)
+	err := gs.SendNotificationToSourcePlayer(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to send poll %s notification to the poll creator: %s", status, err)
+	}
+	err = gs.BroadcastNotification(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to broadcast poll %s notification: %s", status, err)
+	}
+}
+
+// Closes the given poll and reveals the votes that were cast if it is still running once the timeout has passed
+func (gs *GameState) schedulePollExpiry(poll *Poll) {
+	time.AfterFunc(PollTimeout, func() {
+		gs.mutex.Lock()
+		expired := (gs.poll == poll)
+		if expired {
+			gs.poll = nil
+		}
+		gs.mutex.Unlock()
+
+		if expired {
+			gs.notifyPollStatus(poll, POLL_STATUS_EXPIRED)
+		}
+	})
+}
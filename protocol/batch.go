@@ -0,0 +1,54 @@
+package protocol
+
+import (
+	"math"
+)
+
+// A CMD_NOTIFY_BATCH command holds several complete commands (each with its own header), one after the other. The
+// server packs commands that are waiting to be sent to a client into a batch so that they arrive in a single frame
+// (and are compressed together) rather than each needing their own write, which matters when something like dealing
+// a hand sends every player a burst of notifications. Clients handle the commands in a batch in order, exactly as if
+// they had been sent separately. Batches never contain other batches or compressed commands.
+const MinNotifyBatchCommandLength = 2 * CommandHeaderLength
+const MaxNotifyBatchCommandLength = math.MaxUint16
+
+// Packs the given commands (including their headers), which must add up to at most MaxNotifyBatchCommandLength bytes,
+// into a single batch command
+func BuildBatchCommand(commands [][]byte, payloadLength int) []byte {
+	buffer, headerLen := WriteCommandHeader(CMD_NOTIFY_BATCH, uint16(payloadLength))
+	payload := buffer[headerLen:headerLen]
+	for _, command := range commands {
+		payload = append(payload, command...)
+	}
+	return buffer
+}
+
+// Returns the commands in the payload of a batch command, each of which has already been checked with
+// ValidateCommandHeader
+func SplitBatchCommand(payload []byte) ([]CommandContainer, error) {
+	result := make([]CommandContainer, 0)
+	for len(payload) > 0 {
+		if len(payload) < CommandHeaderLength {
+			return nil, ErrInvalidLength
+		}
+		var header CommandHeader
+		err := SerialiseCommandHeader(payload[:CommandHeaderLength], &header, true)
+		if err == nil {
+			err = ValidateCommandHeader(header)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Id == CMD_NOTIFY_BATCH {
+			return nil, ErrInvalidData
+		}
+
+		commandEnd := CommandHeaderLength + int(header.Len)
+		if len(payload) < commandEnd {
+			return nil, ErrInvalidLength
+		}
+		result = append(result, CommandContainer{header, payload[CommandHeaderLength:commandEnd]})
+		payload = payload[commandEnd:]
+	}
+	return result, nil
+}
@@ -0,0 +1,1097 @@
+// Package protocol defines the commands that netdeck clients and servers send to each other and how they are
+// serialised, in both the binary and the JSON formats. Other programs (e.g bots, GUIs or bridges to chat services) can
+// use it to talk to a netdeck server, or use the client package which also handles the connection itself.
+package protocol
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"strings"
+	"time"
+)
+
+/*
+Serialisation notes:
+- All multi-byte integers are transmitted in little-endian format
+*/
+
+const (
+	PROTOCOL_MAGIC_NUMBER = 0x342F // Just some specific random bytes at the beginning of the connection to help verify that the remote client knows about the protocol
+	PROTOCOL_ID           = 0x0005 // Incremented by one for every backwards-incompatible change to the protocol/API
+)
+
+const (
+	// Connection management
+	CMD_UNKNOWN byte = iota
+	CMD_KEEPALIVE
+	CMD_HANDSHAKE
+	CMD_HANDSHAKE_RESPONSE
+	CMD_DISCONNECT
+	CMD_SET_NAME
+	CMD_SET_NAME_RESPONSE
+	CMD_RELAY_HOST
+	CMD_RELAY_HOST_RESPONSE
+	CMD_RELAY_INCOMING
+	CMD_RELAY_ACCEPT
+	CMD_RELAY_CONNECT
+
+	// Info sync
+	CMD_INFO_PLAYERS
+	CMD_INFO_DECKS
+	CMD_INFO_CARDS
+	CMD_INFO_EVENTS
+	CMD_INFO_DISCARDS
+	CMD_INFO_COUNTERS
+	CMD_INFO_TABLE
+	CMD_INFO_TABLEAUS
+	CMD_INFO_SCORES
+	CMD_INFO_GAMES
+	CMD_INFO_MARKET
+	CMD_INFO_CARD_TYPES
+	CMD_INFO_ROLE
+	CMD_INFO_HISTORY
+	CMD_SYNC_REQUEST
+	CMD_INFO_PLAYERS_RESPONSE
+	CMD_INFO_DECKS_RESPONSE
+	CMD_INFO_CARDS_RESPONSE
+	CMD_INFO_EVENTS_RESPONSE
+	CMD_INFO_DISCARDS_RESPONSE
+	CMD_INFO_COUNTERS_RESPONSE
+	CMD_INFO_TABLE_RESPONSE
+	CMD_INFO_TABLEAUS_RESPONSE
+	CMD_INFO_SCORES_RESPONSE
+	CMD_INFO_GAMES_RESPONSE
+	CMD_INFO_MARKET_RESPONSE
+	CMD_INFO_CARD_TYPES_RESPONSE
+	CMD_INFO_ROLE_RESPONSE
+	CMD_INFO_HISTORY_RESPONSE
+	CMD_SYNC_RESPONSE
+
+	// Card actions
+	CMD_CARD_DRAW
+	CMD_CARD_SHOW
+	CMD_CARD_PUTBACK
+	CMD_CARD_DISCARD
+	CMD_CARD_GIVE
+	CMD_CARD_PICKUP
+	CMD_CARD_SHUFFLE_HAND
+	CMD_CARD_FETCH
+	CMD_CARD_SWAP_HANDS
+	CMD_CARD_REVEAL_HAND
+	CMD_CARD_TRADE_OFFER
+	CMD_CARD_TRADE_RESPOND
+	CMD_CARD_VIEW_HAND_REQUEST
+	CMD_CARD_VIEW_HAND_RESPOND
+	CMD_CARD_SET_FACE_UP
+	CMD_CARD_DRAW_UNTIL_TYPE
+	CMD_CARD_DISCARD_TYPE
+	CMD_CARD_ARRANGE_HAND
+
+	// Deck actions
+	CMD_DECK_PEEK
+	CMD_DECK_PEEK_BOTTOM
+	CMD_DECK_SHUFFLE
+	CMD_DECK_BURN
+	CMD_DECK_REARRANGE
+	CMD_DECK_DEAL
+	CMD_DECK_TOP_CARD // Only ever sent as a notification, when the face-up top card of the deck changes
+
+	// Table actions
+	CMD_TABLE_PLAY
+	CMD_TABLE_TAKE
+	CMD_TABLE_PUTBACK
+	CMD_TABLEAU_PLACE
+	CMD_TABLEAU_RETRIEVE
+	CMD_MARKET_TAKE
+	CMD_MARKET_DISCARD
+	CMD_MARKET_REFILL // Only ever sent as a notification, when cards from the deck are added to the market
+
+	// Counter actions
+	CMD_COUNTER_CHANGE
+	CMD_SCORE_ADD
+
+	// Randomisers
+	CMD_RANDOM_ROLL
+	CMD_RANDOM_FLIP
+	CMD_RANDOM_PICK
+	CMD_RANDOM_ROLL_NAMED
+
+	// Polls
+	CMD_POLL_START
+	CMD_POLL_VOTE
+
+	// Turn actions
+	CMD_TURN_END
+	CMD_TURN_TIMER
+
+	// Game Actions
+	CMD_GAME_CREATE
+	CMD_GAME_JOIN
+	CMD_GAME_LEAVE
+	CMD_GAME_START
+	CMD_GAME_UNDO
+	CMD_GAME_UNDO_VOTE
+	CMD_GAME_RESET
+	CMD_GAME_KICK
+	CMD_GAME_TRANSFER_OWNER
+	CMD_GAME_RESUME
+	CMD_GAME_ADD_BOT
+	CMD_GAME_DEAL_ROLES // Only ever sent as a notification, when each player is dealt their secret role
+	CMD_GAME_REVEAL_ROLES
+
+	// Notifications
+	CMD_NOTIFY_PLAYER_ACTION
+	CMD_NOTIFY_GAME_JOINED
+	CMD_NOTIFY_SERVER_SHUTDOWN
+	CMD_NOTIFY_SERVER_MESSAGE
+	CMD_NOTIFY_INPUT_ERROR
+	CMD_NOTIFY_BATCH // Several other commands sent as one, see batch.go
+
+	NUM_CMDS
+)
+
+// The name of each command, as used by the JSON protocol (see jsonprotocol.go)
+var commandNames = [NUM_CMDS]string{
+	CMD_UNKNOWN:                  "UNKNOWN",
+	CMD_KEEPALIVE:                "KEEPALIVE",
+	CMD_HANDSHAKE:                "HANDSHAKE",
+	CMD_HANDSHAKE_RESPONSE:       "HANDSHAKE_RESPONSE",
+	CMD_DISCONNECT:               "DISCONNECT",
+	CMD_SET_NAME:                 "SET_NAME",
+	CMD_SET_NAME_RESPONSE:        "SET_NAME_RESPONSE",
+	CMD_RELAY_HOST:               "RELAY_HOST",
+	CMD_RELAY_HOST_RESPONSE:      "RELAY_HOST_RESPONSE",
+	CMD_RELAY_INCOMING:           "RELAY_INCOMING",
+	CMD_RELAY_ACCEPT:             "RELAY_ACCEPT",
+	CMD_RELAY_CONNECT:            "RELAY_CONNECT",
+	CMD_INFO_PLAYERS:             "INFO_PLAYERS",
+	CMD_INFO_DECKS:               "INFO_DECKS",
+	CMD_INFO_CARDS:               "INFO_CARDS",
+	CMD_INFO_EVENTS:              "INFO_EVENTS",
+	CMD_INFO_DISCARDS:            "INFO_DISCARDS",
+	CMD_INFO_COUNTERS:            "INFO_COUNTERS",
+	CMD_INFO_TABLE:               "INFO_TABLE",
+	CMD_INFO_TABLEAUS:            "INFO_TABLEAUS",
+	CMD_INFO_SCORES:              "INFO_SCORES",
+	CMD_INFO_GAMES:               "INFO_GAMES",
+	CMD_INFO_MARKET:              "INFO_MARKET",
+	CMD_INFO_CARD_TYPES:          "INFO_CARD_TYPES",
+	CMD_INFO_ROLE:                "INFO_ROLE",
+	CMD_INFO_HISTORY:             "INFO_HISTORY",
+	CMD_SYNC_REQUEST:             "SYNC_REQUEST",
+	CMD_INFO_PLAYERS_RESPONSE:    "INFO_PLAYERS_RESPONSE",
+	CMD_INFO_DECKS_RESPONSE:      "INFO_DECKS_RESPONSE",
+	CMD_INFO_CARDS_RESPONSE:      "INFO_CARDS_RESPONSE",
+	CMD_INFO_EVENTS_RESPONSE:     "INFO_EVENTS_RESPONSE",
+	CMD_INFO_DISCARDS_RESPONSE:   "INFO_DISCARDS_RESPONSE",
+	CMD_INFO_COUNTERS_RESPONSE:   "INFO_COUNTERS_RESPONSE",
+	CMD_INFO_TABLE_RESPONSE:      "INFO_TABLE_RESPONSE",
+	CMD_INFO_TABLEAUS_RESPONSE:   "INFO_TABLEAUS_RESPONSE",
+	CMD_INFO_SCORES_RESPONSE:     "INFO_SCORES_RESPONSE",
+	CMD_INFO_GAMES_RESPONSE:      "INFO_GAMES_RESPONSE",
+	CMD_INFO_MARKET_RESPONSE:     "INFO_MARKET_RESPONSE",
+	CMD_INFO_CARD_TYPES_RESPONSE: "INFO_CARD_TYPES_RESPONSE",
+	CMD_INFO_ROLE_RESPONSE:       "INFO_ROLE_RESPONSE",
+	CMD_INFO_HISTORY_RESPONSE:    "INFO_HISTORY_RESPONSE",
+	CMD_SYNC_RESPONSE:            "SYNC_RESPONSE",
+	CMD_CARD_DRAW:                "CARD_DRAW",
+	CMD_CARD_SHOW:                "CARD_SHOW",
+	CMD_CARD_PUTBACK:             "CARD_PUTBACK",
+	CMD_CARD_DISCARD:             "CARD_DISCARD",
+	CMD_CARD_GIVE:                "CARD_GIVE",
+	CMD_CARD_PICKUP:              "CARD_PICKUP",
+	CMD_CARD_SHUFFLE_HAND:        "CARD_SHUFFLE_HAND",
+	CMD_CARD_FETCH:               "CARD_FETCH",
+	CMD_CARD_SWAP_HANDS:          "CARD_SWAP_HANDS",
+	CMD_CARD_REVEAL_HAND:         "CARD_REVEAL_HAND",
+	CMD_CARD_TRADE_OFFER:         "CARD_TRADE_OFFER",
+	CMD_CARD_TRADE_RESPOND:       "CARD_TRADE_RESPOND",
+	CMD_CARD_VIEW_HAND_REQUEST:   "CARD_VIEW_HAND_REQUEST",
+	CMD_CARD_VIEW_HAND_RESPOND:   "CARD_VIEW_HAND_RESPOND",
+	CMD_CARD_SET_FACE_UP:         "CARD_SET_FACE_UP",
+	CMD_CARD_DRAW_UNTIL_TYPE:     "CARD_DRAW_UNTIL_TYPE",
+	CMD_CARD_DISCARD_TYPE:        "CARD_DISCARD_TYPE",
+	CMD_CARD_ARRANGE_HAND:        "CARD_ARRANGE_HAND",
+	CMD_DECK_PEEK:                "DECK_PEEK",
+	CMD_DECK_PEEK_BOTTOM:         "DECK_PEEK_BOTTOM",
+	CMD_DECK_SHUFFLE:             "DECK_SHUFFLE",
+	CMD_DECK_BURN:                "DECK_BURN",
+	CMD_DECK_REARRANGE:           "DECK_REARRANGE",
+	CMD_DECK_DEAL:                "DECK_DEAL",
+	CMD_DECK_TOP_CARD:            "DECK_TOP_CARD",
+	CMD_TABLE_PLAY:               "TABLE_PLAY",
+	CMD_TABLE_TAKE:               "TABLE_TAKE",
+	CMD_TABLE_PUTBACK:            "TABLE_PUTBACK",
+	CMD_TABLEAU_PLACE:            "TABLEAU_PLACE",
+	CMD_TABLEAU_RETRIEVE:         "TABLEAU_RETRIEVE",
+	CMD_MARKET_TAKE:              "MARKET_TAKE",
+	CMD_MARKET_DISCARD:           "MARKET_DISCARD",
+	CMD_MARKET_REFILL:            "MARKET_REFILL",
+	CMD_COUNTER_CHANGE:           "COUNTER_CHANGE",
+	CMD_SCORE_ADD:                "SCORE_ADD",
+	CMD_RANDOM_ROLL:              "RANDOM_ROLL",
+	CMD_RANDOM_FLIP:              "RANDOM_FLIP",
+	CMD_RANDOM_PICK:              "RANDOM_PICK",
+	CMD_RANDOM_ROLL_NAMED:        "RANDOM_ROLL_NAMED",
+	CMD_POLL_START:               "POLL_START",
+	CMD_POLL_VOTE:                "POLL_VOTE",
+	CMD_TURN_END:                 "TURN_END",
+	CMD_TURN_TIMER:               "TURN_TIMER",
+	CMD_GAME_CREATE:              "GAME_CREATE",
+	CMD_GAME_JOIN:                "GAME_JOIN",
+	CMD_GAME_LEAVE:               "GAME_LEAVE",
+	CMD_GAME_START:               "GAME_START",
+	CMD_GAME_UNDO:                "GAME_UNDO",
+	CMD_GAME_UNDO_VOTE:           "GAME_UNDO_VOTE",
+	CMD_GAME_RESET:               "GAME_RESET",
+	CMD_GAME_KICK:                "GAME_KICK",
+	CMD_GAME_TRANSFER_OWNER:      "GAME_TRANSFER_OWNER",
+	CMD_GAME_RESUME:              "GAME_RESUME",
+	CMD_GAME_ADD_BOT:             "GAME_ADD_BOT",
+	CMD_GAME_DEAL_ROLES:          "GAME_DEAL_ROLES",
+	CMD_GAME_REVEAL_ROLES:        "GAME_REVEAL_ROLES",
+	CMD_NOTIFY_PLAYER_ACTION:     "NOTIFY_PLAYER_ACTION",
+	CMD_NOTIFY_GAME_JOINED:       "NOTIFY_GAME_JOINED",
+	CMD_NOTIFY_SERVER_SHUTDOWN:   "NOTIFY_SERVER_SHUTDOWN",
+	CMD_NOTIFY_SERVER_MESSAGE:    "NOTIFY_SERVER_MESSAGE",
+	CMD_NOTIFY_INPUT_ERROR:       "NOTIFY_INPUT_ERROR",
+	CMD_NOTIFY_BATCH:             "NOTIFY_BATCH",
+}
+
+// Returns the name of the command with the given ID (as used by the JSON protocol), or "UNKNOWN" if there is no such
+// command
+func CommandName(cmdId byte) string {
+	if int(cmdId) >= len(commandNames) {
+		return commandNames[CMD_UNKNOWN]
+	}
+	return commandNames[cmdId]
+}
+
+// Returns the ID of the command with the given name, or CMD_UNKNOWN if there is no such command
+func findCommandByName(name string) byte {
+	for cmdId, cmdName := range commandNames {
+		if cmdName == name {
+			return byte(cmdId)
+		}
+	}
+	return CMD_UNKNOWN
+}
+
+var ErrInvalidCommandId = errors.New("Invalid command ID")
+var ErrInvalidPlayerId = errors.New("Invalid player ID")
+var ErrInvalidHeader = errors.New("Invalid command header")
+var ErrInvalidLength = errors.New("Invalid command length")
+var ErrInvalidData = errors.New("Invalid command data")
+var ErrHeaderMismatch = errors.New("Header deserialisation mismatch")
+
+var ErrIncompleteWrite = errors.New("Failed to write complete packet")
+
+const MaxPlayerNameLength = 64
+const MaxCounterNameLength = 32
+const MaxServerMessageLength = 512
+const MaxCardTypeLength = 32
+const MaxDiceNameLength = 32
+const MaxJoinCodeLength = 32
+const MaxRelayCodeLength = 64
+const MaxBotStrategyLength = 16
+
+// Identity tokens are the identity's ID followed by an HMAC-SHA256 of that ID
+const IdentityTokenLength = 8 + sha256.Size
+
+const (
+	ERROR_INVALID_CMD_ID byte = iota
+	ERROR_INVALID_GAME_ID
+	ERROR_INVALID_PLAYER_ID
+	ERROR_INVALID_DECK_ID
+	ERROR_INVALID_CARD_ID
+
+	ERROR_INVALID_PLAYER_NAME
+	ERROR_INVALID_DATA
+
+	ERROR_SERVER_FULL
+	ERROR_NOT_PERMITTED
+	ERROR_UNSUPPORTED_SPEC_VERSION
+	ERROR_PLAYER_COUNT
+	ERROR_SERVER_SHUTTING_DOWN
+	ERROR_RATE_LIMITED
+)
+
+const (
+	PLAYER_ID_ALL  = math.MaxUint64
+	PLAYER_ID_ANY  = math.MaxUint64 - 1
+	PLAYER_ID_NONE = math.MaxUint64 - 2
+	PLAYER_ID_MAX  = math.MaxUint64 - 3
+
+	DECK_ID_ALL  = math.MaxUint16
+	DECK_ID_ANY  = math.MaxUint16 - 1
+	DECK_ID_NONE = math.MaxUint16 - 2
+	DECK_ID_MAX  = math.MaxUint16 - 3
+
+	CARD_ID_ALL  = math.MaxUint16
+	CARD_ID_ANY  = math.MaxUint16 - 1
+	CARD_ID_NONE = math.MaxUint16 - 2
+	CARD_ID_MAX  = math.MaxUint16 - 3
+
+	// Putting a card back into the deck at these depths tells the server to pick a random depth (which isn't revealed),
+	// or to put it at the bottom of the deck
+	DECK_POSITION_RANDOM = math.MaxUint16
+	DECK_POSITION_BOTTOM = math.MaxUint16 - 1
+)
+
+// Command Header
+const CommandHeaderLength = 3
+
+// How often clients send CMD_KEEPALIVE to the server, so that it knows the connection is still alive
+const KeepAliveInterval = 10 * time.Second
+
+// How long the server waits to receive anything on a connection before dropping it, unless configured otherwise
+const DefaultKeepAliveTimeoutSeconds = 60
+
+type CommandHeader struct {
+	Id  byte
+	Len uint16
+}
+
+func SerialiseCommandHeader(buffer []byte, header *CommandHeader, isReading bool) error {
+	ctx := NewSerialisation(buffer, isReading)
+	ctx.SerialiseByte(&header.Id)
+	ctx.SerialiseUint16(&header.Len)
+	return ctx.Complete()
+}
+
+func WriteCommandHeader(cmdId byte, cmdLen uint16) ([]byte, uint16) {
+	buffer := make([]byte, CommandHeaderLength+cmdLen)
+	header := CommandHeader{
+		cmdId,
+		cmdLen,
+	}
+	SerialiseCommandHeader(buffer, &header, false)
+	return buffer, CommandHeaderLength
+}
+
+type CommandContainer struct {
+	Header  CommandHeader
+	Payload []byte
+}
+
+// Implemented by the struct of every command that has any data (see commands_gen.go)
+type Command interface {
+	CommandLength() int
+	Serialise(buffer []byte, isReading bool) error
+}
+
+// Returns the given command (including its header), ready to be sent. cmd is nil for commands that have no data.
+// Commands longer than math.MaxUint16 are refused with ErrCommandTooLong, since their length can't be sent in the header
+// (see CMD_FLAG_COMPRESSED).
+func BuildCommand(cmdId byte, cmd Command) ([]byte, error) {
+	if cmd == nil {
+		buffer, _ := WriteCommandHeader(cmdId, 0)
+		return buffer, nil
+	}
+	cmdLen := cmd.CommandLength()
+	if cmdLen > math.MaxUint16 {
+		return nil, ErrCommandTooLong
+	}
+	buffer, headerLen := WriteCommandHeader(cmdId, uint16(cmdLen))
+	err := cmd.Serialise(buffer[headerLen:], false)
+	if err != nil {
+		return nil, err
+	}
+	return buffer, nil
+}
+
+func commandLengthLimits(id byte) (uint16, uint16) {
+	var minCmdLen uint16 = 0
+	var maxCmdLen uint16 = 0
+	switch id {
+	case CMD_HANDSHAKE:
+		minCmdLen = MinHandshakeCommandLength
+		maxCmdLen = MaxHandshakeCommandLength
+	case CMD_HANDSHAKE_RESPONSE:
+		minCmdLen = HandshakeResponseCommandLength
+		maxCmdLen = HandshakeResponseCommandLength
+	case CMD_SET_NAME, CMD_SET_NAME_RESPONSE:
+		minCmdLen = MinSetNameCommandLength
+		maxCmdLen = MaxSetNameCommandLength
+	case CMD_RELAY_HOST, CMD_RELAY_HOST_RESPONSE, CMD_RELAY_CONNECT:
+		minCmdLen = MinRelayCodeCommandLength
+		maxCmdLen = MaxRelayCodeCommandLength
+	case CMD_RELAY_INCOMING, CMD_RELAY_ACCEPT:
+		minCmdLen = RelayConnectionCommandLength
+		maxCmdLen = RelayConnectionCommandLength
+	case CMD_INFO_PLAYERS_RESPONSE:
+		minCmdLen = MinPlayerInfoResponseCommandLength
+		maxCmdLen = MaxPlayerInfoResponseCommandLength
+	case CMD_INFO_DECKS_RESPONSE:
+		minCmdLen = MinDeckInfoResponseCommandLength
+		maxCmdLen = MaxDeckInfoResponseCommandLength
+	case CMD_INFO_CARDS_RESPONSE:
+		minCmdLen = MinCardInfoResponseCommandLength
+		maxCmdLen = MaxCardInfoResponseCommandLength
+	case CMD_INFO_DISCARDS_RESPONSE:
+		minCmdLen = MinCardInfoResponseCommandLength
+		maxCmdLen = MaxCardInfoResponseCommandLength
+	case CMD_INFO_COUNTERS_RESPONSE:
+		minCmdLen = MinCounterInfoResponseCommandLength
+		maxCmdLen = MaxCounterInfoResponseCommandLength
+	case CMD_INFO_CARD_TYPES_RESPONSE:
+		minCmdLen = MinCardTypeInfoResponseCommandLength
+		maxCmdLen = MaxCardTypeInfoResponseCommandLength
+	case CMD_INFO_TABLE_RESPONSE, CMD_INFO_MARKET_RESPONSE, CMD_INFO_ROLE_RESPONSE:
+		minCmdLen = MinCardInfoResponseCommandLength
+		maxCmdLen = MaxCardInfoResponseCommandLength
+	case CMD_INFO_TABLEAUS_RESPONSE:
+		minCmdLen = MinTableauInfoResponseCommandLength
+		maxCmdLen = MaxTableauInfoResponseCommandLength
+	case CMD_INFO_SCORES_RESPONSE:
+		minCmdLen = MinScoreInfoResponseCommandLength
+		maxCmdLen = MaxScoreInfoResponseCommandLength
+	case CMD_INFO_GAMES_RESPONSE:
+		minCmdLen = MinGameInfoResponseCommandLength
+		maxCmdLen = MaxGameInfoResponseCommandLength
+	case CMD_INFO_EVENTS:
+		minCmdLen = EventInfoCommandLength
+		maxCmdLen = EventInfoCommandLength
+	case CMD_INFO_EVENTS_RESPONSE:
+		minCmdLen = MinEventInfoResponseCommandLength
+		maxCmdLen = MaxEventInfoResponseCommandLength
+	case CMD_INFO_HISTORY_RESPONSE:
+		minCmdLen = MinHistoryInfoResponseCommandLength
+		maxCmdLen = MaxHistoryInfoResponseCommandLength
+	case CMD_SYNC_RESPONSE:
+		minCmdLen = MinSyncResponseCommandLength
+		maxCmdLen = MaxSyncResponseCommandLength
+	case CMD_CARD_DRAW:
+		minCmdLen = CardDrawCommandLength
+		maxCmdLen = CardDrawCommandLength
+	case CMD_CARD_SHOW:
+		minCmdLen = CardShowCommandLength
+		maxCmdLen = CardShowCommandLength
+	case CMD_CARD_PUTBACK:
+		minCmdLen = CardPutbackCommandLength
+		maxCmdLen = CardPutbackCommandLength
+	case CMD_CARD_DISCARD:
+		minCmdLen = CardDiscardCommandLength
+		maxCmdLen = CardDiscardCommandLength
+	case CMD_CARD_GIVE:
+		minCmdLen = CardGiveCommandLength
+		maxCmdLen = CardGiveCommandLength
+	case CMD_CARD_PICKUP:
+		minCmdLen = CardPickupCommandLength
+		maxCmdLen = CardPickupCommandLength
+	case CMD_CARD_FETCH:
+		minCmdLen = CardFetchCommandLength
+		maxCmdLen = CardFetchCommandLength
+	case CMD_CARD_SWAP_HANDS:
+		minCmdLen = CardSwapHandsCommandLength
+		maxCmdLen = CardSwapHandsCommandLength
+	case CMD_CARD_REVEAL_HAND:
+		minCmdLen = CardRevealHandCommandLength
+		maxCmdLen = CardRevealHandCommandLength
+	case CMD_CARD_TRADE_OFFER:
+		minCmdLen = CardTradeOfferCommandLength
+		maxCmdLen = CardTradeOfferCommandLength
+	case CMD_CARD_TRADE_RESPOND:
+		minCmdLen = CardTradeRespondCommandLength
+		maxCmdLen = CardTradeRespondCommandLength
+	case CMD_CARD_VIEW_HAND_REQUEST:
+		minCmdLen = CardViewHandRequestCommandLength
+		maxCmdLen = CardViewHandRequestCommandLength
+	case CMD_CARD_VIEW_HAND_RESPOND:
+		minCmdLen = CardViewHandRespondCommandLength
+		maxCmdLen = CardViewHandRespondCommandLength
+	case CMD_CARD_SET_FACE_UP:
+		minCmdLen = CardSetFaceUpCommandLength
+		maxCmdLen = CardSetFaceUpCommandLength
+	case CMD_CARD_DRAW_UNTIL_TYPE:
+		minCmdLen = MinCardDrawUntilTypeCommandLength
+		maxCmdLen = MaxCardDrawUntilTypeCommandLength
+	case CMD_CARD_DISCARD_TYPE:
+		minCmdLen = MinCardDiscardTypeCommandLength
+		maxCmdLen = MaxCardDiscardTypeCommandLength
+	case CMD_CARD_ARRANGE_HAND:
+		minCmdLen = MinCardArrangeHandCommandLength
+		maxCmdLen = MaxCardArrangeHandCommandLength
+	case CMD_DECK_PEEK, CMD_DECK_PEEK_BOTTOM:
+		minCmdLen = DeckPeekCommandLength
+		maxCmdLen = DeckPeekCommandLength
+	case CMD_DECK_SHUFFLE:
+		minCmdLen = DeckShuffleCommandLength
+		maxCmdLen = DeckShuffleCommandLength
+	case CMD_DECK_BURN:
+		minCmdLen = DeckBurnCommandLength
+		maxCmdLen = DeckBurnCommandLength
+	case CMD_DECK_DEAL:
+		minCmdLen = DeckDealCommandLength
+		maxCmdLen = DeckDealCommandLength
+	case CMD_DECK_REARRANGE:
+		minCmdLen = MinDeckRearrangeCommandLength
+		maxCmdLen = MaxDeckRearrangeCommandLength
+	case CMD_TABLE_PLAY, CMD_TABLE_TAKE, CMD_TABLEAU_PLACE, CMD_TABLEAU_RETRIEVE, CMD_MARKET_TAKE, CMD_MARKET_DISCARD:
+		minCmdLen = TableCardCommandLength
+		maxCmdLen = TableCardCommandLength
+	case CMD_TABLE_PUTBACK:
+		minCmdLen = TablePutbackCommandLength
+		maxCmdLen = TablePutbackCommandLength
+	case CMD_GAME_UNDO_VOTE:
+		minCmdLen = GameUndoVoteCommandLength
+		maxCmdLen = GameUndoVoteCommandLength
+	case CMD_GAME_KICK:
+		minCmdLen = GameKickCommandLength
+		maxCmdLen = GameKickCommandLength
+	case CMD_GAME_TRANSFER_OWNER:
+		minCmdLen = GameTransferOwnerCommandLength
+		maxCmdLen = GameTransferOwnerCommandLength
+	case CMD_GAME_ADD_BOT:
+		minCmdLen = MinGameAddBotCommandLength
+		maxCmdLen = MaxGameAddBotCommandLength
+	case CMD_SCORE_ADD:
+		minCmdLen = ScoreAddCommandLength
+		maxCmdLen = ScoreAddCommandLength
+	case CMD_COUNTER_CHANGE:
+		minCmdLen = MinCounterChangeCommandLength
+		maxCmdLen = MaxCounterChangeCommandLength
+	case CMD_RANDOM_ROLL:
+		minCmdLen = RandomRollCommandLength
+		maxCmdLen = RandomRollCommandLength
+	case CMD_RANDOM_PICK:
+		minCmdLen = MinRandomPickCommandLength
+		maxCmdLen = MaxRandomPickCommandLength
+	case CMD_RANDOM_ROLL_NAMED:
+		minCmdLen = MinRandomRollNamedCommandLength
+		maxCmdLen = MaxRandomRollNamedCommandLength
+	case CMD_POLL_START:
+		minCmdLen = MinPollStartCommandLength
+		maxCmdLen = MaxPollStartCommandLength
+	case CMD_POLL_VOTE:
+		minCmdLen = PollVoteCommandLength
+		maxCmdLen = PollVoteCommandLength
+	case CMD_TURN_TIMER:
+		minCmdLen = TurnTimerCommandLength
+		maxCmdLen = TurnTimerCommandLength
+	case CMD_GAME_CREATE:
+		minCmdLen = MinGameCreateCommandLength
+		maxCmdLen = MaxGameCreateCommandLength
+	case CMD_GAME_JOIN:
+		minCmdLen = MinGameJoinCommandLength
+		maxCmdLen = MaxGameJoinCommandLength
+	case CMD_NOTIFY_PLAYER_ACTION:
+		minCmdLen = MinNotifyPlayerActionCommandLength
+		maxCmdLen = MaxNotifyPlayerActionCommandLength
+	case CMD_NOTIFY_GAME_JOINED:
+		minCmdLen = MinNotifyGameJoinedCommandLength
+		maxCmdLen = MaxNotifyGameJoinedCommandLength
+	case CMD_NOTIFY_SERVER_MESSAGE:
+		minCmdLen = MinNotifyServerMessageCommandLength
+		maxCmdLen = MaxNotifyServerMessageCommandLength
+	case CMD_NOTIFY_INPUT_ERROR:
+		minCmdLen = NotifyInputErrorCommandLength
+		maxCmdLen = NotifyInputErrorCommandLength
+	case CMD_NOTIFY_BATCH:
+		minCmdLen = MinNotifyBatchCommandLength
+		maxCmdLen = MaxNotifyBatchCommandLength
+	}
+	return minCmdLen, maxCmdLen
+}
+
+func ValidateCommandHeader(header CommandHeader) error {
+	if header.Id >= NUM_CMDS {
+		return ErrInvalidHeader
+	}
+
+	// NOTE: Its important for us to validate the packet length here because otherwise somebody can
+	//		 send us a packet that claims to be very long but not send us any data and we'll sit
+	//		 trying to read it all from the socket
+	minCmdLen, maxCmdLen := commandLengthLimits(header.Id)
+	if (header.Len < minCmdLen) || (header.Len > maxCmdLen) {
+		return ErrInvalidLength
+	}
+	return nil
+}
+
+// The serialisation code for each command (and the constants for its length) is generated from these structs by
+// gencommands.go, which describes the tags that they can be given. The fields are sent in the order that they are
+// declared in.
+//go:generate go run gencommands.go
+
+// ResumeToken is zero for a new connection, or the token from an earlier handshake response if the client wants to
+// take back control of the player that it had before its connection dropped.
+// IdentityToken is empty the first time that the client connects to a server, and after that is the identity token
+// from that server's first handshake response.
+// CompressionMethods is a bitmask of the COMPRESSION_* methods that the client can decompress.
+type HandshakeCommand struct {
+	MagicNumber        uint16
+	ProtocolId         uint16
+	ResumeToken        uint64
+	IdentityToken      []byte `netdeck:"len=IdentityTokenLength,empty"`
+	LocalName          string `netdeck:"max=MaxPlayerNameLength"`
+	CompressionMethods byte
+}
+
+// IdentityToken is the token that was given in the handshake if it was valid, or a token for a new identity otherwise.
+// Compression is the COMPRESSION_* method that the server will use for large commands that it sends to the client.
+type HandshakeResponseCommand struct {
+	PlayerId      uint64
+	ResumeToken   uint64
+	IdentityToken []byte `netdeck:"len=IdentityTokenLength"`
+	Compression   byte
+}
+
+// Sent by a player in the lobby to change their name. The server sends the same command back (as a
+// CMD_SET_NAME_RESPONSE) once the name has been changed, or an input error if the name was not accepted.
+type SetNameCommand struct {
+	Name string `netdeck:"max=MaxPlayerNameLength"`
+}
+
+// Used for the commands that set up relayed connections (see relay.go):
+//   - RELAY_HOST is sent by a server to start hosting through the relay. code is the code that it used last time (so
+//     that players can keep using it after the host reconnects), or empty for a new one.
+//   - RELAY_HOST_RESPONSE is sent back with the code that players can use to connect to the host.
+//   - RELAY_CONNECT is sent by a player instead of a handshake, to have the rest of their connection relayed to the host
+//     with the given code.
+type RelayCodeCommand struct {
+	Code string `netdeck:"max=MaxRelayCodeLength"`
+}
+
+// RELAY_INCOMING is sent by the relay to tell the host that a player wants to connect, and the host then opens a new
+// connection to the relay and sends RELAY_ACCEPT with the same ID to have it joined up with the player's connection.
+type RelayConnectionCommand struct {
+	ConnectionId uint64
+}
+
+func IsValidPlayerName(name string) bool {
+	return (len(name) > 0) && (len(name) <= MaxPlayerNameLength) && !strings.ContainsAny(name, " \t\r\n")
+}
+
+// RevealedHands contains the whole hand of every player whose HandRevealed flag is set, and only the face-up cards in
+// the hand of every other player
+type PlayerInfoResponseCommand struct {
+	Ids           []uint64
+	Names         []string   `netdeck:"samelen=Ids"`
+	HandSizes     []uint16   `netdeck:"samelen=Ids"`
+	HandRevealed  []bool     `netdeck:"samelen=Ids"`
+	RevealedHands [][]uint16 `netdeck:"samelen=Ids"`
+}
+
+type DeckInfoResponseCommand struct {
+	Ids        []uint16
+	CardCounts []uint16 `netdeck:"samelen=Ids"`
+	TopCardIds []uint16 `netdeck:"samelen=Ids"` // CARD_ID_NONE for decks whose top card is face-down (or that are empty)
+}
+
+// DeckCounts holds the number of cards of each type that are left in the deck
+type CardTypeInfoResponseCommand struct {
+	Types      []string
+	DeckCounts []uint16 `netdeck:"samelen=Types"`
+}
+
+// FaceUpIds is only used when describing a player's hand, and contains those ids that everybody can see
+type CardInfoResponseCommand struct {
+	Ids       []uint16
+	FaceUpIds []uint16
+}
+
+type EventInfoCommand struct {
+	Count uint16
+}
+
+type EventInfoResponseCommand struct {
+	Timestamps        []uint64
+	PlayerNames       []string   `netdeck:"samelen=Timestamps"`
+	TargetPlayerNames []string   `netdeck:"samelen=Timestamps"`
+	CmdIds            []byte     `netdeck:"samelen=Timestamps"`
+	TargetCardIds     [][]uint16 `netdeck:"samelen=Timestamps"`
+	TargetStrings     [][]string `netdeck:"samelen=Timestamps"`
+}
+
+// The complete history of a game is usually too long to fit in a single command, so it is sent in as many of these as
+// it takes. FirstIndex is the position in the history of the first event in this response, and Remaining is the
+// number of events that will follow in later responses (so it is zero in the last one).
+// Private is set for events that only the receiving player was told about, e.g which cards they drew.
+type HistoryInfoResponseCommand struct {
+	FirstIndex        uint64
+	Remaining         uint64
+	Timestamps        []uint64
+	PlayerNames       []string   `netdeck:"samelen=Timestamps"`
+	TargetPlayerNames []string   `netdeck:"samelen=Timestamps"`
+	CmdIds            []byte     `netdeck:"samelen=Timestamps"`
+	TargetDeckIds     []uint16   `netdeck:"samelen=Timestamps"`
+	TargetCardIds     [][]uint16 `netdeck:"samelen=Timestamps"`
+	TargetStrings     [][]string `netdeck:"samelen=Timestamps"`
+	Private           []bool     `netdeck:"samelen=Timestamps"`
+}
+
+// Everything that the client keeps track of about the game it is in, so that it can start again from the server's
+// state if its own has diverged. The player lists are all in the same order, and Hand and FaceUpIds are the hand of
+// the player that asked.
+type SyncResponseCommand struct {
+	OwnerId      uint64
+	TurnPlayerId uint64
+	PlayerIds    []uint64
+	PlayerNames  []string   `netdeck:"samelen=PlayerIds"`
+	HandSizes    []uint16   `netdeck:"samelen=PlayerIds"`
+	TableauIds   [][]uint16 `netdeck:"samelen=PlayerIds"`
+	Hand         []uint16
+	FaceUpIds    []uint16
+	HandRevealed bool
+	DeckSizes    []uint16
+	TableIds     []uint16
+	DiscardIds   []uint16 // From top to bottom, with face-down cards as CARD_ID_ANY
+	MarketIds    []uint16
+}
+
+// Contains one entry for every counter of every player, so the same player ID may appear many times
+type CounterInfoResponseCommand struct {
+	PlayerIds    []uint64
+	CounterNames []string `netdeck:"samelen=PlayerIds"`
+	Values       []int64  `netdeck:"samelen=PlayerIds"`
+}
+
+type TableauInfoResponseCommand struct {
+	PlayerIds []uint64
+	CardIds   [][]uint16 `netdeck:"samelen=PlayerIds"`
+}
+
+// Contains one entry for every round of every player, in the order that the scores were recorded
+type ScoreInfoResponseCommand struct {
+	PlayerNames []string
+	Values      []int64 `netdeck:"samelen=PlayerNames"`
+}
+
+// The most games that will be listed in a single game info response, to keep it within the maximum command length
+const MaxGameInfoResponseGameCount = 128
+
+// Contains one entry for every public game that can be joined
+type GameInfoResponseCommand struct {
+	GameIds      []uint64
+	Names        []string `netdeck:"samelen=GameIds"`
+	PlayerCounts []uint16 `netdeck:"samelen=GameIds"`
+	OwnerNames   []string `netdeck:"samelen=GameIds"`
+}
+
+type CardDrawCommand struct {
+	DeckId uint16
+	Count  uint16
+	FaceUp bool
+}
+
+// Sent as the TargetStrings of a card show notification when the target player is the one player who did NOT see the cards
+const SHOW_TARGET_EXCEPT = "except"
+
+// ExceptPlayerId can only be given when showing the card to all players, and is PLAYER_ID_NONE otherwise
+type CardShowCommand struct {
+	CardId         uint16
+	PlayerId       uint64
+	ExceptPlayerId uint64
+}
+
+// Sent as the TargetStrings of a putback notification when the card was put back at a random depth or at the bottom
+const (
+	PUTBACK_POSITION_RANDOM = "random"
+	PUTBACK_POSITION_BOTTOM = "bottom"
+)
+
+type CardPutbackCommand struct {
+	CardId       uint16
+	DeckId       uint16
+	CardsFromTop uint16
+	FaceUp       bool
+}
+
+type CardDiscardCommand struct {
+	CardId uint16
+	FaceUp bool
+}
+
+type CardGiveCommand struct {
+	CardId   uint16
+	PlayerId uint64
+	FaceUp   bool
+}
+
+// Picks up the top card of the discard pile, or if Search is true then the face-up card with the same name as CardId
+type CardPickupCommand struct {
+	CardId uint16
+	Search bool
+}
+
+type CardFetchCommand struct {
+	DeckId uint16
+	CardId uint16
+}
+
+type CardSwapHandsCommand struct {
+	PlayerId uint64
+}
+
+type CardRevealHandCommand struct {
+	KeepRevealed bool
+}
+
+type CardTradeOfferCommand struct {
+	OfferedCardId   uint16
+	PlayerId        uint64
+	RequestedCardId uint16
+}
+
+// Sent by the player who received a trade offer, PlayerId is the player who made the offer
+type CardTradeRespondCommand struct {
+	PlayerId uint64
+	Accept   bool
+}
+
+type CardViewHandRequestCommand struct {
+	PlayerId uint64
+}
+
+// Sent by the player whose hand somebody asked to see, PlayerId is the player who asked
+type CardViewHandRespondCommand struct {
+	PlayerId uint64
+	Accept   bool
+}
+
+// The strings sent in the TargetStrings of a set-face-up notification to say which way the card was turned
+const (
+	CARD_FACING_UP   = "up"
+	CARD_FACING_DOWN = "down"
+)
+
+type CardSetFaceUpCommand struct {
+	CardId uint16
+	FaceUp bool
+}
+
+// Draws cards from the top of the deck until a card of the given type is drawn (or the deck runs out)
+type CardDrawUntilTypeCommand struct {
+	DeckId   uint16
+	CardType string `netdeck:"max=MaxCardTypeLength"`
+}
+
+// Discards every card of the given type from the player's hand
+type CardDiscardTypeCommand struct {
+	CardType string `netdeck:"max=MaxCardTypeLength"`
+	FaceUp   bool
+}
+
+// Reorders the cards in the player's hand. NewOrder[i] is the current position (counting from 0) of the card that
+// should end up at position i, and every card in the hand must be given exactly once.
+type CardArrangeHandCommand struct {
+	NewOrder []uint16
+}
+
+type DeckPeekCommand struct {
+	DeckId uint16
+	Count  uint16
+	Public bool
+}
+
+type DeckShuffleCommand struct {
+	DeckId uint16
+}
+
+type DeckBurnCommand struct {
+	DeckId uint16
+	Count  uint16
+	FaceUp bool
+}
+
+// Gives count cards from the deck to every player in the game
+type DeckDealCommand struct {
+	DeckId uint16
+	Count  uint16
+}
+
+// Reorders the top len(NewOrder) cards of the deck. NewOrder[i] is the current position (counting from 0 at the top)
+// of the card that should end up at position i.
+type DeckRearrangeCommand struct {
+	DeckId   uint16
+	NewOrder []uint16
+}
+
+// Used for moving a single card between your hand and either the table or your tableau
+type TableCardCommand struct {
+	CardId uint16
+}
+
+type TablePutbackCommand struct {
+	CardId       uint16
+	DeckId       uint16
+	CardsFromTop uint16
+}
+
+type ScoreAddCommand struct {
+	PlayerId uint64
+	Value    int64
+}
+
+// Adds Value to the given counter of the given player, or if SetValue is true then sets the counter to Value.
+// The name and new value of the counter are sent to all players as the TargetStrings of an action notification.
+type CounterChangeCommand struct {
+	PlayerId    uint64
+	CounterName string `netdeck:"max=MaxCounterNameLength"`
+	SetValue    bool
+	Value       int64
+}
+
+func IsValidCounterName(name string) bool {
+	return (len(name) > 0) && (len(name) <= MaxCounterNameLength) && !strings.ContainsAny(name, " \t\r\n")
+}
+
+const MaxRandomRollDiceCount = 100
+
+// The results of the roll are sent to all players in the TargetCardIds of an action notification. The first element is
+// the number of sides on each die and the remaining elements are the values rolled.
+type RandomRollCommand struct {
+	Count uint16
+	Sides uint16
+}
+
+// Rolls dice that are defined in the game's spec. The results are sent to all players in the TargetStrings of an action
+// notification. The first element is the name of the dice and the remaining elements are the faces that were rolled.
+type RandomRollNamedCommand struct {
+	DiceName string `netdeck:"max=MaxDiceNameLength"`
+	Count    uint16
+}
+
+// The option that was picked is sent to all players as the first of the TargetStrings in an action notification,
+// followed by all of the options that were available.
+//
+//netdeck:maxlength 4096
+type RandomPickCommand struct {
+	Options []string
+}
+
+//netdeck:maxlength 4096
+type PollStartCommand struct {
+	Question string
+	Options  []string
+}
+
+// Option is the index of the chosen option in the list of options that the poll was started with
+type PollVoteCommand struct {
+	Option uint16
+}
+
+// A time limit of zero turns the turn timer off
+type TurnTimerCommand struct {
+	Seconds     uint16
+	AutoAdvance bool
+}
+
+const MaxGameNameLength = 64
+
+var MaxGameCreateSpecDataLength = MaxGameCreateCommandLength - GameCreateCommandLength(MaxGameNameLength, 0)
+
+func GameCreateCommandLength(nameLength int, specDataLength int) int {
+	return MinGameCreateCommandLength + nameLength + specDataLength
+}
+
+// Public games are listed for everybody in the lobby, others can only be joined by players who know their ID.
+// If seeded is set then the game's random number generator is seeded with the given seed, so that every shuffle, dice
+// roll etc is the same each time the game is played with the same commands (e.g for tests and reproducing bugs).
+type GameCreateCommand struct {
+	Name     string `netdeck:"max=MaxGameNameLength"`
+	Public   bool
+	Seeded   bool
+	Seed     int64
+	SpecData []byte
+}
+
+// Games can be joined either by their ID or by their join code. If JoinCode is given then GameId is ignored.
+type GameJoinCommand struct {
+	GameId   uint64
+	JoinCode string `netdeck:"max=MaxJoinCodeLength"`
+}
+
+type GameLeaveCommand struct{}
+
+type GameUndoVoteCommand struct {
+	Approve bool
+}
+
+type GameKickCommand struct {
+	PlayerId     uint64
+	DiscardCards bool
+}
+
+type GameTransferOwnerCommand struct {
+	PlayerId uint64
+}
+
+type NotifyPlayerActionCommand struct {
+	PlayerId       uint64
+	CmdId          byte
+	TargetDeckId   uint16
+	TargetPlayerId uint64
+	TargetCardIds  []uint16
+	TargetStrings  []string
+}
+
+func NewPlayerActionNotify(playerId uint64, cmdId byte, targetDeckId uint16, targetPlayerId uint64, targetCardIds []uint16) NotifyPlayerActionCommand {
+	return NotifyPlayerActionCommand{
+		playerId,
+		cmdId,
+		targetDeckId,
+		targetPlayerId,
+		targetCardIds,
+		nil,
+	}
+}
+
+type GameAddBotCommand struct {
+	Strategy string `netdeck:"max=MaxBotStrategyLength"`
+}
+
+type NotifyGameJoinedCommand struct {
+	GameId      uint64
+	JoinCode    string
+	OwnerId     uint64
+	SpecData    []byte
+	SpecHash    []byte // A hash of the canonical form of the game's spec, so that players can check that they all have the same one
+	PlayerIds   []uint64
+	PlayerNames []string   `netdeck:"samelen=PlayerIds"`
+	PlayerHands [][]uint16 `netdeck:"samelen=PlayerIds"`
+	DeckSizes   []uint16   // The number of cards in each deck, indexed by deck ID
+}
+
+type NotifyServerShutdownCommand struct{}
+
+// Text sent by whoever is running the server to every connected player (e.g to warn them of an upcoming restart)
+type NotifyServerMessageCommand struct {
+	Message string `netdeck:"max=MaxServerMessageLength"`
+}
+
+type NotifyInputErrorCommand struct {
+	CmdId   byte
+	ErrorId byte
+}
+
+func ReadExactlyNBytes(reader io.Reader, n uint16) ([]byte, error) {
+	bytes := make([]byte, n)
+	bytesRead := 0
+	for bytesRead < int(n) {
+		newBytes, err := reader.Read(bytes[bytesRead:])
+		if (newBytes == 0) && (err != nil) {
+			return nil, err
+		}
+		bytesRead += newBytes
+	}
+
+	return bytes, nil
+}
+
+func SendCommandBufferTo(conn net.Conn, buffer []byte) error {
+	bytesWritten := 0
+	for bytesWritten < len(buffer) {
+		newBytesWritten, err := conn.Write(buffer)
+		if err != nil {
+			return err
+		}
+		bytesWritten += newBytesWritten
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+)
+
+// The compression methods that can be agreed on during the handshake. Clients send a bitmask of the methods that they
+// can decompress, and the server replies with the one that it will use for the commands that it sends them.
+const (
+	COMPRESSION_NONE byte = 0x00
+	COMPRESSION_GZIP byte = 0x01
+)
+
+// Set in the ID of a command whose payload has been compressed, in which case the length in its header is the length
+// of the compressed payload. Every command ID is less than this.
+// Compression only makes commands smaller on the wire: the decompressed payload is still limited to the command's
+// maximum length, which is at most math.MaxUint16, so it does not allow any larger commands to be sent.
+const CMD_FLAG_COMPRESSED byte = 0x80
+
+// Commands with payloads shorter than this are never compressed, since they would barely get any smaller
+const CompressionThreshold = 1024
+
+var ErrCompressedCommandTooLong = errors.New("Decompressed command is too long")
+var ErrCommandTooLong = errors.New("Command is longer than the 64 KiB that the protocol allows, whether or not it is compressed")
+
+// Returns the method that the server will compress commands with for a client that supports the given methods
+func ChooseCompression(supportedMethods byte) byte {
+	if (supportedMethods & COMPRESSION_GZIP) != 0 {
+		return COMPRESSION_GZIP
+	}
+	return COMPRESSION_NONE
+}
+
+// Returns the given command (including its header) with its payload compressed using the given method, or the command
+// unchanged if it is not worth compressing
+func CompressCommandBuffer(buffer []byte, compression byte) []byte {
+	if (compression != COMPRESSION_GZIP) || (len(buffer) < CommandHeaderLength+CompressionThreshold) {
+		return buffer
+	}
+	var header CommandHeader
+	err := SerialiseCommandHeader(buffer[:CommandHeaderLength], &header, true)
+	if (err != nil) || ((header.Id & CMD_FLAG_COMPRESSED) != 0) {
+		return buffer
+	}
+
+	var compressed bytes.Buffer
+	compressed.Write(make([]byte, CommandHeaderLength))
+	writer := gzip.NewWriter(&compressed)
+	_, err = writer.Write(buffer[CommandHeaderLength:])
+	if err == nil {
+		err = writer.Close()
+	}
+	if (err != nil) || (compressed.Len() >= len(buffer)) {
+		return buffer
+	}
+
+	result := compressed.Bytes()
+	header.Id |= CMD_FLAG_COMPRESSED
+	header.Len = uint16(len(result) - CommandHeaderLength)
+	SerialiseCommandHeader(result[:CommandHeaderLength], &header, false)
+	return result
+}
+
+// Reads the payload of the command with the given header (which has CMD_FLAG_COMPRESSED set) and decompresses it.
+// Returns the header and payload of the decompressed command, which has already been checked with
+// ValidateCommandHeader.
+func ReadCompressedCommand(reader io.Reader, header CommandHeader) (CommandHeader, []byte, error) {
+	header.Id &^= CMD_FLAG_COMPRESSED
+	if header.Id >= NUM_CMDS {
+		return header, nil, ErrInvalidHeader
+	}
+	compressed, err := ReadExactlyNBytes(reader, header.Len)
+	if err != nil {
+		return header, nil, err
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return header, nil, err
+	}
+
+	// Reading at most one byte more than the longest allowed payload is enough to tell that the payload is too long,
+	// without having to decompress all of it
+	_, maxCmdLen := commandLengthLimits(header.Id)
+	payload, err := io.ReadAll(io.LimitReader(gzipReader, int64(maxCmdLen)+1))
+	if err != nil {
+		return header, nil, err
+	}
+	if len(payload) > int(maxCmdLen) {
+		return header, nil, ErrCompressedCommandTooLong
+	}
+	header.Len = uint16(len(payload))
+	return header, payload, ValidateCommandHeader(header)
+}
@@ -0,0 +1,75 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+// Returns a join notification for a game whose players have the given number of cards between them
+func joinedCommandWithCards(cardCount int) *NotifyGameJoinedCommand {
+	hand := make([]uint16, cardCount)
+	for i := range hand {
+		hand[i] = uint16(i % 54)
+	}
+	return &NotifyGameJoinedCommand{
+		GameId:      1,
+		OwnerId:     1,
+		PlayerIds:   []uint64{1},
+		PlayerNames: []string{"alice"},
+		PlayerHands: [][]uint16{hand},
+	}
+}
+
+func TestCompression(t *testing.T) {
+	tests := []struct {
+		name        string
+		cardCount   int
+		compression byte
+		buildErr    error
+		compressed  bool
+	}{
+		{"Short command", 10, COMPRESSION_GZIP, nil, false},
+		{"Long command", 30000, COMPRESSION_GZIP, nil, true},
+		{"Long command without compression", 30000, COMPRESSION_NONE, nil, false},
+		// Compression would shrink this to well under 64 KiB, but the uncompressed length still has to fit in the header
+		{"Command over 64 KiB", 40000, COMPRESSION_GZIP, ErrCommandTooLong, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cmd := joinedCommandWithCards(test.cardCount)
+			buffer, err := BuildCommand(CMD_NOTIFY_GAME_JOINED, cmd)
+			if err != test.buildErr {
+				t.Fatalf("Building the command returned error %v, expected %v", err, test.buildErr)
+			}
+			if err != nil {
+				return
+			}
+
+			sent := CompressCommandBuffer(buffer, test.compression)
+			var header CommandHeader
+			err = SerialiseCommandHeader(sent[:CommandHeaderLength], &header, true)
+			if err != nil {
+				t.Fatalf("Failed to read the header of the sent command: %s", err)
+			}
+			isCompressed := (header.Id & CMD_FLAG_COMPRESSED) != 0
+			if isCompressed != test.compressed {
+				t.Fatalf("Command was compressed: %t, expected %t", isCompressed, test.compressed)
+			}
+			if !isCompressed {
+				return
+			}
+
+			header, payload, err := ReadCompressedCommand(bytes.NewReader(sent[CommandHeaderLength:]), header)
+			if err != nil {
+				t.Fatalf("Failed to read the compressed command: %s", err)
+			}
+			if header.Id != CMD_NOTIFY_GAME_JOINED {
+				t.Fatalf("Decompressed command has ID %d, expected %d", header.Id, CMD_NOTIFY_GAME_JOINED)
+			}
+			if !bytes.Equal(payload, buffer[CommandHeaderLength:]) {
+				t.Errorf("Command payload changed when compressed and decompressed")
+			}
+		})
+	}
+}
@@ -0,0 +1,317 @@
+//go:build ignore
+
+// Generates commands_gen.go from the command structs in commands.go, along with a fuzz target for each of them in
+// commands_fuzz_test.go (see fuzzCommand). Run it with `go generate` after adding or changing a command.
+//
+// Every struct in commands.go whose name ends with "Command" (and has at least one field) gets:
+//   - A Serialise<Name> function that reads or writes its fields, in the order in which they are declared.
+//   - A CommandLength method that returns the length of its serialised form.
+//   - A Serialise method that calls Serialise<Name>, so that the struct implements the Command interface.
+//   - Either a <Name>Length constant (if every instance has the same length), or Min<Name>Length and Max<Name>Length.
+//
+// Fields can be given a `netdeck:"..."` tag with a comma-separated list of these options, which are checked whenever
+// the command is serialised and are used to work out the command's maximum length:
+//   - max=X: The field (a string or slice) has at most X elements
+//   - len=X: The field has exactly X elements
+//   - empty: Used with len, the field can also be empty
+//   - samelen=f: The field has the same number of elements as field f of the same command
+//
+// Commands whose maximum length can't be worked out from their fields can be given one with a //netdeck:maxlength
+// directive in the struct's doc comment. Otherwise the maximum is math.MaxUint16.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const inputFileName = "commands.go"
+const outputFileName = "commands_gen.go"
+const fuzzOutputFileName = "commands_fuzz_test.go"
+const maxLengthDirective = "//netdeck:maxlength "
+
+// How each type of field is serialised. elementSize is the size of a single element of a string or slice (or the whole
+// field otherwise), and is zero for slices whose elements can have different sizes.
+type fieldType struct {
+	serialiseFunc string
+	isSlice       bool
+	elementSize   int
+}
+
+var fieldTypes = map[string]fieldType{
+	"byte":       {"SerialiseByte", false, 1},
+	"bool":       {"SerialiseBool", false, 1},
+	"uint16":     {"SerialiseUint16", false, 2},
+	"uint64":     {"SerialiseUint64", false, 8},
+	"int64":      {"SerialiseInt64", false, 8},
+	"string":     {"SerialiseString", true, 1},
+	"[]byte":     {"SerialiseByteSlice", true, 1},
+	"[]bool":     {"SerialiseBoolSlice", true, 1},
+	"[]uint16":   {"SerialiseUint16Slice", true, 2},
+	"[]uint64":   {"SerialiseUint64Slice", true, 8},
+	"[]int64":    {"SerialiseInt64Slice", true, 8},
+	"[]string":   {"SerialiseStringSlice", true, 0},
+	"[][]uint16": {"SerialiseUint16SliceSlice", true, 0},
+	"[][]string": {"SerialiseStringSliceSlice", true, 0},
+}
+
+type commandField struct {
+	name       string
+	typeName   string
+	fieldType  fieldType
+	maxLen     string
+	exactLen   string
+	allowEmpty bool
+	sameLenAs  string
+}
+
+type command struct {
+	name      string
+	fields    []commandField
+	maxLength string
+}
+
+// A length that is a fixed number of bytes plus the sum of some constants from commands.go
+type lengthExpr struct {
+	bytes int
+	terms []string
+}
+
+func (expr *lengthExpr) add(elementCount string, elementSize int) {
+	if elementSize == 1 {
+		expr.terms = append(expr.terms, elementCount)
+	} else {
+		expr.terms = append(expr.terms, fmt.Sprintf("%d*%s", elementSize, elementCount))
+	}
+}
+
+func (expr lengthExpr) String() string {
+	return strings.Join(append([]string{strconv.Itoa(expr.bytes)}, expr.terms...), " + ")
+}
+
+func main() {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, inputFileName, nil, parser.ParseComments)
+	if err != nil {
+		log.Fatalf("Failed to parse %s: %s", inputFileName, err)
+	}
+
+	var commands []command
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || (genDecl.Tok != token.TYPE) {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok || !strings.HasSuffix(typeSpec.Name.Name, "Command") || (len(structType.Fields.List) == 0) {
+				continue
+			}
+			cmd, err := parseCommand(fileSet, typeSpec.Name.Name, structType, genDecl.Doc)
+			if err != nil {
+				log.Fatalf("Invalid command struct %s: %s", typeSpec.Name.Name, err)
+			}
+			commands = append(commands, cmd)
+		}
+	}
+
+	var output bytes.Buffer
+	fmt.Fprintf(&output, "// Code generated by gencommands.go from the command structs in %s. DO NOT EDIT.\n\n", inputFileName)
+	fmt.Fprintf(&output, "package protocol\n\nimport \"math\"\n")
+	for _, cmd := range commands {
+		writeCommand(&output, cmd)
+	}
+	writeGoFile(outputFileName, output)
+
+	var fuzzOutput bytes.Buffer
+	fmt.Fprintf(&fuzzOutput, "// Code generated by gencommands.go from the command structs in %s. DO NOT EDIT.\n\n", inputFileName)
+	fmt.Fprintf(&fuzzOutput, "package protocol\n\nimport \"testing\"\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(&fuzzOutput, "\nfunc Fuzz%s(f *testing.F) {\n", cmd.name)
+		fmt.Fprintf(&fuzzOutput, "fuzzCommand(f, func() Command { return &%s{} })\n}\n", cmd.name)
+	}
+	writeGoFile(fuzzOutputFileName, fuzzOutput)
+}
+
+func writeGoFile(fileName string, output bytes.Buffer) {
+	source, err := format.Source(output.Bytes())
+	if err != nil {
+		log.Fatalf("Failed to format the generated code: %s\n%s", err, output.String())
+	}
+	err = ioutil.WriteFile(fileName, source, 0644)
+	if err != nil {
+		log.Fatalf("Failed to write %s: %s", fileName, err)
+	}
+}
+
+func parseCommand(fileSet *token.FileSet, name string, structType *ast.StructType, doc *ast.CommentGroup) (command, error) {
+	cmd := command{name: name}
+	if doc != nil {
+		for _, comment := range doc.List {
+			if strings.HasPrefix(comment.Text, maxLengthDirective) {
+				cmd.maxLength = strings.TrimSpace(strings.TrimPrefix(comment.Text, maxLengthDirective))
+			}
+		}
+	}
+
+	for _, field := range structType.Fields.List {
+		var typeName bytes.Buffer
+		format.Node(&typeName, fileSet, field.Type)
+		fieldType, ok := fieldTypes[typeName.String()]
+		if !ok {
+			return cmd, fmt.Errorf("unsupported field type %s", typeName.String())
+		}
+
+		var tag string
+		if field.Tag != nil {
+			rawTag, err := strconv.Unquote(field.Tag.Value)
+			if err != nil {
+				return cmd, err
+			}
+			tag = reflect.StructTag(rawTag).Get("netdeck")
+		}
+		for _, fieldName := range field.Names {
+			cmdField := commandField{name: fieldName.Name, typeName: typeName.String(), fieldType: fieldType}
+			for _, option := range strings.Split(tag, ",") {
+				key, value, _ := strings.Cut(option, "=")
+				switch key {
+				case "":
+				case "max":
+					cmdField.maxLen = value
+				case "len":
+					cmdField.exactLen = value
+				case "empty":
+					cmdField.allowEmpty = true
+				case "samelen":
+					cmdField.sameLenAs = value
+				default:
+					return cmd, fmt.Errorf("unknown option '%s' for field %s", key, fieldName.Name)
+				}
+			}
+			if !fieldType.isSlice && (tag != "") {
+				return cmd, fmt.Errorf("field %s is not a string or slice, so it can't be given a length", fieldName.Name)
+			}
+			if cmdField.allowEmpty && (cmdField.exactLen == "") {
+				return cmd, fmt.Errorf("field %s can only be empty if it has an exact length", fieldName.Name)
+			}
+			cmd.fields = append(cmd.fields, cmdField)
+		}
+	}
+	return cmd, nil
+}
+
+func writeCommand(output *bytes.Buffer, cmd command) {
+	minLength := lengthExpr{}
+	maxLength := lengthExpr{}
+	unboundedMax := false
+	fixedLength := true
+	for _, field := range cmd.fields {
+		if !field.fieldType.isSlice {
+			minLength.bytes += field.fieldType.elementSize
+			maxLength.bytes += field.fieldType.elementSize
+			continue
+		}
+
+		minLength.bytes += 2
+		maxLength.bytes += 2
+		if (field.exactLen != "") && (field.fieldType.elementSize != 0) {
+			maxLength.add(field.exactLen, field.fieldType.elementSize)
+			if field.allowEmpty {
+				fixedLength = false
+			} else {
+				minLength.add(field.exactLen, field.fieldType.elementSize)
+			}
+		} else if (field.maxLen != "") && (field.fieldType.elementSize != 0) {
+			maxLength.add(field.maxLen, field.fieldType.elementSize)
+			fixedLength = false
+		} else {
+			unboundedMax = true
+			fixedLength = false
+		}
+	}
+
+	lengthName := cmd.name + "Length"
+	minLengthName := "Min" + lengthName
+	maxLengthName := "Max" + lengthName
+	fixedLength = fixedLength && (cmd.maxLength == "")
+	fmt.Fprintln(output)
+	if fixedLength {
+		fmt.Fprintf(output, "const %s = %s\n", lengthName, minLength)
+	} else {
+		fmt.Fprintf(output, "const %s = %s\n", minLengthName, minLength)
+		if cmd.maxLength != "" {
+			fmt.Fprintf(output, "const %s = %s\n", maxLengthName, cmd.maxLength)
+		} else if unboundedMax {
+			fmt.Fprintf(output, "const %s = math.MaxUint16\n", maxLengthName)
+		} else {
+			fmt.Fprintf(output, "const %s = %s\n", maxLengthName, maxLength)
+		}
+	}
+
+	fmt.Fprintf(output, "\nfunc (cmd *%s) CommandLength() int {\n", cmd.name)
+	if fixedLength {
+		fmt.Fprintf(output, "return %s\n}\n", lengthName)
+	} else {
+		writeVariableLength(output, cmd, minLengthName)
+	}
+
+	fmt.Fprintf(output, "\nfunc Serialise%s(buffer []byte, cmd *%s, isReading bool) error {\n", cmd.name, cmd.name)
+	fmt.Fprintf(output, "ctx := NewSerialisation(buffer, isReading)\n")
+	for _, field := range cmd.fields {
+		fmt.Fprintf(output, "ctx.%s(&cmd.%s)\n", field.fieldType.serialiseFunc, field.name)
+	}
+	for _, field := range cmd.fields {
+		if field.sameLenAs != "" {
+			fmt.Fprintf(output, "ctx.Assert(len(cmd.%s) == len(cmd.%s))\n", field.sameLenAs, field.name)
+		}
+		if field.maxLen != "" {
+			fmt.Fprintf(output, "ctx.Assert(len(cmd.%s) <= %s)\n", field.name, field.maxLen)
+		}
+		if field.exactLen != "" {
+			if field.allowEmpty {
+				fmt.Fprintf(output, "ctx.Assert((len(cmd.%s) == 0) || (len(cmd.%s) == %s))\n", field.name, field.name, field.exactLen)
+			} else {
+				fmt.Fprintf(output, "ctx.Assert(len(cmd.%s) == %s)\n", field.name, field.exactLen)
+			}
+		}
+	}
+	fmt.Fprintf(output, "return ctx.Complete()\n}\n")
+
+	fmt.Fprintf(output, "\nfunc (cmd *%s) Serialise(buffer []byte, isReading bool) error {\n", cmd.name)
+	fmt.Fprintf(output, "return Serialise%s(buffer, cmd, isReading)\n}\n", cmd.name)
+}
+
+// Writes the body of CommandLength for a command whose length depends on the length of some of its fields
+func writeVariableLength(output *bytes.Buffer, cmd command, minLengthName string) {
+	fmt.Fprintf(output, "result := %s\n", minLengthName)
+	for _, field := range cmd.fields {
+		if !field.fieldType.isSlice || ((field.exactLen != "") && !field.allowEmpty && (field.fieldType.elementSize != 0)) {
+			continue
+		}
+		switch field.typeName {
+		case "[]string":
+			fmt.Fprintf(output, "for _, str := range cmd.%s {\nresult += 2 + len(str)\n}\n", field.name)
+		case "[][]uint16":
+			fmt.Fprintf(output, "for _, slice := range cmd.%s {\nresult += 2 + 2*len(slice)\n}\n", field.name)
+		case "[][]string":
+			fmt.Fprintf(output, "for _, slice := range cmd.%s {\nresult += 2\nfor _, str := range slice {\nresult += 2 + len(str)\n}\n}\n", field.name)
+		default:
+			if field.fieldType.elementSize == 1 {
+				fmt.Fprintf(output, "result += len(cmd.%s)\n", field.name)
+			} else {
+				fmt.Fprintf(output, "result += %d * len(cmd.%s)\n", field.fieldType.elementSize, field.name)
+			}
+		}
+	}
+	fmt.Fprintf(output, "return result\n}\n")
+}
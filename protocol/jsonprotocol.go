@@ -0,0 +1,437 @@
+package protocol
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Clients can send and receive commands as JSON instead of in the binary format, which is much easier to do from
+// scripts or from languages other than Go. A connection uses JSON if the first byte sent on it is a '{' (which can never
+// be the start of a binary command), and from then on every command in both directions is a JSON object on its own line:
+//
+//	{"cmd":"HANDSHAKE","magicNumber":13359,"protocolId":5,"resumeToken":0,"identityToken":"","localName":"bot"}
+//	{"cmd":"CARD_DRAW","deckId":0,"count":1,"faceUp":false}
+//
+// "cmd" is the name of the command (see commandNames) and the other fields are the fields of the struct for that
+// command in commands.go (starting with a lowercase letter). Fields can be left out to send their zero value. Byte
+// slices (e.g identityToken) are base64-encoded strings, and IDs are 64-bit integers (which not every JSON library can
+// represent exactly).
+const JSONProtocolPrefix = '{'
+
+// JSON commands are longer than the binary ones, especially when they contain byte slices
+const MaxJSONCommandLength = 4 * math.MaxUint16
+
+var ErrUnknownCommandName = errors.New("Unknown command name")
+var ErrUnsupportedFieldType = errors.New("Command has a field that cannot be serialised")
+var ErrJSONCommandTooLong = errors.New("JSON command is too long")
+
+// Returns a pointer to a new struct of the type that holds the data for the given command, or nil if the command has
+// no data. The struct's fields must be in the same order as they are serialised.
+func newCommandStruct(cmdId byte) interface{} {
+	switch cmdId {
+	case CMD_HANDSHAKE:
+		return &HandshakeCommand{}
+	case CMD_HANDSHAKE_RESPONSE:
+		return &HandshakeResponseCommand{}
+	case CMD_SET_NAME, CMD_SET_NAME_RESPONSE:
+		return &SetNameCommand{}
+	case CMD_RELAY_HOST, CMD_RELAY_HOST_RESPONSE, CMD_RELAY_CONNECT:
+		return &RelayCodeCommand{}
+	case CMD_RELAY_INCOMING, CMD_RELAY_ACCEPT:
+		return &RelayConnectionCommand{}
+	case CMD_INFO_PLAYERS_RESPONSE:
+		return &PlayerInfoResponseCommand{}
+	case CMD_INFO_DECKS_RESPONSE:
+		return &DeckInfoResponseCommand{}
+	case CMD_INFO_CARDS_RESPONSE, CMD_INFO_DISCARDS_RESPONSE, CMD_INFO_TABLE_RESPONSE, CMD_INFO_MARKET_RESPONSE, CMD_INFO_ROLE_RESPONSE:
+		return &CardInfoResponseCommand{}
+	case CMD_INFO_COUNTERS_RESPONSE:
+		return &CounterInfoResponseCommand{}
+	case CMD_INFO_CARD_TYPES_RESPONSE:
+		return &CardTypeInfoResponseCommand{}
+	case CMD_INFO_TABLEAUS_RESPONSE:
+		return &TableauInfoResponseCommand{}
+	case CMD_INFO_SCORES_RESPONSE:
+		return &ScoreInfoResponseCommand{}
+	case CMD_INFO_GAMES_RESPONSE:
+		return &GameInfoResponseCommand{}
+	case CMD_INFO_EVENTS:
+		return &EventInfoCommand{}
+	case CMD_INFO_EVENTS_RESPONSE:
+		return &EventInfoResponseCommand{}
+	case CMD_INFO_HISTORY_RESPONSE:
+		return &HistoryInfoResponseCommand{}
+	case CMD_SYNC_RESPONSE:
+		return &SyncResponseCommand{}
+	case CMD_CARD_DRAW:
+		return &CardDrawCommand{}
+	case CMD_CARD_SHOW:
+		return &CardShowCommand{}
+	case CMD_CARD_PUTBACK:
+		return &CardPutbackCommand{}
+	case CMD_CARD_DISCARD:
+		return &CardDiscardCommand{}
+	case CMD_CARD_GIVE:
+		return &CardGiveCommand{}
+	case CMD_CARD_PICKUP:
+		return &CardPickupCommand{}
+	case CMD_CARD_FETCH:
+		return &CardFetchCommand{}
+	case CMD_CARD_SWAP_HANDS:
+		return &CardSwapHandsCommand{}
+	case CMD_CARD_REVEAL_HAND:
+		return &CardRevealHandCommand{}
+	case CMD_CARD_TRADE_OFFER:
+		return &CardTradeOfferCommand{}
+	case CMD_CARD_TRADE_RESPOND:
+		return &CardTradeRespondCommand{}
+	case CMD_CARD_VIEW_HAND_REQUEST:
+		return &CardViewHandRequestCommand{}
+	case CMD_CARD_VIEW_HAND_RESPOND:
+		return &CardViewHandRespondCommand{}
+	case CMD_CARD_SET_FACE_UP:
+		return &CardSetFaceUpCommand{}
+	case CMD_CARD_DRAW_UNTIL_TYPE:
+		return &CardDrawUntilTypeCommand{}
+	case CMD_CARD_DISCARD_TYPE:
+		return &CardDiscardTypeCommand{}
+	case CMD_CARD_ARRANGE_HAND:
+		return &CardArrangeHandCommand{}
+	case CMD_DECK_PEEK, CMD_DECK_PEEK_BOTTOM:
+		return &DeckPeekCommand{}
+	case CMD_DECK_SHUFFLE:
+		return &DeckShuffleCommand{}
+	case CMD_DECK_BURN:
+		return &DeckBurnCommand{}
+	case CMD_DECK_DEAL:
+		return &DeckDealCommand{}
+	case CMD_DECK_REARRANGE:
+		return &DeckRearrangeCommand{}
+	case CMD_TABLE_PLAY, CMD_TABLE_TAKE, CMD_TABLEAU_PLACE, CMD_TABLEAU_RETRIEVE, CMD_MARKET_TAKE, CMD_MARKET_DISCARD:
+		return &TableCardCommand{}
+	case CMD_TABLE_PUTBACK:
+		return &TablePutbackCommand{}
+	case CMD_GAME_UNDO_VOTE:
+		return &GameUndoVoteCommand{}
+	case CMD_GAME_KICK:
+		return &GameKickCommand{}
+	case CMD_GAME_TRANSFER_OWNER:
+		return &GameTransferOwnerCommand{}
+	case CMD_GAME_ADD_BOT:
+		return &GameAddBotCommand{}
+	case CMD_SCORE_ADD:
+		return &ScoreAddCommand{}
+	case CMD_COUNTER_CHANGE:
+		return &CounterChangeCommand{}
+	case CMD_RANDOM_ROLL:
+		return &RandomRollCommand{}
+	case CMD_RANDOM_PICK:
+		return &RandomPickCommand{}
+	case CMD_RANDOM_ROLL_NAMED:
+		return &RandomRollNamedCommand{}
+	case CMD_POLL_START:
+		return &PollStartCommand{}
+	case CMD_POLL_VOTE:
+		return &PollVoteCommand{}
+	case CMD_TURN_TIMER:
+		return &TurnTimerCommand{}
+	case CMD_GAME_CREATE:
+		return &GameCreateCommand{}
+	case CMD_GAME_JOIN:
+		return &GameJoinCommand{}
+	case CMD_NOTIFY_PLAYER_ACTION:
+		return &NotifyPlayerActionCommand{}
+	case CMD_NOTIFY_GAME_JOINED:
+		return &NotifyGameJoinedCommand{}
+	case CMD_NOTIFY_SERVER_MESSAGE:
+		return &NotifyServerMessageCommand{}
+	case CMD_NOTIFY_INPUT_ERROR:
+		return &NotifyInputErrorCommand{}
+	}
+	return nil
+}
+
+// Returns the name of the given command struct field in JSON commands
+func jsonFieldName(field reflect.StructField) string {
+	return strings.ToLower(field.Name[:1]) + field.Name[1:]
+}
+
+// Reads or writes a single field of a command in the same way that the command's Serialise function does
+func serialiseCommandField(ctx *SerialisationContext, val interface{}) {
+	switch typedVal := val.(type) {
+	case *byte:
+		ctx.SerialiseByte(typedVal)
+	case *bool:
+		ctx.SerialiseBool(typedVal)
+	case *uint16:
+		ctx.SerialiseUint16(typedVal)
+	case *uint64:
+		ctx.SerialiseUint64(typedVal)
+	case *int64:
+		ctx.SerialiseInt64(typedVal)
+	case *string:
+		ctx.SerialiseString(typedVal)
+	case *[]byte:
+		ctx.SerialiseByteSlice(typedVal)
+	case *[]bool:
+		ctx.SerialiseBoolSlice(typedVal)
+	case *[]uint16:
+		ctx.SerialiseUint16Slice(typedVal)
+	case *[]uint64:
+		ctx.SerialiseUint64Slice(typedVal)
+	case *[]int64:
+		ctx.SerialiseInt64Slice(typedVal)
+	case *[]string:
+		ctx.SerialiseStringSlice(typedVal)
+	case *[][]uint16:
+		ctx.SerialiseUint16SliceSlice(typedVal)
+	case *[][]string:
+		ctx.SerialiseStringSliceSlice(typedVal)
+	default:
+		if ctx.err == nil {
+			ctx.err = ErrUnsupportedFieldType
+		}
+	}
+}
+
+// Returns the given binary command as a line of JSON
+func CommandToJSON(header CommandHeader, payload []byte) ([]byte, error) {
+	if header.Id >= NUM_CMDS {
+		return nil, ErrInvalidCommandId
+	}
+	cmdName, err := json.Marshal(commandNames[header.Id])
+	if err != nil {
+		return nil, err
+	}
+	var line bytes.Buffer
+	line.WriteString(`{"cmd":`)
+	line.Write(cmdName)
+
+	ctx := NewSerialisation(payload, true)
+	cmdStruct := newCommandStruct(header.Id)
+	if cmdStruct != nil {
+		structType := reflect.TypeOf(cmdStruct).Elem()
+		for fieldIndex := 0; fieldIndex < structType.NumField(); fieldIndex++ {
+			field := structType.Field(fieldIndex)
+			value := reflect.New(field.Type)
+			serialiseCommandField(&ctx, value.Interface())
+			if ctx.err != nil {
+				break
+			}
+			// Empty slices are sent as [] rather than null, so that clients don't need to check for both
+			if (field.Type.Kind() == reflect.Slice) && value.Elem().IsNil() {
+				value.Elem().Set(reflect.MakeSlice(field.Type, 0, 0))
+			}
+
+			fieldJSON, err := json.Marshal(value.Interface())
+			if err != nil {
+				return nil, err
+			}
+			line.WriteString(`,"` + jsonFieldName(field) + `":`)
+			line.Write(fieldJSON)
+		}
+	} else if len(payload) > 0 {
+		return nil, ErrInvalidLength
+	}
+	err = ctx.Complete()
+	if err != nil {
+		return nil, err
+	}
+
+	line.WriteString("}\n")
+	return line.Bytes(), nil
+}
+
+// Returns the given line of JSON as a binary command (including its header), along with the ID of that command. The ID
+// is returned even if the rest of the command is invalid, as long as the command name is recognised.
+func CommandFromJSON(line []byte) (byte, []byte, error) {
+	var fields map[string]json.RawMessage
+	err := json.Unmarshal(line, &fields)
+	if err != nil {
+		return CMD_UNKNOWN, nil, err
+	}
+	var cmdName string
+	err = json.Unmarshal(fields["cmd"], &cmdName)
+	if err != nil {
+		return CMD_UNKNOWN, nil, ErrUnknownCommandName
+	}
+	cmdId := findCommandByName(cmdName)
+	if cmdId == CMD_UNKNOWN {
+		return CMD_UNKNOWN, nil, ErrUnknownCommandName
+	}
+	delete(fields, "cmd")
+
+	buffer := make([]byte, CommandHeaderLength+math.MaxUint16)
+	ctx := NewSerialisation(buffer[CommandHeaderLength:], false)
+	cmdStruct := newCommandStruct(cmdId)
+	if cmdStruct != nil {
+		structType := reflect.TypeOf(cmdStruct).Elem()
+		for fieldIndex := 0; fieldIndex < structType.NumField(); fieldIndex++ {
+			field := structType.Field(fieldIndex)
+			fieldName := jsonFieldName(field)
+			value := reflect.New(field.Type)
+			if fieldJSON, ok := fields[fieldName]; ok {
+				err = json.Unmarshal(fieldJSON, value.Interface())
+				if err != nil {
+					return cmdId, nil, fmt.Errorf("Invalid value for '%s': %w", fieldName, err)
+				}
+				delete(fields, fieldName)
+			}
+			serialiseCommandField(&ctx, value.Interface())
+		}
+	}
+	for fieldName := range fields {
+		return cmdId, nil, fmt.Errorf("%s commands have no '%s' field", cmdName, fieldName)
+	}
+	if ctx.err != nil {
+		return cmdId, nil, ctx.err
+	}
+
+	header := CommandHeader{cmdId, uint16(ctx.bufferLoc)}
+	err = SerialiseCommandHeader(buffer[:CommandHeaderLength], &header, false)
+	if err != nil {
+		return cmdId, nil, err
+	}
+	return cmdId, buffer[:CommandHeaderLength+ctx.bufferLoc], nil
+}
+
+// A connection from a client using the JSON protocol. Commands are converted to and from the binary format as they are
+// read and written, so the server handles these clients in the same way as any other.
+type JSONConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	received   []byte // Commands that have been converted from JSON but not yet read
+	written    []byte // The start of a command that cannot be converted until the rest of it has been written
+	writeMutex *sync.Mutex
+}
+
+// Sent (instead of a normal NOTIFY_INPUT_ERROR) when a line of JSON cannot be converted to a command, along with the
+// reason why
+type jsonInputError struct {
+	Cmd     string `json:"cmd"`
+	CmdId   byte   `json:"cmdId"`
+	ErrorId byte   `json:"errorId"`
+	Message string `json:"message"`
+}
+
+// Returns a line of JSON reporting that the given command could not be sent, for the given reason
+func InputErrorJSON(cmdId byte, errorId byte, message string) []byte {
+	errorJSON, _ := json.Marshal(jsonInputError{commandNames[CMD_NOTIFY_INPUT_ERROR], cmdId, errorId, message})
+	return append(errorJSON, '\n')
+}
+
+func (jc *JSONConn) Read(buffer []byte) (int, error) {
+	for len(jc.received) == 0 {
+		line, err := jc.reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			return 0, ErrJSONCommandTooLong
+		} else if (err != nil) && ((err != io.EOF) || (len(bytes.TrimSpace(line)) == 0)) {
+			return 0, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		cmdId, command, err := CommandFromJSON(line)
+		if err != nil {
+			// Mistakes are easy to make when writing JSON by hand, so tell the client what was wrong instead of
+			// disconnecting them
+			err = jc.writeLine(InputErrorJSON(cmdId, ERROR_INVALID_DATA, err.Error()))
+			if err != nil {
+				return 0, err
+			}
+			continue
+		}
+		jc.received = command
+	}
+
+	bytesRead := copy(buffer, jc.received)
+	jc.received = jc.received[bytesRead:]
+	return bytesRead, nil
+}
+
+func (jc *JSONConn) Write(buffer []byte) (int, error) {
+	jc.writeMutex.Lock()
+	defer jc.writeMutex.Unlock()
+	jc.written = append(jc.written, buffer...)
+	for len(jc.written) >= CommandHeaderLength {
+		var header CommandHeader
+		err := SerialiseCommandHeader(jc.written[:CommandHeaderLength], &header, true)
+		if err != nil {
+			return 0, err
+		}
+		commandEnd := CommandHeaderLength + int(header.Len)
+		if len(jc.written) < commandEnd {
+			break
+		}
+
+		payload := jc.written[CommandHeaderLength:commandEnd]
+		jc.written = jc.written[commandEnd:]
+		if (header.Id & CMD_FLAG_COMPRESSED) != 0 {
+			// JSON is already much bigger than the binary commands, so there's no point in compressing it
+			header, payload, err = ReadCompressedCommand(bytes.NewReader(payload), header)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if header.Id == CMD_NOTIFY_BATCH {
+			// Each of the commands in the batch is sent as its own line instead
+			jc.written = append(append([]byte{}, payload...), jc.written...)
+			continue
+		}
+		line, err := CommandToJSON(header, payload)
+		if err != nil {
+			return 0, err
+		}
+		_, err = jc.Conn.Write(line)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(buffer), nil
+}
+
+func (jc *JSONConn) writeLine(line []byte) error {
+	jc.writeMutex.Lock()
+	defer jc.writeMutex.Unlock()
+	_, err := jc.Conn.Write(line)
+	return err
+}
+
+// A connection that has had some of its data read into a buffer already
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(buffer []byte) (int, error) {
+	return bc.reader.Read(buffer)
+}
+
+// Waits for the first data to arrive on the given connection and returns the connection to use from then on, which
+// converts commands to and from JSON if that is what the client sent
+func DetectProtocol(conn net.Conn, timeout time.Duration) (net.Conn, error) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	reader := bufio.NewReader(conn)
+	firstByte, err := reader.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if firstByte[0] == JSONProtocolPrefix {
+		return &JSONConn{conn, bufio.NewReaderSize(reader, MaxJSONCommandLength), nil, nil, &sync.Mutex{}}, nil
+	}
+	return &bufferedConn{conn, reader}, nil
+}
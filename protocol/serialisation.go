@@ -1,7 +1,8 @@
-package main
+package protocol
 
 import (
 	"encoding/binary"
+	"math"
 )
 
 type SerialisationContext struct {
@@ -11,7 +12,7 @@ type SerialisationContext struct {
 	err       error
 }
 
-func newSerialisation(buffer []byte, isReading bool) SerialisationContext {
+func NewSerialisation(buffer []byte, isReading bool) SerialisationContext {
 	result := SerialisationContext{
 		buffer,
 		0,
@@ -21,13 +22,13 @@ func newSerialisation(buffer []byte, isReading bool) SerialisationContext {
 	return result
 }
 
-func (ctx *SerialisationContext) assert(condition bool) {
+func (ctx *SerialisationContext) Assert(condition bool) {
 	if (ctx.err == nil) && !condition {
 		ctx.err = ErrInvalidData
 	}
 }
 
-func (ctx *SerialisationContext) serialiseByte(val *byte) {
+func (ctx *SerialisationContext) SerialiseByte(val *byte) {
 	ctx.ensureFreeBufferSpace(1)
 	if ctx.err != nil {
 		return
@@ -41,7 +42,7 @@ func (ctx *SerialisationContext) serialiseByte(val *byte) {
 	ctx.bufferLoc += 1
 }
 
-func (ctx *SerialisationContext) serialiseUint16(val *uint16) {
+func (ctx *SerialisationContext) SerialiseUint16(val *uint16) {
 	ctx.ensureFreeBufferSpace(2)
 	if ctx.err != nil {
 		return
@@ -56,7 +57,7 @@ func (ctx *SerialisationContext) serialiseUint16(val *uint16) {
 	ctx.bufferLoc += 2
 }
 
-func (ctx *SerialisationContext) serialiseUint64(val *uint64) {
+func (ctx *SerialisationContext) SerialiseUint64(val *uint64) {
 	ctx.ensureFreeBufferSpace(8)
 	if ctx.err != nil {
 		return
@@ -71,24 +72,32 @@ func (ctx *SerialisationContext) serialiseUint64(val *uint64) {
 	ctx.bufferLoc += 8
 }
 
-func (ctx *SerialisationContext) serialiseString(val *string) {
+func (ctx *SerialisationContext) SerialiseInt64(val *int64) {
+	temp := uint64(*val)
+	ctx.SerialiseUint64(&temp)
+	if ctx.isReading {
+		*val = int64(temp)
+	}
+}
+
+func (ctx *SerialisationContext) SerialiseString(val *string) {
 	if ctx.err != nil {
 		return
 	}
 
 	if ctx.isReading {
 		var buffer []byte
-		ctx.serialiseByteSlice(&buffer)
+		ctx.SerialiseByteSlice(&buffer)
 		if buffer != nil {
 			*val = string(buffer)
 		}
 	} else {
 		buffer := []byte(*val)
-		ctx.serialiseByteSlice(&buffer)
+		ctx.SerialiseByteSlice(&buffer)
 	}
 }
 
-func (ctx *SerialisationContext) serialiseStringSlice(val *[]string) {
+func (ctx *SerialisationContext) SerialiseStringSlice(val *[]string) {
 	ctx.ensureFreeBufferSpace(2)
 	if ctx.err != nil {
 		return
@@ -96,13 +105,17 @@ func (ctx *SerialisationContext) serialiseStringSlice(val *[]string) {
 
 	var sliceLen uint16
 	if ctx.isReading {
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
+		ctx.ensureSliceFits(int(sliceLen), 2)
+		if ctx.err != nil {
+			return
+		}
 		*val = make([]string, sliceLen)
 
 	} else { // writing
 		if val == nil {
 			sliceLen := uint16(0)
-			ctx.serialiseUint16(&sliceLen)
+			ctx.SerialiseUint16(&sliceLen)
 			return
 		}
 
@@ -112,17 +125,21 @@ func (ctx *SerialisationContext) serialiseStringSlice(val *[]string) {
 			totalLen += 2 + len(str)
 		}
 		ctx.ensureFreeBufferSpace(totalLen)
+		ctx.ensureWritableSliceLength(sliceLenInt)
+		if ctx.err != nil {
+			return
+		}
 
 		sliceLen = uint16(sliceLenInt)
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 	}
 
-	for i := uint16(0); i < sliceLen; i++ {
-		ctx.serialiseString(&(*val)[i])
+	for i := uint16(0); (i < sliceLen) && (ctx.err == nil); i++ {
+		ctx.SerialiseString(&(*val)[i])
 	}
 }
 
-func (ctx *SerialisationContext) serialiseByteSlice(val *[]byte) {
+func (ctx *SerialisationContext) SerialiseByteSlice(val *[]byte) {
 	ctx.ensureFreeBufferSpace(2)
 	if ctx.err != nil {
 		return
@@ -130,7 +147,7 @@ func (ctx *SerialisationContext) serialiseByteSlice(val *[]byte) {
 
 	if ctx.isReading {
 		var sliceLen uint16
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 		sliceLenInt := int(sliceLen)
 
 		ctx.ensureFreeBufferSpace(sliceLenInt)
@@ -148,9 +165,13 @@ func (ctx *SerialisationContext) serialiseByteSlice(val *[]byte) {
 			sliceLenInt = len(*val)
 		}
 		ctx.ensureFreeBufferSpace(2 + sliceLenInt)
+		ctx.ensureWritableSliceLength(sliceLenInt)
+		if ctx.err != nil {
+			return
+		}
 
 		var sliceLen = uint16(sliceLenInt)
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 		if val != nil {
 			copy(ctx.buffer[ctx.bufferLoc:], *val)
 		}
@@ -158,7 +179,7 @@ func (ctx *SerialisationContext) serialiseByteSlice(val *[]byte) {
 	}
 }
 
-func (ctx *SerialisationContext) serialiseUint16Slice(val *[]uint16) {
+func (ctx *SerialisationContext) SerialiseUint16Slice(val *[]uint16) {
 	ctx.ensureFreeBufferSpace(2)
 	if ctx.err != nil {
 		return
@@ -166,7 +187,7 @@ func (ctx *SerialisationContext) serialiseUint16Slice(val *[]uint16) {
 
 	if ctx.isReading {
 		var sliceLen uint16
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 		sliceLenInt := int(sliceLen)
 
 		ctx.ensureFreeBufferSpace(sliceLenInt * 2)
@@ -187,8 +208,12 @@ func (ctx *SerialisationContext) serialiseUint16Slice(val *[]uint16) {
 		}
 
 		ctx.ensureFreeBufferSpace(2 + 2*(sliceLenInt))
+		ctx.ensureWritableSliceLength(sliceLenInt)
+		if ctx.err != nil {
+			return
+		}
 		var sliceLen = uint16(sliceLenInt)
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 
 		if val != nil {
 			for index, x := range *val {
@@ -199,7 +224,7 @@ func (ctx *SerialisationContext) serialiseUint16Slice(val *[]uint16) {
 	}
 }
 
-func (ctx *SerialisationContext) serialiseUint64Slice(val *[]uint64) {
+func (ctx *SerialisationContext) SerialiseUint64Slice(val *[]uint64) {
 	ctx.ensureFreeBufferSpace(2)
 	if ctx.err != nil {
 		return
@@ -207,7 +232,7 @@ func (ctx *SerialisationContext) serialiseUint64Slice(val *[]uint64) {
 
 	if ctx.isReading {
 		var sliceLen uint16
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 		sliceLenInt := int(sliceLen)
 
 		ctx.ensureFreeBufferSpace(sliceLenInt * 8)
@@ -228,8 +253,12 @@ func (ctx *SerialisationContext) serialiseUint64Slice(val *[]uint64) {
 		}
 
 		ctx.ensureFreeBufferSpace(2 + 8*(sliceLenInt))
+		ctx.ensureWritableSliceLength(sliceLenInt)
+		if ctx.err != nil {
+			return
+		}
 		var sliceLen = uint16(sliceLenInt)
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 
 		if val != nil {
 			for index, x := range *val {
@@ -240,14 +269,33 @@ func (ctx *SerialisationContext) serialiseUint64Slice(val *[]uint64) {
 	}
 }
 
-func (ctx *SerialisationContext) serialiseBool(val *bool) {
+func (ctx *SerialisationContext) SerialiseInt64Slice(val *[]int64) {
+	var temp []uint64
+	if !ctx.isReading && (val != nil) {
+		temp = make([]uint64, len(*val))
+		for index, x := range *val {
+			temp[index] = uint64(x)
+		}
+	}
+
+	ctx.SerialiseUint64Slice(&temp)
+
+	if ctx.isReading && (ctx.err == nil) {
+		*val = make([]int64, len(temp))
+		for index, x := range temp {
+			(*val)[index] = int64(x)
+		}
+	}
+}
+
+func (ctx *SerialisationContext) SerialiseBool(val *bool) {
 	if ctx.err != nil {
 		return
 	}
 
 	if ctx.isReading {
 		var temp byte
-		ctx.serialiseByte(&temp)
+		ctx.SerialiseByte(&temp)
 		*val = (temp != 0)
 	} else {
 		var temp byte
@@ -256,11 +304,32 @@ func (ctx *SerialisationContext) serialiseBool(val *bool) {
 		} else {
 			temp = 0
 		}
-		ctx.serialiseByte(&temp)
+		ctx.SerialiseByte(&temp)
+	}
+}
+
+func (ctx *SerialisationContext) SerialiseBoolSlice(val *[]bool) {
+	var temp []byte
+	if !ctx.isReading && (val != nil) {
+		temp = make([]byte, len(*val))
+		for index, x := range *val {
+			if x {
+				temp[index] = 1
+			}
+		}
+	}
+
+	ctx.SerialiseByteSlice(&temp)
+
+	if ctx.isReading && (ctx.err == nil) {
+		*val = make([]bool, len(temp))
+		for index, x := range temp {
+			(*val)[index] = (x != 0)
+		}
 	}
 }
 
-func (ctx *SerialisationContext) serialiseUint16SliceSlice(val *[][]uint16) {
+func (ctx *SerialisationContext) SerialiseUint16SliceSlice(val *[][]uint16) {
 	ctx.ensureFreeBufferSpace(2)
 	if ctx.err != nil {
 		return
@@ -268,12 +337,16 @@ func (ctx *SerialisationContext) serialiseUint16SliceSlice(val *[][]uint16) {
 
 	if ctx.isReading {
 		var sliceLen uint16
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 		sliceLenInt := int(sliceLen)
 
+		ctx.ensureSliceFits(sliceLenInt, 2)
+		if ctx.err != nil {
+			return
+		}
 		*val = make([][]uint16, sliceLen)
-		for i := 0; i < sliceLenInt; i++ {
-			ctx.serialiseUint16Slice(&(*val)[i])
+		for i := 0; (i < sliceLenInt) && (ctx.err == nil); i++ {
+			ctx.SerialiseUint16Slice(&(*val)[i])
 		}
 
 	} else { // writing
@@ -286,18 +359,62 @@ func (ctx *SerialisationContext) serialiseUint16SliceSlice(val *[][]uint16) {
 			}
 		}
 		ctx.ensureFreeBufferSpace(totalLen)
+		ctx.ensureWritableSliceLength(sliceLenInt)
+		if ctx.err != nil {
+			return
+		}
+
+		var sliceLen = uint16(sliceLenInt)
+		ctx.SerialiseUint16(&sliceLen)
+		if val != nil {
+			for _, slice := range *val {
+				ctx.SerialiseUint16Slice(&slice)
+			}
+		}
+	}
+}
+
+func (ctx *SerialisationContext) SerialiseStringSliceSlice(val *[][]string) {
+	ctx.ensureFreeBufferSpace(2)
+	if ctx.err != nil {
+		return
+	}
+
+	if ctx.isReading {
+		var sliceLen uint16
+		ctx.SerialiseUint16(&sliceLen)
+		sliceLenInt := int(sliceLen)
+
+		ctx.ensureSliceFits(sliceLenInt, 2)
+		if ctx.err != nil {
+			return
+		}
+		*val = make([][]string, sliceLen)
+		for i := 0; (i < sliceLenInt) && (ctx.err == nil); i++ {
+			ctx.SerialiseStringSlice(&(*val)[i])
+		}
+
+	} else { // writing
+		sliceLenInt := 0
+		if val != nil {
+			sliceLenInt = len(*val)
+		}
+		ctx.ensureWritableSliceLength(sliceLenInt)
+		if ctx.err != nil {
+			return
+		}
 
 		var sliceLen = uint16(sliceLenInt)
-		ctx.serialiseUint16(&sliceLen)
+		ctx.SerialiseUint16(&sliceLen)
 		if val != nil {
 			for _, slice := range *val {
-				ctx.serialiseUint16Slice(&slice)
+				ctx.SerialiseStringSlice(&slice)
 			}
 		}
 	}
 }
 
-func (ctx *SerialisationContext) complete() error {
+func (ctx *SerialisationContext) Complete() error {
 	if (ctx.err == nil) && (ctx.buffer != nil) && (ctx.bufferLoc != len(ctx.buffer)) {
 		return ErrInvalidLength
 	}
@@ -313,19 +430,24 @@ func (ctx *SerialisationContext) ensureBufferSize(minSize int) {
 		return
 	}
 
-	//if ctx.isReading {
 	ctx.err = ErrInvalidLength
-	panic("Invalid length")
-	//return
-	//}
-
-	/*
-		newBuffer := make([]byte, minCap)
-		copy(newBuffer, ctx.buffer)
-		ctx.buffer = newBuffer
-	*/
 }
 
 func (ctx *SerialisationContext) ensureFreeBufferSpace(minSpace int) {
 	ctx.ensureBufferSize(ctx.bufferLoc + minSpace)
 }
+
+// Checks that a slice with the given number of elements, each of which takes up at least minElementSize bytes, could
+// fit in the rest of the buffer. Slice lengths read from the wire are checked with this before anything is allocated
+// for them, so that a short command cannot make us allocate far more memory than it took to send.
+func (ctx *SerialisationContext) ensureSliceFits(sliceLen int, minElementSize int) {
+	ctx.ensureFreeBufferSpace(sliceLen * minElementSize)
+}
+
+// Slice lengths are written as a uint16, so longer slices cannot be written at all (rather than having their length
+// silently truncated, which would leave the reader unable to make sense of the rest of the command)
+func (ctx *SerialisationContext) ensureWritableSliceLength(sliceLen int) {
+	if (ctx.err == nil) && (sliceLen > math.MaxUint16) {
+		ctx.err = ErrInvalidData
+	}
+}
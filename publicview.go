@@ -0,0 +1,118 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// The number of recent actions included in a game's public view
+const PublicViewActionCount = 20
+
+// Everything about a game that anybody watching the table could see, e.g for stream overlays or companion apps that
+// show the state of a game without joining it as a player. Cards are given by name, and face-down cards as "".
+type PublicGameView struct {
+	Name          string             `json:"name"`
+	Started       bool               `json:"started"`
+	TurnPlayer    string             `json:"turn_player"` // Empty if turns are not being tracked
+	Players       []PublicPlayerView `json:"players"`
+	Decks         []PublicDeckView   `json:"decks"`
+	DiscardPile   []string           `json:"discard_pile"` // From top to bottom
+	Table         []string           `json:"table"`
+	Market        []string           `json:"market"`
+	RecentActions []PublicAction     `json:"recent_actions"` // From oldest to newest
+}
+
+type PublicPlayerView struct {
+	Name         string           `json:"name"`
+	HandSize     int              `json:"hand_size"`
+	FaceUpCards  []string         `json:"face_up_cards"` // The whole hand if the player has revealed it
+	Tableau      []string         `json:"tableau"`
+	Counters     map[string]int64 `json:"counters"`
+	IsBot        bool             `json:"is_bot"`
+	Disconnected bool             `json:"disconnected"`
+}
+
+type PublicDeckView struct {
+	Name    string `json:"name"`
+	Size    int    `json:"size"`
+	TopCard string `json:"top_card,omitempty"` // Only for games that keep the top card of the deck face-up
+}
+
+type PublicAction struct {
+	Time time.Time `json:"time"`
+	Text string    `json:"text"` // As it would have been described to a player who was not involved
+}
+
+func (gs *GameState) PublicView() PublicGameView {
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	result := PublicGameView{
+		gs.Name,
+		gs.Started,
+		"",
+		make([]PublicPlayerView, 0, len(gs.Players)),
+		make([]PublicDeckView, 0, len(gs.Decks)),
+		make([]string, len(gs.DiscardPile)),
+		gs.cardNames(gs.Table),
+		gs.cardNames(gs.Market),
+		nil,
+	}
+	for _, player := range gs.Players {
+		faceUpCards := player.FaceUpCards
+		if player.HandRevealed {
+			faceUpCards = player.Hand
+		}
+		counters := make(map[string]int64, len(player.Counters))
+		for name, value := range player.Counters {
+			counters[name] = value
+		}
+		result.Players = append(result.Players, PublicPlayerView{
+			player.Name,
+			len(player.Hand),
+			gs.cardNames(faceUpCards),
+			gs.cardNames(player.Tableau),
+			counters,
+			player.IsBot,
+			player.IsDisconnected(),
+		})
+		if player.Id == gs.TurnPlayerId {
+			result.TurnPlayer = player.Name
+		}
+	}
+	for deckId, deck := range gs.Decks {
+		deckView := PublicDeckView{gs.spec.DeckName(uint16(deckId)), len(deck), ""}
+		if (deckId == 0) && gs.spec.TopCardFaceUp && (len(deck) > 0) {
+			deckView.TopCard = gs.spec.CardName(deck[len(deck)-1])
+		}
+		result.Decks = append(result.Decks, deckView)
+	}
+	for index, card := range gs.DiscardPile {
+		if card.FaceUp {
+			result.DiscardPile[len(gs.DiscardPile)-index-1] = gs.spec.CardName(card.CardId)
+		}
+	}
+
+	events := gs.EventLog
+	if len(events) > PublicViewActionCount {
+		events = events[len(events)-PublicViewActionCount:]
+	}
+	result.RecentActions = make([]PublicAction, len(events))
+	for index, event := range events {
+		text := describeGameEvent(gs, nil, event.PlayerName, event.TargetPlayerName, &event.Notify)
+		result.RecentActions[index] = PublicAction{event.Timestamp, text}
+	}
+	return result
+}
+
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) cardNames(cardIds []uint16) []string {
+	result := make([]string, len(cardIds))
+	for index, cardId := range cardIds {
+		if cardId != protocol.CARD_ID_ANY {
+			result[index] = gs.spec.CardName(cardId)
+		}
+	}
+	return result
+}
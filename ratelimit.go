@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"time"
+)
+
+const DefaultMaxConnectionsPerIP = 16
+const DefaultMaxCommandsPerSecond = 20
+
+// Players can send this many seconds' worth of commands in a single burst (e.g when pasting several commands at once)
+const CommandBurstSeconds = 3
+
+// Limits how often something can happen, allowing short bursts as long as the average rate stays low enough
+type RateLimiter struct {
+	perSecond  float64
+	burst      float64
+	tokens     float64
+	lastUpdate time.Time
+}
+
+func NewRateLimiter(perSecond int, burstSeconds int) *RateLimiter {
+	burst := float64(perSecond * burstSeconds)
+	return &RateLimiter{float64(perSecond), burst, burst, time.Now()}
+}
+
+// Returns true (and uses up some of the allowance) if another event is allowed to happen now
+func (rl *RateLimiter) Allow() bool {
+	now := time.Now()
+	rl.tokens += now.Sub(rl.lastUpdate).Seconds() * rl.perSecond
+	if rl.tokens > rl.burst {
+		rl.tokens = rl.burst
+	}
+	rl.lastUpdate = now
+
+	if rl.tokens < 1 {
+		return false
+	}
+	rl.tokens--
+	return true
+}
+
+// Returns the IP address that the given connection comes from, without the port
+func connectionIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// Records a new connection from the given IP address. Returns false (and records nothing) if that address already has
+// as many connections as the server allows.
+func (ss *ServerState) acquireConnection(ip string) bool {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	if (ss.config.MaxConnectionsPerIP > 0) && (ss.connectionsByIP[ip] >= ss.config.MaxConnectionsPerIP) {
+		return false
+	}
+	ss.connectionsByIP[ip]++
+	return true
+}
+
+func (ss *ServerState) releaseConnection(ip string) {
+	ss.mutex.Lock()
+	ss.connectionsByIP[ip]--
+	if ss.connectionsByIP[ip] <= 0 {
+		delete(ss.connectionsByIP, ip)
+	}
+	ss.mutex.Unlock()
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// A server that has been run with --relay lets other servers host games "through" it, so that people can run their own
+// server (perhaps with their own changes) without having to accept connections from the internet:
+//   - The host connects to the relay and sends RELAY_HOST, and gets back a code that players can connect with.
+//   - Players connect to the relay and send RELAY_CONNECT with that code instead of a handshake.
+//   - The relay sends RELAY_INCOMING to the host, which opens a new connection to the relay and sends RELAY_ACCEPT.
+//     Connection IDs are unguessable, and are only accepted from the same address as the host's control connection, so
+//     that nobody else can take over a player's connection by accepting it first.
+//   - From then on the relay just passes everything sent on either connection to the other, so the player's client
+//     does its handshake with (and plays on) the host as if it had connected to it directly.
+
+// How long a player waits for the host to accept their connection before giving up
+const RelayAcceptTimeout = 15 * time.Second
+const RelayReconnectDelay = 10 * time.Second
+
+var ErrRelayRefused = errors.New("The relay refused to host the server")
+var ErrRelayConnectionNotPending = errors.New("The relayed connection is not waiting to be accepted")
+var ErrRelayConnectionForOtherHost = errors.New("The relayed connection is for a host at a different address")
+
+// A server that is hosting through this one
+type RelayHost struct {
+	code      string
+	address   net.Addr   // The address of the host's control connection
+	sendQueue *SendQueue // Sends commands to the host's control connection
+}
+
+// A player's connection that is waiting for its host to accept it
+type pendingRelayConnection struct {
+	host     *RelayHost
+	accepted chan relayedConnection
+}
+
+// A connection from a host that has been accepted for a player, along with a channel to close once the relay is done
+// with it
+type relayedConnection struct {
+	conn net.Conn
+	done chan bool
+}
+
+type RelayRegistry struct {
+	mutex   *sync.Mutex
+	hosts   map[string]*RelayHost
+	pending map[uint64]pendingRelayConnection // Players waiting for their host to accept, by connection ID
+}
+
+func NewRelayRegistry() *RelayRegistry {
+	return &RelayRegistry{
+		&sync.Mutex{},
+		make(map[string]*RelayHost),
+		make(map[uint64]pendingRelayConnection),
+	}
+}
+
+// Returns true if the two addresses have the same IP, i.e the connections came from the same machine (or at least
+// from behind the same NAT)
+func sameRemoteHost(addrA net.Addr, addrB net.Addr) bool {
+	hostA, _, errA := net.SplitHostPort(addrA.String())
+	hostB, _, errB := net.SplitHostPort(addrB.String())
+	return (errA == nil) && (errB == nil) && (hostA == hostB)
+}
+
+// Removes and returns the pending connection with the given ID, so long as it is being accepted from the same address
+// as its host. Connections that some other address tries to accept are left for their host to accept.
+func (relays *RelayRegistry) takePending(connectionId uint64, acceptAddr net.Addr) (pendingRelayConnection, error) {
+	relays.mutex.Lock()
+	defer relays.mutex.Unlock()
+	pending, ok := relays.pending[connectionId]
+	if !ok {
+		return pending, ErrRelayConnectionNotPending
+	}
+	if !sameRemoteHost(acceptAddr, pending.host.address) {
+		return pending, ErrRelayConnectionForOtherHost
+	}
+	delete(relays.pending, connectionId)
+	return pending, nil
+}
+
+func isRelayCommand(cmdId byte) bool {
+	switch cmdId {
+	case protocol.CMD_RELAY_HOST, protocol.CMD_RELAY_CONNECT, protocol.CMD_RELAY_ACCEPT:
+		return true
+	}
+	return false
+}
+
+// Handles a connection whose first command was one of the relay commands. This only returns once the relay is done
+// with the connection.
+func (ss *ServerState) handleRelayConnection(conn net.Conn, cmdHeader protocol.CommandHeader, cmdBuffer []byte) {
+	if ss.relays == nil {
+		serverLog.Warnf("Connection from %s tried to use the relay, which is not enabled", conn.RemoteAddr())
+		sendInputErrorTo(conn, cmdHeader.Id, protocol.ERROR_INVALID_CMD_ID)
+		return
+	}
+
+	switch cmdHeader.Id {
+	case protocol.CMD_RELAY_HOST:
+		var cmd protocol.RelayCodeCommand
+		err := protocol.SerialiseRelayCodeCommand(cmdBuffer, &cmd, true)
+		if err != nil {
+			serverLog.Errorf("Failed to deserialise relay host command from %s: %s", conn.RemoteAddr(), err)
+			return
+		}
+		ss.runRelayHost(conn, normaliseJoinCode(cmd.Code))
+
+	case protocol.CMD_RELAY_CONNECT:
+		var cmd protocol.RelayCodeCommand
+		err := protocol.SerialiseRelayCodeCommand(cmdBuffer, &cmd, true)
+		if err != nil {
+			serverLog.Errorf("Failed to deserialise relay connect command from %s: %s", conn.RemoteAddr(), err)
+			return
+		}
+		ss.relayPlayer(conn, normaliseJoinCode(cmd.Code))
+
+	case protocol.CMD_RELAY_ACCEPT:
+		var cmd protocol.RelayConnectionCommand
+		err := protocol.SerialiseRelayConnectionCommand(cmdBuffer, &cmd, true)
+		if err != nil {
+			serverLog.Errorf("Failed to deserialise relay accept command from %s: %s", conn.RemoteAddr(), err)
+			return
+		}
+		pending, err := ss.relays.takePending(cmd.ConnectionId, conn.RemoteAddr())
+		if err == ErrRelayConnectionNotPending {
+			serverLog.Warnf("Connection from %s accepted relayed connection %d, which is not waiting to be accepted", conn.RemoteAddr(), cmd.ConnectionId)
+			return
+		} else if err != nil {
+			serverLog.Warnf("Connection from %s tried to accept relayed connection %d, which is for the host at %s", conn.RemoteAddr(), cmd.ConnectionId, pending.host.address)
+			return
+		}
+		done := make(chan bool)
+		pending.accepted <- relayedConnection{conn, done}
+		<-done
+	}
+}
+
+// Registers the host on the given control connection and keeps it registered until the connection is lost
+func (ss *ServerState) runRelayHost(conn net.Conn, requestedCode string) {
+	relays := ss.relays
+	host := &RelayHost{"", conn.RemoteAddr(), NewSendQueue(conn)}
+	defer host.sendQueue.Close()
+
+	relays.mutex.Lock()
+	if (len(requestedCode) > 0) && (len(requestedCode) <= protocol.MaxRelayCodeLength) && (relays.hosts[requestedCode] == nil) {
+		host.code = requestedCode
+	}
+	for len(host.code) == 0 {
+		ss.mutex.Lock()
+		code := ss.newJoinCode()
+		ss.mutex.Unlock()
+		if relays.hosts[code] == nil {
+			host.code = code
+		}
+	}
+	relays.hosts[host.code] = host
+	relays.mutex.Unlock()
+	serverLog.Infof("Relaying for the server at %s, with code %s", conn.RemoteAddr(), host.code)
+
+	response := protocol.RelayCodeCommand{Code: host.code}
+	respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_RELAY_HOST_RESPONSE, uint16(response.CommandLength()))
+	err := protocol.SerialiseRelayCodeCommand(respBuffer[respHeaderLen:], &response, false)
+	if err == nil {
+		err = host.sendQueue.Send(respBuffer)
+	}
+
+	// Hosts only send keep-alives on their control connection from now on
+	for err == nil {
+		if ss.config.KeepAliveTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(ss.config.KeepAliveTimeout))
+		}
+		var headerBytes []byte
+		headerBytes, err = protocol.ReadExactlyNBytes(conn, protocol.CommandHeaderLength)
+		if err != nil {
+			break
+		}
+		var cmdHeader protocol.CommandHeader
+		err = protocol.SerialiseCommandHeader(headerBytes, &cmdHeader, true)
+		if (err == nil) && (cmdHeader.Id != protocol.CMD_KEEPALIVE) {
+			err = fmt.Errorf("Unexpected command ID %d", cmdHeader.Id)
+		}
+	}
+
+	relays.mutex.Lock()
+	delete(relays.hosts, host.code)
+	relays.mutex.Unlock()
+	serverLog.Infof("Stopped relaying for the server at %s with code %s: %s", conn.RemoteAddr(), host.code, err)
+}
+
+// Asks the host with the given code to accept the player's connection, and then relays between them until either
+// connection is closed
+func (ss *ServerState) relayPlayer(conn net.Conn, code string) {
+	relays := ss.relays
+	accepted := make(chan relayedConnection, 1)
+	relays.mutex.Lock()
+	host := relays.hosts[code]
+	connectionId := newUnguessableId()
+	for _, inUse := relays.pending[connectionId]; inUse; _, inUse = relays.pending[connectionId] {
+		connectionId = newUnguessableId()
+	}
+	if host != nil {
+		relays.pending[connectionId] = pendingRelayConnection{host, accepted}
+	}
+	relays.mutex.Unlock()
+	if host == nil {
+		serverLog.Infof("Connection from %s tried to use relay code '%s', which is not in use", conn.RemoteAddr(), code)
+		sendInputErrorTo(conn, protocol.CMD_RELAY_CONNECT, protocol.ERROR_INVALID_GAME_ID)
+		return
+	}
+
+	incoming := protocol.RelayConnectionCommand{ConnectionId: connectionId}
+	incomingBuffer, incomingHeaderLen := protocol.WriteCommandHeader(protocol.CMD_RELAY_INCOMING, protocol.RelayConnectionCommandLength)
+	err := protocol.SerialiseRelayConnectionCommand(incomingBuffer[incomingHeaderLen:], &incoming, false)
+	if err == nil {
+		err = host.sendQueue.Send(incomingBuffer)
+	}
+	if err != nil {
+		serverLog.Errorf("Failed to tell the host with relay code %s about a connection from %s: %s", code, conn.RemoteAddr(), err)
+	}
+
+	var hostConn relayedConnection
+	select {
+	case hostConn = <-accepted:
+	case <-time.After(RelayAcceptTimeout):
+		relays.mutex.Lock()
+		_, stillPending := relays.pending[connectionId]
+		delete(relays.pending, connectionId)
+		relays.mutex.Unlock()
+		if stillPending {
+			serverLog.Warnf("The host with relay code %s did not accept the connection from %s", code, conn.RemoteAddr())
+			sendInputErrorTo(conn, protocol.CMD_RELAY_CONNECT, protocol.ERROR_SERVER_FULL)
+			return
+		}
+		hostConn = <-accepted // The host accepted just as we gave up waiting
+	}
+
+	serverLog.Infof("Relaying the connection from %s to the host with relay code %s", conn.RemoteAddr(), code)
+	spliceConnections(conn, hostConn.conn)
+	close(hostConn.done)
+}
+
+// Passes everything received on each connection to the other one, until either of them is closed
+func spliceConnections(connA net.Conn, connB net.Conn) {
+	// It's up to the host to drop connections that have gone quiet
+	connA.SetReadDeadline(time.Time{})
+	connB.SetReadDeadline(time.Time{})
+
+	copyDone := make(chan bool, 2)
+	go func() {
+		io.Copy(connA, connB)
+		copyDone <- true
+	}()
+	go func() {
+		io.Copy(connB, connA)
+		copyDone <- true
+	}()
+	<-copyDone
+	connA.Close()
+	connB.Close()
+	<-copyDone
+}
+
+// Hosts the given server through the relay at the given address, reconnecting (and asking for the same code) whenever
+// the connection to the relay is lost
+func runRelayClient(server *ServerState, relayAddress string) {
+	_, relayAddress = parseListenAddress(relayAddress)
+	code := ""
+	for {
+		err := hostThroughRelay(server, relayAddress, &code)
+		if errors.Is(err, ErrRelayRefused) {
+			serverLog.Errorf("Failed to host through the relay at %s: %s", relayAddress, err)
+			return
+		}
+		serverLog.Warnf("Lost the connection to the relay at %s, reconnecting in %s: %s", relayAddress, RelayReconnectDelay, err)
+		time.Sleep(RelayReconnectDelay)
+	}
+}
+
+func hostThroughRelay(server *ServerState, relayAddress string, code *string) error {
+	conn, err := net.Dial("tcp", relayAddress)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	hostCmd := protocol.RelayCodeCommand{Code: *code}
+	hostBuffer, hostHeaderLen := protocol.WriteCommandHeader(protocol.CMD_RELAY_HOST, uint16(hostCmd.CommandLength()))
+	err = protocol.SerialiseRelayCodeCommand(hostBuffer[hostHeaderLen:], &hostCmd, false)
+	if err != nil {
+		return err
+	}
+	err = protocol.SendCommandBufferTo(conn, hostBuffer)
+	if err != nil {
+		return err
+	}
+
+	// Keep-alives are sent from a separate goroutine, which is stopped by closing the connection
+	go func() {
+		keepAliveTicker := time.NewTicker(protocol.KeepAliveInterval)
+		defer keepAliveTicker.Stop()
+		keepAliveBuffer, _ := protocol.WriteCommandHeader(protocol.CMD_KEEPALIVE, 0)
+		for range keepAliveTicker.C {
+			if protocol.SendCommandBufferTo(conn, keepAliveBuffer) != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		headerBytes, err := protocol.ReadExactlyNBytes(conn, protocol.CommandHeaderLength)
+		if err != nil {
+			return err
+		}
+		var cmdHeader protocol.CommandHeader
+		err = protocol.SerialiseCommandHeader(headerBytes, &cmdHeader, true)
+		if err == nil {
+			err = protocol.ValidateCommandHeader(cmdHeader)
+		}
+		if err != nil {
+			return err
+		}
+		cmdBuffer, err := protocol.ReadExactlyNBytes(conn, cmdHeader.Len)
+		if err != nil {
+			return err
+		}
+
+		switch cmdHeader.Id {
+		case protocol.CMD_RELAY_HOST_RESPONSE:
+			var cmd protocol.RelayCodeCommand
+			err = protocol.SerialiseRelayCodeCommand(cmdBuffer, &cmd, true)
+			if err != nil {
+				return err
+			}
+			*code = cmd.Code
+			relayHost, relayPort, _ := net.SplitHostPort(relayAddress)
+			if relayPort != DefaultListenPort {
+				relayHost = relayAddress
+			}
+			serverLog.Infof("Hosting through the relay at %s. Players can connect with: netdeck play -s %s --relay %s", relayAddress, relayHost, cmd.Code)
+
+		case protocol.CMD_RELAY_INCOMING:
+			var cmd protocol.RelayConnectionCommand
+			err = protocol.SerialiseRelayConnectionCommand(cmdBuffer, &cmd, true)
+			if err != nil {
+				return err
+			}
+			go acceptRelayedConnection(server, relayAddress, cmd.ConnectionId)
+
+		case protocol.CMD_NOTIFY_INPUT_ERROR:
+			return ErrRelayRefused
+
+		default:
+			serverLog.Warnf("Received unexpected command %d from the relay at %s", cmdHeader.Id, relayAddress)
+		}
+	}
+}
+
+// Opens a new connection to the relay for the player with the given connection ID, and handles it in the same way as a
+// connection that came directly from the player
+func acceptRelayedConnection(server *ServerState, relayAddress string, connectionId uint64) {
+	conn, err := net.Dial("tcp", relayAddress)
+	if err != nil {
+		serverLog.Errorf("Failed to connect to the relay at %s to accept a player's connection: %s", relayAddress, err)
+		return
+	}
+	acceptCmd := protocol.RelayConnectionCommand{ConnectionId: connectionId}
+	acceptBuffer, acceptHeaderLen := protocol.WriteCommandHeader(protocol.CMD_RELAY_ACCEPT, protocol.RelayConnectionCommandLength)
+	err = protocol.SerialiseRelayConnectionCommand(acceptBuffer[acceptHeaderLen:], &acceptCmd, false)
+	if err == nil {
+		err = protocol.SendCommandBufferTo(conn, acceptBuffer)
+	}
+	if err != nil {
+		serverLog.Errorf("Failed to accept a player's connection through the relay at %s: %s", relayAddress, err)
+		conn.Close()
+		return
+	}
+	serverLog.Infof("Received connection %d through the relay at %s", connectionId, relayAddress)
+	handleNewConnection(server, conn)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRelayTakePending(t *testing.T) {
+	hostAddress := &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 7000}
+	tests := []struct {
+		name         string
+		connectionId uint64
+		acceptAddr   net.Addr
+		wantErr      error
+		wantPending  bool
+	}{
+		{"Accepted by the host", 1, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 7001}, nil, false},
+		{"Accepted by another address", 1, &net.TCPAddr{IP: net.ParseIP("198.51.100.1"), Port: 7001}, ErrRelayConnectionForOtherHost, true},
+		{"Unknown connection ID", 2, &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 7001}, ErrRelayConnectionNotPending, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			relays := NewRelayRegistry()
+			host := &RelayHost{"ABCD", hostAddress, nil}
+			accepted := make(chan relayedConnection, 1)
+			relays.pending[1] = pendingRelayConnection{host, accepted}
+
+			pending, err := relays.takePending(test.connectionId, test.acceptAddr)
+			if err != test.wantErr {
+				t.Fatalf("Taking the pending connection returned error %v, expected %v", err, test.wantErr)
+			}
+			if (err == nil) && ((pending.host != host) || (pending.accepted != accepted)) {
+				t.Errorf("Took pending connection %+v, expected the one for host %s", pending, host.code)
+			}
+			if _, stillPending := relays.pending[1]; stillPending != test.wantPending {
+				t.Errorf("Connection is still pending: %t, expected %t", stillPending, test.wantPending)
+			}
+		})
+	}
+}
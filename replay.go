@@ -0,0 +1,379 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// Replay files contain a header record followed by one record for every event in the game, in the order that they
+// happened. Each record is a little-endian uint32 length followed by that many bytes of data.
+const ReplayFileExtension = ".ndr"
+const ReplayMagicNumber uint16 = 0x524E // "NR"
+const ReplayRecordLengthSize = 4
+
+const MinReplayHeaderLength = 26
+
+// The first record in every replay file, describing the game that the events belong to
+type ReplayHeader struct {
+	magicNumber uint16
+	protocolId  uint16
+	gameId      uint64
+	startTime   int64 // Unix time in nanoseconds
+	gameName    string
+	joinCode    string
+	specData    []byte // As sent in NotifyGameJoinedCommand, see SerialiseSpecFromSpec
+}
+
+func (hdr *ReplayHeader) RecordLength() int {
+	return MinReplayHeaderLength + len(hdr.gameName) + len(hdr.joinCode) + len(hdr.specData)
+}
+
+func SerialiseReplayHeader(buffer []byte, hdr *ReplayHeader, isReading bool) error {
+	ctx := protocol.NewSerialisation(buffer, isReading)
+	ctx.SerialiseUint16(&hdr.magicNumber)
+	ctx.SerialiseUint16(&hdr.protocolId)
+	ctx.SerialiseUint64(&hdr.gameId)
+	ctx.SerialiseInt64(&hdr.startTime)
+	ctx.SerialiseString(&hdr.gameName)
+	ctx.SerialiseString(&hdr.joinCode)
+	ctx.SerialiseByteSlice(&hdr.specData)
+	ctx.Assert(hdr.magicNumber == ReplayMagicNumber)
+	return ctx.Complete()
+}
+
+const MinReplayEventLength = 14
+
+// A single GameEvent as it is stored in a replay file
+type ReplayEvent struct {
+	timestamp        int64 // Unix time in nanoseconds
+	playerName       string
+	targetPlayerName string
+	notify           []byte // The serialised NotifyPlayerActionCommand, without a command header
+}
+
+func (evt *ReplayEvent) RecordLength() int {
+	return MinReplayEventLength + len(evt.playerName) + len(evt.targetPlayerName) + len(evt.notify)
+}
+
+func SerialiseReplayEvent(buffer []byte, evt *ReplayEvent, isReading bool) error {
+	ctx := protocol.NewSerialisation(buffer, isReading)
+	ctx.SerialiseInt64(&evt.timestamp)
+	ctx.SerialiseString(&evt.playerName)
+	ctx.SerialiseString(&evt.targetPlayerName)
+	ctx.SerialiseByteSlice(&evt.notify)
+	return ctx.Complete()
+}
+
+// Appends the events of a single game to its replay file as they happen
+type ReplayWriter struct {
+	file *os.File
+	path string
+}
+
+// Creates a new replay file for the given game in the given directory, and writes the game's header to it.
+// The file is named after the time at which it was created and the game's join code, e.g "20240131-183000-BRAVE-OTTER-42.ndr".
+func NewReplayWriter(directory string, game *GameState) (*ReplayWriter, error) {
+	specData, err := SerialiseSpecFromSpec(game.spec)
+	if err != nil {
+		return nil, err
+	}
+	if len(specData) > math.MaxUint16 {
+		return nil, protocol.ErrInvalidLength
+	}
+
+	now := time.Now().UTC()
+	path := filepath.Join(directory, now.Format("20060102-150405")+"-"+game.JoinCode+ReplayFileExtension)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	header := ReplayHeader{
+		ReplayMagicNumber,
+		protocol.PROTOCOL_ID,
+		game.Id,
+		now.UnixNano(),
+		game.Name,
+		game.JoinCode,
+		specData,
+	}
+	buffer := make([]byte, header.RecordLength())
+	SerialiseReplayHeader(buffer, &header, false)
+
+	result := &ReplayWriter{file, path}
+	err = result.writeRecord(buffer)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return result, nil
+}
+
+func (rw *ReplayWriter) WriteEvent(event GameEvent) error {
+	notifyLen := event.Notify.CommandLength()
+	if notifyLen > protocol.MaxNotifyPlayerActionCommandLength {
+		return protocol.ErrInvalidLength
+	}
+	notifyData := make([]byte, notifyLen)
+	protocol.SerialiseNotifyPlayerActionCommand(notifyData, &event.Notify, false)
+
+	replayEvent := ReplayEvent{
+		event.Timestamp.UnixNano(),
+		event.PlayerName,
+		event.TargetPlayerName,
+		notifyData,
+	}
+	buffer := make([]byte, replayEvent.RecordLength())
+	SerialiseReplayEvent(buffer, &replayEvent, false)
+	return rw.writeRecord(buffer)
+}
+
+func (rw *ReplayWriter) writeRecord(data []byte) error {
+	// Write each record with a single call so that a record is never split up by another process appending to the file
+	record := make([]byte, ReplayRecordLengthSize+len(data))
+	binary.LittleEndian.PutUint32(record, uint32(len(data)))
+	copy(record[ReplayRecordLengthSize:], data)
+	_, err := rw.file.Write(record)
+	return err
+}
+
+func (rw *ReplayWriter) Close() error {
+	return rw.file.Close()
+}
+
+// Starts recording the events of the given game to a new file in the given directory. Games are still played normally
+// if the file cannot be created, they just are not recorded.
+func (gs *GameState) startReplay(directory string) {
+	replay, err := NewReplayWriter(directory, gs)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to create a replay file in '%s': %s", directory, err)
+		return
+	}
+	gameLog(gs).Infof("Recording the game to '%s'", replay.path)
+	gs.mutex.Lock()
+	gs.replay = replay
+	gs.mutex.Unlock()
+}
+
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) recordReplayEvent(event GameEvent) {
+	if gs.replay == nil {
+		return
+	}
+	err := gs.replay.WriteEvent(event)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to write to the replay file '%s', the rest of the game will not be recorded: %s", gs.replay.path, err)
+		gs.closeReplay()
+	}
+}
+
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) closeReplay() {
+	if gs.replay == nil {
+		return
+	}
+	err := gs.replay.Close()
+	if err != nil {
+		gameLog(gs).Errorf("Failed to close the replay file '%s': %s", gs.replay.path, err)
+	}
+	gs.replay = nil
+}
+
+var ErrNotAReplay = errors.New("File is not a netdeck replay")
+
+// A game that was recorded by the server, as loaded back from its replay file
+type Replay struct {
+	GameName  string
+	JoinCode  string
+	StartTime time.Time
+	spec      *GameSpecification
+	Events    []GameEvent
+
+	// The replay was recorded by a different version of netdeck, so some events might not be described correctly
+	ProtocolMismatch bool
+}
+
+func LoadReplayFromFile(path string) (*Replay, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([][]byte, 0)
+	for len(data) > 0 {
+		if len(data) < ReplayRecordLengthSize {
+			return nil, protocol.ErrInvalidLength
+		}
+		recordLen := binary.LittleEndian.Uint32(data)
+		data = data[ReplayRecordLengthSize:]
+		if uint64(recordLen) > uint64(len(data)) {
+			return nil, protocol.ErrInvalidLength
+		}
+		records = append(records, data[:recordLen])
+		data = data[recordLen:]
+	}
+
+	if (len(records) == 0) || (len(records[0]) < MinReplayHeaderLength) ||
+		(binary.LittleEndian.Uint16(records[0]) != ReplayMagicNumber) {
+		return nil, ErrNotAReplay
+	}
+	var header ReplayHeader
+	err = SerialiseReplayHeader(records[0], &header, true)
+	if err != nil {
+		return nil, err
+	}
+	spec, err := NewSpec(header.specData)
+	if err != nil {
+		return nil, err
+	}
+
+	result := Replay{
+		header.gameName,
+		header.joinCode,
+		time.Unix(0, header.startTime),
+		spec,
+		make([]GameEvent, 0, len(records)-1),
+		header.protocolId != protocol.PROTOCOL_ID,
+	}
+	for _, record := range records[1:] {
+		if len(record) < MinReplayEventLength {
+			return nil, protocol.ErrInvalidLength
+		}
+		var replayEvent ReplayEvent
+		err = SerialiseReplayEvent(record, &replayEvent, true)
+		if err != nil {
+			return nil, err
+		}
+		if len(replayEvent.notify) < protocol.MinNotifyPlayerActionCommandLength {
+			return nil, protocol.ErrInvalidLength
+		}
+		var notify protocol.NotifyPlayerActionCommand
+		err = protocol.SerialiseNotifyPlayerActionCommand(replayEvent.notify, &notify, true)
+		if err != nil {
+			return nil, err
+		}
+		result.Events = append(result.Events, GameEvent{
+			time.Unix(0, replayEvent.timestamp),
+			replayEvent.playerName,
+			replayEvent.targetPlayerName,
+			notify,
+		})
+	}
+	return &result, nil
+}
+
+// Lets the user step through the events in a replay file, describing each one in the same way as the client does while
+// the game is being played
+func runReplay(replayFilePath string) {
+	replay, err := LoadReplayFromFile(replayFilePath)
+	if err != nil {
+		fmt.Printf("Failed to load replay '%s': %s\n", replayFilePath, err)
+		return
+	}
+	game := CreateGameFromSpec(replay.spec)
+
+	fmt.Printf("Replay of game '%s' (%s), recorded on %s with %d events\n",
+		replay.GameName, replay.JoinCode, replay.StartTime.Format("2006-01-02 15:04"), len(replay.Events))
+	if replay.ProtocolMismatch {
+		fmt.Println("Warning: This replay was recorded by a different version of netdeck, so some events might not be shown correctly")
+	}
+	fmt.Println("Press enter to show the next event, or enter 'help' to see the other commands")
+
+	printEvent := func(index int) {
+		event := &replay.Events[index]
+		eventStr := describeGameEvent(&game, nil, event.PlayerName, event.TargetPlayerName, &event.Notify)
+		fmt.Printf("  [%d/%d %s] %s\n", index+1, len(replay.Events), event.Timestamp.Format("15:04:05"), eventStr)
+	}
+
+	// The index of the last event that was shown, or -1 if we are at the start of the replay
+	position := -1
+	stdInRead := bufio.NewReader(os.Stdin)
+	for {
+		inputLine, err := stdInRead.ReadString('\n')
+		if err != nil {
+			return
+		}
+		inputTokens := strings.Fields(inputLine)
+		cmdStr := "next"
+		if len(inputTokens) > 0 {
+			cmdStr = inputTokens[0]
+		}
+		unusedCmdArgs := []string{}
+		if len(inputTokens) > 1 {
+			unusedCmdArgs = inputTokens[1:]
+		}
+
+		if cmdStr == "help" {
+			fmt.Print(`
+You are watching a replay of a game that was recorded by a netdeck server. Events are described in the same way as they
+would have been shown to a player that was watching the game (so you will not see any other player's hand).
+
+The following commands are currently available to you:
+=======================================================================================================================
+Command         | Description
+================|============
+next [n]        | Show the next n events (default 1). Entering nothing does the same
+prev [n]        | Go back n events (default 1) and show the event there
+jump <n>        | Go to the nth event in the replay and show it
+help            | Show the currently-available commands
+quit            | Stop watching the replay
+=======================================================================================================================
+`)
+
+		} else if (cmdStr == "next") || (cmdStr == "n") {
+			count, err := parseInputUint64(unusedCmdArgs)
+			if err != nil {
+				count = 1
+			}
+			if position+1 >= len(replay.Events) {
+				fmt.Println("You have reached the end of the replay")
+				continue
+			}
+			for i := uint64(0); (i < count) && (position+1 < len(replay.Events)); i++ {
+				position++
+				printEvent(position)
+			}
+
+		} else if (cmdStr == "prev") || (cmdStr == "p") {
+			count, err := parseInputUint64(unusedCmdArgs)
+			if err != nil {
+				count = 1
+			}
+			if (position < 0) || (count > uint64(position)) {
+				position = -1
+				fmt.Println("You are at the start of the replay")
+				continue
+			}
+			position -= int(count)
+			printEvent(position)
+
+		} else if (cmdStr == "jump") || (cmdStr == "j") {
+			eventNumber, err := parseInputUint64(unusedCmdArgs)
+			if err != nil {
+				fmt.Printf("Error! Failed to parse the <n> argument for '%s': %s\n", cmdStr, err)
+				continue
+			}
+			if (eventNumber == 0) || (eventNumber > uint64(len(replay.Events))) {
+				fmt.Printf("Error! There is no event %d, the replay has events 1 to %d\n", eventNumber, len(replay.Events))
+				continue
+			}
+			position = int(eventNumber) - 1
+			printEvent(position)
+
+		} else if cmdStr == "quit" {
+			return
+
+		} else {
+			fmt.Printf("Unrecognised command: '%s', enter 'help' for a list of available commands\n", strings.TrimSpace(inputLine))
+		}
+	}
+}
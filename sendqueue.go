@@ -0,0 +1,168 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// The most commands that can be waiting to be sent to a single connection. A client that falls this far behind is
+// disconnected (and can then reconnect and be sent the current state of its game) rather than letting its queue grow
+// without limit.
+const SendQueueLength = 256
+
+// A connection is dropped if writing a single command to it takes longer than this
+const SendTimeout = 10 * time.Second
+
+var ErrSendQueueFull = errors.New("Too many commands are waiting to be sent to the connection")
+var ErrConnectionClosed = errors.New("Connection is closed")
+
+// Sends commands to a single connection from a dedicated goroutine, so that the goroutines handling commands (and
+// broadcasting their results) never have to wait for a slow client, and commands sent from different goroutines are
+// never interleaved on the connection.
+type SendQueue struct {
+	conn    net.Conn
+	mutex   *sync.Mutex
+	buffers chan []byte
+	closed  bool
+	done    chan bool // Closed once the writer goroutine has stopped and the connection has been closed
+
+	compression byte // The COMPRESSION_* method agreed with the client during the handshake
+	batching    bool // Whether commands that are waiting to be sent are packed into a CMD_NOTIFY_BATCH
+}
+
+func NewSendQueue(conn net.Conn) *SendQueue {
+	queue := &SendQueue{
+		conn,
+		&sync.Mutex{},
+		make(chan []byte, SendQueueLength),
+		false,
+		make(chan bool),
+		protocol.COMPRESSION_NONE,
+		false,
+	}
+	go queue.runWriter()
+	return queue
+}
+
+// Queues the given command to be sent to the connection. This never blocks: if the queue is already full then the
+// connection is closed immediately and the command is dropped.
+func (queue *SendQueue) Send(buffer []byte) error {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	if queue.closed {
+		return ErrConnectionClosed
+	}
+
+	select {
+	case queue.buffers <- buffer:
+		return nil
+	default:
+		queue.closed = true
+		close(queue.buffers)
+		queue.conn.Close()
+		return ErrSendQueueFull
+	}
+}
+
+// Closes the connection once every command that has already been queued has been sent
+func (queue *SendQueue) Close() {
+	queue.mutex.Lock()
+	if !queue.closed {
+		queue.closed = true
+		close(queue.buffers)
+	}
+	queue.mutex.Unlock()
+}
+
+// Sets the method used to compress large commands from now on. Commands that are already queued might also be
+// compressed, so this should only be called once the client is known to support the method.
+func (queue *SendQueue) SetCompression(compression byte) {
+	queue.mutex.Lock()
+	queue.compression = compression
+	queue.mutex.Unlock()
+}
+
+// Starts packing commands that are waiting to be sent into batches (see protocol/batch.go). This should only be called
+// once the client is known to handle batches.
+func (queue *SendQueue) EnableBatching() {
+	queue.mutex.Lock()
+	queue.batching = true
+	queue.mutex.Unlock()
+}
+
+// Waits for the connection to be closed (see Close). Returns false if it was still open when the timeout passed.
+func (queue *SendQueue) Wait(timeout time.Duration) bool {
+	select {
+	case <-queue.done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (queue *SendQueue) runWriter() {
+	defer close(queue.done)
+	defer queue.conn.Close()
+	var leftover []byte // A command that was taken from the queue but didn't fit in the last batch
+	for {
+		buffer := leftover
+		leftover = nil
+		if buffer == nil {
+			var ok bool
+			buffer, ok = <-queue.buffers
+			if !ok {
+				return
+			}
+		}
+
+		queue.mutex.Lock()
+		compression := queue.compression
+		batching := queue.batching
+		queue.mutex.Unlock()
+		if batching {
+			buffer, leftover = queue.takeBatch(buffer)
+		}
+
+		queue.conn.SetWriteDeadline(time.Now().Add(SendTimeout))
+		err := protocol.SendCommandBufferTo(queue.conn, protocol.CompressCommandBuffer(buffer, compression))
+		if err != nil {
+			// Closing the connection also stops the goroutine reading from it, which then handles the disconnection
+			queue.Close()
+			return
+		}
+	}
+}
+
+// Returns a batch of the given command and any others that are already waiting to be sent (or just the given command
+// if no others are waiting), along with the next command from the queue if it did not fit in the batch
+func (queue *SendQueue) takeBatch(first []byte) ([]byte, []byte) {
+	commands := [][]byte{first}
+	batchLen := len(first)
+	var leftover []byte
+	for leftover == nil {
+		var buffer []byte
+		ok := false
+		select {
+		case buffer, ok = <-queue.buffers:
+		default:
+		}
+		if !ok {
+			break
+		}
+		if batchLen+len(buffer) > protocol.MaxNotifyBatchCommandLength {
+			leftover = buffer
+		} else {
+			commands = append(commands, buffer)
+			batchLen += len(buffer)
+		}
+	}
+
+	if len(commands) == 1 {
+		return first, leftover
+	}
+	return protocol.BuildBatchCommand(commands, batchLen), leftover
+}
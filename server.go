@@ -2,38 +2,149 @@ package main
 
 import (
 	"bufio"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// How long the server waits for games to finish after being told to quit, unless some other time is given
+const DefaultShutdownDrainTimeout = 10 * time.Minute
+
+// Players are reminded that the server is shutting down when this much time remains until it does
+var shutdownWarningTimes = []time.Duration{5 * time.Minute, time.Minute, 30 * time.Second, 10 * time.Second}
+
+// How long a player whose connection dropped keeps their place in the game while waiting for them to reconnect
+const PlayerResumeTimeout = 5 * time.Minute
+
+// How long the server waits for the shutdown notification to be sent to every player before it exits
+const ShutdownFlushTimeout = 5 * time.Second
+
+// The address that the server listens on if no others are given, which is every interface (both IPv4 and IPv6)
+const DefaultListenAddress = ":43831"
+const DefaultListenPort = "43831"
+
+// The strings sent in the TargetStrings of a resume notification to say what happened to the player's connection
+const (
+	RESUME_STATUS_DISCONNECTED = "disconnected"
+	RESUME_STATUS_RESUMED      = "resumed"
 )
 
+// Settings for the server, which are given on the command line
+type ServerConfig struct {
+	IdleGameTimeout  time.Duration // Games are closed if nobody does anything in them for this long. 0 to never close them
+	KeepAliveTimeout time.Duration // Connections are dropped if nothing is received on them for this long. 0 to never drop them
+
+	// The most players that can be connected, games that can exist, and players that can be in one game. 0 for no limit.
+	// Bots do not count as connected players, but they do count towards the number of players in their game.
+	MaxConnections    int
+	MaxGames          int
+	MaxPlayersPerGame int
+
+	// Protects the server from clients that open too many connections or send too many commands. 0 for no limit.
+	MaxConnectionsPerIP  int
+	MaxCommandsPerSecond int
+
+	// The address (e.g ":8080") on which to serve the HTTP health check endpoints, or empty to not serve them
+	HealthAddress string
+
+	// The address (e.g ":8000") on which to serve the browser client, or empty to not serve it
+	WebAddress string
+
+	// The directory in which to write a replay file for each game, or empty to not record games
+	ReplayDirectory string
+
+	// The file containing the secret key that is used to sign identity tokens, which is created if it does not exist
+	IdentityKeyFile string
+
+	// The addresses (e.g ":43831" or "[::1]:43831") that the server accepts player connections on
+	ListenAddresses []string
+
+	// The URL (e.g "ircs://irc.libera.chat/#netdeck") of the IRC channel to mirror public games into, or empty to not
+	// mirror them, along with the nick to use there and whether to accept commands from the channel. See IRCBridge.
+	IRCURL      string
+	IRCNick     string
+	IRCCommands bool
+
+	// Whether other servers can host games through this one, and the address of the relay (if any) that this server
+	// hosts its own games through. See relay.go.
+	RelayEnabled bool
+	RelayVia     string
+}
+
 type ServerState struct {
 	mutex        *sync.Mutex
 	nextPlayerId uint64
-	nextGameId   uint64
 	allPlayers   []*PlayerState
 	allGames     []*GameState
+
+	// Set once the server has been told to shut down. No new games can be created after that, but players can still
+	// finish the games that they are in.
+	draining bool
+
+	config          ServerConfig
+	connectionsByIP map[string]int // The number of open connections from each IP address
+
+	startTime       time.Time
+	activeListeners int // The number of addresses on which the server is currently accepting new connections
+
+	identityKey []byte // The secret key used to sign and check identity tokens, see newIdentityToken
+
+	ircBridge *IRCBridge // Mirrors public games into an IRC channel, or nil if the server is not configured to
+
+	relays *RelayRegistry // The servers hosting through this one, or nil if the server is not a relay
 }
 
-func (ss *ServerState) AddPlayer(socket net.Conn, name string) *PlayerState {
+// Returns nil if the server cannot accept any more players
+func (ss *ServerState) AddPlayer(socket net.Conn, name string, isBot bool) *PlayerState {
 	ss.mutex.Lock()
 	playerId := ss.nextPlayerId
-	if playerId > PLAYER_ID_MAX {
+	if playerId > protocol.PLAYER_ID_MAX {
 		ss.mutex.Unlock()
 		return nil
 	}
+	if !isBot && (ss.config.MaxConnections > 0) {
+		connectionCount := 0
+		for _, player := range ss.allPlayers {
+			if !player.IsBot {
+				connectionCount++
+			}
+		}
+		if connectionCount >= ss.config.MaxConnections {
+			ss.mutex.Unlock()
+			return nil
+		}
+	}
 	ss.nextPlayerId += 1
 
 	ps := PlayerState{
 		playerId,
-		socket,
+		nil,
 		name,
 		make([]uint16, 0),
 		nil,
+		make(map[string]int64),
+		make([]uint16, 0),
+		false,
+		make([]uint16, 0),
+		newUnguessableId(),
+		false,
+		isBot,
+		0,
+		nil,
+		&sync.Mutex{},
 	}
+	ps.setConnection(socket)
 	ss.allPlayers = append(ss.allPlayers, &ps)
 	ss.mutex.Unlock()
 	return &ps
@@ -53,21 +164,99 @@ func (ss *ServerState) RemovePlayer(playerId uint64) {
 	ss.mutex.Unlock()
 
 	if player != nil {
-		player.Conn.Close()
+		player.CloseConnection()
 		if player.CurrentGame != nil {
-			notifyAction := NewPlayerActionNotify(player.Id, CMD_GAME_LEAVE, DECK_ID_NONE, PLAYER_ID_NONE, nil)
-			player.CurrentGame.BroadcastNotification(notifyAction)
-			player.CurrentGame.RemovePlayer(player)
+			game := player.CurrentGame
+			notifyAction := protocol.NewPlayerActionNotify(player.Id, protocol.CMD_GAME_LEAVE, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+			game.BroadcastNotification(notifyAction)
+			game.RemovePlayer(player)
+			game.handOverOwnership(player.Id)
+			player.CurrentGame = nil
+			ss.RemoveIdleBots(game)
+		}
+	}
+}
+
+// Removes every bot from the given game if there are no other players left in it, so that the game can be cleaned up
+func (ss *ServerState) RemoveIdleBots(game *GameState) {
+	botIds := make([]uint64, 0)
+	game.mutex.Lock()
+	for _, player := range game.Players {
+		if !player.IsBot {
+			game.mutex.Unlock()
+			return
+		}
+		botIds = append(botIds, player.Id)
+	}
+	game.mutex.Unlock()
+
+	for _, botId := range botIds {
+		ss.RemovePlayer(botId)
+	}
+}
+
+// Keeps the given player (whose connection has dropped) in their game for a while so that they can reconnect and carry on
+// playing. If they have not reconnected by the time the timeout passes then they are removed from the server.
+func (ss *ServerState) SuspendPlayer(player *PlayerState) {
+	ss.mutex.Lock()
+	droppedConn := player.suspendConnection()
+	ss.mutex.Unlock()
+
+	game := player.CurrentGame
+	notifyAction := protocol.NewPlayerActionNotify(player.Id, protocol.CMD_GAME_RESUME, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+	notifyAction.TargetStrings = []string{RESUME_STATUS_DISCONNECTED}
+	err := game.BroadcastNotification(notifyAction)
+	if err != nil {
+		playerLog(player).Errorf("Failed to broadcast disconnection notification: %s", err)
+	}
+
+	time.AfterFunc(PlayerResumeTimeout, func() {
+		// If the player reconnected (even if they have since dropped again) then they will have a different connection
+		expired := player.isStillDisconnectedFrom(droppedConn)
+		if expired {
+			playerLog(player).Infof("%s did not reconnect in time, removing them from the server", player.Name)
+			ss.RemovePlayer(player.Id)
+		}
+	})
+}
+
+// Gives control of the disconnected player with the given resume token to the new connection, and returns that player.
+// The player must also have the same identity as the new connection, so a stolen resume token is no use on its own.
+// Returns nil if there is no such player waiting to be resumed.
+func (ss *ServerState) ResumePlayer(resumeToken uint64, identityId uint64, socket net.Conn) *PlayerState {
+	var result *PlayerState = nil
+	ss.mutex.Lock()
+	for _, player := range ss.allPlayers {
+		if player.IsDisconnected() && (player.ResumeToken == resumeToken) && (player.IdentityId == identityId) {
+			player.setConnection(socket)
+			result = player
+			break
 		}
 	}
+	ss.mutex.Unlock()
+	return result
 }
 
-func (ss *ServerState) CreateNewGame(spec *GameSpecification, firstPlayer *PlayerState) *GameState {
+// Returns nil if the server already has as many games as it allows
+func (ss *ServerState) CreateNewGame(spec *GameSpecification, name string, public bool, seed int64, firstPlayer *PlayerState) *GameState {
 	gs := CreateGameFromSpec(spec)
-	gs.ShuffleDeck()
+	gs.Name = name
+	gs.Public = public
+	gs.rng = rand.New(rand.NewSource(seed))
+	gs.MaxPlayers = ss.config.MaxPlayersPerGame
+	specHash, err := HashSpec(spec)
+	if err != nil {
+		serverLog.Errorf("Failed to compute the hash of the spec for game '%s': %s", name, err)
+	}
+	gs.specHash = specHash
+	for deckId := range gs.Decks {
+		gs.ShuffleDeck(uint16(deckId))
+	}
 
 	gs.Players = append(gs.Players, firstPlayer)
+	gs.OwnerId = firstPlayer.Id
 	firstPlayer.CurrentGame = &gs
+	gs.initPlayerCounters(firstPlayer)
 
 	ss.mutex.Lock()
 	// Cleanup any old/empty games before creating the new one
@@ -78,19 +267,33 @@ func (ss *ServerState) CreateNewGame(spec *GameSpecification, firstPlayer *Playe
 			shouldRemove := (len(game.Players) == 0)
 
 			if shouldRemove {
-				fmt.Println("Clean up game " + strconv.FormatUint(game.Id, 10))
+				gameLog(game).Infof("Clean up game")
+				game.closeReplay()
 				ss.allGames[i] = ss.allGames[len(ss.allGames)-1]
 				ss.allGames = ss.allGames[:len(ss.allGames)-1]
 			}
 			game.mutex.Unlock()
 		}
 	}
+	if (ss.config.MaxGames > 0) && (len(ss.allGames) >= ss.config.MaxGames) {
+		ss.mutex.Unlock()
+		firstPlayer.CurrentGame = nil
+		return nil
+	}
 
-	gs.Id = ss.nextGameId
-	ss.nextGameId += 1
+	gs.Id = ss.newGameId()
+	gs.JoinCode = ss.newJoinCode()
 	ss.allGames = append(ss.allGames, &gs)
 	ss.mutex.Unlock()
-	fmt.Println("Created game", gs.Id)
+	gameLog(&gs).Infof("Created game '%s' with random seed %d", gs.Name, seed)
+	if ss.config.ReplayDirectory != "" {
+		gs.startReplay(ss.config.ReplayDirectory)
+	}
+	if ss.ircBridge != nil {
+		gs.mutex.Lock()
+		gs.ircBridge = ss.ircBridge
+		gs.mutex.Unlock()
+	}
 	return &gs
 }
 
@@ -109,25 +312,131 @@ func (ss *ServerState) FindGame(gameId uint64) *GameState {
 	return result
 }
 
+// Returns a listing of every public game that still has players in it
+func (ss *ServerState) PublicGames() protocol.GameInfoResponseCommand {
+	result := protocol.GameInfoResponseCommand{
+		GameIds:      make([]uint64, 0),
+		Names:        make([]string, 0),
+		PlayerCounts: make([]uint16, 0),
+		OwnerNames:   make([]string, 0),
+	}
+	ss.mutex.Lock()
+	for _, game := range ss.allGames {
+		if len(result.GameIds) >= protocol.MaxGameInfoResponseGameCount {
+			break
+		}
+		game.mutex.Lock()
+		if game.Public && (len(game.Players) > 0) {
+			ownerName := ""
+			ownerIndex := game.FindPlayer(game.OwnerId)
+			if ownerIndex >= 0 {
+				ownerName = game.Players[ownerIndex].Name
+			}
+			result.GameIds = append(result.GameIds, game.Id)
+			result.Names = append(result.Names, game.Name)
+			result.PlayerCounts = append(result.PlayerCounts, uint16(len(game.Players)))
+			result.OwnerNames = append(result.OwnerNames, ownerName)
+		}
+		game.mutex.Unlock()
+	}
+	ss.mutex.Unlock()
+	return result
+}
+
 func (ss *ServerState) Shutdown() {
-	notifyBuffer, _ := WriteCommandHeader(CMD_NOTIFY_SERVER_SHUTDOWN, 0)
+	notifyBuffer, _ := protocol.WriteCommandHeader(protocol.CMD_NOTIFY_SERVER_SHUTDOWN, 0)
 	ss.mutex.Lock()
-	for _, player := range ss.allPlayers {
-		player.SendCommandBuffer(notifyBuffer)
-		player.Conn.Close()
+	players := ss.allPlayers
+	ss.allPlayers = make([]*PlayerState, 0)
+	for _, game := range ss.allGames {
+		game.mutex.Lock()
+		game.closeReplay()
+		game.mutex.Unlock()
 	}
-	ss.allPlayers = ss.allPlayers[:0]
 	ss.allGames = ss.allGames[:0]
 	ss.mutex.Unlock()
+
+	for _, player := range players {
+		player.SendCommandBuffer(notifyBuffer)
+		player.CloseConnection()
+	}
+
+	// Give every player a chance to receive the shutdown notification before the server exits
+	deadline := time.Now().Add(ShutdownFlushTimeout)
+	for _, player := range players {
+		if !player.currentSendQueue().Wait(time.Until(deadline)) {
+			break
+		}
+	}
+}
+
+// Sends the given text to every player connected to the server, whether or not they are in a game
+func (ss *ServerState) BroadcastMessage(message string) error {
+	ss.mutex.Lock()
+	players := make([]*PlayerState, len(ss.allPlayers))
+	copy(players, ss.allPlayers)
+	ss.mutex.Unlock()
+	return sendServerMessage(players, message)
+}
+
+// Sends the given text from the server to each of the given players (other than bots and disconnected players)
+func sendServerMessage(players []*PlayerState, message string) error {
+	notifyCmd := protocol.NotifyServerMessageCommand{Message: message}
+	notifyBuffer, headerLen := protocol.WriteCommandHeader(protocol.CMD_NOTIFY_SERVER_MESSAGE, uint16(notifyCmd.CommandLength()))
+	err := protocol.SerialiseNotifyServerMessageCommand(notifyBuffer[headerLen:], &notifyCmd, false)
+	if err != nil {
+		return err
+	}
+
+	for _, player := range players {
+		if player.IsBot || player.IsDisconnected() {
+			continue
+		}
+		err = player.SendCommandBuffer(notifyBuffer)
+		if err != nil {
+			playerLog(player).Errorf("Failed to send server message: %s", err)
+		}
+	}
+	return nil
+}
+
+func (ss *ServerState) StartDraining() {
+	ss.mutex.Lock()
+	ss.draining = true
+	ss.mutex.Unlock()
+}
+
+func (ss *ServerState) IsDraining() bool {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	return ss.draining
+}
+
+// Returns the number of games that have at least one player in them who is not a bot
+func (ss *ServerState) ActiveGameCount() int {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	result := 0
+	for _, game := range ss.allGames {
+		game.mutex.Lock()
+		for _, player := range game.Players {
+			if !player.IsBot {
+				result++
+				break
+			}
+		}
+		game.mutex.Unlock()
+	}
+	return result
 }
 
 func serverReadConsoleInput(cmdChan chan string) {
-	fmt.Println("Reading input from stdin...")
+	serverLog.Infof("Reading input from stdin...")
 	stdInRead := bufio.NewReader(os.Stdin)
 	for {
 		inputLine, err := stdInRead.ReadString('\n')
 		if err != nil {
-			fmt.Println("Failed to read from stdin: ", err)
+			serverLog.Errorf("Failed to read from stdin: %s", err)
 			return
 		}
 
@@ -135,733 +444,3107 @@ func serverReadConsoleInput(cmdChan chan string) {
 	}
 }
 
+// Returns the network to listen on for the given address, along with the address with the default port added if it does
+// not already have one. Addresses with an explicit IP only listen on that IP's version, so that (for example) "0.0.0.0"
+// and "::" can both be given without the IPv6 listener also trying to take the IPv4 connections.
+func parseListenAddress(address string) (string, string) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		host = strings.TrimSuffix(strings.TrimPrefix(address, "["), "]")
+		port = DefaultListenPort
+	}
+	network := "tcp"
+	if ip := net.ParseIP(host); ip != nil {
+		if ip.To4() != nil {
+			network = "tcp4"
+		} else {
+			network = "tcp6"
+		}
+	}
+	return network, net.JoinHostPort(host, port)
+}
+
+// Starts listening on every one of the given addresses. If any of them fail then none of them are left open.
+func listenOnAddresses(addresses []string) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, len(addresses))
+	for _, address := range addresses {
+		network, fullAddress := parseListenAddress(address)
+		listener, err := net.Listen(network, fullAddress)
+		if err == nil {
+			listeners = append(listeners, listener)
+			continue
+		}
+
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		return nil, fmt.Errorf("failed to listen on '%s': %w", address, err)
+	}
+	return listeners, nil
+}
+
 func serverListenForConnections(listener net.Listener, server *ServerState) {
-	fmt.Println("Listening for new connections...")
+	serverLog.Infof("Listening for new connections on %s", listener.Addr())
+	server.listenerStarted()
+	defer server.listenerStopped()
 	for {
 		newConn, err := listener.Accept()
 		if err != nil {
-			fmt.Println("Error while accepting connection: ", err)
+			serverLog.Errorf("Error while accepting connection on %s: %s", listener.Addr(), err)
 			return
 		}
 
-		fmt.Printf("Received connection from %s\n", newConn.RemoteAddr().String())
-		go runServerPlayer(server, newConn)
+		serverLog.Infof("Received connection from %s", newConn.RemoteAddr().String())
+		go handleNewConnection(server, newConn)
 	}
 }
 
-func runServerPlayer(server *ServerState, playerConn net.Conn) {
-	var player *PlayerState = nil
+// Handles commands from a new connection (over any transport) until it is closed
+func handleNewConnection(server *ServerState, conn net.Conn) {
+	ip := connectionIP(conn)
+	if !server.acquireConnection(ip) {
+		serverLog.Warnf("Refused connection from %s, which already has the maximum of %d connections", ip, server.config.MaxConnectionsPerIP)
+		sendInputErrorTo(conn, protocol.CMD_HANDSHAKE, protocol.ERROR_RATE_LIMITED)
+		conn.Close()
+		return
+	}
+	// Clients can choose to send commands as JSON (see JSONConn) by starting with a '{' instead of a binary command
+	playerConn, err := protocol.DetectProtocol(conn, server.config.KeepAliveTimeout)
+	if err != nil {
+		serverLog.Warnf("Nothing was received from %s: %s", ip, err)
+		conn.Close()
+		server.releaseConnection(ip)
+		return
+	}
+	runServerPlayer(server, playerConn, nil)
+	server.releaseConnection(ip)
+}
+
+// Handles commands from the given connection. Players connecting over the network start without a player, which is
+// created by their handshake, but server-controlled players (bots) are given one that has already joined a game.
+func runServerPlayer(server *ServerState, playerConn net.Conn, player *PlayerState) {
 	playerName := "UNKNOWN - Awaiting handshake"
+	if player != nil {
+		playerName = player.Name
+	}
+	connectionClosedByPlayer := false
+
+	// The snapshot taken before the undoable command that is being run (see TakeSnapshot), and the game it was taken of.
+	// If the connection is dropped part way through the command then the snapshot is discarded here instead of pushed.
+	var undoGame *GameState
+	var undoSnapshot *GameSnapshot
+	defer func() {
+		if undoSnapshot != nil {
+			undoGame.DiscardUndoSnapshot(undoSnapshot)
+		}
+	}()
+
+	var commandLimiter *RateLimiter
+	if (server.config.MaxCommandsPerSecond > 0) && ((player == nil) || !player.IsBot) {
+		commandLimiter = NewRateLimiter(server.config.MaxCommandsPerSecond, CommandBurstSeconds)
+	}
 
 	for {
-		headerBytes, err := ReadExactlyNBytes(playerConn, CommandHeaderLength)
-		if err != nil {
-			fmt.Printf("Error: Failed to read command header from player '%s': %s\n", playerName, err)
+		// Clients send keep-alives while they are idle, so a connection that stays silent for too long has probably died.
+		// Bots are driven by the server itself and never send them.
+		keepAliveTimeout := server.config.KeepAliveTimeout
+		if (keepAliveTimeout > 0) && ((player == nil) || !player.IsBot) {
+			playerConn.SetReadDeadline(time.Now().Add(keepAliveTimeout))
+		}
+
+		headerBytes, err := protocol.ReadExactlyNBytes(playerConn, protocol.CommandHeaderLength)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			playerLog(player).Warnf("Nothing received from player '%s' for %s, dropping their connection", playerName, keepAliveTimeout)
+			break
+		} else if err != nil {
+			playerLog(player).Errorf("Failed to read command header from player '%s': %s", playerName, err)
 			break
 		}
 
-		var cmdHeader CommandHeader
-		err = SerialiseCommandHeader(headerBytes, &cmdHeader, true)
+		var cmdHeader protocol.CommandHeader
+		err = protocol.SerialiseCommandHeader(headerBytes, &cmdHeader, true)
 		if err != nil {
-			fmt.Printf("Error: Failed to deserialise command header from player '%s': %s\n", playerName, err)
+			playerLog(player).Errorf("Failed to deserialise command header from player '%s': %s", playerName, err)
 			break
 		}
 
-		err = ValidateCommandHeader(cmdHeader)
+		err = protocol.ValidateCommandHeader(cmdHeader)
 		if err != nil {
-			fmt.Printf("ERROR: Invalid command header {id=%d,len=%d} received from player '%s': %s\n",
-				cmdHeader.id, cmdHeader.len, playerName, err)
+			playerLog(player).Errorf("Invalid command header {id=%d,len=%d} received from player '%s': %s",
+				cmdHeader.Id, cmdHeader.Len, playerName, err)
+			// We can't tell where the next command would start, so there's no way to carry on reading from them
+			errorCode := protocol.ERROR_INVALID_DATA
+			if errors.Is(err, protocol.ErrInvalidHeader) {
+				errorCode = protocol.ERROR_INVALID_CMD_ID
+			}
+			if player != nil {
+				sendInputError(player, cmdHeader.Id, errorCode)
+			} else {
+				sendInputErrorTo(playerConn, cmdHeader.Id, errorCode)
+			}
+			connectionClosedByPlayer = true
 			break
 		}
 
-		cmdBuffer, err := ReadExactlyNBytes(playerConn, cmdHeader.len)
+		cmdBuffer, err := protocol.ReadExactlyNBytes(playerConn, cmdHeader.Len)
 		if err != nil {
-			fmt.Printf("ERROR: Failed to read command buffer of length %d for command %d from player '%s': %s\n",
-				cmdHeader.len, cmdHeader.id, playerName, err)
+			playerLog(player).Errorf("Failed to read command buffer of length %d for command %d from player '%s': %s",
+				cmdHeader.Len, cmdHeader.Id, playerName, err)
+			break
+		}
+
+		if (commandLimiter != nil) && !commandLimiter.Allow() {
+			playerLog(player).Warnf("Player '%s' sent more than %d commands per second, disconnecting...", playerName, server.config.MaxCommandsPerSecond)
+			if player != nil {
+				sendInputError(player, cmdHeader.Id, protocol.ERROR_RATE_LIMITED)
+			} else {
+				sendInputErrorTo(playerConn, cmdHeader.Id, protocol.ERROR_RATE_LIMITED)
+			}
+			// Don't keep their place in the game for them to reconnect, they'll just do the same thing again
+			connectionClosedByPlayer = true
+			break
+		}
+
+		if (player == nil) && isRelayCommand(cmdHeader.Id) {
+			// The connection is used to relay another server's commands from now on, rather than for a player here
+			server.handleRelayConnection(playerConn, cmdHeader, cmdBuffer)
+			connectionClosedByPlayer = true
 			break
 		}
 
 		wantsToCloseConnection := false
 		if player == nil {
-			if cmdHeader.id != CMD_HANDSHAKE {
-				fmt.Printf("Connection from %s sent command ID %d first instead of a handshake, disconnecting...\n", playerConn.RemoteAddr().String(), cmdHeader.id)
+			if cmdHeader.Id != protocol.CMD_HANDSHAKE {
+				playerLog(player).Warnf("Connection from %s sent command ID %d first instead of a handshake, disconnecting...", playerConn.RemoteAddr().String(), cmdHeader.Id)
 				break
 			} else {
-				var cmd HandshakeCommand
-				err = SerialiseHandshakeCommand(cmdBuffer, &cmd, true)
+				var cmd protocol.HandshakeCommand
+				err = protocol.SerialiseHandshakeCommand(cmdBuffer, &cmd, true)
 				if err != nil {
-					fmt.Printf("Error! Failed to deserialise handshake command %+v: %s\n", cmdBuffer, err)
+					playerLog(player).Errorf("Failed to deserialise handshake command %+v: %s", cmdBuffer, err)
 					break
 				}
 
-				if (cmd.magicNumber != PROTOCOL_MAGIC_NUMBER) || (cmd.protocolId != PROTOCOL_ID) {
-					fmt.Printf("Connection from %s sent invalid handshake, disconnecting...\n", playerConn.RemoteAddr().String())
+				if (cmd.MagicNumber != protocol.PROTOCOL_MAGIC_NUMBER) || (cmd.ProtocolId != protocol.PROTOCOL_ID) {
+					playerLog(player).Warnf("Connection from %s sent invalid handshake, disconnecting...", playerConn.RemoteAddr().String())
 					break
 				} else {
-					playerName = cmd.localName
-					player = server.AddPlayer(playerConn, playerName)
-					if player == nil {
-						fmt.Println("Failed to add new player to the server. The server is full")
-						sendInputErrorTo(playerConn, cmdHeader.id, ERROR_SERVER_FULL)
-						break
+					identityToken := cmd.IdentityToken
+					identityId := server.verifyIdentityToken(identityToken)
+					if identityId == 0 {
+						if len(identityToken) > 0 {
+							serverLog.Warnf("Connection from %s sent an identity token that was not issued by this server, giving them a new identity", playerConn.RemoteAddr())
+						}
+						identityId, identityToken = server.newIdentityToken()
 					}
 
-					if (len(playerName) > MaxPlayerNameLength) || (strings.ContainsAny(playerName, " \t\n\r")) {
-						fmt.Printf("Player attempted to join with invalid name '%s'. Rejecting...\n", playerName)
-						sendInputError(player, cmdHeader.id, ERROR_INVALID_PLAYER_NAME)
-						break
+					resumed := false
+					if cmd.ResumeToken != 0 {
+						player = server.ResumePlayer(cmd.ResumeToken, identityId, playerConn)
+						resumed = (player != nil)
 					}
-					fmt.Printf("Received player name from %s - %s\n", playerConn.RemoteAddr(), playerName)
 
-					response := HandshakeResponseCommand{
-						player.Id,
+					if resumed {
+						playerName = player.Name
+						playerLog(player).Infof("Player %s reconnected from %s", playerName, playerConn.RemoteAddr())
+					} else {
+						playerName = cmd.LocalName
+						player = server.AddPlayer(playerConn, playerName, false)
+						if player == nil {
+							serverLog.Warnf("Failed to add new player to the server. The server is full")
+							sendInputErrorTo(playerConn, cmdHeader.Id, protocol.ERROR_SERVER_FULL)
+							break
+						}
+						player.IdentityId = identityId
+
+						if !protocol.IsValidPlayerName(playerName) {
+							playerLog(player).Warnf("Player attempted to join with invalid name '%s'. Rejecting...", playerName)
+							sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_NAME)
+							break
+						}
+						playerLog(player).Infof("Received player name from %s - %s (identity %d)", playerConn.RemoteAddr(), playerName, identityId)
+					}
+
+					response := protocol.HandshakeResponseCommand{
+						PlayerId:      player.Id,
+						ResumeToken:   player.ResumeToken,
+						IdentityToken: identityToken,
+						Compression:   protocol.ChooseCompression(cmd.CompressionMethods),
 					}
-					respBuffer, respHeaderLen := WriteCommandHeader(CMD_HANDSHAKE_RESPONSE, HandshakeResponseCommandLength)
-					err = SerialiseHandshakeResponseCommand(respBuffer[respHeaderLen:], &response, false)
+					respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_HANDSHAKE_RESPONSE, protocol.HandshakeResponseCommandLength)
+					err = protocol.SerialiseHandshakeResponseCommand(respBuffer[respHeaderLen:], &response, false)
 					if err != nil {
-						fmt.Printf("Error! Failed to serialise handshake command %+v: %s\n", response, err)
+						playerLog(player).Errorf("Failed to serialise handshake command %+v: %s", response, err)
 						break
 					}
 					err = player.SendCommandBuffer(respBuffer)
 					if err != nil {
-						fmt.Printf("Error! Failed to send response for command %d to player %d: %s\n", cmdHeader.id, player.Id, err)
+						playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
+					}
+					sendQueue := player.currentSendQueue()
+					sendQueue.SetCompression(response.Compression)
+					sendQueue.EnableBatching()
+
+					if resumed && player.InGame() {
+						err = sendGameJoinedState(player)
+						if err != nil {
+							playerLog(player).Errorf("Failed to send the game state to resumed player %d: %s", player.Id, err)
+						}
+
+						notifyAction := protocol.NewPlayerActionNotify(player.Id, protocol.CMD_GAME_RESUME, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+						notifyAction.TargetStrings = []string{RESUME_STATUS_RESUMED}
+						err = player.CurrentGame.BroadcastNotification(notifyAction)
+						if err != nil {
+							playerLog(player).Errorf("Failed to broadcast resume notification: %s", err)
+						}
 					}
 				}
 			}
 
 		} else if player.InGame() {
 			game := player.CurrentGame
-			switch cmdHeader.id {
-			case CMD_KEEPALIVE:
+			if (cmdHeader.Id != protocol.CMD_KEEPALIVE) && !player.IsBot {
+				game.markActive()
+			}
+			if isUndoableCommand(cmdHeader.Id) {
+				undoGame = game
+				undoSnapshot = game.TakeSnapshot()
+			}
+			topCardBefore := game.FaceUpTopCard()
+
+			switch cmdHeader.Id {
+			case protocol.CMD_KEEPALIVE:
 				// Do nothing
 
-			case CMD_INFO_PLAYERS:
-				fmt.Printf("Show player info\n")
+			case protocol.CMD_INFO_PLAYERS:
+				playerLog(player).Debugf("Show player info")
 				game.mutex.Lock()
 				playerIds := make([]uint64, 0, len(game.Players))
 				playerNames := make([]string, 0, len(game.Players))
 				handSizes := make([]uint16, 0, len(game.Players))
+				handRevealed := make([]bool, 0, len(game.Players))
+				revealedHands := make([][]uint16, 0, len(game.Players))
 				for _, p := range game.Players {
 					playerIds = append(playerIds, p.Id)
 					playerNames = append(playerNames, p.Name)
 					handSizes = append(handSizes, uint16(len(p.Hand)))
+					handRevealed = append(handRevealed, p.HandRevealed)
+					if p.HandRevealed {
+						hand := make([]uint16, len(p.Hand))
+						copy(hand, p.Hand)
+						revealedHands = append(revealedHands, hand)
+					} else {
+						revealedHands = append(revealedHands, copyCardIds(p.FaceUpCards))
+					}
 				}
 				game.mutex.Unlock()
 
-				respCmd := PlayerInfoResponseCommand{
-					playerIds,
-					playerNames,
-					handSizes,
+				respCmd := protocol.PlayerInfoResponseCommand{
+					Ids:           playerIds,
+					Names:         playerNames,
+					HandSizes:     handSizes,
+					HandRevealed:  handRevealed,
+					RevealedHands: revealedHands,
 				}
-				respBuffer, respHeaderLen := WriteCommandHeader(CMD_INFO_PLAYERS_RESPONSE, uint16(respCmd.CommandLength()))
-				err = SerialisePlayerInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_PLAYERS_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialisePlayerInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				if err != nil {
-					fmt.Printf("Error! Failed to serialise player info command %+v: %s\n", respCmd, err)
+					playerLog(player).Errorf("Failed to serialise player info command %+v: %s", respCmd, err)
 					break
 				}
-				fmt.Printf("Send players response: %+v = %+v\n", respCmd, respBuffer)
+				playerLog(player).Debugf("Send players response: %+v = %+v", respCmd, respBuffer)
 				err = player.SendCommandBuffer(respBuffer)
 				if err != nil {
-					fmt.Printf("Error! Failed to send response for command %d to player %d: %s\n", cmdHeader.id, player.Id, err)
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
 
-			case CMD_INFO_DECKS:
-				fmt.Printf("Show deck info\n")
+			case protocol.CMD_INFO_DECKS:
+				playerLog(player).Debugf("Show deck info")
 				game.mutex.Lock()
-				respCmd := DeckInfoResponseCommand{
-					[]uint16{0},
-					[]uint16{uint16(len(game.Deck))},
+				respCmd := protocol.DeckInfoResponseCommand{
+					Ids:        make([]uint16, len(game.Decks)),
+					CardCounts: game.deckSizes(),
+					TopCardIds: makeFilledIdSlice(len(game.Decks), protocol.CARD_ID_NONE),
+				}
+				for deckId := range game.Decks {
+					respCmd.Ids[deckId] = uint16(deckId)
 				}
 				game.mutex.Unlock()
-				respBuffer, respHeaderLen := WriteCommandHeader(CMD_INFO_DECKS_RESPONSE, uint16(respCmd.CommandLength()))
-				err = SerialiseDeckInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				respCmd.TopCardIds[0] = game.FaceUpTopCard()
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_DECKS_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseDeckInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				if err != nil {
-					fmt.Printf("Error! Failed to serialise deck info command %+v: %s\n", respCmd, err)
+					playerLog(player).Errorf("Failed to serialise deck info command %+v: %s", respCmd, err)
 					break
 				}
 				err = player.SendCommandBuffer(respBuffer)
 				if err != nil {
-					fmt.Printf("Error! Failed to send response for command %d to player %d: %s\n", cmdHeader.id, player.Id, err)
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
 
-			case CMD_INFO_CARDS:
-				fmt.Printf("Show card info\n")
+			case protocol.CMD_INFO_CARDS:
+				playerLog(player).Debugf("Show card info")
 				game.mutex.Lock()
-				respCmd := CardInfoResponseCommand{
-					player.Hand,
+				respCmd := protocol.CardInfoResponseCommand{
+					Ids:       player.Hand,
+					FaceUpIds: player.FaceUpCards,
 				}
-				respBuffer, respHeaderLen := WriteCommandHeader(CMD_INFO_CARDS_RESPONSE, uint16(respCmd.CommandLength()))
-				err = SerialiseCardInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_CARDS_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseCardInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				if err != nil {
-					fmt.Printf("Error! Failed to serialise card info command %+v: %s\n", respCmd, err)
+					playerLog(player).Errorf("Failed to serialise card info command %+v: %s", respCmd, err)
 					break
 				}
 				game.mutex.Unlock()
 
 				err = player.SendCommandBuffer(respBuffer)
 				if err != nil {
-					fmt.Printf("Error! Failed to send response for command %d to player %d: %s\n", cmdHeader.id, player.Id, err)
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
 
-			case CMD_CARD_DRAW:
-				var cmd CardDrawCommand
-				err := SerialiseCardDrawCommand(cmdBuffer, &cmd, true)
+			case protocol.CMD_INFO_DISCARDS:
+				playerLog(player).Debugf("Show discard pile info")
+				respCmd := protocol.CardInfoResponseCommand{
+					Ids:       game.VisibleDiscardPile(),
+					FaceUpIds: nil,
+				}
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_DISCARDS_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseCardInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				if err != nil {
-					fmt.Printf("Error: Failed to serialise command body of command %d from player '%s': %s", cmdHeader.id, playerName, err)
-					server.RemovePlayer(player.Id)
-					return
+					playerLog(player).Errorf("Failed to serialise discard pile info command %+v: %s", respCmd, err)
+					break
+				}
+				err = player.SendCommandBuffer(respBuffer)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
-				fmt.Printf("Draw %d cards from deck %d\n", cmd.count, cmd.deckId)
 
-				newCards := game.Draw(cmd.deckId, int(cmd.count))
+			case protocol.CMD_INFO_TABLE:
+				playerLog(player).Debugf("Show table info")
 				game.mutex.Lock()
-				for _, newCard := range newCards {
-					player.Draw(newCard)
+				respCmd := protocol.CardInfoResponseCommand{
+					Ids:       game.Table,
+					FaceUpIds: nil,
 				}
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_TABLE_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseCardInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				game.mutex.Unlock()
-
-				publicNotifyCards := newCards
-				if !cmd.faceUp {
-					publicNotifyCards = makeFilledIdSlice(len(newCards), CARD_ID_ANY)
-				}
-				notifyAction := NewPlayerActionNotify(player.Id, cmdHeader.id, cmd.deckId, PLAYER_ID_NONE, publicNotifyCards)
-				err = game.BroadcastNotification(notifyAction)
-				if err != nil {
-					fmt.Printf("ERROR: Failed to broadcast draw command notification to all players: %s\n", err)
-				}
-
-				notifyAction = NewPlayerActionNotify(player.Id, cmdHeader.id, cmd.deckId, player.Id, newCards)
-				err = game.SendNotificationToTargetPlayer(notifyAction)
 				if err != nil {
-					fmt.Printf("ERROR: Failed to broadcast draw command notification to the drawing player: %s\n", err)
+					playerLog(player).Errorf("Failed to serialise table info command %+v: %s", respCmd, err)
+					break
 				}
-
-			case CMD_CARD_SHOW:
-				var cmd CardShowCommand
-				err := SerialiseCardShowCommand(cmdBuffer, &cmd, true)
+				err = player.SendCommandBuffer(respBuffer)
 				if err != nil {
-					fmt.Printf("Error: Failed to read command %d body from player '%s': %s\n", cmdHeader.id, playerName, err)
-					server.RemovePlayer(player.Id)
-					return
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
-				fmt.Printf("Show card %d to player %d\n", cmd.cardId, cmd.playerId)
 
+			case protocol.CMD_INFO_MARKET:
+				playerLog(player).Debugf("Show market info")
 				game.mutex.Lock()
-				var cardIndex int
-				cardIndex = game.FindCard(player, cmd.cardId)
-				targetPlayerIndex := game.FindPlayer(cmd.playerId)
-				var targetPlayer *PlayerState = nil
-				if targetPlayerIndex >= 0 {
-					targetPlayer = game.Players[targetPlayerIndex]
+				respCmd := protocol.CardInfoResponseCommand{
+					Ids:       game.Market,
+					FaceUpIds: nil,
 				}
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_MARKET_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseCardInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				game.mutex.Unlock()
-
-				if (cardIndex < 0) && (cmd.cardId != CARD_ID_ALL) {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_CARD_ID)
-					break
-				} else if (targetPlayerIndex < 0) && (cmd.playerId != PLAYER_ID_ANY) && (cmd.playerId != PLAYER_ID_ALL) {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_PLAYER_ID)
+				if err != nil {
+					playerLog(player).Errorf("Failed to serialise market info command %+v: %s", respCmd, err)
 					break
 				}
-
-				var visibleCardSlice []uint16
-				if cmd.cardId == CARD_ID_ALL {
-					visibleCardSlice = player.Hand
-				} else {
-					visibleCardSlice = []uint16{player.Hand[cardIndex]}
+				err = player.SendCommandBuffer(respBuffer)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
 
-				notifyAction := NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, targetPlayer.Id, visibleCardSlice)
-				err = game.SendNotificationToSourcePlayer(notifyAction)
-				if err != nil {
-					fmt.Printf("Error! Failed to send card show notification to source player: %s\n", err)
+			case protocol.CMD_INFO_CARD_TYPES:
+				playerLog(player).Debugf("Show card type info")
+				types, deckCounts := game.DeckTypeCounts()
+				respCmd := protocol.CardTypeInfoResponseCommand{
+					Types:      types,
+					DeckCounts: deckCounts,
 				}
-				err = game.SendNotificationToTargetPlayer(notifyAction)
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_CARD_TYPES_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseCardTypeInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				if err != nil {
-					fmt.Printf("Error! Failed to send card show notification to target player: %s\n", err)
-				}
-
-				if cmd.playerId == PLAYER_ID_ALL {
-					err = game.BroadcastNotification(notifyAction)
-					if err != nil {
-						fmt.Printf("ERROR: Failed to broadcast card show notification: %s\n", err)
-					}
-				} else {
-					hiddenCardSlice := makeFilledIdSlice(len(visibleCardSlice), CARD_ID_ANY)
-					notifyAction = NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, targetPlayer.Id, hiddenCardSlice)
-					err = game.BroadcastNotification(notifyAction)
-					if err != nil {
-						fmt.Printf("ERROR: Failed to broadcast anonymised card show notification: %s\n", err)
-					}
+					playerLog(player).Errorf("Failed to serialise card type info command %+v: %s", respCmd, err)
+					break
 				}
-
-			case CMD_CARD_PUTBACK:
-				var cmd CardPutbackCommand
-				err := SerialiseCardPutbackCommand(cmdBuffer, &cmd, true)
+				err = player.SendCommandBuffer(respBuffer)
 				if err != nil {
-					fmt.Printf("Error: Failed to read command %d body from player '%s': %s\n", cmdHeader.id, playerName, err)
-					server.RemovePlayer(player.Id)
-					return
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
-				fmt.Printf("Received putback: %+v\n", cmd)
-				fmt.Printf("Put card %d back onto deck %d, %d cards from the top\n", cmd.cardId, cmd.deckId, cmd.cardsFromTop)
 
+			case protocol.CMD_INFO_ROLE:
+				playerLog(player).Debugf("Show role info")
 				game.mutex.Lock()
-				cardIndex := game.FindCard(player, cmd.cardId)
-				deckIndex := game.FindDeck(cmd.deckId)
-				if cardIndex < 0 {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_CARD_ID)
-					break
+				respCmd := protocol.CardInfoResponseCommand{
+					Ids:       make([]uint16, 0, 1),
+					FaceUpIds: nil,
 				}
-				if deckIndex < 0 {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_DECK_ID)
-					break
+				if roleCardId, hasRole := game.Roles[player.Id]; hasRole {
+					respCmd.Ids = append(respCmd.Ids, roleCardId)
 				}
-				if (cmd.cardsFromTop < 0) || (int(cmd.cardsFromTop) > len(game.Deck)) {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_DATA)
+				game.mutex.Unlock()
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_ROLE_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseCardInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				if err != nil {
+					playerLog(player).Errorf("Failed to serialise role info command %+v: %s", respCmd, err)
 					break
 				}
+				err = player.SendCommandBuffer(respBuffer)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
+				}
 
-				cardIndexInDeck := len(game.Deck) - int(cmd.cardsFromTop)
-				game.Deck = sliceInsert(game.Deck, player.Hand[cardIndex], cardIndexInDeck)
-				player.Discard(cardIndex)
+			case protocol.CMD_INFO_TABLEAUS:
+				playerLog(player).Debugf("Show tableau info")
+				game.mutex.Lock()
+				respCmd := protocol.TableauInfoResponseCommand{
+					PlayerIds: make([]uint64, 0, len(game.Players)),
+					CardIds:   make([][]uint16, 0, len(game.Players)),
+				}
+				for _, p := range game.Players {
+					respCmd.PlayerIds = append(respCmd.PlayerIds, p.Id)
+					respCmd.CardIds = append(respCmd.CardIds, p.Tableau)
+				}
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_TABLEAUS_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseTableauInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				game.mutex.Unlock()
-
-				notifyAction := NewPlayerActionNotify(player.Id, cmdHeader.id, cmd.deckId, PLAYER_ID_NONE, []uint16{CARD_ID_ANY})
-				err = game.BroadcastNotification(notifyAction)
 				if err != nil {
-					fmt.Printf("ERROR: Failed to broadcast card putback notification: %s\n", err)
+					playerLog(player).Errorf("Failed to serialise tableau info command %+v: %s", respCmd, err)
+					break
 				}
-				notifyAction = NewPlayerActionNotify(player.Id, cmdHeader.id, cmd.deckId, PLAYER_ID_NONE, []uint16{cmd.cardId})
-				err = game.SendNotificationToSourcePlayer(notifyAction)
+				err = player.SendCommandBuffer(respBuffer)
 				if err != nil {
-					fmt.Printf("ERROR: Failed to send card putback notification to %s: %s\n", player.Name, err)
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
 
-			case CMD_CARD_DISCARD:
-				var cmd CardDiscardCommand
-				err := SerialiseCardDiscardCommand(cmdBuffer, &cmd, true)
-				if err != nil {
-					fmt.Printf("Error: Failed to read command %d body from player '%s': %s", cmdHeader.id, playerName, err)
-					server.RemovePlayer(player.Id)
+			case protocol.CMD_INFO_SCORES:
+				playerLog(player).Debugf("Show score info")
+				respCmd := protocol.ScoreInfoResponseCommand{
+					PlayerNames: make([]string, 0),
+					Values:      make([]int64, 0),
+				}
+				game.mutex.Lock()
+				for _, scores := range game.Scores {
+					for _, roundScore := range scores.Rounds {
+						respCmd.PlayerNames = append(respCmd.PlayerNames, scores.PlayerName)
+						respCmd.Values = append(respCmd.Values, roundScore)
+					}
+				}
+				game.mutex.Unlock()
+
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_SCORES_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseScoreInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				if err != nil {
+					playerLog(player).Errorf("Failed to serialise score info command %+v: %s", respCmd, err)
+					break
+				}
+				err = player.SendCommandBuffer(respBuffer)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
+				}
+
+			case protocol.CMD_INFO_COUNTERS:
+				playerLog(player).Debugf("Show counter info")
+				respCmd := protocol.CounterInfoResponseCommand{
+					PlayerIds:    make([]uint64, 0),
+					CounterNames: make([]string, 0),
+					Values:       make([]int64, 0),
+				}
+				game.mutex.Lock()
+				for _, p := range game.Players {
+					counterNames := make([]string, 0, len(p.Counters))
+					for counterName := range p.Counters {
+						counterNames = append(counterNames, counterName)
+					}
+					sort.Strings(counterNames)
+					for _, counterName := range counterNames {
+						respCmd.PlayerIds = append(respCmd.PlayerIds, p.Id)
+						respCmd.CounterNames = append(respCmd.CounterNames, counterName)
+						respCmd.Values = append(respCmd.Values, p.Counters[counterName])
+					}
+				}
+				game.mutex.Unlock()
+
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_COUNTERS_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseCounterInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				if err != nil {
+					playerLog(player).Errorf("Failed to serialise counter info command %+v: %s", respCmd, err)
+					break
+				}
+				err = player.SendCommandBuffer(respBuffer)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
+				}
+
+			case protocol.CMD_INFO_EVENTS:
+				var cmd protocol.EventInfoCommand
+				err := protocol.SerialiseEventInfoCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Show the last %d game events", cmd.Count)
+
+				events := game.RecentEvents(int(cmd.Count))
+				respCmd := protocol.EventInfoResponseCommand{
+					Timestamps:        make([]uint64, 0, len(events)),
+					PlayerNames:       make([]string, 0, len(events)),
+					TargetPlayerNames: make([]string, 0, len(events)),
+					CmdIds:            make([]byte, 0, len(events)),
+					TargetCardIds:     make([][]uint16, 0, len(events)),
+					TargetStrings:     make([][]string, 0, len(events)),
+				}
+				for _, event := range events {
+					respCmd.Timestamps = append(respCmd.Timestamps, uint64(event.Timestamp.Unix()))
+					respCmd.PlayerNames = append(respCmd.PlayerNames, event.PlayerName)
+					respCmd.TargetPlayerNames = append(respCmd.TargetPlayerNames, event.TargetPlayerName)
+					respCmd.CmdIds = append(respCmd.CmdIds, event.Notify.CmdId)
+					respCmd.TargetCardIds = append(respCmd.TargetCardIds, event.Notify.TargetCardIds)
+					respCmd.TargetStrings = append(respCmd.TargetStrings, event.Notify.TargetStrings)
+				}
+				// Drop the oldest events until the response fits in a single command
+				for respCmd.CommandLength() > protocol.MaxEventInfoResponseCommandLength {
+					respCmd.Timestamps = respCmd.Timestamps[1:]
+					respCmd.PlayerNames = respCmd.PlayerNames[1:]
+					respCmd.TargetPlayerNames = respCmd.TargetPlayerNames[1:]
+					respCmd.CmdIds = respCmd.CmdIds[1:]
+					respCmd.TargetCardIds = respCmd.TargetCardIds[1:]
+					respCmd.TargetStrings = respCmd.TargetStrings[1:]
+				}
+
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_EVENTS_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseEventInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				if err != nil {
+					playerLog(player).Errorf("Failed to serialise event info command %+v: %s", respCmd, err)
+					break
+				}
+				err = player.SendCommandBuffer(respBuffer)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
+				}
+
+			case protocol.CMD_INFO_HISTORY:
+				playerLog(player).Debugf("Show the complete game history")
+				history := game.HistoryForPlayer(player.Id)
+				err := sendGameHistory(player, history)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
+				}
+
+			case protocol.CMD_SYNC_REQUEST:
+				playerLog(player).Debugf("Resend the complete game state")
+				discardIds := game.VisibleDiscardPile()
+				game.mutex.Lock()
+				respCmd := protocol.SyncResponseCommand{
+					OwnerId:      game.OwnerId,
+					TurnPlayerId: game.TurnPlayerId,
+					PlayerIds:    make([]uint64, 0, len(game.Players)),
+					PlayerNames:  make([]string, 0, len(game.Players)),
+					HandSizes:    make([]uint16, 0, len(game.Players)),
+					TableauIds:   make([][]uint16, 0, len(game.Players)),
+					Hand:         player.Hand,
+					FaceUpIds:    player.FaceUpCards,
+					HandRevealed: player.HandRevealed,
+					DeckSizes:    game.deckSizes(),
+					TableIds:     game.Table,
+					DiscardIds:   discardIds,
+					MarketIds:    game.Market,
+				}
+				for _, p := range game.Players {
+					respCmd.PlayerIds = append(respCmd.PlayerIds, p.Id)
+					respCmd.PlayerNames = append(respCmd.PlayerNames, p.Name)
+					respCmd.HandSizes = append(respCmd.HandSizes, uint16(len(p.Hand)))
+					respCmd.TableauIds = append(respCmd.TableauIds, p.Tableau)
+				}
+				respBuffer, err := protocol.BuildCommand(protocol.CMD_SYNC_RESPONSE, &respCmd)
+				game.mutex.Unlock()
+				if err != nil {
+					playerLog(player).Errorf("Failed to serialise sync response command %+v: %s", respCmd, err)
+					break
+				}
+
+				err = player.SendCommandBuffer(respBuffer)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
+				}
+
+			case protocol.CMD_CARD_DRAW:
+				var cmd protocol.CardDrawCommand
+				err := protocol.SerialiseCardDrawCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to serialise command body of command %d from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Draw %d cards from deck %d. Visible to all players? %t", cmd.Count, cmd.DeckId, cmd.FaceUp)
+
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				newCards := game.Draw(cmd.DeckId, int(cmd.Count))
+				game.mutex.Lock()
+				for _, newCard := range newCards {
+					player.Draw(newCard)
+				}
+				game.mutex.Unlock()
+
+				publicNotifyCards := newCards
+				if !cmd.FaceUp {
+					publicNotifyCards = makeFilledIdSlice(len(newCards), protocol.CARD_ID_ANY)
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, publicNotifyCards)
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast draw command notification to all players: %s", err)
+				}
+
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, player.Id, newCards)
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast draw command notification to the drawing player: %s", err)
+				}
+
+			case protocol.CMD_CARD_DRAW_UNTIL_TYPE:
+				var cmd protocol.CardDrawUntilTypeCommand
+				err := protocol.SerialiseCardDrawUntilTypeCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Draw cards from deck %d until one of type '%s' is drawn", cmd.DeckId, cmd.CardType)
+
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				if !game.spec.HasCardType(cmd.CardType) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+				newCards, found := game.DrawUntilType(cmd.DeckId, cmd.CardType)
+				game.mutex.Lock()
+				for _, newCard := range newCards {
+					player.Draw(newCard)
+				}
+				game.mutex.Unlock()
+
+				// Everybody knows what type of card the last one is (if it was found), but not exactly which card it is
+				resultStrings := []string{cmd.CardType, strconv.FormatBool(found)}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, makeFilledIdSlice(len(newCards), protocol.CARD_ID_ANY))
+				notifyAction.TargetStrings = resultStrings
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast draw-until-type notification to all players: %s", err)
+				}
+
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, player.Id, newCards)
+				notifyAction.TargetStrings = resultStrings
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send draw-until-type notification to the drawing player: %s", err)
+				}
+
+			case protocol.CMD_CARD_SHOW:
+				var cmd protocol.CardShowCommand
+				err := protocol.SerialiseCardShowCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Show card %d to player %d, except player %d", cmd.CardId, cmd.PlayerId, cmd.ExceptPlayerId)
+
+				game.mutex.Lock()
+				var cardIndex int
+				cardIndex = game.FindCard(player, cmd.CardId)
+				targetPlayerIndex := game.FindPlayer(cmd.PlayerId)
+				targetPlayerId := cmd.PlayerId
+				if targetPlayerIndex >= 0 {
+					targetPlayerId = game.Players[targetPlayerIndex].Id
+				}
+				exceptPlayerIndex := -1
+				if (cmd.ExceptPlayerId != protocol.PLAYER_ID_NONE) && (cmd.ExceptPlayerId != protocol.PLAYER_ID_ANY) {
+					exceptPlayerIndex = game.FindPlayer(cmd.ExceptPlayerId)
+				}
+				game.mutex.Unlock()
+
+				if (cardIndex < 0) && (cmd.CardId != protocol.CARD_ID_ALL) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					break
+				} else if (targetPlayerIndex < 0) && (cmd.PlayerId != protocol.PLAYER_ID_ANY) && (cmd.PlayerId != protocol.PLAYER_ID_ALL) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					break
+				} else if (cmd.ExceptPlayerId != protocol.PLAYER_ID_NONE) &&
+					((cmd.PlayerId != protocol.PLAYER_ID_ALL) || (exceptPlayerIndex < 0) || (cmd.ExceptPlayerId == player.Id)) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					break
+				}
+
+				var visibleCardSlice []uint16
+				if cmd.CardId == protocol.CARD_ID_ALL {
+					visibleCardSlice = player.Hand
+				} else {
+					visibleCardSlice = []uint16{player.Hand[cardIndex]}
+				}
+
+				if cmd.ExceptPlayerId != protocol.PLAYER_ID_NONE {
+					// The excluded player is the target of the notification so that everyone can see who was left out.
+					// Only they (and the event log) get the hidden version, everybody else sees the cards.
+					hiddenCardSlice := player.MaskHiddenCards(visibleCardSlice)
+					hiddenNotifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, cmd.ExceptPlayerId, hiddenCardSlice)
+					hiddenNotifyAction.TargetStrings = []string{protocol.SHOW_TARGET_EXCEPT}
+					err = game.SendNotificationToTargetPlayer(hiddenNotifyAction)
+					if err != nil {
+						playerLog(player).Errorf("Failed to send card show notification to the excluded player: %s", err)
+					}
+					game.RecordEvent(hiddenNotifyAction)
+
+					notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, cmd.ExceptPlayerId, visibleCardSlice)
+					notifyAction.TargetStrings = []string{protocol.SHOW_TARGET_EXCEPT}
+					game.mutex.Lock()
+					otherPlayerIds := make([]uint64, 0, len(game.Players))
+					for _, otherPlayer := range game.Players {
+						if otherPlayer.Id != cmd.ExceptPlayerId {
+							otherPlayerIds = append(otherPlayerIds, otherPlayer.Id)
+						}
+					}
+					game.mutex.Unlock()
+					for _, otherPlayerId := range otherPlayerIds {
+						err = game.SendNotificationToPlayer(notifyAction, otherPlayerId)
+						if err != nil {
+							playerLog(player).Errorf("Failed to send card show notification to player %d: %s", otherPlayerId, err)
+						}
+					}
+					break
+				}
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayerId, visibleCardSlice)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send card show notification to source player: %s", err)
+				}
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send card show notification to target player: %s", err)
+				}
+
+				if cmd.PlayerId == protocol.PLAYER_ID_ALL {
+					err = game.BroadcastNotification(notifyAction)
+					if err != nil {
+						playerLog(player).Errorf("Failed to broadcast card show notification: %s", err)
+					}
+				} else {
+					hiddenCardSlice := player.MaskHiddenCards(visibleCardSlice)
+					notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayerId, hiddenCardSlice)
+					err = game.BroadcastNotification(notifyAction)
+					if err != nil {
+						playerLog(player).Errorf("Failed to broadcast anonymised card show notification: %s", err)
+					}
+				}
+
+			case protocol.CMD_CARD_PUTBACK:
+				var cmd protocol.CardPutbackCommand
+				err := protocol.SerialiseCardPutbackCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Received putback: %+v", cmd)
+				if cmd.CardsFromTop == protocol.DECK_POSITION_RANDOM {
+					playerLog(player).Debugf("Put card %d back onto deck %d at a random depth. Visible to all players? %t", cmd.CardId, cmd.DeckId, cmd.FaceUp)
+				} else if cmd.CardsFromTop == protocol.DECK_POSITION_BOTTOM {
+					playerLog(player).Debugf("Put card %d back onto the bottom of deck %d. Visible to all players? %t", cmd.CardId, cmd.DeckId, cmd.FaceUp)
+				} else {
+					playerLog(player).Debugf("Put card %d back onto deck %d, %d cards from the top. Visible to all players? %t", cmd.CardId, cmd.DeckId, cmd.CardsFromTop, cmd.FaceUp)
+				}
+
+				game.mutex.Lock()
+				cardIndex := game.FindCard(player, cmd.CardId)
+				deckIndex := game.FindDeck(cmd.DeckId)
+				if cardIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				if deckIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					game.mutex.Unlock()
+					break
+				}
+				deck := game.Decks[deckIndex]
+				var positionStrings []string
+				if cmd.CardsFromTop == protocol.DECK_POSITION_RANDOM {
+					cmd.CardsFromTop = uint16(game.rng.Intn(len(deck) + 1))
+					positionStrings = []string{protocol.PUTBACK_POSITION_RANDOM}
+				} else if cmd.CardsFromTop == protocol.DECK_POSITION_BOTTOM {
+					cmd.CardsFromTop = uint16(len(deck))
+					positionStrings = []string{protocol.PUTBACK_POSITION_BOTTOM}
+				}
+				if (cmd.CardsFromTop < 0) || (int(cmd.CardsFromTop) > len(deck)) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					game.mutex.Unlock()
+					break
+				}
+
+				cardIndexInDeck := len(deck) - int(cmd.CardsFromTop)
+				game.Decks[deckIndex] = sliceInsert(deck, player.Hand[cardIndex], cardIndexInDeck)
+				player.Discard(cardIndex)
+				game.mutex.Unlock()
+
+				displayedCardId := cmd.CardId
+				if !cmd.FaceUp {
+					displayedCardId = protocol.CARD_ID_ANY
+				}
+				// Nobody (not even the player putting the card back) gets told where a randomly-placed card ended up
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, []uint16{displayedCardId})
+				notifyAction.TargetStrings = positionStrings
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast card putback notification: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, []uint16{cmd.CardId})
+				notifyAction.TargetStrings = positionStrings
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send card putback notification to %s: %s", player.Name, err)
+				}
+
+			case protocol.CMD_CARD_DISCARD:
+				var cmd protocol.CardDiscardCommand
+				err := protocol.SerialiseCardDiscardCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Discard card %d. Face up? %t", cmd.CardId, cmd.FaceUp)
+
+				game.mutex.Lock()
+				cardIndex := game.FindCard(player, cmd.CardId)
+				if cardIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				cardId := player.Hand[cardIndex]
+				player.Discard(cardIndex)
+				game.AddToDiscardPile(cardId, cmd.FaceUp)
+				game.mutex.Unlock()
+
+				displayedCardId := cardId
+				if !cmd.FaceUp {
+					displayedCardId = protocol.CARD_ID_ANY
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{displayedCardId})
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast card discard notification: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{cardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send card discard notification: %s", err)
+				}
+
+			case protocol.CMD_CARD_DISCARD_TYPE:
+				var cmd protocol.CardDiscardTypeCommand
+				err := protocol.SerialiseCardDiscardTypeCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Discard all cards of type '%s'. Face up? %t", cmd.CardType, cmd.FaceUp)
+
+				if !game.spec.HasCardType(cmd.CardType) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+				game.mutex.Lock()
+				discardedCards := make([]uint16, 0)
+				// Go backwards so that removing a card never moves one that hasn't been checked yet
+				for cardIndex := len(player.Hand) - 1; cardIndex >= 0; cardIndex-- {
+					cardId := player.Hand[cardIndex]
+					if game.spec.IsCardOfType(cardId, cmd.CardType) {
+						player.Discard(cardIndex)
+						game.AddToDiscardPile(cardId, cmd.FaceUp)
+						discardedCards = append(discardedCards, cardId)
+					}
+				}
+				game.mutex.Unlock()
+				if len(discardedCards) == 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					break
+				}
+
+				publicCards := discardedCards
+				if !cmd.FaceUp {
+					publicCards = makeFilledIdSlice(len(discardedCards), protocol.CARD_ID_ANY)
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, publicCards)
+				notifyAction.TargetStrings = []string{cmd.CardType}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast discard-type notification: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, discardedCards)
+				notifyAction.TargetStrings = []string{cmd.CardType}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send discard-type notification: %s", err)
+				}
+
+			case protocol.CMD_CARD_GIVE:
+				var cmd protocol.CardGiveCommand
+				err := protocol.SerialiseCardGiveCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Give card %d to player %d. Visible to all players? %t", cmd.CardId, cmd.PlayerId, cmd.FaceUp)
+
+				if player.Id == cmd.PlayerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					break
+				}
+
+				game.mutex.Lock()
+				cardIndex := game.FindCard(player, cmd.CardId)
+				playerIndex := game.FindPlayer(cmd.PlayerId)
+				if cardIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				if playerIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					game.mutex.Unlock()
+					break
+				}
+				targetPlayer := game.Players[playerIndex]
+				targetPlayer.Hand = append(targetPlayer.Hand, player.Hand[cardIndex])
+				player.Discard(cardIndex)
+				game.mutex.Unlock()
+
+				displayedCardId := cmd.CardId
+				if !cmd.FaceUp {
+					displayedCardId = protocol.CARD_ID_ANY
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, cmd.PlayerId, []uint16{cmd.CardId})
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send card give notification to source player: %s", err)
+				}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send card give notification to target player: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, cmd.PlayerId, []uint16{displayedCardId})
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast card give notification: %s", err)
+				}
+
+			case protocol.CMD_CARD_PICKUP:
+				var cmd protocol.CardPickupCommand
+				err := protocol.SerialiseCardPickupCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Pick up card %d from the discard pile. Search? %t", cmd.CardId, cmd.Search)
+
+				if cmd.Search && !game.spec.DiscardPileSearchable {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				game.mutex.Lock()
+				discardIndex := game.FindDiscardedCard(cmd.CardId, cmd.Search)
+				if discardIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				pickedUpCard := game.DiscardPile[discardIndex]
+				game.DiscardPile = append(game.DiscardPile[:discardIndex], game.DiscardPile[discardIndex+1:]...)
+				player.Draw(pickedUpCard.CardId)
+				game.mutex.Unlock()
+
+				displayedCardId := pickedUpCard.CardId
+				if !pickedUpCard.FaceUp {
+					displayedCardId = protocol.CARD_ID_ANY
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{displayedCardId})
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast card pickup notification: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{pickedUpCard.CardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send card pickup notification to %s: %s", player.Name, err)
+				}
+
+			case protocol.CMD_CARD_SHUFFLE_HAND:
+				playerLog(player).Debugf("Shuffle the hand of player %d", player.Id)
+				newHand := game.ShuffleHand(player)
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast hand shuffle notification: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, newHand)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send hand shuffle notification to %s: %s", player.Name, err)
+				}
+
+			case protocol.CMD_CARD_ARRANGE_HAND:
+				var cmd protocol.CardArrangeHandCommand
+				err := protocol.SerialiseCardArrangeHandCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Arrange the cards in their hand: %v", cmd.NewOrder)
+
+				newHand, ok := game.ArrangeHand(player, cmd.NewOrder)
+				if !ok {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				// Nobody else can see the order of the cards in somebody's hand, so only the player themselves is told
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, newHand)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send hand arrangement notification to %s: %s", player.Name, err)
+				}
+
+			case protocol.CMD_CARD_FETCH:
+				var cmd protocol.CardFetchCommand
+				err := protocol.SerialiseCardFetchCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Fetch card %d from deck %d", cmd.CardId, cmd.DeckId)
+
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				fetchedCardId := game.Fetch(cmd.DeckId, cmd.CardId)
+				if fetchedCardId == protocol.CARD_ID_NONE {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					break
+				}
+				game.mutex.Lock()
+				player.Draw(fetchedCardId)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, []uint16{fetchedCardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send card fetch notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast card fetch notification: %s", err)
+				}
+
+			case protocol.CMD_DECK_PEEK:
+				var cmd protocol.DeckPeekCommand
+				err := protocol.SerialiseDeckPeekCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Peek at the top %d cards of deck %d. Public? %t", cmd.Count, cmd.DeckId, cmd.Public)
+
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				cardList := make([]uint16, 0, cmd.Count)
+				game.mutex.Lock()
+				deckSlice := game.Decks[cmd.DeckId]
+				if int(cmd.Count) <= len(deckSlice) {
+					deckSlice = deckSlice[len(deckSlice)-int(cmd.Count):]
+				}
+				for i := len(deckSlice) - 1; i >= 0; i-- {
+					cardList = append(cardList, deckSlice[i])
+				}
+				game.mutex.Unlock()
+
+				var publicCardList []uint16
+				if cmd.Public {
+					publicCardList = cardList
+				} else {
+					publicCardList = makeFilledIdSlice(len(cardList), protocol.CARD_ID_ANY)
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, cardList)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed send deck peek response notification to source player: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, publicCardList)
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed broadcast deck peek response notification: %s", err)
+				}
+
+			case protocol.CMD_DECK_PEEK_BOTTOM:
+				var cmd protocol.DeckPeekCommand
+				err := protocol.SerialiseDeckPeekCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Peek at the bottom %d cards of deck %d. Public? %t", cmd.Count, cmd.DeckId, cmd.Public)
+
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				// NOTE: The bottom of the deck is at the start of the slice, so this list is ordered from the bottom up
+				game.mutex.Lock()
+				deckSlice := game.Decks[cmd.DeckId]
+				if int(cmd.Count) <= len(deckSlice) {
+					deckSlice = deckSlice[:cmd.Count]
+				}
+				cardList := make([]uint16, len(deckSlice))
+				copy(cardList, deckSlice)
+				game.mutex.Unlock()
+
+				var publicCardList []uint16
+				if cmd.Public {
+					publicCardList = cardList
+				} else {
+					publicCardList = makeFilledIdSlice(len(cardList), protocol.CARD_ID_ANY)
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, cardList)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed send deck peek bottom response notification to source player: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, publicCardList)
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed broadcast deck peek bottom response notification: %s", err)
+				}
+
+			case protocol.CMD_DECK_SHUFFLE:
+				var cmd protocol.DeckShuffleCommand
+				err := protocol.SerialiseDeckShuffleCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Shuffle deck %d", cmd.DeckId)
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				game.ShuffleDeck(cmd.DeckId)
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, nil)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed send shuffle response notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Error while broadcasting notification of command %d: %s", cmdHeader.Id, err)
+				}
+
+			case protocol.CMD_DECK_BURN:
+				var cmd protocol.DeckBurnCommand
+				err := protocol.SerialiseDeckBurnCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Burn %d cards from deck %d. Face up? %t", cmd.Count, cmd.DeckId, cmd.FaceUp)
+
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				burnedCards := game.Draw(cmd.DeckId, int(cmd.Count))
+				game.mutex.Lock()
+				for _, cardId := range burnedCards {
+					game.AddToDiscardPile(cardId, cmd.FaceUp)
+				}
+				game.mutex.Unlock()
+
+				publicNotifyCards := burnedCards
+				if !cmd.FaceUp {
+					publicNotifyCards = makeFilledIdSlice(len(burnedCards), protocol.CARD_ID_ANY)
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, publicNotifyCards)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send burn notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast burn notification: %s", err)
+				}
+
+			case protocol.CMD_DECK_DEAL:
+				var cmd protocol.DeckDealCommand
+				err := protocol.SerialiseDeckDealCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Deal %d cards from deck %d to every player", cmd.Count, cmd.DeckId)
+
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				dealToEveryone(game, player.Id, cmd.DeckId, int(cmd.Count))
+
+			case protocol.CMD_DECK_REARRANGE:
+				var cmd protocol.DeckRearrangeCommand
+				err := protocol.SerialiseDeckRearrangeCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Rearrange the top %d cards of deck %d: %v", len(cmd.NewOrder), cmd.DeckId, cmd.NewOrder)
+
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					break
+				}
+				if !game.RearrangeDeck(cmd.DeckId, cmd.NewOrder) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, makeFilledIdSlice(len(cmd.NewOrder), protocol.CARD_ID_ANY))
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send rearrange notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast rearrange notification: %s", err)
+				}
+
+			case protocol.CMD_CARD_SWAP_HANDS:
+				var cmd protocol.CardSwapHandsCommand
+				err := protocol.SerialiseCardSwapHandsCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Swap hands with player %d", cmd.PlayerId)
+
+				if player.Id == cmd.PlayerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					break
+				}
+
+				game.mutex.Lock()
+				playerIndex := game.FindPlayer(cmd.PlayerId)
+				if playerIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					game.mutex.Unlock()
+					break
+				}
+				targetPlayer := game.Players[playerIndex]
+				player.Hand, targetPlayer.Hand = targetPlayer.Hand, player.Hand
+				player.FaceUpCards, targetPlayer.FaceUpCards = targetPlayer.FaceUpCards, player.FaceUpCards
+				sourceHand := make([]uint16, len(player.Hand))
+				copy(sourceHand, player.Hand)
+				targetHand := make([]uint16, len(targetPlayer.Hand))
+				copy(targetHand, targetPlayer.Hand)
+				game.mutex.Unlock()
+
+				// Everybody gets told the new hand sizes, but only the two players involved get to see their new cards
+				handSizes := []string{strconv.Itoa(len(sourceHand)), strconv.Itoa(len(targetHand))}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayer.Id, sourceHand)
+				notifyAction.TargetStrings = handSizes
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send swap hands notification to source player: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayer.Id, targetHand)
+				notifyAction.TargetStrings = handSizes
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send swap hands notification to target player: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayer.Id, []uint16{})
+				notifyAction.TargetStrings = handSizes
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast swap hands notification: %s", err)
+				}
+
+			case protocol.CMD_CARD_REVEAL_HAND:
+				var cmd protocol.CardRevealHandCommand
+				err := protocol.SerialiseCardRevealHandCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Reveal hand to all players. Keep it revealed? %t", cmd.KeepRevealed)
+
+				game.mutex.Lock()
+				player.HandRevealed = cmd.KeepRevealed
+				hand := make([]uint16, len(player.Hand))
+				copy(hand, player.Hand)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, hand)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send reveal hand notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast reveal hand notification: %s", err)
+				}
+
+			case protocol.CMD_CARD_SET_FACE_UP:
+				var cmd protocol.CardSetFaceUpCommand
+				err := protocol.SerialiseCardSetFaceUpCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Set card %d face-up? %t", cmd.CardId, cmd.FaceUp)
+
+				game.mutex.Lock()
+				// Look for a copy of the card that isn't already facing the requested way
+				cardIndex := -1
+				for index, handCardId := range player.Hand {
+					if game.spec.SameCard(handCardId, cmd.CardId) && (player.IsFaceUp(handCardId) != cmd.FaceUp) {
+						cardIndex = index
+						break
+					}
+				}
+				if cardIndex < 0 {
+					game.mutex.Unlock()
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					break
+				}
+				cardId := player.Hand[cardIndex]
+				player.SetFaceUp(cardId, cmd.FaceUp)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{cardId})
+				notifyAction.TargetStrings = []string{protocol.CARD_FACING_UP}
+				if !cmd.FaceUp {
+					notifyAction.TargetStrings = []string{protocol.CARD_FACING_DOWN}
+				}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send set face-up notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast set face-up notification: %s", err)
+				}
+
+			case protocol.CMD_CARD_TRADE_OFFER:
+				var cmd protocol.CardTradeOfferCommand
+				err := protocol.SerialiseCardTradeOfferCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Offer card %d to player %d in exchange for card %d", cmd.OfferedCardId, cmd.PlayerId, cmd.RequestedCardId)
+
+				if player.Id == cmd.PlayerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					break
+				}
+
+				game.mutex.Lock()
+				playerIndex := game.FindPlayer(cmd.PlayerId)
+				if playerIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					game.mutex.Unlock()
+					break
+				}
+				// NOTE: We deliberately don't check whether the target player has the requested card yet, since refusing the
+				//       offer here would tell the source player what is (or isn't) in the target player's hand.
+				targetPlayerId := game.Players[playerIndex].Id
+				offer, err := game.offerTrade(player, targetPlayerId, cmd.OfferedCardId, cmd.RequestedCardId)
+				game.mutex.Unlock()
+				if err != nil {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					break
+				}
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayerId, []uint16{offer.OfferedCardId, offer.RequestedCardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send trade offer notification to source player: %s", err)
+				}
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send trade offer notification to target player: %s", err)
+				}
+
+			case protocol.CMD_CARD_TRADE_RESPOND:
+				var cmd protocol.CardTradeRespondCommand
+				err := protocol.SerialiseCardTradeRespondCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Respond to trade offer from player %d. Accept? %t", cmd.PlayerId, cmd.Accept)
+
+				game.mutex.Lock()
+				offerIndex := game.findTradeOffer(cmd.PlayerId, player.Id)
+				if offerIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					game.mutex.Unlock()
+					break
+				}
+				offer := game.TradeOffers[offerIndex]
+				if !cmd.Accept {
+					game.removeTradeOffer(offer.SourcePlayerId, offer.TargetPlayerId)
+					game.mutex.Unlock()
+
+					notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, offer.SourcePlayerId, []uint16{offer.OfferedCardId, offer.RequestedCardId})
+					notifyAction.TargetStrings = []string{"declined"}
+					err = game.SendNotificationToSourcePlayer(notifyAction)
+					if err != nil {
+						playerLog(player).Errorf("Failed to send trade response notification to source player: %s", err)
+					}
+					err = game.SendNotificationToTargetPlayer(notifyAction)
+					if err != nil {
+						playerLog(player).Errorf("Failed to send trade response notification to target player: %s", err)
+					}
+					break
+				}
+
+				sourcePlayer, requestedCardId, err := game.acceptTrade(player, offer)
+				game.mutex.Unlock()
+				if err == ErrCardNotInHand {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					break
+				} else if err != nil {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, sourcePlayer.Id, []uint16{offer.OfferedCardId, requestedCardId})
+				notifyAction.TargetStrings = []string{"accepted"}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send trade response notification to source player: %s", err)
+				}
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send trade response notification to target player: %s", err)
+				}
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, sourcePlayer.Id, nil)
+				notifyAction.TargetStrings = []string{"accepted"}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast trade notification: %s", err)
+				}
+
+			case protocol.CMD_CARD_VIEW_HAND_REQUEST:
+				var cmd protocol.CardViewHandRequestCommand
+				err := protocol.SerialiseCardViewHandRequestCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Ask to see the hand of player %d", cmd.PlayerId)
+
+				if player.Id == cmd.PlayerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					break
+				}
+
+				game.mutex.Lock()
+				playerIndex := game.FindPlayer(cmd.PlayerId)
+				if playerIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					game.mutex.Unlock()
+					break
+				}
+				targetPlayerId := game.Players[playerIndex].Id
+				game.removeViewHandRequest(player.Id, targetPlayerId)
+				game.ViewHandRequests = append(game.ViewHandRequests, HandViewRequest{player.Id, targetPlayerId})
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayerId, nil)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send view hand request notification to source player: %s", err)
+				}
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send view hand request notification to target player: %s", err)
+				}
+
+			case protocol.CMD_CARD_VIEW_HAND_RESPOND:
+				var cmd protocol.CardViewHandRespondCommand
+				err := protocol.SerialiseCardViewHandRespondCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Respond to request from player %d to see our hand. Accept? %t", cmd.PlayerId, cmd.Accept)
+
+				game.mutex.Lock()
+				if !game.removeViewHandRequest(cmd.PlayerId, player.Id) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					game.mutex.Unlock()
+					break
+				}
+				hand := make([]uint16, len(player.Hand))
+				copy(hand, player.Hand)
+				game.mutex.Unlock()
+
+				response := "declined"
+				if cmd.Accept {
+					response = "accepted"
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, cmd.PlayerId, nil)
+				notifyAction.TargetStrings = []string{response}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send view hand response notification to source player: %s", err)
+				}
+				if cmd.Accept {
+					// Everybody else only gets told that the hand was inspected, not what was in it
+					err = game.BroadcastNotification(notifyAction)
+					if err != nil {
+						playerLog(player).Errorf("Failed to broadcast view hand response notification: %s", err)
+					}
+					notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, cmd.PlayerId, hand)
+					notifyAction.TargetStrings = []string{response}
+				}
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send view hand response notification to target player: %s", err)
+				}
+
+			case protocol.CMD_TABLE_PLAY:
+				var cmd protocol.TableCardCommand
+				err := protocol.SerialiseTableCardCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Play card %d onto the table", cmd.CardId)
+
+				game.mutex.Lock()
+				cardIndex := game.FindCard(player, cmd.CardId)
+				if cardIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				cardId := player.Hand[cardIndex]
+				player.Discard(cardIndex)
+				game.Table = append(game.Table, cardId)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{cardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send table play notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast table play notification: %s", err)
+				}
+
+			case protocol.CMD_TABLE_TAKE:
+				var cmd protocol.TableCardCommand
+				err := protocol.SerialiseTableCardCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Take card %d from the table", cmd.CardId)
+
+				game.mutex.Lock()
+				tableIndex := game.FindTableCard(cmd.CardId)
+				if tableIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				cardId := game.Table[tableIndex]
+				game.Table = append(game.Table[:tableIndex], game.Table[tableIndex+1:]...)
+				player.Draw(cardId)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{cardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send table take notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast table take notification: %s", err)
+				}
+
+			case protocol.CMD_TABLE_PUTBACK:
+				var cmd protocol.TablePutbackCommand
+				err := protocol.SerialiseTablePutbackCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Put card %d from the table back onto deck %d, %d cards from the top", cmd.CardId, cmd.DeckId, cmd.CardsFromTop)
+
+				game.mutex.Lock()
+				tableIndex := game.FindTableCard(cmd.CardId)
+				if tableIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				if game.FindDeck(cmd.DeckId) < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DECK_ID)
+					game.mutex.Unlock()
+					break
+				}
+				deck := game.Decks[cmd.DeckId]
+				if int(cmd.CardsFromTop) > len(deck) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					game.mutex.Unlock()
+					break
+				}
+				cardId := game.Table[tableIndex]
+				game.Table = append(game.Table[:tableIndex], game.Table[tableIndex+1:]...)
+				game.Decks[cmd.DeckId] = sliceInsert(deck, cardId, len(deck)-int(cmd.CardsFromTop))
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, cmd.DeckId, protocol.PLAYER_ID_NONE, []uint16{cardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send table putback notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast table putback notification: %s", err)
+				}
+
+			case protocol.CMD_TABLEAU_PLACE:
+				var cmd protocol.TableCardCommand
+				err := protocol.SerialiseTableCardCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Place card %d into tableau", cmd.CardId)
+
+				game.mutex.Lock()
+				cardIndex := game.FindCard(player, cmd.CardId)
+				if cardIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				cardId := player.Hand[cardIndex]
+				player.Discard(cardIndex)
+				player.Tableau = append(player.Tableau, cardId)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{cardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send tableau place notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast tableau place notification: %s", err)
+				}
+
+			case protocol.CMD_TABLEAU_RETRIEVE:
+				var cmd protocol.TableCardCommand
+				err := protocol.SerialiseTableCardCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Retrieve card %d from tableau", cmd.CardId)
+
+				game.mutex.Lock()
+				tableauIndex := game.FindTableauCard(player, cmd.CardId)
+				if tableauIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				cardId := player.Tableau[tableauIndex]
+				player.RemoveFromTableau(tableauIndex)
+				player.Draw(cardId)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{cardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send tableau retrieve notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast tableau retrieve notification: %s", err)
+				}
+
+			case protocol.CMD_MARKET_TAKE, protocol.CMD_MARKET_DISCARD:
+				var cmd protocol.TableCardCommand
+				err := protocol.SerialiseTableCardCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				takeCard := (cmdHeader.Id == protocol.CMD_MARKET_TAKE)
+				playerLog(player).Debugf("Remove card %d from the market. Take it into hand? %t", cmd.CardId, takeCard)
+
+				game.mutex.Lock()
+				marketIndex := game.FindMarketCard(cmd.CardId)
+				if marketIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CARD_ID)
+					game.mutex.Unlock()
+					break
+				}
+				cardId := game.Market[marketIndex]
+				game.Market = append(game.Market[:marketIndex], game.Market[marketIndex+1:]...)
+				if takeCard {
+					player.Draw(cardId)
+				} else {
+					game.AddToDiscardPile(cardId, true)
+				}
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{cardId})
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send market notification to %s: %s", player.Name, err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast market notification: %s", err)
+				}
+				game.RefillMarket(player.Id)
+
+			case protocol.CMD_COUNTER_CHANGE:
+				var cmd protocol.CounterChangeCommand
+				err := protocol.SerialiseCounterChangeCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Change counter '%s' of player %d by %d. Set? %t", cmd.CounterName, cmd.PlayerId, cmd.Value, cmd.SetValue)
+
+				if !protocol.IsValidCounterName(cmd.CounterName) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+				targetPlayerId := cmd.PlayerId
+				if targetPlayerId == protocol.PLAYER_ID_NONE {
+					targetPlayerId = player.Id
+				}
+
+				game.mutex.Lock()
+				playerIndex := game.FindPlayer(targetPlayerId)
+				if playerIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					game.mutex.Unlock()
+					break
+				}
+				targetPlayer := game.Players[playerIndex]
+				oldValue := targetPlayer.Counters[cmd.CounterName]
+				newValue := oldValue + cmd.Value
+				if cmd.SetValue {
+					newValue = cmd.Value
+				}
+				targetPlayer.Counters[cmd.CounterName] = newValue
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayer.Id, nil)
+				notifyAction.TargetStrings = []string{cmd.CounterName, strconv.FormatInt(oldValue, 10), strconv.FormatInt(newValue, 10)}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send counter change notification to source player: %s", err)
+				}
+				if targetPlayer.Id != player.Id {
+					err = game.SendNotificationToTargetPlayer(notifyAction)
+					if err != nil {
+						playerLog(player).Errorf("Failed to send counter change notification to target player: %s", err)
+					}
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast counter change notification: %s", err)
+				}
+
+			case protocol.CMD_SCORE_ADD:
+				var cmd protocol.ScoreAddCommand
+				err := protocol.SerialiseScoreAddCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Add score %d for player %d", cmd.Value, cmd.PlayerId)
+
+				game.mutex.Lock()
+				playerIndex := game.FindPlayer(cmd.PlayerId)
+				if playerIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					game.mutex.Unlock()
+					break
+				}
+				targetPlayer := game.Players[playerIndex]
+				round, total := game.addScore(targetPlayer.Name, cmd.Value)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, targetPlayer.Id, nil)
+				notifyAction.TargetStrings = []string{strconv.FormatInt(cmd.Value, 10), strconv.Itoa(round), strconv.FormatInt(total, 10)}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send score notification to source player: %s", err)
+				}
+				if targetPlayer.Id != player.Id {
+					err = game.SendNotificationToTargetPlayer(notifyAction)
+					if err != nil {
+						playerLog(player).Errorf("Failed to send score notification to target player: %s", err)
+					}
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast score notification: %s", err)
+				}
+
+			case protocol.CMD_RANDOM_ROLL:
+				var cmd protocol.RandomRollCommand
+				err := protocol.SerialiseRandomRollCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Roll %d dice with %d sides", cmd.Count, cmd.Sides)
+
+				if (cmd.Count == 0) || (cmd.Count > protocol.MaxRandomRollDiceCount) || (cmd.Sides == 0) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				rollResult := append([]uint16{cmd.Sides}, game.RollDice(int(cmd.Count), int(cmd.Sides))...)
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, rollResult)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send dice roll notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast dice roll notification: %s", err)
+				}
+
+			case protocol.CMD_RANDOM_FLIP:
+				playerLog(player).Debugf("Flip a coin")
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				notifyAction.TargetStrings = []string{game.PickRandom([]string{"Heads", "Tails"})}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send coin flip notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast coin flip notification: %s", err)
+				}
+
+			case protocol.CMD_RANDOM_PICK:
+				var cmd protocol.RandomPickCommand
+				err := protocol.SerialiseRandomPickCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Pick randomly from %d options", len(cmd.Options))
+
+				if len(cmd.Options) == 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				notifyAction.TargetStrings = append([]string{game.PickRandom(cmd.Options)}, cmd.Options...)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send random pick notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast random pick notification: %s", err)
+				}
+
+			case protocol.CMD_RANDOM_ROLL_NAMED:
+				var cmd protocol.RandomRollNamedCommand
+				err := protocol.SerialiseRandomRollNamedCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Roll %d of the dice named '%s'", cmd.Count, cmd.DiceName)
+
+				dice := game.spec.FindDice(cmd.DiceName)
+				if (dice == nil) || (cmd.Count == 0) || (cmd.Count > protocol.MaxRandomRollDiceCount) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				faces := dice.FaceNames()
+				rollResult := []string{dice.Name}
+				for i := 0; i < int(cmd.Count); i++ {
+					rollResult = append(rollResult, game.PickRandom(faces))
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				notifyAction.TargetStrings = rollResult
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send named dice roll notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast named dice roll notification: %s", err)
+				}
+
+			case protocol.CMD_POLL_START:
+				var cmd protocol.PollStartCommand
+				err := protocol.SerialisePollStartCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Start a poll '%s' with %d options", cmd.Question, len(cmd.Options))
+
+				if (len(cmd.Question) == 0) || (len(cmd.Options) < 2) || (len(cmd.Options) > MaxPollOptionCount) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				game.mutex.Lock()
+				if game.poll != nil {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					game.mutex.Unlock()
+					break
+				}
+				poll := &Poll{
+					player.Id,
+					cmd.Question,
+					cmd.Options,
+					make(map[uint64]uint16),
+				}
+				game.poll = poll
+				game.mutex.Unlock()
+
+				game.notifyPollStatus(poll, POLL_STATUS_STARTED)
+				game.schedulePollExpiry(poll)
+
+			case protocol.CMD_POLL_VOTE:
+				var cmd protocol.PollVoteCommand
+				err := protocol.SerialisePollVoteCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Vote for option %d in the current poll", cmd.Option)
+
+				game.mutex.Lock()
+				poll := game.poll
+				if (poll == nil) || (int(cmd.Option) >= len(poll.options)) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					game.mutex.Unlock()
+					break
+				}
+				poll.votes[player.Id] = cmd.Option
+				complete := game.pollComplete()
+				if complete {
+					game.poll = nil
+				}
+				game.mutex.Unlock()
+
+				// Only the fact that somebody voted is made public, the option they chose stays hidden
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send poll vote notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast poll vote notification: %s", err)
+				}
+
+				if complete {
+					game.notifyPollStatus(poll, POLL_STATUS_FINISHED)
+				}
+
+			case protocol.CMD_TURN_END:
+				playerLog(player).Debugf("End turn")
+				game.mutex.Lock()
+				// Anybody can end the turn of a player who has left, otherwise the game would be stuck
+				if (game.TurnPlayerId == protocol.PLAYER_ID_NONE) || ((game.TurnPlayerId != player.Id) && (game.FindPlayer(game.TurnPlayerId) >= 0)) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					game.mutex.Unlock()
+					break
+				}
+				nextPlayerId := game.nextTurnPlayerId()
+				game.setTurn(nextPlayerId)
+				game.mutex.Unlock()
+
+				game.notifyTurnChange(player.Id, nextPlayerId)
+
+			case protocol.CMD_TURN_TIMER:
+				var cmd protocol.TurnTimerCommand
+				err := protocol.SerialiseTurnTimerCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
+				}
+				playerLog(player).Debugf("Set the turn timer to %d seconds. Auto-advance? %t", cmd.Seconds, cmd.AutoAdvance)
+
+				if player.Id != game.OwnerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_NOT_PERMITTED)
+					break
+				}
+				if cmd.Seconds > MaxTurnTimeLimitSeconds {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				game.mutex.Lock()
+				game.turnTimeLimit = time.Duration(cmd.Seconds) * time.Second
+				game.turnAutoAdvance = cmd.AutoAdvance
+				game.setTurn(game.TurnPlayerId) // Restart the timer for the current turn with the new limit
+				game.mutex.Unlock()
+
+				autoAdvance := "manual"
+				if cmd.AutoAdvance {
+					autoAdvance = "auto"
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				notifyAction.TargetStrings = []string{TURN_TIMER_STATUS_SET, strconv.Itoa(int(cmd.Seconds)), autoAdvance}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send turn timer notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast turn timer notification: %s", err)
+				}
+
+			case protocol.CMD_GAME_START:
+				playerLog(player).Infof("Start game")
+				if player.Id != game.OwnerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_NOT_PERMITTED)
+					break
+				}
+				game.mutex.Lock()
+				if len(game.Players) < game.spec.MinPlayers {
+					game.mutex.Unlock()
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_PLAYER_COUNT)
+					break
+				}
+				alreadyStarted := game.Started
+				game.Started = true
+				if !alreadyStarted {
+					game.resetPlayerCounters()
+					game.setTurn(player.Id)
+				}
+				game.mutex.Unlock()
+				if alreadyStarted {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send game start notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast game start notification: %s", err)
+				}
+				runGameSetup(game, player)
+				game.RefillMarket(player.Id)
+
+			case protocol.CMD_GAME_RESET:
+				playerLog(player).Infof("Reset game")
+				if player.Id != game.OwnerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_NOT_PERMITTED)
+					break
+				}
+
+				game.mutex.Lock()
+				game.ResetCards()
+				game.resetPlayerCounters()
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send game reset notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast game reset notification: %s", err)
+				}
+				dealRoles(game, player.Id)
+				game.RefillMarket(player.Id)
+
+			case protocol.CMD_GAME_REVEAL_ROLES:
+				playerLog(player).Infof("Reveal roles")
+				if player.Id != game.OwnerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_NOT_PERMITTED)
+					break
+				}
+
+				game.mutex.Lock()
+				roleCardIds := make([]uint16, 0, len(game.Roles))
+				playerNames := make([]string, 0, len(game.Roles))
+				for _, rolePlayer := range game.Players {
+					if roleCardId, hasRole := game.Roles[rolePlayer.Id]; hasRole {
+						roleCardIds = append(roleCardIds, roleCardId)
+						playerNames = append(playerNames, rolePlayer.Name)
+					}
+				}
+				game.mutex.Unlock()
+				if len(roleCardIds) == 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
+				}
+
+				// The roles are listed in the same order as the names of the players that they belong to
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, roleCardIds)
+				notifyAction.TargetStrings = playerNames
+				err = game.SendNotificationToSourcePlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send role reveal notification to source player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to broadcast role reveal notification: %s", err)
+				}
+
+			case protocol.CMD_GAME_KICK:
+				var cmd protocol.GameKickCommand
+				err := protocol.SerialiseGameKickCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
 					return
 				}
-				fmt.Printf("Discard card %d. Face up? %t\n", cmd.cardId, cmd.faceUp)
+				playerLog(player).Infof("Kick player %d from the game. Discard their cards? %t", cmd.PlayerId, cmd.DiscardCards)
+
+				if player.Id != game.OwnerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_NOT_PERMITTED)
+					break
+				}
+				if player.Id == cmd.PlayerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
+					break
+				}
 
 				game.mutex.Lock()
-				cardIndex := game.FindCard(player, cmd.cardId)
-				if cardIndex < 0 {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_CARD_ID)
+				playerIndex := game.FindPlayer(cmd.PlayerId)
+				if playerIndex < 0 {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
 					game.mutex.Unlock()
 					break
 				}
-				cardId := player.Hand[cardIndex]
-				player.Discard(cardIndex)
+				kickedPlayer := game.Players[playerIndex]
+				game.ReclaimPlayerCards(kickedPlayer, cmd.DiscardCards)
 				game.mutex.Unlock()
 
-				displayedCardId := cardId
-				if !cmd.faceUp {
-					displayedCardId = CARD_ID_ANY
+				cardDestination := "returned"
+				if cmd.DiscardCards {
+					cardDestination = "discarded"
 				}
-				notifyAction := NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, PLAYER_ID_NONE, []uint16{displayedCardId})
-				err = game.BroadcastNotification(notifyAction)
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, kickedPlayer.Id, nil)
+				notifyAction.TargetStrings = []string{cardDestination}
+				err = game.SendNotificationToSourcePlayer(notifyAction)
 				if err != nil {
-					fmt.Printf("Failed to broadcast card discard notification: %s\n", err)
+					playerLog(player).Errorf("Failed to send kick notification to source player: %s", err)
 				}
-				notifyAction = NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, PLAYER_ID_NONE, []uint16{cardId})
-				err = game.SendNotificationToSourcePlayer(notifyAction)
+				err = game.SendNotificationToTargetPlayer(notifyAction)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send kick notification to target player: %s", err)
+				}
+				err = game.BroadcastNotification(notifyAction)
 				if err != nil {
-					fmt.Printf("Failed to send card discard notification: %s\n", err)
+					playerLog(player).Errorf("Failed to broadcast kick notification: %s", err)
 				}
+				game.RemovePlayer(kickedPlayer)
+				kickedPlayer.CurrentGame = nil
+				server.RemoveIdleBots(game)
 
-			case CMD_CARD_GIVE:
-				var cmd CardGiveCommand
-				err := SerialiseCardGiveCommand(cmdBuffer, &cmd, true)
+			case protocol.CMD_GAME_TRANSFER_OWNER:
+				var cmd protocol.GameTransferOwnerCommand
+				err := protocol.SerialiseGameTransferOwnerCommand(cmdBuffer, &cmd, true)
 				if err != nil {
-					fmt.Printf("Error: Failed to read command %d body from player '%s': %s", cmdHeader.id, playerName, err)
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
 					server.RemovePlayer(player.Id)
 					return
 				}
-				fmt.Printf("Give card %d to player %d. Visible to all players? %t\n", cmd.cardId, cmd.playerId, cmd.faceUp)
+				playerLog(player).Infof("Transfer ownership of the game to player %d", cmd.PlayerId)
 
-				if player.Id == cmd.playerId {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_PLAYER_ID)
+				if player.Id != game.OwnerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_NOT_PERMITTED)
 					break
 				}
 
 				game.mutex.Lock()
-				cardIndex := game.FindCard(player, cmd.cardId)
-				playerIndex := game.FindPlayer(cmd.playerId)
-				if cardIndex < 0 {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_CARD_ID)
-					game.mutex.Unlock()
-					break
-				}
-				if playerIndex < 0 {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_PLAYER_ID)
+				playerIndex := game.FindPlayer(cmd.PlayerId)
+				if (playerIndex < 0) || (game.Players[playerIndex].Id == player.Id) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_ID)
 					game.mutex.Unlock()
 					break
 				}
-				targetPlayer := game.Players[playerIndex]
-				targetPlayer.Hand = append(targetPlayer.Hand, player.Hand[cardIndex])
-				player.Discard(cardIndex)
+				game.OwnerId = game.Players[playerIndex].Id
+				newOwnerId := game.OwnerId
 				game.mutex.Unlock()
 
-				displayedCardId := cmd.cardId
-				if !cmd.faceUp {
-					displayedCardId = CARD_ID_ANY
-				}
-				notifyAction := NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, cmd.playerId, []uint16{cmd.cardId})
-				err = game.SendNotificationToTargetPlayer(notifyAction)
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, newOwnerId, nil)
+				err = game.SendNotificationToSourcePlayer(notifyAction)
 				if err != nil {
-					fmt.Printf("Error! Failed to send card give notification to source player: %s\n", err)
+					playerLog(player).Errorf("Failed to send ownership transfer notification to source player: %s", err)
 				}
-				err = game.SendNotificationToSourcePlayer(notifyAction)
+				err = game.SendNotificationToTargetPlayer(notifyAction)
 				if err != nil {
-					fmt.Printf("Error! Failed to send card give notification to target player: %s\n", err)
+					playerLog(player).Errorf("Failed to send ownership transfer notification to target player: %s", err)
 				}
-				notifyAction = NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, cmd.playerId, []uint16{displayedCardId})
 				err = game.BroadcastNotification(notifyAction)
 				if err != nil {
-					fmt.Printf("Failed to broadcast card give notification: %s\n", err)
+					playerLog(player).Errorf("Failed to broadcast ownership transfer notification: %s", err)
 				}
 
-			case CMD_DECK_PEEK:
-				var cmd DeckPeekCommand
-				err := SerialiseDeckPeekCommand(cmdBuffer, &cmd, true)
+			case protocol.CMD_GAME_ADD_BOT:
+				var cmd protocol.GameAddBotCommand
+				err := protocol.SerialiseGameAddBotCommand(cmdBuffer, &cmd, true)
 				if err != nil {
-					fmt.Printf("Error: Failed to read command %d body from player '%s': %s", cmdHeader.id, playerName, err)
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
 					server.RemovePlayer(player.Id)
 					return
 				}
-				fmt.Printf("Peek at the top %d cards of deck %d. Public? %t\n", cmd.count, cmd.deckId, cmd.public)
+				playerLog(player).Infof("Add a bot with strategy '%s'", cmd.Strategy)
 
-				cardList := make([]uint16, 0, cmd.count)
-				game.mutex.Lock()
-				deckSlice := game.Deck
-				if int(cmd.count) <= len(deckSlice) {
-					deckSlice = deckSlice[len(deckSlice)-int(cmd.count):]
+				if player.Id != game.OwnerId {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_NOT_PERMITTED)
+					break
 				}
-				for i := len(deckSlice) - 1; i >= 0; i-- {
-					cardList = append(cardList, deckSlice[i])
+				if !isValidBotStrategy(cmd.Strategy) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					break
 				}
-				game.mutex.Unlock()
-
-				var publicCardList []uint16
-				if cmd.public {
-					publicCardList = cardList
-				} else {
-					publicCardList = makeFilledIdSlice(len(cardList), CARD_ID_ANY)
+				serverConn, botConn := net.Pipe()
+				bot := server.AddPlayer(serverConn, game.newBotName(), true)
+				if bot == nil {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_SERVER_FULL)
+					serverConn.Close()
+					botConn.Close()
+					break
 				}
-				notifyAction := NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, PLAYER_ID_NONE, cardList)
-				err = game.SendNotificationToSourcePlayer(notifyAction)
+
+				err = game.AddPlayer(bot)
 				if err != nil {
-					fmt.Printf("ERROR: Failed send deck peek response notification to source player: %s\n", err)
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_PLAYER_COUNT)
+					server.RemovePlayer(bot.Id)
+					botConn.Close()
+					break
 				}
-				notifyAction = NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, PLAYER_ID_NONE, publicCardList)
-				err = game.BroadcastNotification(notifyAction)
+				err = notifyPlayerJoined(game, bot)
 				if err != nil {
-					fmt.Printf("ERROR: Failed broadcast deck peek response notification: %s\n", err)
+					playerLog(player).Errorf("Failed to serialise notify game join command for bot %d: %s", bot.Id, err)
+				}
+				game.RecordEvent(protocol.NewPlayerActionNotify(bot.Id, protocol.CMD_GAME_JOIN, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil))
+
+				go runServerPlayer(server, serverConn, bot)
+				go runBot(botConn, bot.Id, cmd.Strategy)
+
+			case protocol.CMD_GAME_UNDO:
+				playerLog(player).Debugf("Propose undoing the last action")
+				game.mutex.Lock()
+				if !game.proposeUndo(player.Id) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					game.mutex.Unlock()
+					break
+				}
+				proposal := game.undoProposal
+				approved := game.undoApproved()
+				applied := approved && game.applyUndo()
+				game.mutex.Unlock()
+
+				if applied {
+					game.notifyUndoApplied(player.Id)
+				} else if approved {
+					game.notifyUndoStatus(player.Id, UNDO_STATUS_CANCELLED)
+				} else {
+					game.notifyUndoStatus(player.Id, UNDO_STATUS_PROPOSED)
+					game.scheduleUndoExpiry(proposal)
 				}
 
-			case CMD_DECK_SHUFFLE:
-				var cmd DeckShuffleCommand
-				err := SerialiseDeckShuffleCommand(cmdBuffer, &cmd, true)
+			case protocol.CMD_GAME_UNDO_VOTE:
+				var cmd protocol.GameUndoVoteCommand
+				err := protocol.SerialiseGameUndoVoteCommand(cmdBuffer, &cmd, true)
 				if err != nil {
-					fmt.Printf("Error: Failed to read command %d body from player '%s': %s", cmdHeader.id, playerName, err)
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
 					server.RemovePlayer(player.Id)
 					return
 				}
-				fmt.Printf("Shuffle deck %d\n", cmd.deckId)
-				game.ShuffleDeck()
-				notifyAction := NewPlayerActionNotify(player.Id, cmdHeader.id, cmd.deckId, PLAYER_ID_NONE, nil)
+				playerLog(player).Debugf("Vote on undoing the last action. Approve? %t", cmd.Approve)
+
+				game.mutex.Lock()
+				proposal := game.undoProposal
+				if proposal == nil {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					game.mutex.Unlock()
+					break
+				}
+				approved := false
+				applied := false
+				if cmd.Approve {
+					proposal.approvals[player.Id] = true
+					approved = game.undoApproved()
+					applied = approved && game.applyUndo()
+				} else {
+					game.undoProposal = nil
+				}
+				game.mutex.Unlock()
+
+				vote := "no"
+				if cmd.Approve {
+					vote = "yes"
+				}
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+				notifyAction.TargetStrings = []string{vote}
 				err = game.SendNotificationToSourcePlayer(notifyAction)
 				if err != nil {
-					fmt.Printf("ERROR: Failed send shuffle response notification to source player: %s\n", err)
+					playerLog(player).Errorf("Failed to send undo vote notification to source player: %s", err)
 				}
 				err = game.BroadcastNotification(notifyAction)
 				if err != nil {
-					fmt.Printf("Error while broadcasting notification of command %d: %s\n", cmdHeader.id, err)
+					playerLog(player).Errorf("Failed to broadcast undo vote notification: %s", err)
+				}
+
+				if !cmd.Approve {
+					game.notifyUndoStatus(proposal.proposerId, UNDO_STATUS_REJECTED)
+				} else if applied {
+					game.notifyUndoApplied(proposal.proposerId)
+				} else if approved {
+					game.notifyUndoStatus(proposal.proposerId, UNDO_STATUS_CANCELLED)
 				}
 
-			case CMD_GAME_LEAVE:
-				fmt.Println("Request to leave game")
-				notifyAction := NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, PLAYER_ID_NONE, nil)
+			case protocol.CMD_GAME_LEAVE:
+				playerLog(player).Infof("Request to leave game")
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
 				err = game.BroadcastNotification(notifyAction)
 				if err != nil {
-					fmt.Printf("Error while broadcasting notification of command %d: %s\n", cmdHeader.id, err)
+					playerLog(player).Errorf("Error while broadcasting notification of command %d: %s", cmdHeader.Id, err)
 				}
 
-				notifyAction = NewPlayerActionNotify(player.Id, cmdHeader.id, DECK_ID_NONE, player.Id, nil)
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, cmdHeader.Id, protocol.DECK_ID_NONE, player.Id, nil)
 				err = game.SendNotificationToTargetPlayer(notifyAction)
 				if err != nil {
-					fmt.Printf("Error while sending notification of command %d: %s\n", cmdHeader.id, err)
+					playerLog(player).Errorf("Error while sending notification of command %d: %s", cmdHeader.Id, err)
 				}
 				game.RemovePlayer(player)
+				game.handOverOwnership(player.Id)
 				player.CurrentGame = nil
+				server.RemoveIdleBots(game)
 
-			case CMD_DISCONNECT:
-				fmt.Printf("Request to disconnect")
+			case protocol.CMD_DISCONNECT:
+				playerLog(player).Infof("Request to disconnect")
 				game.RemovePlayer(player)
+				game.handOverOwnership(player.Id)
 				player.CurrentGame = nil
+				server.RemoveIdleBots(game)
 				wantsToCloseConnection = true
 
-				notifyAction := NewPlayerActionNotify(player.Id, CMD_GAME_LEAVE, DECK_ID_NONE, PLAYER_ID_NONE, nil)
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, protocol.CMD_GAME_LEAVE, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
 				err = game.BroadcastNotification(notifyAction)
 				if err != nil {
-					fmt.Printf("Error while broadcasting notification of command %d: %s\n", cmdHeader.id, err)
+					playerLog(player).Errorf("Error while broadcasting notification of command %d: %s", cmdHeader.Id, err)
 				}
 
 			default:
-				fmt.Printf("Received unexpected command %d from %s, disconnecting...\n", cmdHeader.id, player.Name)
-				sendInputError(player, cmdHeader.id, ERROR_INVALID_CMD_ID)
+				playerLog(player).Warnf("Received unexpected command %d from %s, disconnecting...", cmdHeader.Id, player.Name)
+				sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CMD_ID)
 				wantsToCloseConnection = true
 			}
 
+			if undoSnapshot != nil {
+				game.PushUndoSnapshot(undoSnapshot)
+				undoSnapshot = nil
+			}
+			game.notifyTopCardChange(player.Id, topCardBefore)
+
 		} else {
-			switch cmdHeader.id {
-			case CMD_KEEPALIVE:
-				fmt.Printf("Keep-alive\n")
+			switch cmdHeader.Id {
+			case protocol.CMD_KEEPALIVE:
+				playerLog(player).Debugf("Keep-alive")
 				// Do nothing
 
-			case CMD_GAME_CREATE:
-				var cmd GameCreateCommand
-				err := SerialiseGameCreateCommand(cmdBuffer, &cmd, true)
+			case protocol.CMD_GAME_CREATE:
+				var cmd protocol.GameCreateCommand
+				err := protocol.SerialiseGameCreateCommand(cmdBuffer, &cmd, true)
 				if err != nil {
-					fmt.Printf("Error: Failed to read command %d body from player '%s': %s", cmdHeader.id, playerName, err)
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
 					server.RemovePlayer(player.Id)
 					return
 				}
-				fmt.Printf("Create game\n")
+				playerLog(player).Infof("Create game '%s'. Public? %t. Seeded? %t", cmd.Name, cmd.Public, cmd.Seeded)
+				if server.IsDraining() {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_SERVER_SHUTTING_DOWN)
+					playerLog(player).Warnf("Refused to create a game because the server is shutting down")
+					break
+				}
 
-				spec, err := NewSpec(cmd.specData)
-				if err != nil {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_DATA)
-					fmt.Printf("Invalid specification provided for the 'create' command: " + err.Error())
+				spec, err := NewSpec(cmd.SpecData)
+				if err == ErrUnsupportedSpecVersion {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_UNSUPPORTED_SPEC_VERSION)
+					playerLog(player).Warnf("Specification provided for the 'create' command has an unsupported format version")
+					break
+				} else if err != nil {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_DATA)
+					playerLog(player).Debugf("Invalid specification provided for the 'create' command: %s", err)
 					break
 				}
 
 				playerNameIsValidForGame := true
-				lowerPlayerName := strings.ToLower(player.Name)
+				lowerPlayerName := foldForMatching(player.Name, false)
 				for _, cardName := range spec.Deck {
-					if lowerPlayerName == strings.ToLower(cardName) {
+					if lowerPlayerName == foldForMatching(cardName, false) {
 						playerNameIsValidForGame = false
 						break
 					}
 				}
 				if !playerNameIsValidForGame {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_PLAYER_NAME)
-					fmt.Printf("Player '%s' could not create a game because they share a name with a card\n", player.Name)
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_NAME)
+					playerLog(player).Warnf("Player '%s' could not create a game because they share a name with a card", player.Name)
 					break
 				}
-				newGame := server.CreateNewGame(spec, player)
-
-				respCmd := NotifyGameJoinedCommand{
-					newGame.Id,
-					cmd.specData,
-					[]uint64{player.Id},
-					[]string{player.Name},
-					[][]uint16{nil},
-					uint16(len(player.CurrentGame.Deck)),
+				// Games are always given a seed (and it is logged) so that any game can be replayed when investigating a bug
+				seed := cmd.Seed
+				if !cmd.Seeded {
+					seed = time.Now().UTC().UnixNano()
+				}
+				newGame := server.CreateNewGame(spec, cmd.Name, cmd.Public, seed, player)
+				if newGame == nil {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_SERVER_FULL)
+					playerLog(player).Warnf("Refused to create a game because the server already has the maximum of %d games", server.config.MaxGames)
+					break
+				}
+				newGame.RecordEvent(protocol.NewPlayerActionNotify(player.Id, protocol.CMD_GAME_CREATE, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil))
+
+				newGame.mutex.Lock()
+				deckSizes := newGame.deckSizes()
+				newGame.mutex.Unlock()
+				respCmd := protocol.NotifyGameJoinedCommand{
+					GameId:      newGame.Id,
+					JoinCode:    newGame.JoinCode,
+					OwnerId:     newGame.OwnerId,
+					SpecData:    cmd.SpecData,
+					SpecHash:    newGame.specHash,
+					PlayerIds:   []uint64{player.Id},
+					PlayerNames: []string{player.Name},
+					PlayerHands: [][]uint16{nil},
+					DeckSizes:   deckSizes,
+				}
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_NOTIFY_GAME_JOINED, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseNotifyGameJoinedCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				if err != nil {
+					playerLog(player).Errorf("Failed to serialise game_create command %+v: %s", respCmd, err)
+					break
 				}
-				respBuffer, respHeaderLen := WriteCommandHeader(CMD_NOTIFY_GAME_JOINED, uint16(respCmd.CommandLength()))
-				err = SerialiseNotifyGameJoinedCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				err = player.SendCommandBuffer(respBuffer)
+				if err != nil {
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
+				}
+
+			case protocol.CMD_INFO_GAMES:
+				playerLog(player).Debugf("List public games")
+				respCmd := server.PublicGames()
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_INFO_GAMES_RESPONSE, uint16(respCmd.CommandLength()))
+				err = protocol.SerialiseGameInfoResponseCommand(respBuffer[respHeaderLen:], &respCmd, false)
 				if err != nil {
-					fmt.Printf("Error! Failed to serialise game_create command %+v: %s\n", respCmd, err)
+					playerLog(player).Errorf("Failed to serialise game info command %+v: %s", respCmd, err)
 					break
 				}
 				err = player.SendCommandBuffer(respBuffer)
 				if err != nil {
-					fmt.Printf("Error! Failed to send response for command %d to player %d: %s\n", cmdHeader.id, player.Id, err)
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
 
-			case CMD_GAME_JOIN:
-				var cmd GameJoinCommand
-				err := SerialiseGameJoinCommand(cmdBuffer, &cmd, true)
+			case protocol.CMD_GAME_JOIN:
+				var cmd protocol.GameJoinCommand
+				err := protocol.SerialiseGameJoinCommand(cmdBuffer, &cmd, true)
 				if err != nil {
-					fmt.Printf("Error: Failed to read command %d body from player '%s': %s", cmdHeader.id, playerName, err)
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
 					server.RemovePlayer(player.Id)
 					return
 				}
-				fmt.Printf("Join game %d\n", cmd.gameId)
-
-				gameToJoin := server.FindGame(cmd.gameId)
+				var gameToJoin *GameState
+				if len(cmd.JoinCode) > 0 {
+					playerLog(player).Infof("Join game with code '%s'", cmd.JoinCode)
+					gameToJoin = server.FindGameByJoinCode(cmd.JoinCode)
+				} else {
+					playerLog(player).Infof("Join game %d", cmd.GameId)
+					gameToJoin = server.FindGame(cmd.GameId)
+				}
 				if gameToJoin == nil {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_GAME_ID)
-					fmt.Printf("Player '%s' failed not join unrecognised game ID %d\n", player.Name, cmd.gameId)
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_GAME_ID)
+					playerLog(player).Warnf("Player '%s' failed not join unrecognised game ID %d (code '%s')", player.Name, cmd.GameId, cmd.JoinCode)
 					break
 				}
-
-				lowerPlayerName := strings.ToLower(player.Name)
-				nameAlreadyExists := false
-				gameToJoin.mutex.Lock()
-				for _, existingPlayer := range gameToJoin.Players {
-					if lowerPlayerName == strings.ToLower(existingPlayer.Name) {
-						nameAlreadyExists = true
-						break
-					}
-				}
-				gameToJoin.mutex.Unlock()
-				if !nameAlreadyExists {
-					for _, cardName := range gameToJoin.spec.Deck {
-						if lowerPlayerName == strings.ToLower(cardName) {
-							nameAlreadyExists = true
-							break
-						}
-					}
-				}
-				if nameAlreadyExists {
-					sendInputError(player, cmdHeader.id, ERROR_INVALID_PLAYER_NAME)
+				cmd.GameId = gameToJoin.Id
+				err = gameToJoin.AddPlayer(player)
+				if err == ErrTooManyPlayers {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_PLAYER_COUNT)
+					playerLog(player).Warnf("Player '%s' could not join game %d because it already has the maximum number of players", player.Name, cmd.GameId)
+					break
+				} else if err == ErrGameFull {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_SERVER_FULL)
+					playerLog(player).Warnf("Player '%s' could not join game %d because it already has as many players as the server allows", player.Name, cmd.GameId)
+					break
+				} else if err == ErrPlayerNameTaken {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_NAME)
+					playerLog(player).Warnf("Player '%s' could not join game %d because another player or a card already has that name", player.Name, cmd.GameId)
+					break
 				}
 
 				// Notify other players
-				notify := NotifyGameJoinedCommand{
-					gameToJoin.Id,
-					nil,
-					[]uint64{player.Id},
-					[]string{player.Name},
-					nil,
-					0,
-				}
-				notifyBuffer, notifyHeaderLen := WriteCommandHeader(CMD_NOTIFY_GAME_JOINED, uint16(notify.CommandLength()))
-				err = SerialiseNotifyGameJoinedCommand(notifyBuffer[notifyHeaderLen:], &notify, false)
+				err = notifyPlayerJoined(gameToJoin, player)
 				if err != nil {
-					fmt.Printf("Error! Failed to serialise notify game join command %+v: %s\n", notify, err)
-					break
+					playerLog(player).Errorf("Failed to serialise notify game join command for player %d: %s", player.Id, err)
 				}
-				gameToJoin.mutex.Lock()
-				for _, player := range gameToJoin.Players {
-					err = player.SendCommandBuffer(notifyBuffer)
-					if err != nil {
-						fmt.Printf("Failed to send new-player notification to %s @ %s: %s\n", player.Name, player.Conn.RemoteAddr().String(), err)
-					}
-				}
-				gameToJoin.mutex.Unlock()
-
-				// NOTE: Its important that we add the new player *after* sending the broadcast so that they do not get
-				//	 	 the "you are already in the game" version of the new-player notification
-				gameToJoin.AddPlayer(player)
+				gameToJoin.RecordEvent(protocol.NewPlayerActionNotify(player.Id, protocol.CMD_GAME_JOIN, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil))
 
 				// Send all the relevant information to the new player
-				specData, err := SerialiseSpecFromSpec(player.CurrentGame.spec)
+				err = sendGameJoinedState(player)
 				if err != nil {
-					fmt.Printf("Failed to re-serialise game spec for sending to a new player\n")
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 					server.RemovePlayer(player.Id)
 				}
 
-				gameToJoin.mutex.Lock()
-				allPlayerIds := make([]uint64, len(player.CurrentGame.Players))
-				allPlayerNames := make([]string, len(player.CurrentGame.Players))
-				allPlayerHands := make([][]uint16, len(player.CurrentGame.Players))
-				for index, tempPlayer := range player.CurrentGame.Players {
-					allPlayerIds[index] = tempPlayer.Id
-					allPlayerNames[index] = tempPlayer.Name
-					allPlayerHands[index] = tempPlayer.Hand
+			case protocol.CMD_SET_NAME:
+				var cmd protocol.SetNameCommand
+				err := protocol.SerialiseSetNameCommand(cmdBuffer, &cmd, true)
+				if err != nil {
+					playerLog(player).Errorf("Failed to read command %d body from player '%s': %s", cmdHeader.Id, playerName, err)
+					server.RemovePlayer(player.Id)
+					return
 				}
-				gameToJoin.mutex.Unlock()
-				respCmd := NotifyGameJoinedCommand{
-					player.CurrentGame.Id,
-					specData,
-					allPlayerIds,
-					allPlayerNames,
-					allPlayerHands,
-					uint16(len(player.CurrentGame.Deck)),
+				if !protocol.IsValidPlayerName(cmd.Name) {
+					sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_PLAYER_NAME)
+					playerLog(player).Warnf("Player '%s' attempted to change to invalid name '%s'", player.Name, cmd.Name)
+					break
 				}
-				respBuffer, respHeaderLen := WriteCommandHeader(CMD_NOTIFY_GAME_JOINED, uint16(respCmd.CommandLength()))
-				err = SerialiseNotifyGameJoinedCommand(respBuffer[respHeaderLen:], &respCmd, false)
+				playerLog(player).Infof("Player '%s' changed their name to '%s'", player.Name, cmd.Name)
+				player.Name = cmd.Name
+				playerName = cmd.Name
+
+				respBuffer, respHeaderLen := protocol.WriteCommandHeader(protocol.CMD_SET_NAME_RESPONSE, uint16(cmd.CommandLength()))
+				err = protocol.SerialiseSetNameCommand(respBuffer[respHeaderLen:], &cmd, false)
 				if err != nil {
-					fmt.Printf("Error! Failed to serialise notify game join command %+v: %s\n", notify, err)
+					playerLog(player).Errorf("Failed to serialise set name response %+v: %s", cmd, err)
 					break
 				}
 				err = player.SendCommandBuffer(respBuffer)
 				if err != nil {
-					fmt.Printf("Error! Failed to send response for command %d to player %d: %s\n", cmdHeader.id, player.Id, err)
-					server.RemovePlayer(player.Id)
+					playerLog(player).Errorf("Failed to send response for command %d to player %d: %s", cmdHeader.Id, player.Id, err)
 				}
 
-			case CMD_DISCONNECT:
-				fmt.Printf("Request to disconnect from lobby\n")
+			case protocol.CMD_DISCONNECT:
+				playerLog(player).Infof("Request to disconnect from lobby")
 				wantsToCloseConnection = true
 
 			default:
-				fmt.Printf("Unsupported command ID %d\n", cmdHeader.id)
-				sendInputError(player, cmdHeader.id, ERROR_INVALID_CMD_ID)
+				playerLog(player).Warnf("Unsupported command ID %d", cmdHeader.Id)
+				sendInputError(player, cmdHeader.Id, protocol.ERROR_INVALID_CMD_ID)
 				wantsToCloseConnection = true
 			}
 		}
 
 		if wantsToCloseConnection {
+			connectionClosedByPlayer = true
 			break
 		}
 	}
 
 	if player != nil {
+		if !connectionClosedByPlayer && player.InGame() && !player.IsBot {
+			playerLog(player).Infof("Lost the connection to %s, waiting for them to reconnect", playerName)
+			server.SuspendPlayer(player)
+			return
+		}
 		server.RemovePlayer(player.Id)
 	} else {
 		playerConn.Close()
 	}
-	fmt.Println(playerName + " has disconnected")
+	playerLog(player).Infof("%s has disconnected", playerName)
 }
 
-func runServer() {
-	fmt.Println("Launching server...")
-	stdinChan := make(chan string)
+// Tells every other player in the given game that the new player has joined it. The new player is sent the whole game
+// instead, see sendGameJoinedState.
+func notifyPlayerJoined(game *GameState, newPlayer *PlayerState) error {
+	notify := protocol.NotifyGameJoinedCommand{
+		GameId:      game.Id,
+		JoinCode:    "",
+		OwnerId:     protocol.PLAYER_ID_NONE,
+		SpecData:    nil,
+		SpecHash:    nil,
+		PlayerIds:   []uint64{newPlayer.Id},
+		PlayerNames: []string{newPlayer.Name},
+		PlayerHands: make([][]uint16, 1), // Every per-player list needs an entry for each player, even an empty hand
+		DeckSizes:   nil,
+	}
+	notifyBuffer, notifyHeaderLen := protocol.WriteCommandHeader(protocol.CMD_NOTIFY_GAME_JOINED, uint16(notify.CommandLength()))
+	err := protocol.SerialiseNotifyGameJoinedCommand(notifyBuffer[notifyHeaderLen:], &notify, false)
+	if err != nil {
+		return err
+	}
+	game.mutex.Lock()
+	players := make([]*PlayerState, len(game.Players))
+	copy(players, game.Players)
+	game.mutex.Unlock()
+
+	for _, player := range players {
+		if player == newPlayer {
+			continue
+		}
+		err = player.SendCommandBuffer(notifyBuffer)
+		if err != nil {
+			gameLog(game).Errorf("Failed to send new-player notification to %s @ %s: %s", player.Name, player.RemoteAddr().String(), err)
+		}
+	}
+	return nil
+}
+
+// Sends the given player everything they need to set up their local view of the game that they are in
+func sendGameJoinedState(player *PlayerState) error {
+	game := player.CurrentGame
+	specData, err := SerialiseSpecFromSpec(game.spec)
+	if err != nil {
+		return err
+	}
+
+	game.mutex.Lock()
+	allPlayerIds := make([]uint64, len(game.Players))
+	allPlayerNames := make([]string, len(game.Players))
+	allPlayerHands := make([][]uint16, len(game.Players))
+	for index, tempPlayer := range game.Players {
+		allPlayerIds[index] = tempPlayer.Id
+		allPlayerNames[index] = tempPlayer.Name
+		allPlayerHands[index] = tempPlayer.Hand
+	}
+	respCmd := protocol.NotifyGameJoinedCommand{
+		GameId:      game.Id,
+		JoinCode:    game.JoinCode,
+		OwnerId:     game.OwnerId,
+		SpecData:    specData,
+		SpecHash:    game.specHash,
+		PlayerIds:   allPlayerIds,
+		PlayerNames: allPlayerNames,
+		PlayerHands: allPlayerHands,
+		DeckSizes:   game.deckSizes(),
+	}
+	game.mutex.Unlock()
+
+	respBuffer, err := protocol.BuildCommand(protocol.CMD_NOTIFY_GAME_JOINED, &respCmd)
+	if err != nil {
+		return err
+	}
+	return player.SendCommandBuffer(respBuffer)
+}
+
+// Returns a random ID that is not used by any other game. Game IDs are random so that nobody can join a stranger's game
+// just by guessing the ID of the next (or previous) game to be created.
+// NOTE: This expects the server mutex to already be held by the caller
+func (ss *ServerState) newGameId() uint64 {
+	for {
+		gameId := newUnguessableId()
+		if gameId == 0 {
+			continue
+		}
+		idTaken := false
+		for _, game := range ss.allGames {
+			if game.Id == gameId {
+				idTaken = true
+				break
+			}
+		}
+		if !idTaken {
+			return gameId
+		}
+	}
+}
+
+// Returns a random ID (e.g a resume token) that is infeasible for anybody else to guess
+func newUnguessableId() uint64 {
+	var tokenBytes [8]byte
+	_, err := cryptorand.Read(tokenBytes[:])
+	if err != nil {
+		// Fall back to the time, which is easier to guess but still better than not being able to create IDs at all
+		return uint64(time.Now().UnixNano())
+	}
+	return binary.LittleEndian.Uint64(tokenBytes[:])
+}
 
-	serverState := ServerState{
+func newServerState(config ServerConfig, identityKey []byte) ServerState {
+	return ServerState{
 		&sync.Mutex{},
 		uint64(1),
-		uint64(1),
 		make([]*PlayerState, 0),
 		make([]*GameState, 0),
+		false,
+		config,
+		make(map[string]int),
+		time.Now(),
+		0,
+		identityKey,
+		nil,
+		nil,
+	}
+}
+
+func runServer(config ServerConfig) {
+	serverLog.Infof("Launching server...")
+	stdinChan := make(chan string)
+
+	identityKey, err := loadOrCreateIdentityKey(config.IdentityKeyFile)
+	if err != nil {
+		serverLog.Errorf("Failed to load identity key from '%s': %s", config.IdentityKeyFile, err)
+		return
+	}
+
+	serverState := newServerState(config, identityKey)
+	if config.RelayEnabled {
+		serverState.relays = NewRelayRegistry()
+	}
+	if len(config.IRCURL) > 0 {
+		serverState.ircBridge, err = NewIRCBridge(config.IRCURL, config.IRCNick, config.IRCCommands, &serverState)
+		if err != nil {
+			serverLog.Errorf("Invalid IRC URL '%s': %s", config.IRCURL, err)
+			return
+		}
 	}
 
-	listener, err := net.Listen("tcp", ":43831")
+	listeners, err := listenOnAddresses(config.ListenAddresses)
 	if err != nil {
-		fmt.Println("Error: Failed to listen on TCP socket. ", err)
+		serverLog.Errorf("Failed to listen on TCP socket: %s", err)
 		return
 	}
 
-	go serverListenForConnections(listener, &serverState)
+	listenAddresses := make([]string, 0, len(listeners))
+	for _, listener := range listeners {
+		listenAddresses = append(listenAddresses, listener.Addr().String())
+		go serverListenForConnections(listener, &serverState)
+	}
+	serverLog.Infof("Serving on %s", strings.Join(listenAddresses, ", "))
 	go serverReadConsoleInput(stdinChan)
+	if len(config.HealthAddress) > 0 {
+		go serveHealthChecks(config.HealthAddress, &serverState)
+	}
+	if len(config.WebAddress) > 0 {
+		go serveWebClient(config.WebAddress, &serverState)
+	}
+	if serverState.ircBridge != nil {
+		go serverState.ircBridge.Run()
+	}
+	if len(config.RelayVia) > 0 {
+		go runRelayClient(&serverState, config.RelayVia)
+	}
+
+	shutdown := func() {
+		serverLog.Infof("Shutting down the server...")
+		for _, listener := range listeners {
+			listener.Close()
+		}
+		serverLog.Infof("Listeners stopped")
+		serverState.Shutdown()
+		serverLog.Infof("Game stopped")
+	}
+
+	// While draining, the server checks every second whether it can shut down yet and warns players as the deadline nears
+	var drainDeadline time.Time
+	nextWarningIndex := 0
+	drainTicker := time.NewTicker(time.Second)
+	defer drainTicker.Stop()
+	idleTicker := time.NewTicker(IdleGameCheckInterval)
+	defer idleTicker.Stop()
 
 	for {
 		select {
+		case <-idleTicker.C:
+			if config.IdleGameTimeout > 0 {
+				serverState.ExpireIdleGames(config.IdleGameTimeout)
+			}
+
+		case <-drainTicker.C:
+			if !serverState.IsDraining() {
+				break
+			}
+			remaining := time.Until(drainDeadline)
+			activeGames := serverState.ActiveGameCount()
+			if activeGames == 0 {
+				serverLog.Infof("Every game has finished")
+				shutdown()
+				return
+			} else if remaining <= 0 {
+				serverLog.Infof("Timed out waiting for %d games to finish", activeGames)
+				shutdown()
+				return
+			}
+
+			// If several warnings are due at once then only one is sent
+			warningDue := false
+			for (nextWarningIndex < len(shutdownWarningTimes)) && (remaining <= shutdownWarningTimes[nextWarningIndex]) {
+				nextWarningIndex++
+				warningDue = true
+			}
+			if warningDue {
+				err = serverState.BroadcastMessage(fmt.Sprintf("The server will shut down in %s", remaining.Round(time.Second)))
+				if err != nil {
+					serverLog.Errorf("Failed to send shutdown warning: %s", err)
+				}
+			}
+
 		case stdinCmd := <-stdinChan:
-			if strings.Trim(stdinCmd, "\r\n\t ") == "quit" {
-				fmt.Println("Shutting down the server...")
-				listener.Close()
-				fmt.Println("Listener stopped")
-				serverState.Shutdown()
-				fmt.Println("Game stopped")
+			stdinCmd = strings.Trim(stdinCmd, "\r\n\t ")
+			if strings.HasPrefix(stdinCmd, "say ") {
+				message := strings.TrimSpace(strings.TrimPrefix(stdinCmd, "say "))
+				if len(message) > protocol.MaxServerMessageLength {
+					serverLog.Warnf("Server messages can be at most %d bytes long", protocol.MaxServerMessageLength)
+					continue
+				}
+				serverLog.Infof("Send message to every player: %s", message)
+				err = serverState.BroadcastMessage(message)
+				if err != nil {
+					serverLog.Errorf("Failed to send server message: %s", err)
+				}
+			} else if stdinCmd == "quit now" {
+				shutdown()
 				return
+			} else if (stdinCmd == "quit") || strings.HasPrefix(stdinCmd, "quit ") {
+				// "quit n" waits at most n minutes for games to finish before shutting down
+				timeout := DefaultShutdownDrainTimeout
+				if stdinCmd != "quit" {
+					minutes, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(stdinCmd, "quit ")))
+					if (err != nil) || (minutes <= 0) {
+						serverLog.Warnf("Usage: 'quit' or 'quit n' to wait at most n minutes for games to finish, or 'quit now'")
+						continue
+					}
+					timeout = time.Duration(minutes) * time.Minute
+				}
+				if serverState.IsDraining() {
+					serverLog.Warnf("The server is already shutting down")
+					continue
+				}
+
+				serverLog.Infof("Stop creating new games and shut down in at most %s", timeout)
+				serverState.StartDraining()
+				drainDeadline = time.Now().Add(timeout)
+				for (nextWarningIndex < len(shutdownWarningTimes)) && (timeout <= shutdownWarningTimes[nextWarningIndex]) {
+					nextWarningIndex++
+				}
+				err = serverState.BroadcastMessage(fmt.Sprintf("The server will shut down in %s, or once every game has finished. No new games can be created until then", timeout))
+				if err != nil {
+					serverLog.Errorf("Failed to send shutdown warning: %s", err)
+				}
 			}
 		}
 	}
 }
 
-func sendInputError(player *PlayerState, inputCmdId byte, cmdErr byte) {
-	err := sendInputErrorTo(player.Conn, inputCmdId, cmdErr)
-	if err != nil {
-		fmt.Printf("ERROR: Failed to send input error notification to %s/%s: %s\n", player.Name, player.Conn.RemoteAddr().String(), err)
+// Deals count cards from the given deck to every player in the game
+func dealToEveryone(game *GameState, sourcePlayerId uint64, deckId uint16, count int) {
+	dealtCards := game.Deal(deckId, count)
+	countStr := strconv.Itoa(count)
+
+	// Each player only gets told about the cards that they received, and the event log just records the deal
+	for playerId, cardIds := range dealtCards {
+		notifyAction := protocol.NewPlayerActionNotify(sourcePlayerId, protocol.CMD_DECK_DEAL, deckId, protocol.PLAYER_ID_NONE, cardIds)
+		notifyAction.TargetStrings = []string{countStr}
+		err := game.SendNotificationToPlayer(notifyAction, playerId)
+		if err != nil {
+			gameLog(game).Errorf("Failed to send deal notification to player %d: %s", playerId, err)
+		}
 	}
+	notifyAction := protocol.NewPlayerActionNotify(sourcePlayerId, protocol.CMD_DECK_DEAL, deckId, protocol.PLAYER_ID_NONE, nil)
+	notifyAction.TargetStrings = []string{countStr}
+	game.RecordEvent(notifyAction)
 }
 
-func sendInputErrorTo(conn net.Conn, inputCmdId byte, cmdErr byte) error {
-	errCmd := NotifyInputErrorCommand{
-		inputCmdId,
-		cmdErr,
+// Runs the setup steps from the game's specification and then deals each player their starting hand (if the spec gives
+// one), sending the same notifications to players that they would have received if the steps had been performed
+// manually by the player that started the game.
+func runGameSetup(game *GameState, startingPlayer *PlayerState) {
+	for _, step := range game.spec.setupSteps {
+		gameLog(game).Infof("Run setup step %+v", step)
+		switch step.Action {
+		case SETUP_SHUFFLE:
+			game.mutex.Lock()
+			game.ShuffleDeck(0)
+			game.mutex.Unlock()
+			notifyAction := protocol.NewPlayerActionNotify(startingPlayer.Id, protocol.CMD_DECK_SHUFFLE, 0, protocol.PLAYER_ID_NONE, nil)
+			game.SendNotificationToSourcePlayer(notifyAction)
+			game.BroadcastNotification(notifyAction)
+
+		case SETUP_BURN:
+			burnedCards := game.Draw(0, step.Count)
+			game.mutex.Lock()
+			for _, cardId := range burnedCards {
+				game.AddToDiscardPile(cardId, false)
+			}
+			game.mutex.Unlock()
+			notifyAction := protocol.NewPlayerActionNotify(startingPlayer.Id, protocol.CMD_DECK_BURN, 0, protocol.PLAYER_ID_NONE, makeFilledIdSlice(len(burnedCards), protocol.CARD_ID_ANY))
+			game.SendNotificationToSourcePlayer(notifyAction)
+			game.BroadcastNotification(notifyAction)
+
+		case SETUP_DEAL:
+			game.mutex.Lock()
+			players := make([]*PlayerState, len(game.Players))
+			copy(players, game.Players)
+			game.mutex.Unlock()
+
+			for _, player := range players {
+				newCards := game.Draw(0, step.Count)
+				game.mutex.Lock()
+				for _, newCard := range newCards {
+					player.Draw(newCard)
+				}
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, protocol.CMD_CARD_DRAW, 0, protocol.PLAYER_ID_NONE, makeFilledIdSlice(len(newCards), protocol.CARD_ID_ANY))
+				game.BroadcastNotification(notifyAction)
+				notifyAction = protocol.NewPlayerActionNotify(player.Id, protocol.CMD_CARD_DRAW, 0, player.Id, newCards)
+				game.SendNotificationToTargetPlayer(notifyAction)
+			}
+
+		case SETUP_GIVE_EACH:
+			game.mutex.Lock()
+			players := make([]*PlayerState, len(game.Players))
+			copy(players, game.Players)
+			game.mutex.Unlock()
+
+			for _, player := range players {
+				deckId := game.spec.CardDeck(step.CardId)
+				fetchedCardId := game.Fetch(deckId, step.CardId)
+				if fetchedCardId == protocol.CARD_ID_NONE {
+					gameLog(game).Errorf("Failed to run setup step %+v for player %d, there are no matching cards left in the deck", step, player.Id)
+					break
+				}
+				game.mutex.Lock()
+				player.Draw(fetchedCardId)
+				game.mutex.Unlock()
+
+				notifyAction := protocol.NewPlayerActionNotify(player.Id, protocol.CMD_CARD_FETCH, deckId, protocol.PLAYER_ID_NONE, []uint16{fetchedCardId})
+				game.SendNotificationToSourcePlayer(notifyAction)
+				game.BroadcastNotification(notifyAction)
+			}
+		}
 	}
-	errBuffer, errHeaderLen := WriteCommandHeader(CMD_NOTIFY_INPUT_ERROR, uint16(NotifyInputErrorCommandLength))
-	err := SerialiseNotifyInputErrorCommand(errBuffer[errHeaderLen:], &errCmd, false)
-	if err != nil {
-		return err
+
+	game.mutex.Lock()
+	handSize := game.spec.StartingHandSizeFor(len(game.Players))
+	game.mutex.Unlock()
+	if handSize > 0 {
+		gameLog(game).Infof("Deal a starting hand of %d cards to each player", handSize)
+		dealToEveryone(game, startingPlayer.Id, 0, handSize)
+	}
+	dealRoles(game, startingPlayer.Id)
+}
+
+// Deals each player a secret role from the spec's roles (if it has any). Each player is only told their own role, and
+// the event log just records that roles were dealt.
+func dealRoles(game *GameState, sourcePlayerId uint64) {
+	if len(game.spec.Roles) == 0 {
+		return
+	}
+	gameLog(game).Infof("Deal roles to each player")
+	roles := game.DealRoles()
+	for playerId, roleCardId := range roles {
+		notifyAction := protocol.NewPlayerActionNotify(sourcePlayerId, protocol.CMD_GAME_DEAL_ROLES, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, []uint16{roleCardId})
+		err := game.SendNotificationToPlayer(notifyAction, playerId)
+		if err != nil {
+			gameLog(game).Errorf("Failed to send role notification to player %d: %s", playerId, err)
+		}
 	}
+	notifyAction := protocol.NewPlayerActionNotify(sourcePlayerId, protocol.CMD_GAME_DEAL_ROLES, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+	game.RecordEvent(notifyAction)
+}
 
-	err = SendCommandBufferTo(conn, errBuffer)
+func sendInputError(player *PlayerState, inputCmdId byte, cmdErr byte) {
+	errBuffer := inputErrorBuffer(inputCmdId, cmdErr)
+	err := player.SendCommandBuffer(errBuffer)
 	if err != nil {
-		return err
+		playerLog(player).Errorf("Failed to send input error notification to %s/%s: %s", player.Name, player.RemoteAddr().String(), err)
 	}
-	return nil
+}
+
+// Sends an input error directly to a connection that does not have a player yet (e.g because its handshake failed)
+func sendInputErrorTo(conn net.Conn, inputCmdId byte, cmdErr byte) error {
+	errBuffer := inputErrorBuffer(inputCmdId, cmdErr)
+	return protocol.SendCommandBufferTo(conn, errBuffer)
+}
+
+func inputErrorBuffer(inputCmdId byte, cmdErr byte) []byte {
+	errCmd := protocol.NotifyInputErrorCommand{
+		CmdId:   inputCmdId,
+		ErrorId: cmdErr,
+	}
+	errBuffer, errHeaderLen := protocol.WriteCommandHeader(protocol.CMD_NOTIFY_INPUT_ERROR, uint16(protocol.NotifyInputErrorCommandLength))
+	protocol.SerialiseNotifyInputErrorCommand(errBuffer[errHeaderLen:], &errCmd, false)
+	return errBuffer
 }
 
 func sliceInsert(slice []uint16, val uint16, index int) []uint16 {
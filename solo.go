@@ -0,0 +1,29 @@
+package main
+
+import (
+	"io/ioutil"
+	"net"
+
+	"github.com/jacquesh/netdeck/client"
+)
+
+// The name that the player is given in solo mode if they don't choose one with --name
+const DefaultSoloPlayerName = "Player"
+
+// Starts a server inside the client for the player to play alone on (e.g to try out a spec file or learn the commands
+// without a connection to the internet), and returns a session that is connected to it. The server doesn't listen for
+// connections from anywhere else, and its log is discarded so that it doesn't get mixed up with the client's output.
+func startSoloSession() (*client.Session, error) {
+	identityKey, err := newIdentityKey()
+	if err != nil {
+		return nil, err
+	}
+	setServerLogWriter(ioutil.Discard)
+
+	// None of the timeouts or limits that protect a public server from its players are needed with only one player
+	server := newServerState(ServerConfig{}, identityKey)
+
+	serverConn, clientConn := net.Pipe()
+	go runServerPlayer(&server, serverConn, nil)
+	return client.NewSession(clientConn), nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// Words that have a special meaning when given as an argument to a client command, so a card or deck with one of these
+// names could not be referred to by name
+var reservedArgumentWords = []string{
+	"anycard", "allcards", "anyplayer", "allplayers",
+	"faceup", "facedown", "up", "down", "random", "rand", "bottom", "public", "except", "keep", "accept", "decline",
+}
+
+func runSpecValidate(specFilePath string) {
+	spec, err := LoadSpecFromFile(specFilePath)
+	if err != nil {
+		fmt.Printf("'%s' is not a valid game specification: %s\n", specFilePath, err)
+		return
+	}
+	fmt.Printf("'%s' is a valid game specification with %d cards in %d decks and %d setup steps\n",
+		specFilePath, len(spec.Deck), len(spec.DeckNames), len(spec.Setup))
+
+	for deckId, deckName := range spec.DeckNames {
+		deckCards := spec.DeckCards(uint16(deckId))
+		cardCount := 0
+		for _, card := range deckCards {
+			cardCount += card.Count
+		}
+		fmt.Printf("\nDeck '%s' (%d cards):\n", deckName, cardCount)
+		for _, card := range deckCards {
+			fmt.Printf("  %3dx %s\n", card.Count, card.Name)
+		}
+	}
+	if len(spec.Roles) > 0 {
+		fmt.Printf("\nRoles:\n")
+		for _, card := range spec.Roles {
+			fmt.Printf("  %3dx %s\n", card.Count, card.Name)
+		}
+	}
+
+	warnings := specWarnings(spec)
+	if len(warnings) > 0 {
+		fmt.Printf("\nWarnings:\n")
+		for _, warning := range warnings {
+			fmt.Printf("  - %s\n", warning)
+		}
+	}
+}
+
+// Returns a description of everything in the given spec that is allowed but is probably a mistake
+func specWarnings(spec *GameSpecification) []string {
+	result := make([]string, 0)
+	deckNamesByCard := make(map[string][]string)
+	for deckId, deckName := range spec.DeckNames {
+		deckCards := spec.DeckCards(uint16(deckId))
+		if len(deckCards) == 0 {
+			result = append(result, fmt.Sprintf("Deck '%s' is empty", deckName))
+		}
+		for _, card := range deckCards {
+			foldedName := foldForMatching(card.Name, false)
+			deckNamesByCard[foldedName] = append(deckNamesByCard[foldedName], deckName)
+			if stringInSlice(foldedName, reservedArgumentWords) {
+				result = append(result, fmt.Sprintf("Card '%s' has the same name as the '%s' command argument, so it cannot be referred to by name", card.Name, foldedName))
+			}
+			if spec.FindDeckByName(card.Name) != protocol.DECK_ID_NONE {
+				result = append(result, fmt.Sprintf("Card '%s' has the same name as a deck, so it cannot be referred to by name", card.Name))
+			}
+		}
+		if stringInSlice(foldForMatching(deckName, false), reservedArgumentWords) {
+			result = append(result, fmt.Sprintf("Deck '%s' has the same name as a command argument, so it cannot be referred to by name", deckName))
+		}
+	}
+
+	for deckId := range spec.DeckNames {
+		for _, card := range spec.DeckCards(uint16(deckId)) {
+			foldedName := foldForMatching(card.Name, false)
+			cardDeckNames, listed := deckNamesByCard[foldedName]
+			if listed && (len(cardDeckNames) > 1) {
+				result = append(result, fmt.Sprintf("Card '%s' is listed %d times (in decks: %s), use a count instead or give each card a different name",
+					card.Name, len(cardDeckNames), strings.Join(cardDeckNames, ", ")))
+			}
+			// Only report each duplicated name once
+			delete(deckNamesByCard, foldedName)
+		}
+	}
+
+	roleCount := 0
+	for _, card := range spec.Roles {
+		roleCount += card.Count
+		// Role cards come after every deck card, so this only finds a deck card if one has the same name
+		if spec.CardDeck(spec.FindCardByName(card.Name)) != protocol.DECK_ID_NONE {
+			result = append(result, fmt.Sprintf("Role '%s' has the same name as a card in a deck, so it cannot be referred to by name", card.Name))
+		}
+	}
+	if (roleCount > 0) && (spec.MaxPlayers > roleCount) {
+		result = append(result, fmt.Sprintf("There are only %d roles but up to %d players, so some players will not be dealt a role", roleCount, spec.MaxPlayers))
+	}
+	return result
+}
+
+func runSpecList() {
+	specFileNames, err := ListLocalSpecFiles()
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		return
+	}
+
+	if len(specFileNames) == 0 {
+		fmt.Println("There are no game specification files in the current directory")
+	} else {
+		fmt.Println("Game specifications in the current directory:")
+		for _, filename := range specFileNames {
+			specName := strings.TrimSuffix(filename, filepath.Ext(filename))
+			_, err := LoadSpecFromFile(filename)
+			if err != nil {
+				fmt.Printf("  - %s  <-- INVALID: %s\n", specName, err)
+			} else {
+				fmt.Printf("  - %s\n", specName)
+			}
+		}
+	}
+
+	fmt.Println("Built-in game specifications:")
+	fmt.Println("  - default: A standard 52-card deck")
+	for _, builtin := range builtinSpecs {
+		fmt.Printf("  - %s: %s\n", builtin.Name, builtin.Description)
+	}
+}
+
+func runSpecConvert(inputPath string, outputPath string) {
+	spec, err := LoadSpecFromFile(inputPath)
+	if err != nil {
+		fmt.Printf("'%s' is not a valid game specification: %s\n", inputPath, err)
+		return
+	}
+
+	if !IsSpecFileName(outputPath) {
+		fmt.Printf("Unsupported output format '%s', the output file must have a .yml, .yaml or .json extension\n", filepath.Ext(outputPath))
+		return
+	}
+
+	var specData []byte
+	if IsJSONSpecFileName(outputPath) {
+		specData, err = MarshalSpecJSON(spec)
+	} else {
+		specData, err = MarshalSpec(spec)
+	}
+	if err != nil {
+		fmt.Printf("Failed to convert specification '%s': %s\n", inputPath, err)
+		return
+	}
+
+	err = ioutil.WriteFile(outputPath, specData, 0644)
+	if err != nil {
+		fmt.Printf("Failed to write specification to '%s': %s\n", outputPath, err)
+		return
+	}
+	fmt.Printf("Wrote specification from '%s' to '%s'\n", inputPath, outputPath)
+}
@@ -0,0 +1,6 @@
+package main
+
+import "syscall"
+
+const ioctlGetTermios = syscall.TCGETS
+const ioctlSetTermios = syscall.TCSETS
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+package main
+
+import "errors"
+
+var ErrRawTerminalUnsupported = errors.New("Line editing is not supported on this platform")
+
+func enableRawTerminal(fd uintptr) (func(), error) {
+	return nil, ErrRawTerminalUnsupported
+}
+
+// Colours are only used on platforms where the output can be checked for being a terminal
+func isTerminal(fd uintptr) bool {
+	return false
+}
@@ -0,0 +1,39 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// Turns off line buffering and echoing on the given terminal so that the line editor sees every key as it is pressed,
+// and returns a function that puts the terminal back the way it was. Fails if the file is not a terminal.
+func enableRawTerminal(fd uintptr) (func(), error) {
+	var original syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&original)))
+	if errno != 0 {
+		return nil, errno
+	}
+
+	raw := original
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&raw)))
+	if errno != 0 {
+		return nil, errno
+	}
+
+	restore := func() {
+		syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlSetTermios, uintptr(unsafe.Pointer(&original)))
+	}
+	return restore, nil
+}
+
+// Returns true if the given file is a terminal
+func isTerminal(fd uintptr) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, ioctlGetTermios, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
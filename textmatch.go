@@ -0,0 +1,28 @@
+package main
+
+import (
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+var caseFolder = cases.Fold()
+
+// Converts the given string into a form that can be directly compared (or prefix-matched) against other strings that
+// have been converted the same way. The result is normalised (so that precomposed and decomposed forms of the same
+// character are equal) and case-folded. If ignoreAccents is true then any combining marks are also removed so that
+// "cafe" will match "café".
+func foldForMatching(str string, ignoreAccents bool) string {
+	result := caseFolder.String(norm.NFC.String(str))
+	if ignoreAccents {
+		stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+		stripped, _, err := transform.String(stripAccents, result)
+		if err == nil {
+			result = stripped
+		}
+	}
+	return result
+}
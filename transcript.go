@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Everything that the client prints for the player is written to clientOutput rather than straight to stdout, so that
+// it can also be copied into the transcript given with --log-file
+var clientOutput io.Writer = os.Stdout
+
+// A record of everything that the client printed and every command that the player entered, with the time at which
+// each line was written, for reviewing a game afterwards or attaching to a bug report. Colours are left out.
+type Transcript struct {
+	mutex       sync.Mutex
+	file        *os.File
+	atLineStart bool // Whether the next byte written starts a new line, and so needs a timestamp
+	inEscape    bool // Whether the bytes being written are part of an ANSI escape sequence, which are left out
+}
+
+// Opens the transcript at the given path, adding to the end of it if it already exists
+func OpenTranscript(filePath string) (*Transcript, error) {
+	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	transcript := &Transcript{file: file, atLineStart: true}
+	fmt.Fprintln(transcript, "=== Started netdeck client ===")
+	return transcript, nil
+}
+
+func (transcript *Transcript) Write(data []byte) (int, error) {
+	transcript.mutex.Lock()
+	defer transcript.mutex.Unlock()
+
+	output := make([]byte, 0, len(data)+len(LogTimestampFormat)+1)
+	for _, char := range data {
+		if transcript.inEscape {
+			// Every escape sequence that the client prints is a CSI sequence (e.g "\x1b[31m"), which ends with a letter
+			if ((char >= 'a') && (char <= 'z')) || ((char >= 'A') && (char <= 'Z')) {
+				transcript.inEscape = false
+			}
+			continue
+		} else if char == '\x1b' {
+			transcript.inEscape = true
+			continue
+		}
+
+		if transcript.atLineStart {
+			output = append(output, time.Now().Format(LogTimestampFormat)...)
+			output = append(output, ' ')
+			transcript.atLineStart = false
+		}
+		output = append(output, char)
+		if char == '\n' {
+			transcript.atLineStart = true
+		}
+	}
+
+	_, err := transcript.file.Write(output)
+	if err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// Records a line that the player entered, which isn't otherwise in the transcript because it is only printed by the
+// terminal (or the line editor)
+func (transcript *Transcript) WriteInput(line string) {
+	fmt.Fprintf(transcript, "> %s\n", line)
+}
+
+func (transcript *Transcript) Close() error {
+	transcript.mutex.Lock()
+	if !transcript.atLineStart {
+		transcript.file.Write([]byte("\n"))
+		transcript.atLineStart = true
+	}
+	transcript.mutex.Unlock()
+
+	fmt.Fprintln(transcript, "=== Stopped netdeck client ===")
+	return transcript.file.Close()
+}
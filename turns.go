@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+const MaxTurnTimeLimitSeconds = 60 * 60
+
+// A warning is sent when this fraction (1/n) of the turn time limit remains
+const TurnTimerWarningFraction = 4
+
+// The strings sent as the first of the TargetStrings of a turn timer notification to say what happened to the timer.
+// They are followed by the number of seconds that the timer was set to (or that remain, for warnings).
+const (
+	TURN_TIMER_STATUS_SET     = "set"
+	TURN_TIMER_STATUS_WARNING = "warning"
+	TURN_TIMER_STATUS_EXPIRED = "expired"
+)
+
+// Returns the ID of the player whose turn is after the current player, or PLAYER_ID_NONE if there are no players.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) nextTurnPlayerId() uint64 {
+	if len(gs.Players) == 0 {
+		return protocol.PLAYER_ID_NONE
+	}
+	for index, player := range gs.Players {
+		if player.Id == gs.TurnPlayerId {
+			return gs.Players[(index+1)%len(gs.Players)].Id
+		}
+	}
+	// The current player has left the game, so just start again from the beginning
+	return gs.Players[0].Id
+}
+
+// Gives the turn to the given player and restarts the turn timer (if there is one)
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) setTurn(playerId uint64) {
+	gs.TurnPlayerId = playerId
+	gs.turnSequence++
+	if (gs.turnTimeLimit <= 0) || (playerId == protocol.PLAYER_ID_NONE) {
+		return
+	}
+
+	// Each timer remembers which turn it was started for, so that timers from earlier turns do nothing when they fire
+	sequence := gs.turnSequence
+	warningDelay := gs.turnTimeLimit - (gs.turnTimeLimit / TurnTimerWarningFraction)
+	time.AfterFunc(warningDelay, func() {
+		gs.turnTimerFired(sequence, playerId, false)
+	})
+	time.AfterFunc(gs.turnTimeLimit, func() {
+		gs.turnTimerFired(sequence, playerId, true)
+	})
+}
+
+func (gs *GameState) turnTimerFired(sequence uint64, playerId uint64, expired bool) {
+	// The turn may be passed on when the timer expires, which can be undone just like ending the turn with CMD_TURN_END
+	var undoSnapshot *GameSnapshot = nil
+	if expired {
+		undoSnapshot = gs.TakeSnapshot()
+	}
+
+	gs.mutex.Lock()
+	if gs.turnSequence != sequence {
+		gs.mutex.Unlock()
+		if undoSnapshot != nil {
+			gs.DiscardUndoSnapshot(undoSnapshot)
+		}
+		return
+	}
+	status := TURN_TIMER_STATUS_WARNING
+	remaining := gs.turnTimeLimit / TurnTimerWarningFraction
+	if expired {
+		status = TURN_TIMER_STATUS_EXPIRED
+		remaining = 0
+	}
+	nextPlayerId := uint64(protocol.PLAYER_ID_NONE)
+	autoAdvance := expired && gs.turnAutoAdvance
+	if autoAdvance {
+		nextPlayerId = gs.nextTurnPlayerId()
+		gs.setTurn(nextPlayerId)
+	}
+	gs.mutex.Unlock()
+
+	notifyAction := protocol.NewPlayerActionNotify(playerId, protocol.CMD_TURN_TIMER, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+	notifyAction.TargetStrings = []string{status, strconv.Itoa(int(remaining / time.Second))}
+	err := gs.SendNotificationToSourcePlayer(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to send turn timer %s notification to player %d: %s", status, playerId, err)
+	}
+	err = gs.BroadcastNotification(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to broadcast turn timer %s notification: %s", status, err)
+	}
+
+	if autoAdvance && (nextPlayerId != protocol.PLAYER_ID_NONE) {
+		gs.notifyTurnChange(playerId, nextPlayerId)
+	}
+
+	if autoAdvance {
+		gs.PushUndoSnapshot(undoSnapshot)
+	} else if undoSnapshot != nil {
+		gs.DiscardUndoSnapshot(undoSnapshot)
+	}
+}
+
+// Tells everyone in the game that the turn has passed from one player to another
+func (gs *GameState) notifyTurnChange(fromPlayerId uint64, toPlayerId uint64) {
+	notifyAction := protocol.NewPlayerActionNotify(fromPlayerId, protocol.CMD_TURN_END, protocol.DECK_ID_NONE, toPlayerId, nil)
+	err := gs.SendNotificationToSourcePlayer(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to send turn end notification to source player: %s", err)
+	}
+	if toPlayerId != fromPlayerId {
+		err = gs.SendNotificationToTargetPlayer(notifyAction)
+		if err != nil {
+			gameLog(gs).Errorf("Failed to send turn end notification to target player: %s", err)
+		}
+	}
+	err = gs.BroadcastNotification(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to broadcast turn end notification: %s", err)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+const MaxUndoHistoryLength = 16
+const UndoProposalTimeout = 60 * time.Second
+
+// The strings sent in the TargetStrings of an undo notification to say what stage the proposal is at
+const (
+	UNDO_STATUS_PROPOSED  = "proposed"
+	UNDO_STATUS_ACCEPTED  = "accepted"
+	UNDO_STATUS_REJECTED  = "rejected"
+	UNDO_STATUS_EXPIRED   = "expired"
+	UNDO_STATUS_CANCELLED = "cancelled"
+)
+
+type PlayerSnapshot struct {
+	Id           uint64
+	Hand         []uint16
+	Tableau      []uint16
+	Counters     map[string]int64
+	HandRevealed bool
+	FaceUpCards  []uint16
+}
+
+// A copy of everything in a game that can be changed by a player action, so that the action can be undone
+type GameSnapshot struct {
+	Decks        [][]uint16
+	DiscardPile  []DiscardedCard
+	Table        []uint16
+	Market       []uint16
+	Players      []PlayerSnapshot
+	Scores       []PlayerScores
+	Started      bool
+	TurnPlayerId uint64
+	Roles        map[uint64]uint16
+
+	// The number of events that had been recorded when the snapshot was taken
+	eventCount uint64
+}
+
+type UndoProposal struct {
+	proposerId uint64
+	snapshot   *GameSnapshot
+	approvals  map[uint64]bool
+}
+
+// Returns true for every command that changes the game state in a way that the 'undo' command should be able to revert
+func isUndoableCommand(cmdId byte) bool {
+	switch cmdId {
+	case protocol.CMD_CARD_DRAW, protocol.CMD_CARD_PUTBACK, protocol.CMD_CARD_DISCARD, protocol.CMD_CARD_GIVE, protocol.CMD_CARD_PICKUP,
+		protocol.CMD_CARD_SHUFFLE_HAND, protocol.CMD_CARD_FETCH, protocol.CMD_CARD_SWAP_HANDS, protocol.CMD_CARD_REVEAL_HAND, protocol.CMD_CARD_TRADE_RESPOND,
+		protocol.CMD_CARD_SET_FACE_UP, protocol.CMD_CARD_DRAW_UNTIL_TYPE, protocol.CMD_CARD_DISCARD_TYPE,
+		protocol.CMD_DECK_SHUFFLE, protocol.CMD_DECK_BURN, protocol.CMD_DECK_REARRANGE, protocol.CMD_DECK_DEAL,
+		protocol.CMD_TABLE_PLAY, protocol.CMD_TABLE_TAKE, protocol.CMD_TABLE_PUTBACK, protocol.CMD_TABLEAU_PLACE, protocol.CMD_TABLEAU_RETRIEVE,
+		protocol.CMD_MARKET_TAKE, protocol.CMD_MARKET_DISCARD,
+		protocol.CMD_COUNTER_CHANGE, protocol.CMD_SCORE_ADD, protocol.CMD_GAME_START, protocol.CMD_GAME_RESET, protocol.CMD_TURN_END:
+		return true
+	}
+	return false
+}
+
+func copyCardIds(cardIds []uint16) []uint16 {
+	result := make([]uint16, len(cardIds))
+	copy(result, cardIds)
+	return result
+}
+
+// Takes a snapshot of the game from before an undoable command is run. No other undoable command can run in the game
+// until the snapshot is given to PushUndoSnapshot (or DiscardUndoSnapshot), so that undoing this command never also
+// undoes an action that another player took while it was running.
+func (gs *GameState) TakeSnapshot() *GameSnapshot {
+	gs.undoMutex.Lock()
+	gs.mutex.Lock()
+	defer gs.mutex.Unlock()
+
+	result := &GameSnapshot{
+		make([][]uint16, 0, len(gs.Decks)),
+		make([]DiscardedCard, len(gs.DiscardPile)),
+		copyCardIds(gs.Table),
+		copyCardIds(gs.Market),
+		make([]PlayerSnapshot, 0, len(gs.Players)),
+		make([]PlayerScores, 0, len(gs.Scores)),
+		gs.Started,
+		gs.TurnPlayerId,
+		make(map[uint64]uint16, len(gs.Roles)),
+		gs.eventCount,
+	}
+	for playerId, cardId := range gs.Roles {
+		result.Roles[playerId] = cardId
+	}
+	for _, deck := range gs.Decks {
+		result.Decks = append(result.Decks, copyCardIds(deck))
+	}
+	copy(result.DiscardPile, gs.DiscardPile)
+	for _, scores := range gs.Scores {
+		rounds := make([]int64, len(scores.Rounds))
+		copy(rounds, scores.Rounds)
+		result.Scores = append(result.Scores, PlayerScores{scores.PlayerName, rounds})
+	}
+	for _, player := range gs.Players {
+		counters := make(map[string]int64, len(player.Counters))
+		for name, value := range player.Counters {
+			counters[name] = value
+		}
+		result.Players = append(result.Players, PlayerSnapshot{
+			player.Id,
+			copyCardIds(player.Hand),
+			copyCardIds(player.Tableau),
+			counters,
+			player.HandRevealed,
+			copyCardIds(player.FaceUpCards),
+		})
+	}
+	return result
+}
+
+// Adds the given snapshot to the undo history, but only if some event has been recorded since it was taken.
+// This way commands that failed (and so didn't change anything) do not leave a useless entry in the history.
+func (gs *GameState) PushUndoSnapshot(snapshot *GameSnapshot) {
+	gs.mutex.Lock()
+	if snapshot.eventCount != gs.eventCount {
+		if len(gs.undoHistory) >= MaxUndoHistoryLength {
+			copy(gs.undoHistory, gs.undoHistory[1:])
+			gs.undoHistory = gs.undoHistory[:len(gs.undoHistory)-1]
+		}
+		gs.undoHistory = append(gs.undoHistory, snapshot)
+	}
+	gs.mutex.Unlock()
+	gs.undoMutex.Unlock()
+}
+
+// Lets other undoable commands run again without adding the given snapshot to the undo history, for commands that
+// were abandoned part way through
+func (gs *GameState) DiscardUndoSnapshot(snapshot *GameSnapshot) {
+	gs.undoMutex.Unlock()
+}
+
+// Starts a new undo proposal for the most recent action. Returns false if there is nothing to undo or if there is
+// already a proposal in progress.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) proposeUndo(proposerId uint64) bool {
+	if (gs.undoProposal != nil) || (len(gs.undoHistory) == 0) {
+		return false
+	}
+	gs.undoProposal = &UndoProposal{
+		proposerId,
+		gs.undoHistory[len(gs.undoHistory)-1],
+		map[uint64]bool{proposerId: true},
+	}
+	return true
+}
+
+// Returns true if every player currently in the game has approved the current undo proposal
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) undoApproved() bool {
+	if gs.undoProposal == nil {
+		return false
+	}
+	for _, player := range gs.Players {
+		if !gs.undoProposal.approvals[player.Id] {
+			return false
+		}
+	}
+	return true
+}
+
+// Reverts the game to the snapshot of the current undo proposal. Returns false (and leaves the game untouched) if
+// some other action has been taken since the proposal was made.
+// NOTE: This expects the game mutex to already be held by the caller
+func (gs *GameState) applyUndo() bool {
+	proposal := gs.undoProposal
+	gs.undoProposal = nil
+	if (proposal == nil) || (len(gs.undoHistory) == 0) || (gs.undoHistory[len(gs.undoHistory)-1] != proposal.snapshot) {
+		return false
+	}
+	gs.undoHistory = gs.undoHistory[:len(gs.undoHistory)-1]
+
+	snapshot := proposal.snapshot
+	gs.Decks = snapshot.Decks
+	gs.DiscardPile = snapshot.DiscardPile
+	gs.Table = snapshot.Table
+	gs.Market = snapshot.Market
+	gs.Scores = snapshot.Scores
+	gs.Started = snapshot.Started
+	gs.Roles = snapshot.Roles
+	if gs.TurnPlayerId != snapshot.TurnPlayerId {
+		gs.setTurn(snapshot.TurnPlayerId)
+	}
+	for _, player := range gs.Players {
+		for _, playerSnapshot := range snapshot.Players {
+			if playerSnapshot.Id != player.Id {
+				continue
+			}
+			player.Hand = playerSnapshot.Hand
+			player.Tableau = playerSnapshot.Tableau
+			player.Counters = playerSnapshot.Counters
+			player.HandRevealed = playerSnapshot.HandRevealed
+			player.FaceUpCards = playerSnapshot.FaceUpCards
+			break
+		}
+	}
+	return true
+}
+
+// Tells everyone in the game (including the proposer) about a change in the status of an undo proposal
+func (gs *GameState) notifyUndoStatus(proposerId uint64, status string) {
+	notifyAction := protocol.NewPlayerActionNotify(proposerId, protocol.CMD_GAME_UNDO, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+	notifyAction.TargetStrings = []string{status}
+	err := gs.SendNotificationToSourcePlayer(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to send undo %s notification to the proposing player: %s", status, err)
+	}
+	err = gs.BroadcastNotification(notifyAction)
+	if err != nil {
+		gameLog(gs).Errorf("Failed to broadcast undo %s notification: %s", status, err)
+	}
+}
+
+// Tells every player that the last action was undone. Each player is sent the contents of their hand after the undo
+// so that they can update their local view of it, and the target player is the one whose turn it now is.
+func (gs *GameState) notifyUndoApplied(proposerId uint64) {
+	gs.mutex.Lock()
+	hands := make(map[uint64][]uint16, len(gs.Players))
+	for _, player := range gs.Players {
+		hands[player.Id] = copyCardIds(player.Hand)
+	}
+	turnPlayerId := gs.TurnPlayerId
+	gs.mutex.Unlock()
+
+	for playerId, hand := range hands {
+		notifyAction := protocol.NewPlayerActionNotify(proposerId, protocol.CMD_GAME_UNDO, protocol.DECK_ID_NONE, turnPlayerId, hand)
+		notifyAction.TargetStrings = []string{UNDO_STATUS_ACCEPTED}
+		err := gs.SendNotificationToPlayer(notifyAction, playerId)
+		if err != nil {
+			gameLog(gs).Errorf("Failed to send undo notification to player %d: %s", playerId, err)
+		}
+	}
+
+	notifyAction := protocol.NewPlayerActionNotify(proposerId, protocol.CMD_GAME_UNDO, protocol.DECK_ID_NONE, protocol.PLAYER_ID_NONE, nil)
+	notifyAction.TargetStrings = []string{UNDO_STATUS_ACCEPTED}
+	gs.RecordEvent(notifyAction)
+}
+
+// Cancels the given proposal if it is still waiting for responses once the timeout has passed
+func (gs *GameState) scheduleUndoExpiry(proposal *UndoProposal) {
+	time.AfterFunc(UndoProposalTimeout, func() {
+		gs.mutex.Lock()
+		expired := (gs.undoProposal == proposal)
+		if expired {
+			gs.undoProposal = nil
+		}
+		gs.mutex.Unlock()
+
+		if expired {
+			gs.notifyUndoStatus(proposal.proposerId, UNDO_STATUS_EXPIRED)
+		}
+	})
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+func TestUndo(t *testing.T) {
+	tests := []struct {
+		name         string
+		takeAction   bool
+		proposeTwice bool
+		approvals    []uint64
+		actAfterward bool
+		wantProposed bool
+		wantApproved bool
+		wantApplied  bool
+		wantHand     []uint16
+		wantHistory  int
+	}{
+		{"Nothing to undo", false, false, nil, false, false, false, false, []uint16{1}, 0},
+		{"Proposal already in progress", true, true, nil, false, false, false, false, []uint16{1, 2}, 1},
+		{"Not yet approved by everyone", true, false, nil, false, true, false, false, []uint16{1, 2}, 1},
+		{"Approved by everyone", true, false, []uint64{2}, false, true, true, true, []uint16{1}, 0},
+		{"Another action since the proposal", true, false, []uint64{2}, true, true, true, false, []uint16{1, 2, 3}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, players := newTestGame(t, "jokers", []uint16{1}, nil)
+			drawCard := func(cardId uint16) {
+				snapshot := game.TakeSnapshot()
+				game.mutex.Lock()
+				players[0].Hand = append(players[0].Hand, cardId)
+				game.mutex.Unlock()
+				game.RecordEvent(protocol.NewPlayerActionNotify(players[0].Id, protocol.CMD_CARD_DRAW, 0, protocol.PLAYER_ID_NONE, []uint16{cardId}))
+				game.PushUndoSnapshot(snapshot)
+			}
+			if test.takeAction {
+				drawCard(2)
+			}
+
+			game.mutex.Lock()
+			proposed := game.proposeUndo(players[0].Id)
+			if test.proposeTwice {
+				proposed = game.proposeUndo(players[1].Id)
+			}
+			game.mutex.Unlock()
+			if proposed != test.wantProposed {
+				t.Fatalf("Proposing the undo returned %t, expected %t", proposed, test.wantProposed)
+			}
+
+			if test.actAfterward {
+				drawCard(3)
+			}
+			game.mutex.Lock()
+			for _, playerId := range test.approvals {
+				game.undoProposal.approvals[playerId] = true
+			}
+			approved := game.undoApproved()
+			applied := approved && game.applyUndo()
+			game.mutex.Unlock()
+			if approved != test.wantApproved {
+				t.Errorf("Undo approval was %t, expected %t", approved, test.wantApproved)
+			}
+			if applied != test.wantApplied {
+				t.Errorf("Applying the undo returned %t, expected %t", applied, test.wantApplied)
+			}
+
+			if !reflect.DeepEqual(players[0].Hand, test.wantHand) {
+				t.Errorf("Player's hand is %v, expected %v", players[0].Hand, test.wantHand)
+			}
+			if len(game.undoHistory) != test.wantHistory {
+				t.Errorf("Undo history has %d entries, expected %d", len(game.undoHistory), test.wantHistory)
+			}
+		})
+	}
+}
+
+// Passing the turn on when the turn timer runs out must be undoable, just like ending the turn by hand
+func TestUndoTurnTimerExpiry(t *testing.T) {
+	tests := []struct {
+		name           string
+		autoAdvance    bool
+		expired        bool
+		wantTurnPlayer uint64
+		wantHistory    int
+	}{
+		{"Warning", true, false, 1, 0},
+		{"Expired without auto-advance", false, true, 1, 0},
+		{"Expired with auto-advance", true, true, 2, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			game, players := newTestGame(t, "jokers", nil, nil)
+			// Long enough that none of the timers started by the test ever fire on their own
+			game.turnTimeLimit = time.Hour
+			game.turnAutoAdvance = test.autoAdvance
+			game.mutex.Lock()
+			game.setTurn(players[0].Id)
+			sequence := game.turnSequence
+			game.mutex.Unlock()
+
+			game.turnTimerFired(sequence, players[0].Id, test.expired)
+			if game.TurnPlayerId != test.wantTurnPlayer {
+				t.Fatalf("It is player %d's turn, expected player %d", game.TurnPlayerId, test.wantTurnPlayer)
+			}
+			if len(game.undoHistory) != test.wantHistory {
+				t.Fatalf("Undo history has %d entries, expected %d", len(game.undoHistory), test.wantHistory)
+			}
+			if test.wantHistory == 0 {
+				return
+			}
+
+			game.mutex.Lock()
+			game.proposeUndo(players[0].Id)
+			game.undoProposal.approvals[players[1].Id] = true
+			applied := game.undoApproved() && game.applyUndo()
+			game.mutex.Unlock()
+			if !applied {
+				t.Fatalf("Failed to undo the turn timer expiring")
+			}
+			if game.TurnPlayerId != players[0].Id {
+				t.Errorf("It is player %d's turn after the undo, expected player %d", game.TurnPlayerId, players[0].Id)
+			}
+		})
+	}
+}
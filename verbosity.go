@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// How much the client prints about what is happening, set with --quiet/--verbose or the 'verbosity' command
+type Verbosity int
+
+const (
+	VERBOSITY_QUIET   Verbosity = iota // Leave out other players' minor actions (see isMinorAction) and keep-alive errors
+	VERBOSITY_NORMAL                   // Print everything that happens in the game
+	VERBOSITY_VERBOSE                  // Also print every command received from the server, e.g for bug reports
+)
+
+var verbosityNames = []string{"quiet", "normal", "verbose"}
+
+var ErrUnknownVerbosity = errors.New("Unknown verbosity")
+
+func ParseVerbosity(name string) (Verbosity, error) {
+	for verbosity, verbosityName := range verbosityNames {
+		if strings.EqualFold(verbosityName, name) {
+			return Verbosity(verbosity), nil
+		}
+	}
+	return VERBOSITY_NORMAL, ErrUnknownVerbosity
+}
+
+func (verbosity Verbosity) String() string {
+	if (verbosity < 0) || (int(verbosity) >= len(verbosityNames)) {
+		return "unknown"
+	}
+	return verbosityNames[verbosity]
+}
+
+var clientVerbosity = VERBOSITY_NORMAL
+
+// Where the output that the verbosity leaves out is written instead of clientOutput, so that it is still in the
+// transcript (if there is one)
+var hiddenOutput io.Writer = ioutil.Discard
+
+// Returns true if the given action is a minor one that doesn't involve the local player (e.g another player peeking at
+// the deck), which isn't printed when the verbosity is quiet. The game is still updated as usual.
+func isMinorAction(action *protocol.NotifyPlayerActionCommand, localPlayerId uint64) bool {
+	if (action.PlayerId == localPlayerId) || (action.TargetPlayerId == localPlayerId) {
+		return false
+	}
+	switch action.CmdId {
+	case protocol.CMD_CARD_DRAW, protocol.CMD_CARD_SHUFFLE_HAND, protocol.CMD_CARD_ARRANGE_HAND,
+		protocol.CMD_DECK_PEEK, protocol.CMD_DECK_PEEK_BOTTOM, protocol.CMD_DECK_SHUFFLE, protocol.CMD_DECK_REARRANGE,
+		protocol.CMD_COUNTER_CHANGE, protocol.CMD_POLL_VOTE, protocol.CMD_GAME_UNDO_VOTE:
+		return true
+	}
+	return false
+}
+
+// Shows the current verbosity, or changes it to the one given
+func runVerbosityCommand(args []string) {
+	if len(args) == 0 {
+		fmt.Fprintf(clientOutput, "The verbosity is %s. Use 'verbosity %s' to change it\n", clientVerbosity, strings.Join(verbosityNames, "|"))
+		return
+	}
+	verbosity, err := ParseVerbosity(args[0])
+	if err != nil {
+		printError("Error! Unknown verbosity '%s', it must be one of: %s\n", args[0], strings.Join(verbosityNames, ", "))
+		return
+	}
+	clientVerbosity = verbosity
+	fmt.Fprintf(clientOutput, "The verbosity is now %s\n", clientVerbosity)
+}
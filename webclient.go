@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// The names of the game's cards and decks, indexed by their IDs, which the browser client needs in order to show
+// anything useful but cannot get from the game spec itself (which is sent as compressed YAML)
+type webClientSpec struct {
+	Cards []string `json:"cards"`
+	Decks []string `json:"decks"`
+}
+
+// Serves a simple browser client that players can use to join games without installing anything:
+//   - / is the page itself, which can be linked to with a join code already filled in (e.g /?join=BRAVE-OTTER-42)
+//   - /ws accepts WebSocket connections that carry the same commands as TCP connections
+//   - /spec?game=<id> returns the names of the cards and decks in the game with the given ID
+//   - /games/<id>/public returns what anybody watching the game with the given ID could see (see PublicGameView)
+func serveWebClient(address string, server *ServerState) {
+	page := []byte(strings.Replace(webClientPage, "NETDECK_CONSTANTS", webClientConstants(), 1))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(page)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgradeToWebSocket(w, r)
+		if err != nil {
+			serverLog.Warnf("Failed to accept WebSocket connection from %s: %s", r.RemoteAddr, err)
+			return
+		}
+		serverLog.Infof("Received WebSocket connection from %s", conn.RemoteAddr().String())
+		handleNewConnection(server, conn)
+	})
+	mux.HandleFunc("/spec", func(w http.ResponseWriter, r *http.Request) {
+		// Game IDs are unguessable, so only players who have already joined the game can find out its spec this way
+		gameId, err := strconv.ParseUint(r.URL.Query().Get("game"), 10, 64)
+		var game *GameState
+		if err == nil {
+			game = server.FindGame(gameId)
+		}
+		if game == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(webClientSpec{game.spec.Deck, game.spec.DeckNames})
+		if err != nil {
+			serverLog.Errorf("Failed to write spec for game %d: %s", gameId, err)
+		}
+	})
+	mux.HandleFunc("/games/", func(w http.ResponseWriter, r *http.Request) {
+		// As with /spec, only people who have been given the ID of a game can see it
+		pathParts := strings.Split(strings.TrimPrefix(r.URL.Path, "/games/"), "/")
+		if (len(pathParts) != 2) || (pathParts[1] != "public") {
+			http.NotFound(w, r)
+			return
+		}
+		gameId, err := strconv.ParseUint(pathParts[0], 10, 64)
+		var game *GameState
+		if err == nil {
+			game = server.FindGame(gameId)
+		}
+		if game == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Access-Control-Allow-Origin", "*") // Overlays are often served from somewhere else
+		err = json.NewEncoder(w).Encode(game.PublicView())
+		if err != nil {
+			serverLog.Errorf("Failed to write the public view of game %d: %s", gameId, err)
+		}
+	})
+
+	serverLog.Infof("Serving the browser client on %s", address)
+	err := http.ListenAndServe(address, mux)
+	if err != nil {
+		serverLog.Errorf("Failed to serve the browser client on %s: %s", address, err)
+	}
+}
+
+// Returns a JSON object containing the protocol constants used by the browser client, so that they never need to be
+// kept in sync by hand
+func webClientConstants() string {
+	constants := map[string]interface{}{
+		"magicNumber": protocol.PROTOCOL_MAGIC_NUMBER,
+		"protocolId":  protocol.PROTOCOL_ID,
+		"keepAliveMs": protocol.KeepAliveInterval.Milliseconds(),
+		"cardIdAny":   protocol.CARD_ID_ANY,
+		"commands": map[string]byte{
+			"KEEPALIVE":              protocol.CMD_KEEPALIVE,
+			"HANDSHAKE":              protocol.CMD_HANDSHAKE,
+			"HANDSHAKE_RESPONSE":     protocol.CMD_HANDSHAKE_RESPONSE,
+			"SET_NAME":               protocol.CMD_SET_NAME,
+			"INFO_DECKS":             protocol.CMD_INFO_DECKS,
+			"INFO_CARDS":             protocol.CMD_INFO_CARDS,
+			"INFO_DECKS_RESPONSE":    protocol.CMD_INFO_DECKS_RESPONSE,
+			"INFO_CARDS_RESPONSE":    protocol.CMD_INFO_CARDS_RESPONSE,
+			"CARD_DRAW":              protocol.CMD_CARD_DRAW,
+			"CARD_SHOW":              protocol.CMD_CARD_SHOW,
+			"CARD_DISCARD":           protocol.CMD_CARD_DISCARD,
+			"CARD_GIVE":              protocol.CMD_CARD_GIVE,
+			"DECK_SHUFFLE":           protocol.CMD_DECK_SHUFFLE,
+			"DECK_DEAL":              protocol.CMD_DECK_DEAL,
+			"TABLE_PLAY":             protocol.CMD_TABLE_PLAY,
+			"TABLE_TAKE":             protocol.CMD_TABLE_TAKE,
+			"TURN_END":               protocol.CMD_TURN_END,
+			"GAME_JOIN":              protocol.CMD_GAME_JOIN,
+			"GAME_LEAVE":             protocol.CMD_GAME_LEAVE,
+			"GAME_START":             protocol.CMD_GAME_START,
+			"GAME_RESET":             protocol.CMD_GAME_RESET,
+			"GAME_KICK":              protocol.CMD_GAME_KICK,
+			"NOTIFY_PLAYER_ACTION":   protocol.CMD_NOTIFY_PLAYER_ACTION,
+			"NOTIFY_GAME_JOINED":     protocol.CMD_NOTIFY_GAME_JOINED,
+			"NOTIFY_SERVER_SHUTDOWN": protocol.CMD_NOTIFY_SERVER_SHUTDOWN,
+			"NOTIFY_SERVER_MESSAGE":  protocol.CMD_NOTIFY_SERVER_MESSAGE,
+			"NOTIFY_INPUT_ERROR":     protocol.CMD_NOTIFY_INPUT_ERROR,
+			"NOTIFY_BATCH":           protocol.CMD_NOTIFY_BATCH,
+		},
+		"errors": map[byte]string{
+			protocol.ERROR_INVALID_CMD_ID:           "That can't be done from here",
+			protocol.ERROR_INVALID_GAME_ID:          "There is no game with that join code",
+			protocol.ERROR_INVALID_PLAYER_ID:        "There is no such player",
+			protocol.ERROR_INVALID_DECK_ID:          "There is no such deck",
+			protocol.ERROR_INVALID_CARD_ID:          "You don't have that card",
+			protocol.ERROR_INVALID_PLAYER_NAME:      "Somebody in that game (or one of its cards) already has that name, or the name is not allowed. Please pick another name",
+			protocol.ERROR_INVALID_DATA:             "The server did not understand that",
+			protocol.ERROR_SERVER_FULL:              "The server is full, please try again later",
+			protocol.ERROR_NOT_PERMITTED:            "Only the owner of the game can do that",
+			protocol.ERROR_UNSUPPORTED_SPEC_VERSION: "The game uses a newer kind of game specification than this server supports",
+			protocol.ERROR_PLAYER_COUNT:             "That game already has as many players as it allows",
+			protocol.ERROR_SERVER_SHUTTING_DOWN:     "The server is shutting down",
+			protocol.ERROR_RATE_LIMITED:             "Too many commands were sent too quickly",
+		},
+	}
+	data, err := json.Marshal(constants)
+	if err != nil {
+		serverLog.Errorf("Failed to serialise constants for the browser client: %s", err)
+		return "{}"
+	}
+	return string(data)
+}
@@ -0,0 +1,465 @@
+package main
+
+// The page served by the browser client (see serveWebClient). NETDECK_CONSTANTS is replaced with the protocol constants
+// before it is served.
+const webClientPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>netdeck</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: 0 auto; padding: 1em; background: #f4f1ea; color: #222; }
+section { background: #fff; border-radius: 6px; padding: 0.5em 1em; margin-bottom: 1em; }
+ul { padding-left: 1.5em; }
+li { margin: 0.3em 0; }
+li button { margin-left: 0.5em; }
+#feed { height: 20em; overflow-y: auto; font-family: monospace; white-space: pre-wrap; }
+.hidden { display: none; }
+.error { color: #a00; }
+</style>
+</head>
+<body>
+<h1>netdeck</h1>
+
+<section id="lobby">
+  <form id="join-form">
+    <p><label>Your name <input id="name" maxlength="64" required></label></p>
+    <p><label>Join code <input id="code" placeholder="BRAVE-OTTER-42" required></label></p>
+    <p><button type="submit">Join game</button></p>
+  </form>
+</section>
+
+<section id="game" class="hidden">
+  <h2 id="game-title"></h2>
+  <p>Invite others with this link: <a id="game-link"></a></p>
+  <p id="players"></p>
+  <h3>Your hand</h3>
+  <ul id="hand"></ul>
+  <h3>Decks</h3>
+  <ul id="decks"></ul>
+  <p><button id="end-turn">End turn</button> <button id="leave">Leave game</button></p>
+</section>
+
+<section>
+  <h3>Events</h3>
+  <div id="feed"></div>
+</section>
+
+<script>
+"use strict";
+const NETDECK = NETDECK_CONSTANTS;
+const CMD = NETDECK.commands;
+
+let socket = null;
+let received = new Uint8Array(0);
+let keepAliveTimer = null;
+let refreshTimer = null;
+let myId = null;
+let currentName = "";
+let playerNames = new Map();
+let game = null;
+
+function $(id) {
+  return document.getElementById(id);
+}
+
+function log(text, isError) {
+  const line = document.createElement("div");
+  line.textContent = text;
+  if (isError) {
+    line.className = "error";
+  }
+  $("feed").appendChild(line);
+  $("feed").scrollTop = $("feed").scrollHeight;
+}
+
+// Commands are encoded in exactly the same way as by the terminal client, see protocol/serialisation.go
+class Writer {
+  constructor() { this.bytes = []; }
+  uint8(value) { this.bytes.push(value & 0xFF); }
+  uint16(value) { this.bytes.push(value & 0xFF, (value >> 8) & 0xFF); }
+  uint64(value) {
+    value = BigInt(value);
+    for (let i = 0; i < 8; i++) {
+      this.bytes.push(Number((value >> BigInt(8 * i)) & BigInt(0xFF)));
+    }
+  }
+  bool(value) { this.uint8(value ? 1 : 0); }
+  byteSlice(bytes) {
+    this.uint16(bytes.length);
+    for (const b of bytes) {
+      this.bytes.push(b);
+    }
+  }
+  string(value) { this.byteSlice(new TextEncoder().encode(value)); }
+}
+
+class Reader {
+  constructor(bytes) {
+    this.view = new DataView(bytes.buffer, bytes.byteOffset, bytes.byteLength);
+    this.pos = 0;
+  }
+  uint8() { return this.view.getUint8(this.pos++); }
+  uint16() { const value = this.view.getUint16(this.pos, true); this.pos += 2; return value; }
+  uint64() { const value = this.view.getBigUint64(this.pos, true); this.pos += 8; return value; }
+  bool() { return this.uint8() !== 0; }
+  byteSlice() {
+    const length = this.uint16();
+    const value = new Uint8Array(this.view.buffer, this.view.byteOffset + this.pos, length);
+    this.pos += length;
+    return value;
+  }
+  string() { return new TextDecoder().decode(this.byteSlice()); }
+  slice(readElement) {
+    const length = this.uint16();
+    const result = [];
+    for (let i = 0; i < length; i++) {
+      result.push(readElement.call(this));
+    }
+    return result;
+  }
+}
+
+function send(cmdId, writeBody) {
+  const body = new Writer();
+  if (writeBody) {
+    writeBody(body);
+  }
+  const command = new Writer();
+  command.uint8(cmdId);
+  command.uint16(body.bytes.length);
+  socket.send(new Uint8Array(command.bytes.concat(body.bytes)));
+}
+
+function connect(name, joinCode) {
+  const scheme = (location.protocol === "https:") ? "wss:" : "ws:";
+  socket = new WebSocket(scheme + "//" + location.host + "/ws");
+  socket.binaryType = "arraybuffer";
+  socket.onopen = function() {
+    currentName = name;
+    send(CMD.HANDSHAKE, function(w) {
+      w.uint16(NETDECK.magicNumber);
+      w.uint16(NETDECK.protocolId);
+      w.uint64(0);
+      w.byteSlice([]);
+      w.string(name);
+      w.uint8(0); // No compression
+    });
+    sendJoin(joinCode);
+    keepAliveTimer = setInterval(function() { send(CMD.KEEPALIVE); }, NETDECK.keepAliveMs);
+  };
+  socket.onmessage = function(event) {
+    const data = new Uint8Array(event.data);
+    const merged = new Uint8Array(received.length + data.length);
+    merged.set(received);
+    merged.set(data, received.length);
+    received = merged;
+    while (received.length >= 3) {
+      const length = received[1] | (received[2] << 8);
+      if (received.length < 3 + length) {
+        break;
+      }
+      const cmdId = received[0];
+      const body = received.slice(3, 3 + length);
+      received = received.slice(3 + length);
+      if (cmdId === CMD.NOTIFY_BATCH) {
+        // A batch is just the commands in it, one after the other
+        const unbatched = new Uint8Array(body.length + received.length);
+        unbatched.set(body);
+        unbatched.set(received, body.length);
+        received = unbatched;
+        continue;
+      }
+      handleCommand(cmdId, new Reader(body));
+    }
+  };
+  socket.onclose = function() {
+    clearInterval(keepAliveTimer);
+    socket = null;
+    received = new Uint8Array(0);
+    log("Disconnected from the server", true);
+    leaveGame();
+  };
+}
+
+function sendJoin(joinCode) {
+  send(CMD.GAME_JOIN, function(w) {
+    w.uint64(0);
+    w.string(joinCode);
+  });
+}
+
+function handleCommand(cmdId, r) {
+  switch (cmdId) {
+  case CMD.HANDSHAKE_RESPONSE:
+    myId = r.uint64();
+    break;
+
+  case CMD.NOTIFY_GAME_JOINED: {
+    const gameId = r.uint64();
+    const joinCode = r.string();
+    r.uint64();
+    const specData = r.byteSlice();
+    r.byteSlice();
+    const ids = r.slice(r.uint64);
+    const names = r.slice(r.string);
+    for (let i = 0; i < ids.length; i++) {
+      playerNames.set(ids[i], names[i]);
+    }
+    if (specData.length > 0) {
+      enterGame(gameId, joinCode);
+    } else {
+      log(names.join(", ") + " joined the game");
+    }
+    renderPlayers();
+    break;
+  }
+
+  case CMD.INFO_CARDS_RESPONSE:
+    renderHand(r.slice(r.uint16));
+    break;
+
+  case CMD.INFO_DECKS_RESPONSE: {
+    const ids = r.slice(r.uint16);
+    const counts = r.slice(r.uint16);
+    renderDecks(ids, counts);
+    break;
+  }
+
+  case CMD.NOTIFY_PLAYER_ACTION:
+    handleAction({
+      playerId: r.uint64(),
+      cmdId: r.uint8(),
+      deckId: r.uint16(),
+      targetPlayerId: r.uint64(),
+      cardIds: r.slice(r.uint16),
+      strings: r.slice(r.string),
+    });
+    break;
+
+  case CMD.NOTIFY_SERVER_MESSAGE:
+    log("Message from the server: " + r.string());
+    break;
+
+  case CMD.NOTIFY_SERVER_SHUTDOWN:
+    log("The server is shutting down", true);
+    break;
+
+  case CMD.NOTIFY_INPUT_ERROR: {
+    const failedCmdId = r.uint8();
+    const errorId = r.uint8();
+    log("Error: " + (NETDECK.errors[errorId] || ("Unknown error " + errorId)), true);
+    if ((failedCmdId === CMD.GAME_JOIN) || (failedCmdId === CMD.SET_NAME)) {
+      $("join-form").querySelector("button").disabled = false;
+    }
+    break;
+  }
+  }
+}
+
+function enterGame(gameId, joinCode) {
+  game = { id: gameId, joinCode: joinCode, cards: [], decks: [] };
+  $("lobby").classList.add("hidden");
+  $("game").classList.remove("hidden");
+  $("game-title").textContent = "Game " + joinCode;
+  const link = location.origin + location.pathname + "?join=" + encodeURIComponent(joinCode);
+  $("game-link").textContent = link;
+  $("game-link").href = link;
+  history.replaceState(null, "", link);
+  log("You joined game " + joinCode);
+
+  fetch("spec?game=" + gameId.toString())
+    .then(function(response) { return response.json(); })
+    .then(function(spec) {
+      if (game && (game.id === gameId)) {
+        game.cards = spec.cards;
+        game.decks = spec.decks;
+        requestRefresh();
+      }
+    })
+    .catch(function(err) { log("Failed to load the cards in this game: " + err, true); });
+}
+
+function leaveGame() {
+  game = null;
+  playerNames.clear();
+  $("game").classList.add("hidden");
+  $("lobby").classList.remove("hidden");
+  $("join-form").querySelector("button").disabled = false;
+}
+
+// Hand and deck sizes are asked for again after anything happens, rather than working out the effect of every action
+function requestRefresh() {
+  if ((refreshTimer !== null) || !game) {
+    return;
+  }
+  refreshTimer = setTimeout(function() {
+    refreshTimer = null;
+    if (socket && game) {
+      send(CMD.INFO_CARDS);
+      send(CMD.INFO_DECKS);
+    }
+  }, 200);
+}
+
+function playerName(id) {
+  if (id === myId) {
+    return "You";
+  }
+  return playerNames.get(id) || "Someone";
+}
+
+function cardName(cardId) {
+  if (cardId === NETDECK.cardIdAny) {
+    return "a face-down card";
+  }
+  return (game && game.cards[cardId]) || ("card " + cardId);
+}
+
+function describeAction(e) {
+  const source = playerName(e.playerId);
+  const target = playerName(e.targetPlayerId);
+  const cards = e.cardIds.map(cardName).join(", ");
+  const faceDown = e.cardIds.every(function(cardId) { return cardId === NETDECK.cardIdAny; });
+  switch (e.cmdId) {
+  case CMD.CARD_DRAW:
+    if (e.cardIds.length === 0) {
+      return source + " tried to draw a card, but there were no cards left!";
+    } else if (faceDown) {
+      return source + " drew " + e.cardIds.length + ((e.cardIds.length === 1) ? " card" : " cards");
+    }
+    return source + " drew " + cards;
+  case CMD.CARD_DISCARD:
+    return source + " discarded " + cards;
+  case CMD.CARD_SHOW:
+    return source + " showed " + cards + " to " + target;
+  case CMD.CARD_GIVE:
+    return source + " gave " + cards + " to " + target;
+  case CMD.DECK_SHUFFLE:
+    return source + " shuffled the deck";
+  case CMD.DECK_DEAL:
+    return source + " dealt cards to every player" + ((e.cardIds.length > 0) ? (". You received: " + cards) : "");
+  case CMD.TABLE_PLAY:
+    return source + " played " + cards + " onto the table";
+  case CMD.TABLE_TAKE:
+    return source + " took " + cards + " from the table";
+  case CMD.TURN_END:
+    return source + " ended their turn. It is now " + ((target === "You") ? "your" : (target + "'s")) + " turn";
+  case CMD.GAME_JOIN:
+    return source + " joined the game";
+  case CMD.GAME_LEAVE:
+    return source + " left the game";
+  case CMD.GAME_START:
+    return source + " started the game";
+  case CMD.GAME_RESET:
+    return source + " reset the game";
+  case CMD.GAME_KICK:
+    return source + " removed " + target + " from the game";
+  }
+  return source + " did something that can only be seen in the terminal client";
+}
+
+function handleAction(e) {
+  const leftGame = ((e.cmdId === CMD.GAME_LEAVE) && (e.playerId === myId)) ||
+    ((e.cmdId === CMD.GAME_KICK) && (e.targetPlayerId === myId));
+  if (leftGame) {
+    if (game) {
+      log((e.cmdId === CMD.GAME_KICK) ? "You were removed from the game" : "You left the game");
+      leaveGame();
+    }
+    return;
+  }
+
+  log(describeAction(e));
+  if (e.cmdId === CMD.GAME_LEAVE) {
+    playerNames.delete(e.playerId);
+    renderPlayers();
+  } else if (e.cmdId === CMD.GAME_KICK) {
+    playerNames.delete(e.targetPlayerId);
+    renderPlayers();
+  }
+  requestRefresh();
+}
+
+function renderPlayers() {
+  const names = [];
+  for (const [id, name] of playerNames) {
+    names.push((id === myId) ? (name + " (you)") : name);
+  }
+  $("players").textContent = "Players: " + names.join(", ");
+}
+
+function addButton(parent, label, onClick) {
+  const button = document.createElement("button");
+  button.textContent = label;
+  button.onclick = onClick;
+  parent.appendChild(button);
+}
+
+function renderHand(cardIds) {
+  const list = $("hand");
+  list.replaceChildren();
+  if (cardIds.length === 0) {
+    const item = document.createElement("li");
+    item.textContent = "(empty)";
+    list.appendChild(item);
+  }
+  for (const cardId of cardIds) {
+    const item = document.createElement("li");
+    item.textContent = cardName(cardId);
+    addButton(item, "Play", function() { send(CMD.TABLE_PLAY, function(w) { w.uint16(cardId); }); });
+    addButton(item, "Discard", function() { send(CMD.CARD_DISCARD, function(w) { w.uint16(cardId); w.bool(true); }); });
+    list.appendChild(item);
+  }
+}
+
+function renderDecks(deckIds, counts) {
+  const list = $("decks");
+  list.replaceChildren();
+  for (let i = 0; i < deckIds.length; i++) {
+    const deckId = deckIds[i];
+    const item = document.createElement("li");
+    item.textContent = (game.decks[deckId] || ("Deck " + deckId)) + ": " + counts[i] + ((counts[i] === 1) ? " card" : " cards");
+    addButton(item, "Draw", function() {
+      send(CMD.CARD_DRAW, function(w) {
+        w.uint16(deckId);
+        w.uint16(1);
+        w.bool(false);
+      });
+    });
+    list.appendChild(item);
+  }
+}
+
+$("join-form").onsubmit = function(event) {
+  event.preventDefault();
+  const name = $("name").value.trim();
+  const joinCode = $("code").value.trim();
+  if (/\s/.test(name)) {
+    log("Names cannot contain any spaces", true);
+    return;
+  }
+  localStorage.setItem("netdeck-name", name);
+  $("join-form").querySelector("button").disabled = true;
+  if (!socket) {
+    connect(name, joinCode);
+    return;
+  }
+
+  // Still connected after failing to join, e.g because somebody in the game already has this name
+  if (name !== currentName) {
+    currentName = name;
+    send(CMD.SET_NAME, function(w) { w.string(name); });
+  }
+  sendJoin(joinCode);
+};
+$("end-turn").onclick = function() { send(CMD.TURN_END); };
+$("leave").onclick = function() { send(CMD.GAME_LEAVE); };
+
+$("name").value = localStorage.getItem("netdeck-name") || "";
+$("code").value = new URLSearchParams(location.search).get("join") || "";
+</script>
+</body>
+</html>
+`
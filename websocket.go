@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jacquesh/netdeck/protocol"
+)
+
+// The GUID that a WebSocket server combines with the client's key to accept the connection (see RFC 6455)
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Browsers send each command in its own frame, so no frame needs to be longer than the longest possible command
+const MaxWebSocketFrameLength = protocol.CommandHeaderLength + math.MaxUint16
+
+const (
+	WEBSOCKET_OPCODE_CONTINUATION byte = 0x0
+	WEBSOCKET_OPCODE_TEXT         byte = 0x1
+	WEBSOCKET_OPCODE_BINARY       byte = 0x2
+	WEBSOCKET_OPCODE_CLOSE        byte = 0x8
+	WEBSOCKET_OPCODE_PING         byte = 0x9
+	WEBSOCKET_OPCODE_PONG         byte = 0xA
+)
+
+var ErrNotWebSocket = errors.New("Request is not a WebSocket upgrade")
+var ErrInvalidWebSocketFrame = errors.New("Invalid WebSocket frame")
+var ErrWebSocketFrameTooLong = errors.New("WebSocket frame is too long")
+
+// A WebSocket connection from a browser. It carries exactly the same stream of commands as a TCP connection, just split
+// into binary messages, so the server handles browsers in the same way as any other client. Closing the connection does
+// not send a WebSocket close frame first, since that could block while dropping a connection for being too slow, but
+// browsers treat this the same as any other lost connection.
+type WebSocketConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	message    []byte // The part of the most recently received message that has not been read yet
+	writeMutex *sync.Mutex
+}
+
+// Accepts the given HTTP request as a WebSocket connection. If it is not a valid WebSocket request then an error
+// response is sent and an error is returned.
+func upgradeToWebSocket(w http.ResponseWriter, r *http.Request) (*WebSocketConn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if (r.Method != http.MethodGet) || (len(key) == 0) ||
+		!headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "Expected a WebSocket connection", http.StatusBadRequest)
+		return nil, ErrNotWebSocket
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, ErrNotWebSocket
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket connections are not supported", http.StatusInternalServerError)
+		return nil, ErrNotWebSocket
+	}
+	conn, readWriter, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	accept := sha1.Sum([]byte(key + webSocketGUID))
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(accept[:]) + "\r\n\r\n"
+	_, err = conn.Write([]byte(response))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &WebSocketConn{conn, readWriter.Reader, nil, &sync.Mutex{}}, nil
+}
+
+// Returns true if any of the comma-separated values of the given header is the given token (ignoring case)
+func headerContainsToken(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, field := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (ws *WebSocketConn) Read(buffer []byte) (int, error) {
+	for len(ws.message) == 0 {
+		opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, err
+		}
+
+		switch opcode {
+		case WEBSOCKET_OPCODE_BINARY, WEBSOCKET_OPCODE_CONTINUATION:
+			// Commands are read as a stream, so it doesn't matter where one message ends and the next begins
+			ws.message = payload
+		case WEBSOCKET_OPCODE_PING:
+			err = ws.writeFrame(WEBSOCKET_OPCODE_PONG, payload)
+			if err != nil {
+				return 0, err
+			}
+		case WEBSOCKET_OPCODE_PONG:
+			// Do nothing, we never send pings
+		case WEBSOCKET_OPCODE_CLOSE:
+			ws.writeFrame(WEBSOCKET_OPCODE_CLOSE, nil)
+			return 0, io.EOF
+		default:
+			return 0, ErrInvalidWebSocketFrame
+		}
+	}
+
+	bytesRead := copy(buffer, ws.message)
+	ws.message = ws.message[bytesRead:]
+	return bytesRead, nil
+}
+
+// Sends the given data as a single binary message
+func (ws *WebSocketConn) Write(buffer []byte) (int, error) {
+	err := ws.writeFrame(WEBSOCKET_OPCODE_BINARY, buffer)
+	if err != nil {
+		return 0, err
+	}
+	return len(buffer), nil
+}
+
+func (ws *WebSocketConn) readFrame() (byte, []byte, error) {
+	var header [2]byte
+	_, err := io.ReadFull(ws.reader, header[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	opcode := header[0] & 0x0F
+	reservedBits := header[0] & 0x70
+	masked := (header[1] & 0x80) != 0
+	if (reservedBits != 0) || !masked {
+		// No extensions are ever agreed to, and browsers always mask the frames that they send
+		return 0, nil, ErrInvalidWebSocketFrame
+	}
+
+	length := uint64(header[1] & 0x7F)
+	if length == 126 {
+		var extendedLength [2]byte
+		_, err = io.ReadFull(ws.reader, extendedLength[:])
+		length = uint64(binary.BigEndian.Uint16(extendedLength[:]))
+	} else if length == 127 {
+		var extendedLength [8]byte
+		_, err = io.ReadFull(ws.reader, extendedLength[:])
+		length = binary.BigEndian.Uint64(extendedLength[:])
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if length > MaxWebSocketFrameLength {
+		return 0, nil, ErrWebSocketFrameTooLong
+	}
+
+	var mask [4]byte
+	_, err = io.ReadFull(ws.reader, mask[:])
+	if err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(ws.reader, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	for index := range payload {
+		payload[index] ^= mask[index%4]
+	}
+	return opcode, payload, nil
+}
+
+func (ws *WebSocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, 0x80|opcode) // Every frame that we send is the final frame of its message
+	if len(payload) < 126 {
+		frame = append(frame, byte(len(payload)))
+	} else if len(payload) <= math.MaxUint16 {
+		frame = append(frame, 126, 0, 0)
+		binary.BigEndian.PutUint16(frame[2:], uint16(len(payload)))
+	} else {
+		frame = append(frame, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(frame[2:], uint64(len(payload)))
+	}
+	frame = append(frame, payload...)
+
+	// Pongs are sent from the goroutine reading from the connection, while everything else is sent by its send queue
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+	_, err := ws.Conn.Write(frame)
+	return err
+}